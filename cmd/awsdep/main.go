@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"ziniki.org/deployer/coremod/pkg/coretop"
@@ -16,6 +18,12 @@ func main() {
 	}
 
 	stat := drivertop.RunDeployerWithConfig(loadMods, os.Args[1:])
+	if err := awsmod.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if stat == 0 {
+			stat = 1
+		}
+	}
 	os.Exit(stat)
 }
 
@@ -23,5 +31,32 @@ func loadMods(driver driverbottom.Driver) error {
 	if err := coretop.RegisterWithDriver(driver); err != nil {
 		return err
 	}
+	// AWSDEP_RECORD and AWSDEP_REPLAY name a cassette to record the run's AWS traffic into, or to play it back from
+	if os.Getenv("AWSDEP_RECORD") != "" && os.Getenv("AWSDEP_REPLAY") != "" {
+		return errors.New("AWSDEP_RECORD and AWSDEP_REPLAY cannot both be set")
+	}
+	if path := os.Getenv("AWSDEP_RECORD"); path != "" {
+		if err := awsmod.RecordCassette(path); err != nil {
+			return err
+		}
+	}
+	if path := os.Getenv("AWSDEP_REPLAY"); path != "" {
+		if err := awsmod.ReplayCassette(path); err != nil {
+			return err
+		}
+	}
+	// AWSDEP_EVENTS names a file to log every change made to AWS in, as JSON lines
+	if path := os.Getenv("AWSDEP_EVENTS"); path != "" {
+		if err := awsmod.LogEvents(path); err != nil {
+			return err
+		}
+	}
+	// AWSDEP_PLAN says to show what would be changed in AWS without changing it
+	if os.Getenv("AWSDEP_PLAN") != "" {
+		awsmod.PlanOnly(os.Stdout)
+	}
+	if os.Getenv("AWSDEP_FAKE") != "" {
+		awsmod.UseFakeAWS()
+	}
 	return awsmod.RegisterWithDriver(driver)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/acm"
 	"github.com/aws/aws-sdk-go-v2/service/acm/types"
@@ -14,6 +15,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	myroute53 "ziniki.org/deployer/modules/aws/internal/route53"
 )
 
@@ -28,6 +30,9 @@ type certificateCreator struct {
 
 	client  *acm.Client
 	route53 *route53.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cc *certificateCreator) Loc() *errorsink.Location {
@@ -50,15 +55,22 @@ func (cc *certificateCreator) CoinId() corebottom.CoinId {
 }
 
 func (cc *certificateCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	ae := cc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := ae.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	cc.client = awsEnv.ACMClient()
 	cc.route53 = awsEnv.Route53Client()
+	cc.ctx = awsEnv.Context()
+	cc.timeout = env.ObtainTimeout(cc.tools, cc.props)
+	cc.plan = awsEnv.Plan()
 
-	certs := cc.findCertificatesFor(cc.name)
+	certs, err := cc.findCertificatesFor(cc.ctx, cc.name)
+	if err != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed to get certificates: %v", err)
+		return
+	}
 	if len(certs) == 0 {
 		log.Printf("there were no certs found for %s\n", cc.name)
 		pres.NotFound()
@@ -80,18 +92,21 @@ func (cc *certificateCreator) DetermineDesiredState(pres corebottom.ValuePresent
 	for k, p := range cc.props {
 		v := cc.tools.Storage.Eval(p)
 		switch k.Id() {
+		case "Env", "DeployTimeout":
 		case "Domain":
 			domain, ok := v.(myroute53.ExportedDomain)
 			if !ok {
-				log.Fatalf("Domain did not point to a domain instance")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "Domain did not point to a domain instance")
+				return
 			}
 			model.hzid = domain.HostedZoneId()
+			cc.route53 = domain.Route53Client()
 		case "SubjectAlternativeNames":
 			san, ok := utils.AsStringList(v)
 			if !ok {
 				justString, ok := v.(string)
 				if !ok {
-					log.Fatalf("SubjectAlternativeNames must be a list of strings")
+					cc.tools.Reporter.ReportAtf(p.Loc(), "SubjectAlternativeNames must be a list of strings")
 					return
 				} else {
 					san = []string{justString}
@@ -101,25 +116,29 @@ func (cc *certificateCreator) DetermineDesiredState(pres corebottom.ValuePresent
 		case "ValidationMethod":
 			meth, ok := utils.AsStringer(v)
 			if !ok {
-				log.Fatalf("ValidationMethod must be a string")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "ValidationMethod must be a string")
 				return
 			}
 			model.validationMethod = meth
 		case "ValidationProvider":
 			meth, ok := utils.AsStringer(v)
 			if !ok {
-				log.Fatalf("ValidationProvider must be a string")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "ValidationProvider must be a string")
 				return
 			}
 			model.validationProvider = meth
 		default:
-			log.Fatalf("certificate coin does not support a parameter %s\n", k.Id())
+			cc.tools.Reporter.ReportAtf(k.Loc(), "certificate coin does not support a parameter %s", k.Id())
 		}
 	}
 	pres.Present(model)
 }
 
 func (cc *certificateCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CertificateManager.Certificate", cc.name, cc.coin)
+
 	found := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	desired := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_DESIRED_MODE).(*certificateModel)
@@ -128,21 +147,39 @@ func (cc *certificateCreator) UpdateReality() {
 	if vm == "" {
 		vm = types.ValidationMethodDns
 	}
+	if cc.plan != nil {
+		if found != nil {
+			cc.plan.NoChange("aws.CertificateManager.Certificate", cc.name)
+			cc.tools.Storage.Adopt(cc.coin, found)
+		} else {
+			cc.plan.Create("aws.CertificateManager.Certificate", cc.name, plan.Set("ValidationMethod", vm), plan.Set("SubjectAlternativeNames", desired.sans))
+			planned := NewCertificateModel(desired.loc, cc.coin)
+			planned.name = desired.name
+			planned.hzid = desired.hzid
+			planned.sans = desired.sans
+			planned.arn = plan.Placeholder("aws.CertificateManager.Certificate", cc.name)
+			cc.tools.Storage.Bind(cc.coin, planned)
+		}
+		return
+	}
+
 	vp := desired.validationProvider.String()
 	var dnsAsserter func(string, string, string) error
 	if vp == "" || vp == "Route53" {
 		dnsAsserter = func(zone, key, value string) error {
-			return cc.insertCheckRecords(desired, zone, key, value)
+			return cc.insertCheckRecords(ctx, desired, zone, key, value)
 		}
 	} else {
 		tmp := cc.tools.Recall.Find("dns-asserter", vp)
 		if tmp == nil {
-			panic("no dns-asserter for " + vp + " was found")
+			cc.tools.Reporter.ReportAtf(cc.loc, "no dns-asserter for %s was found", vp)
+			return
 		}
 		var ok bool
 		dnsAsserter, ok = tmp.(func(string, string, string) error)
 		if !ok {
-			panic(vp + " was not a dns-asserter")
+			cc.tools.Reporter.ReportAtf(cc.loc, "%s was not a dns-asserter", vp)
+			return
 		}
 	}
 
@@ -161,18 +198,23 @@ func (cc *certificateCreator) UpdateReality() {
 		if len(desired.sans) > 0 {
 			input.SubjectAlternativeNames = desired.sans
 		}
-		req, err := cc.client.RequestCertificate(context.TODO(), &input)
+		req, err := cc.client.RequestCertificate(ctx, &input)
 		if err != nil {
-			log.Printf("failed to request cert %s: %v\n", cc.name, err)
+			cc.tools.Reporter.ReportAtf(cc.loc, "failed to request cert %s: %v", cc.name, err)
+			return
 		}
 		log.Printf("requested cert for %s: %s\n", cc.name, *req.CertificateArn)
 		created.arn = *req.CertificateArn
 	}
 
 	// Either way, may sure it is validated ...
-	utils.ExponentialBackoff(func() bool {
-		return cc.tryToValidateCert(created.arn, dnsAsserter)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.tryToValidateCert(ctx, created.arn, dnsAsserter)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not validate certificate %s: %v", created.arn, failed)
+		return
+	}
 
 	if found == nil {
 		cc.tools.Storage.Bind(cc.coin, created)
@@ -180,6 +222,10 @@ func (cc *certificateCreator) UpdateReality() {
 }
 
 func (cc *certificateCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CertificateManager.Certificate", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
@@ -193,19 +239,26 @@ func (cc *certificateCreator) TearDown() {
 	case "preserve":
 		log.Printf("not deleting certificate %s because teardown mode is 'preserve'", found.name)
 	case "delete":
+		if cc.plan != nil {
+			cc.plan.Delete("aws.CertificateManager.Certificate", found.name)
+			return
+		}
 		log.Printf("deleting certificate for %s with teardown mode 'delete'", found.name)
-		DeleteCertificate(cc.client, found.arn)
+		err := DeleteCertificate(ctx, cc.client, found.arn)
+		if err != nil {
+			cc.tools.Reporter.ReportAtf(cc.loc, "failed to delete certificate %s: %v", found.arn, err)
+		}
 	default:
 		log.Printf("cannot handle teardown mode '%s' for bucket %s", cc.teardown.Mode(), found.name)
 	}
 }
 
-func (cc *certificateCreator) findCertificatesFor(name string) []string {
+func (cc *certificateCreator) findCertificatesFor(ctx context.Context, name string) ([]string, error) {
 	ret := make([]string, 0)
 	// TODO: need a loop on "NextToken"
-	certs, err := cc.client.ListCertificates(context.TODO(), &acm.ListCertificatesInput{})
+	certs, err := cc.client.ListCertificates(ctx, &acm.ListCertificatesInput{})
 	if err != nil {
-		log.Fatalf("Failed to get certificates: %v\n", err)
+		return nil, err
 	}
 	for _, c := range certs.CertificateSummaryList {
 		// log.Printf("have cert %s: %s\n", *c.DomainName, *c.CertificateArn)
@@ -214,13 +267,14 @@ func (cc *certificateCreator) findCertificatesFor(name string) []string {
 			ret = append(ret, *c.CertificateArn)
 		}
 	}
-	return ret
+	return ret, nil
 }
 
-func (cc *certificateCreator) DescribeCertificate(arn string) {
-	cert, err := cc.client.DescribeCertificate(context.TODO(), &acm.DescribeCertificateInput{CertificateArn: &arn})
+func (cc *certificateCreator) DescribeCertificate(ctx context.Context, arn string) {
+	cert, err := cc.client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: &arn})
 	if err != nil {
-		log.Fatalf("Failed to describe certificate %s: %v\n", arn, err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed to describe certificate %s: %v", arn, err)
+		return
 	}
 	fmt.Printf("cert arn: %s\n", arn)
 	if cert.Certificate.DomainName != nil {
@@ -237,19 +291,19 @@ func (cc *certificateCreator) DescribeCertificate(arn string) {
 	}
 }
 
-func (cc *certificateCreator) tryToValidateCert(arn string, asserter func(string, string, string) error) bool {
-	cert, err := cc.client.DescribeCertificate(context.TODO(), &acm.DescribeCertificateInput{CertificateArn: &arn})
+func (cc *certificateCreator) tryToValidateCert(ctx context.Context, arn string, asserter func(string, string, string) error) (bool, error) {
+	cert, err := cc.client.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: &arn})
 	if err != nil {
-		log.Fatalf("Failed to describe certificate %s: %v\n", arn, err)
+		return true, err
 	}
 
 	switch cert.Certificate.Status {
 	case types.CertificateStatusFailed:
 		log.Printf("failed: %s\n", cert.Certificate.FailureReason)
-		return true
+		return true, nil
 	case types.CertificateStatusIssued:
 		log.Printf("certificate issued until: %s\n", *cert.Certificate.NotAfter)
-		return true
+		return true, nil
 	case types.CertificateStatusPendingValidation:
 		// dns := make(map[string]string, 0)
 		for _, x := range cert.Certificate.DomainValidationOptions {
@@ -258,18 +312,18 @@ func (cc *certificateCreator) tryToValidateCert(arn string, asserter func(string
 				// dns[*x.ResourceRecord.Name] = *x.ResourceRecord.Value
 				err := asserter(cc.name, *x.ResourceRecord.Name, *x.ResourceRecord.Value)
 				if err != nil {
-					panic(err)
+					return true, err
 				}
 			}
 		}
-		return false
+		return false, nil
 	default:
-		panic("what is this? " + cert.Certificate.Status)
+		return true, fmt.Errorf("unexpected certificate status %s", cert.Certificate.Status)
 	}
 }
 
-func (cc *certificateCreator) insertCheckRecords(model *certificateModel, _, key, value string) error {
-	rrs, err := cc.route53.ListResourceRecordSets(context.TODO(), &route53.ListResourceRecordSetsInput{HostedZoneId: &model.hzid})
+func (cc *certificateCreator) insertCheckRecords(ctx context.Context, model *certificateModel, _, key, value string) error {
+	rrs, err := cc.route53.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{HostedZoneId: &model.hzid})
 	if err != nil {
 		return err
 	}
@@ -285,7 +339,7 @@ func (cc *certificateCreator) insertCheckRecords(model *certificateModel, _, key
 	var ttl int64 = 300
 	changes := r53types.ResourceRecordSet{Name: &key, Type: "CNAME", TTL: &ttl, ResourceRecords: []r53types.ResourceRecord{{Value: &value}}}
 	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: "CREATE", ResourceRecordSet: &changes}}}
-	_, err = cc.route53.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{HostedZoneId: &model.hzid, ChangeBatch: &cb})
+	_, err = cc.route53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &model.hzid, ChangeBatch: &cb})
 	return err
 }
 
@@ -293,11 +347,9 @@ func (cc *certificateCreator) String() string {
 	return fmt.Sprintf("CreateCert[%s]", cc.name)
 }
 
-func DeleteCertificate(client *acm.Client, arn string) {
-	_, err := client.DeleteCertificate(context.TODO(), &acm.DeleteCertificateInput{CertificateArn: &arn})
-	if err != nil {
-		panic(err)
-	}
+func DeleteCertificate(ctx context.Context, client *acm.Client, arn string) error {
+	_, err := client.DeleteCertificate(ctx, &acm.DeleteCertificateInput{CertificateArn: &arn})
+	return err
 }
 
 var _ corebottom.Ensurable = &certificateCreator{}
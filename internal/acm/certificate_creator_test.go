@@ -0,0 +1,39 @@
+package acm_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"ziniki.org/deployer/modules/aws/internal/acm"
+	"ziniki.org/deployer/modules/aws/internal/route53"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestCertificateIsValidatedThroughItsZone(t *testing.T) {
+	h := awstest.New(t)
+	zone := h.Fake.AddDomain("example.com")
+	domain := h.Coin("domain")
+	cert := h.Coin("cert")
+	props := map[string]any{"Domain": h.Value(domain), "ValidationMethod": "DNS", "ValidationProvider": "Route53"}
+
+	h.Find(&route53.DomainNameBlank{}, domain, "example.com", nil)
+	h.Ensure(&acm.CertificateBlank{}, cert, "www.example.com", h.Props(props))
+	var validation []string
+	for _, r := range h.Fake.Records(zone) {
+		if r.Type == "CNAME" && strings.HasSuffix(*r.Name, ".www.example.com.") && strings.HasSuffix(*r.ResourceRecords[0].Value, ".acm-validations.aws.") {
+			validation = append(validation, *r.Name)
+		}
+	}
+	if len(validation) != 1 {
+		t.Fatalf("expected one validation record in example.com, not %v", validation)
+	}
+
+	h.NextRun()
+	h.Calls()
+	h.Find(&route53.DomainNameBlank{}, domain, "example.com", nil)
+	h.Ensure(&acm.CertificateBlank{}, cert, "www.example.com", h.Props(props))
+	if calls := h.Calls(); slices.Contains(calls, "ACM.RequestCertificate") {
+		t.Fatalf("the issued certificate should have been kept: %v", calls)
+	}
+}
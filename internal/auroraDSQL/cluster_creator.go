@@ -2,152 +2,221 @@ package auroraDSQL
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"reflect"
+	"time"
 
 	ht "github.com/aws/aws-sdk-go-v2/aws/transport/http"
-
 	"github.com/aws/aws-sdk-go-v2/service/dsql"
 	"github.com/aws/aws-sdk-go-v2/service/dsql/types"
 	"github.com/aws/smithy-go"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
-	"ziniki.org/deployer/driver/pkg/utils"
-
-	"ziniki.org/deployer/coremod/pkg/corepkg"
+	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
-type ClusterCreator struct {
-	Client *dsql.Client
+type clusterCreator struct {
+	tools *corebottom.Tools
+
+	loc  *errorsink.Location
+	name string
+	coin corebottom.CoinId
+	// todo: allow @teardown finalSnapshot
+	// will require @finalShapshotIdentifier
+	teardown corebottom.TearDown
+	props    map[driverbottom.Identifier]driverbottom.Expr
+
+	client  *dsql.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
+}
+
+func (cc *clusterCreator) Loc() *errorsink.Location {
+	return cc.loc
 }
 
-func (cc *ClusterCreator) DetermineInitialState(creator *corepkg.CoreCreator, pres corebottom.ValuePresenter) {
-	creator.GetEnv("aws.AwsEnv", reflect.TypeFor[*env.AwsEnv](), "AuroraClient", "Client")
-	model := cc.findClusterNamed(creator.Name())
+func (cc *clusterCreator) ShortDescription() string {
+	return "aws.AuroraDSQL.Cluster[" + cc.name + "]"
+}
+
+func (cc *clusterCreator) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("aws.AuroraDSQL.Cluster[")
+	iw.AttrsWhere(cc)
+	iw.TextAttr("named", cc.name)
+	iw.EndAttrs()
+}
+
+func (cc *clusterCreator) CoinId() corebottom.CoinId {
+	return cc.coin
+}
+
+func (cc *clusterCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
+	}
+
+	cc.client = awsEnv.AuroraClient()
+	cc.ctx = awsEnv.Context()
+	cc.timeout = env.ObtainTimeout(cc.tools, cc.props)
+	cc.plan = awsEnv.Plan()
+
+	model, err := cc.findClusterNamed(cc.ctx, cc.name)
+	if err != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not list clusters looking for %s: %v", cc.name, err)
+		return
+	}
+
 	if model == nil {
-		log.Printf("cluster %s not found\n", creator.Name())
+		log.Printf("cluster %s not found\n", cc.name)
 		pres.NotFound()
 	} else {
-		log.Printf("cluster found for %s\n", creator.Name())
+		log.Printf("cluster found for %s\n", cc.name)
 		pres.Present(model)
 	}
 }
 
-func (cc *ClusterCreator) DetermineDesiredState(creator *corepkg.CoreCreator, pres corebottom.ValuePresenter) {
-	model := &clusterModel{core: creator}
-	log.Printf("have desired aurora config for %s\n", creator.Name())
-	pres.Present(model)
+func (cc *clusterCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
+	for k := range cc.props {
+		switch k.Id() {
+		case "Env", "DeployTimeout":
+		default:
+			cc.tools.Reporter.ReportAtf(k.Loc(), "aurora dsql cluster does not support a parameter %s", k.Id())
+		}
+	}
+	log.Printf("have desired aurora config for %s\n", cc.name)
+	pres.Present(NewClusterModel(cc.loc, cc.coin, cc.name))
 }
 
-func (cc *ClusterCreator) UpdateReality(creator *corepkg.CoreCreator, initial any, desired any) {
-	if initial != nil {
-		found := initial.(*clusterAWSModel)
-		log.Printf("cluster %s already existed for %s\n", found.arn, creator.Name())
-		creator.Adopt(found)
+func (cc *clusterCreator) UpdateReality() {
+	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
+
+	if tmp != nil {
+		found := tmp.(*clusterModel)
+		log.Printf("cluster %s already existed for %s\n", found.arn, cc.name)
+		if cc.plan != nil {
+			cc.plan.NoChange("aws.AuroraDSQL.Cluster", cc.name)
+		}
+		cc.tools.Storage.Adopt(cc.coin, found)
+		return
+	}
+
+	created := NewClusterModel(cc.loc, cc.coin, cc.name)
+	if cc.plan != nil {
+		cc.plan.Create("aws.AuroraDSQL.Cluster", cc.name, plan.Set("Tags", "Name="+cc.name))
+		created.arn = plan.Placeholder("aws.AuroraDSQL.Cluster", cc.name)
+		created.id = created.arn
+		cc.tools.Storage.Bind(cc.coin, created)
 		return
 	}
 
-	tags := map[string]string{}
-	tags["Name"] = creator.Name()
-	ci := &dsql.CreateClusterInput{Tags: tags}
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.AuroraDSQL.Cluster", cc.name, cc.coin)
 
-	create, err := cc.Client.CreateCluster(context.TODO(), ci)
+	ci := &dsql.CreateClusterInput{Tags: map[string]string{"Name": cc.name}}
+	create, err := cc.client.CreateCluster(ctx, ci)
 	if err != nil {
-		log.Fatalf("failed to create cluster %s: %v\n", creator.Name(), err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed to create cluster %s: %v", cc.name, err)
+		return
 	}
-	created := &clusterAWSModel{id: *create.Identifier, arn: *create.Arn}
+	created.id = *create.Identifier
+	created.arn = *create.Arn
+	log.Printf("initiated request to create cluster %s: %v %s\n", cc.name, create.Status, created.arn)
 
-	log.Printf("initiated request to create cluster %s: %v %s\n", creator.Name(), create.Status, *create.Arn)
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForCreation(created)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForCreation(ctx, created)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for cluster %s: %v", cc.name, failed)
+		return
+	}
 
-	log.Printf("created aurora dsql cluster %s %s", creator.Name(), created.arn)
-	creator.Created(created)
+	log.Printf("created aurora dsql cluster %s %s", cc.name, created.arn)
+	cc.tools.Storage.Bind(cc.coin, created)
 }
 
-func (cc *ClusterCreator) TearDown(creator *corepkg.CoreCreator, initial any, teardown corebottom.TearDown) {
-	if initial == nil {
-		log.Printf("no cluster existed for %s\n", creator.Name())
+func (cc *clusterCreator) TearDown() {
+	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
+
+	if tmp == nil {
+		log.Printf("no cluster existed for %s\n", cc.name)
 		return
 	}
 
-	found := initial.(*clusterAWSModel)
-	log.Printf("you have asked to tear down aurora dsql cluster for %s (arn: %s) with mode %s\n", creator.Name(), found.arn, teardown.Mode())
-	// todo: allow @teardown finalSnapshot
-	// will require @finalShapshotIdentifier
-	switch teardown.Mode() {
+	found := tmp.(*clusterModel)
+	log.Printf("you have asked to tear down aurora dsql cluster for %s (arn: %s) with mode %s\n", cc.name, found.arn, cc.teardown.Mode())
+	if cc.plan != nil {
+		if cc.teardown.Mode() == "delete" {
+			cc.plan.Delete("aws.AuroraDSQL.Cluster", cc.name)
+		}
+		return
+	}
+
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.AuroraDSQL.Cluster", cc.name, cc.coin)
+
+	switch cc.teardown.Mode() {
 	case "preserve":
-		log.Printf("not deleting cluster %s because teardown mode is 'preserve'", creator.Name())
+		log.Printf("not deleting cluster %s because teardown mode is 'preserve'", cc.name)
+		return
 	case "delete":
-		log.Printf("deleting cluster for %s with teardown mode 'delete'", creator.Name())
-		cc.deleteCluster(creator, found)
+		log.Printf("deleting cluster for %s with teardown mode 'delete'", cc.name)
+		if err := cc.deleteCluster(ctx, found); err != nil {
+			cc.tools.Reporter.ReportAtf(cc.loc, "deleting cluster %s failed: %v", cc.name, err)
+			return
+		}
 	default:
-		log.Printf("cannot handle teardown mode '%s' for bucket %s", teardown.Mode(), creator.Name())
+		log.Printf("cannot handle teardown mode '%s' for cluster %s", cc.teardown.Mode(), cc.name)
+		return
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForDeletion(creator, found)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForDeletion(ctx, found)
 	})
-
-	log.Printf("deleted neptune cluster %s", creator.Name())
-}
-
-type clusterModel struct {
-	core *corepkg.CoreCreator
-}
-
-func (c *clusterModel) ObtainMethod(name string) driverbottom.Method {
-	return c.core.DeferredMethod(name)
-}
-
-type clusterAWSModel struct {
-	arn string
-	id  string
-}
-
-// ObtainMethod implements driverbottom.HasMethods.
-func (c *clusterAWSModel) ObtainMethod(name string) driverbottom.Method {
-	switch name {
-	case "arn":
-		return corepkg.SimpleMethod(func(storage driverbottom.RuntimeStorage, obj driverbottom.Expr) any {
-			eval := storage.Eval(obj).(*clusterAWSModel)
-			return eval.arn
-		})
-	case "id":
-		return corepkg.SimpleMethod(func(storage driverbottom.RuntimeStorage, obj driverbottom.Expr) any {
-			eval := storage.Eval(obj).(*clusterAWSModel)
-			return eval.id
-		})
-	default:
-		panic("no such method " + name)
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for cluster %s to be deleted: %v", cc.name, failed)
+		return
 	}
+
+	log.Printf("deleted aurora dsql cluster %s", cc.name)
 }
 
-func (cc *ClusterCreator) findClusterNamed(name string) *clusterAWSModel {
+func (cc *clusterCreator) findClusterNamed(ctx context.Context, name string) (*clusterModel, error) {
 	var tok *string
 	for {
-		clusters, err := cc.Client.ListClusters(context.TODO(), &dsql.ListClustersInput{NextToken: tok})
+		clusters, err := cc.client.ListClusters(ctx, &dsql.ListClustersInput{NextToken: tok})
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		for _, c := range clusters.Clusters {
-			tags, err := cc.Client.ListTagsForResource(context.TODO(), &dsql.ListTagsForResourceInput{ResourceArn: c.Arn})
-			if err != nil {
-				panic(err)
+			tags, err := cc.client.ListTagsForResource(ctx, &dsql.ListTagsForResourceInput{ResourceArn: c.Arn})
+			if !clusterExists(err) {
+				// it has been deleted since it was listed
+				continue
+			} else if err != nil {
+				return nil, err
 			}
 			if tags.Tags["Name"] == name {
-				return &clusterAWSModel{arn: *c.Arn, id: *c.Identifier}
+				ret := NewClusterModel(cc.loc, cc.coin, name)
+				ret.arn = *c.Arn
+				ret.id = *c.Identifier
+				return ret, nil
 			}
 		}
 		if clusters.NextToken == nil {
-			return nil
+			return nil, nil
 		}
 		tok = clusters.NextToken
 	}
 }
 
+// clusterExists is false only when dsql answers 404
 func clusterExists(err error) bool {
 	if err == nil {
 		return true
@@ -155,60 +224,59 @@ func clusterExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*ht.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				return false
-			}
-			log.Fatalf("error: %v %v", e2.ResponseError.Response.StatusCode, e2.Response.Status)
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			return false
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting clusters failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
-func (cc *ClusterCreator) waitForCreation(cluster *clusterAWSModel) bool {
-	c, err := cc.Client.GetCluster(context.TODO(), &dsql.GetClusterInput{Identifier: &cluster.id})
+func (cc *clusterCreator) waitForCreation(ctx context.Context, cluster *clusterModel) (bool, error) {
+	c, err := cc.client.GetCluster(ctx, &dsql.GetClusterInput{Identifier: &cluster.id})
 	if !clusterExists(err) {
 		log.Printf("no clusters found with id %s\n", cluster.id)
-		return false
+		return false, nil
+	} else if err != nil {
+		return true, err
 	}
 	if c.Status == types.ClusterStatusActive {
-		return true
-	} else {
-		log.Printf("status was %s, not available", c.Status)
+		return true, nil
 	}
-	return false
+	log.Printf("status was %s, not available", c.Status)
+	return false, nil
 }
 
-func (cc *ClusterCreator) deleteCluster(creator *corepkg.CoreCreator, cluster *clusterAWSModel) {
+func (cc *clusterCreator) deleteCluster(ctx context.Context, cluster *clusterModel) error {
 	f := false
 	mod := &dsql.UpdateClusterInput{Identifier: &cluster.id, DeletionProtectionEnabled: &f}
-	_, err := cc.Client.UpdateCluster(context.TODO(), mod)
-	if err != nil {
-		log.Fatalf("failed to remove deletion protection from cluster %s: %v", creator.Name(), err)
+	if _, err := cc.client.UpdateCluster(ctx, mod); err != nil {
+		return fmt.Errorf("could not remove deletion protection: %w", err)
 	}
 
-	args := &dsql.DeleteClusterInput{Identifier: &cluster.id}
-	_, err = cc.Client.DeleteCluster(context.TODO(), args)
-	if err != nil {
-		log.Fatalf("deleting cluster failed: %T %v", err, err)
-	}
+	_, err := cc.client.DeleteCluster(ctx, &dsql.DeleteClusterInput{Identifier: &cluster.id})
+	return err
 }
 
-func (cc *ClusterCreator) waitForDeletion(creator *corepkg.CoreCreator, cluster *clusterAWSModel) bool {
-	c, err := cc.Client.GetCluster(context.TODO(), &dsql.GetClusterInput{Identifier: &cluster.id})
-	if !clusterExists(err) || c.Status == types.ClusterStatusDeleted {
-		return true
+func (cc *clusterCreator) waitForDeletion(ctx context.Context, cluster *clusterModel) (bool, error) {
+	c, err := cc.client.GetCluster(ctx, &dsql.GetClusterInput{Identifier: &cluster.id})
+	if !clusterExists(err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
 	}
-	if c.Status == types.ClusterStatusDeleting || c.Status == types.ClusterStatusActive {
-		log.Printf("cluster %s still exists with status %v\n", creator.Name(), c.Status)
-	} else {
-		log.Fatalf("status was %v, not available or deleting", c.Status)
+	switch c.Status {
+	case types.ClusterStatusDeleted:
+		return true, nil
+	case types.ClusterStatusDeleting, types.ClusterStatusActive:
+		log.Printf("cluster %s still exists with status %v\n", cc.name, c.Status)
+		return false, nil
+	default:
+		return true, fmt.Errorf("status was %v, not available or deleting", c.Status)
 	}
-	return false
 }
 
-var _ corepkg.CreationStrategy = &ClusterCreator{}
-var _ driverbottom.HasMethods = &clusterModel{}
-var _ driverbottom.HasMethods = &clusterAWSModel{}
+func (cc *clusterCreator) String() string {
+	return fmt.Sprintf("ClusterCreator[%s]", cc.name)
+}
+
+var _ corebottom.Ensurable = &clusterCreator{}
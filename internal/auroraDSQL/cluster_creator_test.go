@@ -0,0 +1,40 @@
+package auroraDSQL_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"ziniki.org/deployer/modules/aws/internal/auroraDSQL"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestClusterIsFoundByItsNameTagAndDeletedWithoutProtection(t *testing.T) {
+	h := awstest.New(t)
+	cluster := h.Coin("cluster")
+	h.Ensure(&auroraDSQL.ClusterBlank{}, cluster, "orders", nil)
+	if calls := h.Calls(); !slices.Contains(calls, "DSQL.CreateCluster") {
+		t.Fatalf("cluster was not created: %v", calls)
+	}
+
+	h.NextRun()
+	h.Ensure(&auroraDSQL.ClusterBlank{}, cluster, "orders", nil)
+	if calls := h.Calls(); slices.Contains(calls, "DSQL.CreateCluster") {
+		t.Fatalf("cluster was created again: %v", calls)
+	}
+
+	h.NextRun()
+	h.TearDown(&auroraDSQL.ClusterBlank{}, cluster, "orders", nil)
+	if calls := h.Calls(); !slices.Contains(calls, "DSQL.UpdateCluster") || !slices.Contains(calls, "DSQL.DeleteCluster") {
+		t.Fatalf("cluster was not unprotected and deleted: %v", calls)
+	}
+}
+
+func TestAFailedCreateIsReported(t *testing.T) {
+	h := awstest.New(t)
+	h.Fake.Fail("DSQL.CreateCluster", 1)
+	errs := h.Attempt(&auroraDSQL.ClusterBlank{}, h.Coin("cluster"), "orders", nil)
+	if len(errs) != 1 || !strings.Contains(errs[0], "failed to create cluster orders") {
+		t.Fatalf("errors were %v", errs)
+	}
+}
@@ -0,0 +1,81 @@
+package auroraDSQL
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+)
+
+// a cluster is found by its Name tag, since dsql chooses the identifier itself
+type clusterModel struct {
+	loc  *errorsink.Location
+	name string
+	coin corebottom.CoinId
+
+	arn string
+	id  string
+}
+
+func (c *clusterModel) Loc() *errorsink.Location {
+	return c.loc
+}
+
+func (c *clusterModel) ShortDescription() string {
+	return fmt.Sprintf("aws.AuroraDSQL.Cluster[%s]", c.name)
+}
+
+func (c *clusterModel) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("aws.AuroraDSQL.Cluster[%s]", c.name)
+	to.AttrsWhere(c)
+	to.TextAttr("arn", c.arn)
+	to.TextAttr("id", c.id)
+	to.EndAttrs()
+}
+
+func (c *clusterModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "arn":
+		return &clusterMethod{name: name, value: func(m *clusterModel) string { return m.arn }}
+	case "id":
+		return &clusterMethod{name: name, value: func(m *clusterModel) string { return m.id }}
+	}
+	return nil
+}
+
+// clusterMethod returns one of the values AWS gave the cluster; until the cluster
+// has been created, that has to wait until it is needed
+type clusterMethod struct {
+	name  string
+	value func(*clusterModel) string
+}
+
+func (a *clusterMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	model, ok := e.(*clusterModel)
+	if !ok {
+		panic(fmt.Sprintf("%s can only be called on a cluster, not a %T", a.name, e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	if v := a.value(model); v != "" {
+		return v
+	}
+	return utils.DeferString(func() string {
+		curr := s.GetCoinFrom(model.coin, []int{1, 3})
+		if curr == nil {
+			panic("could not find find/create version of " + model.coin.VarName().Id())
+		}
+		return a.value(curr.(*clusterModel))
+	})
+}
+
+func NewClusterModel(loc *errorsink.Location, coin corebottom.CoinId, name string) *clusterModel {
+	return &clusterModel{loc: loc, coin: coin, name: name}
+}
+
+var _ driverbottom.Describable = &clusterModel{}
+var _ driverbottom.HasMethods = &clusterModel{}
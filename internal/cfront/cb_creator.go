@@ -79,7 +79,8 @@ func (cbc *CacheBehaviorCreator) Create(pres corebottom.ValuePresenter) {
 
 	cpId, ok := cbc.tools.Storage.EvalAsStringer(cp)
 	if !ok {
-		panic("not a string")
+		cbc.tools.Reporter.ReportAtf(cbc.loc, "CachePolicy for %s must be a string", cbc.name)
+		return
 	}
 
 	model := &cbModel{name: cbc.name, pp: ppEval, rhp: rhpEval, targetOriginId: targetOriginId, cpId: cpId}
@@ -0,0 +1,101 @@
+package cfront_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/cfront"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestDistributionIsWiredToItsOACAndCachePolicy(t *testing.T) {
+	h := awstest.New(t)
+	oac := h.Coin("oac")
+	cp := h.Coin("cp")
+	dist := h.Coin("dist")
+	oacProps := h.Props(map[string]any{"OriginAccessControlOriginType": "s3", "SigningBehavior": "always", "SigningProtocol": "sigv4"})
+	cpProps := h.Props(map[string]any{"MinTTL": 60})
+	distProps := h.Props(map[string]any{
+		"Comment":             "the site",
+		"OriginDNS":           "site.s3.us-east-1.amazonaws.com",
+		"TargetOriginId":      "site",
+		"Domain":              []string{"www.example.com", "example.com"},
+		"OriginAccessControl": h.Get(oac, "id"),
+		"CachePolicy":         h.Get(cp, "id"),
+		"CacheBehaviors":      drivertop.NewListExpr(&errorsink.Location{}, nil),
+	})
+	deploy := func() {
+		h.Ensure(&cfront.OACBlank{}, oac, "site-oac", oacProps)
+		h.Ensure(&cfront.CachePolicyBlank{}, cp, "site-cache", cpProps)
+		h.Ensure(&cfront.DistributionBlank{}, dist, "site", distProps)
+	}
+
+	deploy()
+	_, config, ok := h.Fake.Distribution("site")
+	if !ok {
+		t.Fatalf("distribution was not created: %v", h.Calls())
+	}
+	if aliases := config.Aliases.Items; !slices.Equal(aliases, []string{"www.example.com", "example.com"}) {
+		t.Fatalf("distribution has aliases %v", aliases)
+	}
+	client := cloudfront.NewFromConfig(h.Fake.Config())
+	oacs, err := client.ListOriginAccessControls(context.Background(), &cloudfront.ListOriginAccessControlsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := config.Origins.Items[0]
+	if aws.ToString(origin.Id) != "site" || aws.ToString(origin.OriginAccessControlId) != aws.ToString(oacs.OriginAccessControlList.Items[0].Id) {
+		t.Fatalf("origin %s is not signed by the OAC", aws.ToString(origin.Id))
+	}
+	cps, err := client.ListCachePolicies(context.Background(), &cloudfront.ListCachePoliciesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(config.DefaultCacheBehavior.CachePolicyId) != aws.ToString(cps.CachePolicyList.Items[0].CachePolicy.Id) {
+		t.Fatalf("default behavior does not use the cache policy")
+	}
+
+	h.NextRun()
+	h.Calls()
+	deploy()
+	for _, op := range h.Calls() {
+		if op == "CloudFront.CreateDistributionWithTags" || op == "CloudFront.UpdateDistribution" {
+			t.Fatalf("nothing had changed, but %s was called", op)
+		}
+	}
+}
+
+func TestCachePolicyMinTTLIsUpdatedInPlace(t *testing.T) {
+	h := awstest.New(t)
+	cp := h.Coin("cp")
+	minTTL := func() int64 {
+		out, err := cloudfront.NewFromConfig(h.Fake.Config()).ListCachePolicies(context.Background(), &cloudfront.ListCachePoliciesInput{})
+		if err != nil || len(out.CachePolicyList.Items) != 1 {
+			t.Fatalf("there should be exactly one cache policy: %v", err)
+		}
+		return aws.ToInt64(out.CachePolicyList.Items[0].CachePolicy.CachePolicyConfig.MinTTL)
+	}
+
+	h.Ensure(&cfront.CachePolicyBlank{}, cp, "site-cache", h.Props(map[string]any{"MinTTL": 60}))
+
+	h.NextRun()
+	h.Calls()
+	h.Ensure(&cfront.CachePolicyBlank{}, cp, "site-cache", h.Props(map[string]any{"MinTTL": 60}))
+	if calls := h.Calls(); slices.Contains(calls, "CloudFront.UpdateCachePolicy") {
+		t.Fatalf("MinTTL had not changed: %v", calls)
+	}
+
+	h.NextRun()
+	h.Ensure(&cfront.CachePolicyBlank{}, cp, "site-cache", h.Props(map[string]any{"MinTTL": 300}))
+	if calls := h.Calls(); !slices.Contains(calls, "CloudFront.UpdateCachePolicy") || slices.Contains(calls, "CloudFront.CreateCachePolicy") {
+		t.Fatalf("cache policy should have been updated: %v", calls)
+	}
+	if got := minTTL(); got != 300 {
+		t.Fatalf("MinTTL is %d", got)
+	}
+}
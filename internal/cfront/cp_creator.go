@@ -3,6 +3,7 @@ package cfront
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
@@ -10,6 +11,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type CachePolicyCreator struct {
@@ -21,7 +23,10 @@ type CachePolicyCreator struct {
 	teardown corebottom.TearDown
 	props    map[driverbottom.Identifier]driverbottom.Expr
 
-	client *cloudfront.Client
+	client  *cloudfront.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cfdc *CachePolicyCreator) Loc() *errorsink.Location {
@@ -47,22 +52,27 @@ func (acmc *CachePolicyCreator) CoinId() corebottom.CoinId {
 }
 
 func (cfdc *CachePolicyCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := cfdc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cfdc.tools, cfdc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	cfdc.client = awsEnv.CFClient()
+	cfdc.ctx = awsEnv.Context()
+	cfdc.timeout = env.ObtainTimeout(cfdc.tools, cfdc.props)
+	cfdc.plan = awsEnv.Plan()
 
 	var model *cachePolicyModel
-	bert, err := cfdc.client.ListCachePolicies(context.TODO(), &cloudfront.ListCachePoliciesInput{})
+	bert, err := cfdc.client.ListCachePolicies(cfdc.ctx, &cloudfront.ListCachePoliciesInput{})
 	if err != nil {
-		log.Fatalf("could not list CPs")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not list CPs: %v", err)
+		return
 	}
 	for _, p := range bert.CachePolicyList.Items {
 		if p.CachePolicy.Id != nil && p.CachePolicy.CachePolicyConfig.Name != nil && *p.CachePolicy.CachePolicyConfig.Name == cfdc.name {
 			model = NewCachePolicyModel(cfdc.coin, cfdc.loc, cfdc.name, "found")
 			model.CachePolicyId = *p.CachePolicy.Id
+			model.config = p.CachePolicy.CachePolicyConfig
 			log.Printf("found CachePolicy for %s with id %s\n", model.name, model.CachePolicyId)
 		}
 	}
@@ -77,6 +87,7 @@ func (cfdc *CachePolicyCreator) DetermineDesiredState(pres corebottom.ValuePrese
 	var minttl driverbottom.Expr
 	for p, v := range cfdc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "MinTTL":
 			minttl = v
 		default:
@@ -94,11 +105,16 @@ func (cfdc *CachePolicyCreator) DetermineDesiredState(pres corebottom.ValuePrese
 }
 
 func (cfdc *CachePolicyCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(cfdc.ctx, cfdc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.CachePolicy", cfdc.name, cfdc.coin)
+
 	tmp := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*cachePolicyModel)
 		log.Printf("CachePolicy %s already existed for %s\n", found.CachePolicyId, found.name)
+		cfdc.updatePolicy(ctx, found)
 		return
 	}
 
@@ -111,9 +127,16 @@ func (cfdc *CachePolicyCreator) UpdateReality() {
 	mt := cfdc.tools.Storage.EvalAsNumber(created.minttl)
 	minttl := int64(mt.F64())
 	cpc := types.CachePolicyConfig{Name: &cfdc.name, MinTTL: &minttl}
-	oac, err := cfdc.client.CreateCachePolicy(context.TODO(), &cloudfront.CreateCachePolicyInput{CachePolicyConfig: &cpc})
+	if cfdc.plan != nil {
+		cfdc.plan.Create("aws.CloudFront.CachePolicy", cfdc.name, plan.Set("MinTTL", minttl))
+		created.CachePolicyId = plan.Placeholder("aws.CloudFront.CachePolicy", cfdc.name)
+		cfdc.tools.Storage.Bind(cfdc.coin, created)
+		return
+	}
+	oac, err := cfdc.client.CreateCachePolicy(ctx, &cloudfront.CreateCachePolicyInput{CachePolicyConfig: &cpc})
 	if err != nil {
-		log.Fatalf("failed to create CachePolicy for %s: %v\n", cfdc.name, err)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to create CachePolicy for %s: %v", cfdc.name, err)
+		return
 	}
 	created.CachePolicyId = *oac.CachePolicy.Id
 	log.Printf("created CachePolicy for %s: %s\n", cfdc.name, created.CachePolicyId)
@@ -121,19 +144,58 @@ func (cfdc *CachePolicyCreator) UpdateReality() {
 	cfdc.tools.Storage.Bind(cfdc.coin, created)
 }
 
+// updatePolicy brings the MinTTL of an existing policy into line with the script;
+// everything else AWS has for the policy is left as it is
+func (cfdc *CachePolicyCreator) updatePolicy(ctx context.Context, found *cachePolicyModel) {
+	desired := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_DESIRED_MODE).(*cachePolicyModel)
+	minttl := int64(cfdc.tools.Storage.EvalAsNumber(desired.minttl).F64())
+	if cfdc.plan != nil {
+		cfdc.plan.Update("aws.CloudFront.CachePolicy", cfdc.name, plan.Compare("MinTTL", found.config.MinTTL, minttl))
+		return
+	}
+	if found.config.MinTTL != nil && *found.config.MinTTL == minttl {
+		return
+	}
+
+	x, err := cfdc.client.GetCachePolicy(ctx, &cloudfront.GetCachePolicyInput{Id: &found.CachePolicyId})
+	if err != nil {
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not get CP %s: %v", found.CachePolicyId, err)
+		return
+	}
+	cpc := x.CachePolicy.CachePolicyConfig
+	cpc.MinTTL = &minttl
+	_, err = cfdc.client.UpdateCachePolicy(ctx, &cloudfront.UpdateCachePolicyInput{Id: &found.CachePolicyId, IfMatch: x.ETag, CachePolicyConfig: cpc})
+	if err != nil {
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to update CachePolicy for %s: %v", cfdc.name, err)
+		return
+	}
+	found.config = cpc
+	log.Printf("updated MinTTL of CachePolicy %s to %d\n", found.CachePolicyId, minttl)
+}
+
 func (cfdc *CachePolicyCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(cfdc.ctx, cfdc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.CachePolicy", cfdc.name, cfdc.coin)
+
 	tmp := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*cachePolicyModel)
 		log.Printf("you have asked to tear down CachePolicy %s (id: %s) with mode %s\n", cfdc.name, found.CachePolicyId, cfdc.teardown.Mode())
-		x, err := cfdc.client.GetCachePolicy(context.TODO(), &cloudfront.GetCachePolicyInput{Id: &found.CachePolicyId})
+		if cfdc.plan != nil {
+			cfdc.plan.Delete("aws.CloudFront.CachePolicy", cfdc.name)
+			return
+		}
+		x, err := cfdc.client.GetCachePolicy(ctx, &cloudfront.GetCachePolicyInput{Id: &found.CachePolicyId})
 		if err != nil {
-			log.Fatalf("could not get CP %s: %v", found.CachePolicyId, err)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not get CP %s: %v", found.CachePolicyId, err)
+			return
 		}
-		_, err = cfdc.client.DeleteCachePolicy(context.TODO(), &cloudfront.DeleteCachePolicyInput{Id: &found.CachePolicyId, IfMatch: x.ETag})
+		_, err = cfdc.client.DeleteCachePolicy(ctx, &cloudfront.DeleteCachePolicyInput{Id: &found.CachePolicyId, IfMatch: x.ETag})
 		if err != nil {
-			log.Fatalf("could not delete CP %s: %v", found.CachePolicyId, err)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not delete CP %s: %v", found.CachePolicyId, err)
+			return
 		}
 		log.Printf("deleted CachePolicy %s\n", found.CachePolicyId)
 	} else {
@@ -3,6 +3,8 @@ package cfront
 import (
 	"fmt"
 
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
@@ -16,6 +18,9 @@ type cachePolicyModel struct {
 	minttl        driverbottom.Expr
 	which         string
 	CachePolicyId string
+
+	// the configuration AWS has for a policy that already exists
+	config *types.CachePolicyConfig
 }
 
 func NewCachePolicyModel(coin corebottom.CoinId, loc *errorsink.Location, name string, which string) *cachePolicyModel {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
@@ -13,6 +14,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type distributionCreator struct {
@@ -24,7 +26,10 @@ type distributionCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *cloudfront.Client
+	client  *cloudfront.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cfdc *distributionCreator) Loc() *errorsink.Location {
@@ -47,21 +52,26 @@ func (acmc *distributionCreator) CoinId() corebottom.CoinId {
 }
 
 func (cfdc *distributionCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := cfdc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cfdc.tools, cfdc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	cfdc.client = awsEnv.CFClient()
+	cfdc.ctx = awsEnv.Context()
+	cfdc.timeout = env.ObtainTimeout(cfdc.tools, cfdc.props)
+	cfdc.plan = awsEnv.Plan()
 
-	distros, err := cfdc.client.ListDistributions(context.TODO(), &cloudfront.ListDistributionsInput{})
+	distros, err := cfdc.client.ListDistributions(cfdc.ctx, &cloudfront.ListDistributionsInput{})
 	if err != nil {
-		log.Fatalf("could not list OACs")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not list distributions: %v", err)
+		return
 	}
 	for _, p := range distros.DistributionList.Items {
-		tags, err := cfdc.client.ListTagsForResource(context.TODO(), &cloudfront.ListTagsForResourceInput{Resource: p.ARN})
+		tags, err := cfdc.client.ListTagsForResource(cfdc.ctx, &cloudfront.ListTagsForResourceInput{Resource: p.ARN})
 		if err != nil {
-			log.Fatalf("error trying to obtain tags for %s\n", *p.ARN)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "error trying to obtain tags for %s: %v", *p.ARN, err)
+			return
 		}
 		for _, q := range tags.Tags.Items {
 			if q.Key != nil && *q.Key == "deployer-name" && q.Value != nil && *q.Value == cfdc.name {
@@ -73,7 +83,8 @@ func (cfdc *distributionCreator) DetermineInitialState(pres corebottom.ValuePres
 				for _, cb := range p.CacheBehaviors.Items {
 					cpid, ok := utils.AsStringer(*cb.CachePolicyId)
 					if !ok {
-						panic("ugh")
+						cfdc.tools.Reporter.ReportAtf(cfdc.loc, "cache policy id %v for distribution %s is not a string", *cb.CachePolicyId, *p.Id)
+						return
 					}
 					cbm := &cbModel{targetOriginId: *cb.TargetOriginId, pp: *cb.PathPattern, cpId: cpid, rhp: *cb.ResponseHeadersPolicyId}
 					model.foundBehaviors = append(model.foundBehaviors, cbm)
@@ -100,6 +111,7 @@ func (cfdc *distributionCreator) DetermineDesiredState(pres corebottom.ValuePres
 	var toid driverbottom.Expr
 	for p, v := range cfdc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Certificate":
 			cert = v
 		case "OriginDNS":
@@ -150,12 +162,16 @@ func (cfdc *distributionCreator) UpdateReality() {
 	tmp := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_DESIRED_MODE).(*DistributionModel)
 	created := &DistributionModel{name: cfdc.name, loc: cfdc.loc, coin: cfdc.coin}
+	ctx, cancel := env.WithTimeout(cfdc.ctx, cfdc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.Distribution", cfdc.name, cfdc.coin)
 
 	var defRootObj *string = nil
 	if desired.defRootExpr != nil {
 		tmp, ok := cfdc.tools.Storage.EvalAsStringer(desired.defRootExpr)
 		if !ok {
-			log.Fatalf("failed to evaluate DefaultRoot")
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to evaluate DefaultRoot")
+			return
 		}
 		ts := tmp.String()
 		defRootObj = &ts
@@ -170,13 +186,23 @@ func (cfdc *distributionCreator) UpdateReality() {
 
 		log.Printf("distribution %s already existed for %s (%s %s)\n", found.arn, found.name, found.distroId, found.domainName)
 		diffs := figureDiffs(cfdc.tools, found, desired)
+		if cfdc.plan != nil {
+			if diffs == nil {
+				cfdc.plan.NoChange("aws.CloudFront.Distribution", cfdc.name)
+			} else {
+				cfdc.plan.Update("aws.CloudFront.Distribution", cfdc.name, plan.Compare("CacheBehaviors", pathPatterns(found.foundBehaviors), pathPatterns(diffs.models)))
+			}
+			cfdc.tools.Storage.Adopt(cfdc.coin, found)
+			return
+		}
 		if diffs == nil {
 			cfdc.tools.Storage.Adopt(cfdc.coin, found)
 			return
 		} else {
-			curr, err := cfdc.client.GetDistributionConfig(context.TODO(), &cloudfront.GetDistributionConfigInput{Id: &found.distroId})
+			curr, err := cfdc.client.GetDistributionConfig(ctx, &cloudfront.GetDistributionConfigInput{Id: &found.distroId})
 			if err != nil {
-				panic(err)
+				cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not get config for distribution %s: %v", found.distroId, err)
+				return
 			}
 			etag := curr.ETag
 			curr.ETag = nil
@@ -189,9 +215,10 @@ func (cfdc *distributionCreator) UpdateReality() {
 			// TODO: should allow other things to be updated too ...
 
 			log.Printf("updating distribution")
-			_, err = cfdc.client.UpdateDistribution(context.TODO(), &cloudfront.UpdateDistributionInput{Id: &found.distroId, IfMatch: etag, DistributionConfig: config})
+			_, err = cfdc.client.UpdateDistribution(ctx, &cloudfront.UpdateDistributionInput{Id: &found.distroId, IfMatch: etag, DistributionConfig: config})
 			if err != nil {
-				panic(err)
+				cfdc.tools.Reporter.ReportAtf(cfdc.loc, "could not update distribution %s: %v", found.distroId, err)
+				return
 			}
 
 			cfdc.tools.Storage.Bind(cfdc.coin, created)
@@ -202,23 +229,44 @@ func (cfdc *distributionCreator) UpdateReality() {
 	cpId, ok1 := cfdc.tools.Storage.EvalAsStringer(desired.cachePolicy)
 	toid, ok2 := cfdc.tools.Storage.EvalAsStringer(desired.toid)
 	if !ok1 || !ok2 {
-		panic("!ok")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "CachePolicy and TargetOriginId must be strings")
+		return
 	}
 	toidS := toid.String()
 	cpIdS := cpId.String()
 	dcb := types.DefaultCacheBehavior{TargetOriginId: &toidS, ViewerProtocolPolicy: types.ViewerProtocolPolicyRedirectToHttps, CachePolicyId: &cpIdS}
 	origins := cfdc.FigureOrigins(desired, toidS)
 	behaviors := cfdc.FigureCacheBehaviors(desired)
+	if origins == nil || behaviors == nil {
+		return
+	}
 	config := cfdc.BuildConfig(desired, &dcb, behaviors, origins, defRootObj)
+	if config == nil {
+		return
+	}
 
-	if desired.viewerCert != nil {
-		cfdc.AttachViewerCert(desired, config)
+	if desired.viewerCert != nil && !cfdc.AttachViewerCert(desired, config) {
+		return
+	}
+	if cfdc.plan != nil {
+		var patterns []string
+		for _, cb := range behaviors.Items {
+			patterns = append(patterns, *cb.PathPattern)
+		}
+		cfdc.plan.Create("aws.CloudFront.Distribution", cfdc.name, plan.Set("TargetOriginId", toidS), plan.Set("CachePolicyId", cpIdS), plan.Set("DefaultRootObject", defRootObj), plan.Set("CacheBehaviors", patterns))
+		placeholder := plan.Placeholder("aws.CloudFront.Distribution", cfdc.name)
+		created.arn = placeholder
+		created.distroId = placeholder
+		created.domainName = placeholder
+		cfdc.tools.Storage.Bind(cfdc.coin, created)
+		return
 	}
 	tagkey := "deployer-name"
 	tags := types.Tags{Items: []types.Tag{{Key: &tagkey, Value: &cfdc.name}}}
-	req, err := cfdc.client.CreateDistributionWithTags(context.TODO(), &cloudfront.CreateDistributionWithTagsInput{DistributionConfigWithTags: &types.DistributionConfigWithTags{DistributionConfig: config, Tags: &tags}})
+	req, err := cfdc.client.CreateDistributionWithTags(ctx, &cloudfront.CreateDistributionWithTagsInput{DistributionConfigWithTags: &types.DistributionConfigWithTags{DistributionConfig: config, Tags: &tags}})
 	if err != nil {
-		log.Fatalf("failed to create distribution %s: %v\n", cfdc.name, err)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to create distribution %s: %v", cfdc.name, err)
+		return
 	}
 	log.Printf("created distribution %s: %s %s %s\n", cfdc.name, *req.Distribution.ARN, *req.Distribution.Id, *req.Distribution.DomainName)
 	created.arn = *req.Distribution.ARN
@@ -230,89 +278,113 @@ func (cfdc *distributionCreator) UpdateReality() {
 
 func (cfdc *distributionCreator) TearDown() {
 	tmp := cfdc.tools.Storage.GetCoin(cfdc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	ctx, cancel := env.WithTimeout(cfdc.ctx, cfdc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.Distribution", cfdc.name, cfdc.coin)
 
 	if tmp != nil {
 		found := tmp.(*DistributionModel)
 		log.Printf("you have asked to tear down distribution %s (id: %s, arn: %s) with mode %s\n", cfdc.name, found.distroId, found.arn, cfdc.teardown.Mode())
+		if cfdc.plan != nil {
+			cfdc.plan.Delete("aws.CloudFront.Distribution", cfdc.name)
+			return
+		}
 
-		cfdc.DisableIt(found)
-		cfdc.DeleteIt(found)
+		if cfdc.DisableIt(ctx, found) {
+			cfdc.DeleteIt(ctx, found)
+		}
 	} else {
 		log.Printf("no distribution existed for %s\n", cfdc.name)
 	}
 
 }
 
-func (cfdc *distributionCreator) DisableIt(model *DistributionModel) {
+func (cfdc *distributionCreator) DisableIt(ctx context.Context, model *DistributionModel) bool {
 tryAgain:
-	distro, err := cfdc.client.GetDistribution(context.TODO(), &cloudfront.GetDistributionInput{Id: &model.distroId})
+	distro, err := cfdc.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &model.distroId})
 	if err != nil {
-		log.Fatalf("failed to recover distribution for %s: %v", model.distroId, err)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to recover distribution for %s: %v", model.distroId, err)
+		return false
 	}
 
 	if *distro.Distribution.Status == "Deployed" && *distro.Distribution.DistributionConfig.Enabled {
 		log.Printf("Disabling %s\n", model.distroId)
 		isFalse := false
 		distro.Distribution.DistributionConfig.Enabled = &isFalse
-		_, err := cfdc.client.UpdateDistribution(context.TODO(), &cloudfront.UpdateDistributionInput{Id: &model.distroId, IfMatch: distro.ETag, DistributionConfig: distro.Distribution.DistributionConfig})
+		_, err := cfdc.client.UpdateDistribution(ctx, &cloudfront.UpdateDistributionInput{Id: &model.distroId, IfMatch: distro.ETag, DistributionConfig: distro.Distribution.DistributionConfig})
 		if err != nil {
-			log.Fatalf("error disabling %s: %v\n", model.distroId, err)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "error disabling %s: %v", model.distroId, err)
+			return false
 		}
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		distro, err := cfdc.client.GetDistribution(context.TODO(), &cloudfront.GetDistributionInput{Id: &model.distroId})
+	err = env.Backoff(ctx, func() (bool, error) {
+		distro, err := cfdc.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &model.distroId})
 		if err != nil {
-			log.Fatalf("failed to recover distribution for %s: %v", model.distroId, err)
+			// report it below
+			return true, nil
 		}
 		log.Printf("disabling distro %s ... %v %s\n", model.distroId, *distro.Distribution.DistributionConfig.Enabled, *distro.Distribution.Status)
-		return *distro.Distribution.Status != "InProgress"
+		return *distro.Distribution.Status != "InProgress", nil
 	})
+	if err != nil {
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed waiting for distribution %s to be disabled: %v", model.distroId, err)
+		return false
+	}
 
 	// This can fail from time to time.  If so, try all over again
-	distro, err = cfdc.client.GetDistribution(context.TODO(), &cloudfront.GetDistributionInput{Id: &model.distroId})
+	distro, err = cfdc.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &model.distroId})
 	if err != nil {
-		log.Fatalf("failed to recover distribution for %s: %v", model.distroId, err)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to recover distribution for %s: %v", model.distroId, err)
+		return false
 	}
 	if *distro.Distribution.DistributionConfig.Enabled {
 		goto tryAgain
 	}
+	return true
 }
 
-func (cfdc *distributionCreator) DeleteIt(model *DistributionModel) {
-	distro, err := cfdc.client.GetDistribution(context.TODO(), &cloudfront.GetDistributionInput{Id: &model.distroId})
+func (cfdc *distributionCreator) DeleteIt(ctx context.Context, model *DistributionModel) {
+	distro, err := cfdc.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &model.distroId})
 	if err != nil {
-		log.Fatalf("failed to recover distribution for %s: %v", model.distroId, err)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed to recover distribution for %s: %v", model.distroId, err)
+		return
 	}
 	log.Printf("have a distro %s %v\n", *distro.Distribution.Status, *distro.Distribution.DistributionConfig.Enabled)
 
 	if *distro.Distribution.DistributionConfig.Enabled {
-		log.Fatalf("the distribution is still enabled")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "the distribution is still enabled")
+		return
 	}
 	if *distro.Distribution.Status == "Deployed" {
 		log.Printf("Deleting %s\n", model.distroId)
-		_, err := cfdc.client.DeleteDistribution(context.TODO(), &cloudfront.DeleteDistributionInput{Id: &model.distroId, IfMatch: distro.ETag})
+		_, err := cfdc.client.DeleteDistribution(ctx, &cloudfront.DeleteDistributionInput{Id: &model.distroId, IfMatch: distro.ETag})
 		if err != nil {
-			log.Fatalf("error deleting %s: %v\n", model.distroId, err)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "error deleting %s: %v", model.distroId, err)
+			return
 		}
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		distro, err := cfdc.client.GetDistribution(context.TODO(), &cloudfront.GetDistributionInput{Id: &model.distroId})
+	err = env.Backoff(ctx, func() (bool, error) {
+		distro, err := cfdc.client.GetDistribution(ctx, &cloudfront.GetDistributionInput{Id: &model.distroId})
 		if err != nil {
 			// We can't get it because it isn't there
-			return true
+			return true, nil
 		}
 		fmt.Printf("deleting distro ... %s\n", *distro.Distribution.Status)
-		return *distro.Distribution.Status != "InProgress"
+		return *distro.Distribution.Status != "InProgress", nil
 	})
+	if err != nil {
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "failed waiting for distribution %s to be deleted: %v", model.distroId, err)
+	}
 }
 
 func (cfdc *distributionCreator) FigureOrigins(desired *DistributionModel, targetOriginId string) *types.Origins {
 	oacId, ok1 := cfdc.tools.Storage.EvalAsStringer(desired.oac)
 	origindns, ok2 := cfdc.tools.Storage.EvalAsStringer(desired.origindns)
 	if !ok1 || !ok2 {
-		panic("!ok")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "OriginAccessControl and OriginDNS must be strings")
+		return nil
 	}
 	oacIdS := oacId.String()
 	origindnsS := origindns.String()
@@ -330,13 +402,15 @@ func (cfdc *distributionCreator) FigureCacheBehaviors(desired *DistributionModel
 	cbci := desired.behaviors.Eval(cfdc.tools.Storage)
 	cbcl, ok := cbci.([]any)
 	if !ok {
-		log.Fatalf("not a list but %T", cbci)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "CacheBehaviors must be a list, not %T", cbci)
+		return nil
 	}
 	cbs := []types.CacheBehavior{}
 	for _, m := range cbcl {
 		cbc, ok := m.(*cbModel)
 		if !ok {
-			log.Fatalf("not a cache behavior but %T", cbci)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "not a cache behavior but %T", m)
+			return nil
 		}
 		resolved := cbc.Complete()
 		cbs = append(cbs, resolved)
@@ -349,30 +423,34 @@ func (cfdc *distributionCreator) FigureCacheBehaviors(desired *DistributionModel
 func (cfdc *distributionCreator) BuildConfig(desired *DistributionModel, dcb *types.DefaultCacheBehavior, behaviors *types.CacheBehaviors, origins *types.Origins, defRootObject *string) *types.DistributionConfig {
 	comment, ok := cfdc.tools.Storage.EvalAsStringer(desired.comment)
 	if !ok {
-		log.Fatalf("!ok, %T", comment)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "Comment must be a string")
+		return nil
 	}
 	commentS := comment.String()
 	e := true
 	dme := cfdc.tools.Storage.Eval(desired.domains)
 	domains, ok := dme.([]any)
 	if !ok {
-		log.Fatalf("!ok, %T", dme)
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "Domain must be a list, not %T", dme)
+		return nil
 	}
 	aliases, ok := utils.AsStringList(domains)
 	if !ok {
-		log.Fatalf("needs to be list of strings")
+		cfdc.tools.Reporter.ReportAtf(cfdc.loc, "Domain needs to be list of strings")
+		return nil
 	}
 	nAliases := int32(len(aliases))
 	return &types.DistributionConfig{CallerReference: &cfdc.name, Comment: &commentS, DefaultCacheBehavior: dcb, CacheBehaviors: behaviors, Enabled: &e, DefaultRootObject: defRootObject, Origins: origins, Aliases: &types.Aliases{Items: aliases, Quantity: &nAliases}}
 }
 
-func (cfdc *distributionCreator) AttachViewerCert(desired *DistributionModel, config *types.DistributionConfig) {
+func (cfdc *distributionCreator) AttachViewerCert(desired *DistributionModel, config *types.DistributionConfig) bool {
 	vc := cfdc.tools.Storage.Eval(desired.viewerCert)
 	vcs, ok := vc.(string)
 	if !ok {
 		tmp, ok := vc.(fmt.Stringer)
 		if !ok {
-			log.Fatalf("not a string or Stringer but %T", vc)
+			cfdc.tools.Reporter.ReportAtf(cfdc.loc, "not a string or Stringer but %T", vc)
+			return false
 		}
 		vcs = tmp.String()
 	}
@@ -380,6 +458,7 @@ func (cfdc *distributionCreator) AttachViewerCert(desired *DistributionModel, co
 	supp := types.SSLSupportMethodSniOnly
 	cfdef := false
 	config.ViewerCertificate = &types.ViewerCertificate{ACMCertificateArn: &vcs, MinimumProtocolVersion: minver, SSLSupportMethod: supp, CloudFrontDefaultCertificate: &cfdef}
+	return true
 }
 
 var _ corebottom.Ensurable = &distributionCreator{}
@@ -4,6 +4,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/utils"
 )
 
 // In attempting to use this as a springboard for the "general" case, I think I have over-engineered this.
@@ -57,3 +58,12 @@ func (diffs *distributionDiffs) apply(_ *corebottom.Tools, _ *cloudfront.Client,
 	cbl := int32(len(cbs))
 	return &types.CacheBehaviors{Quantity: &cbl, Items: cbs}
 }
+
+// pathPatterns lists the path patterns of some behaviors, in order, to show them in a plan
+func pathPatterns(cbs []*cbModel) []string {
+	ret := []string{}
+	for _, cb := range cbs {
+		ret = append(ret, utils.AsString(cb.pp))
+	}
+	return ret
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
@@ -13,6 +14,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type invalidateAction struct {
@@ -21,8 +23,11 @@ type invalidateAction struct {
 
 	distribution driverbottom.Expr
 	paths        driverbottom.Expr
+	env          driverbottom.Expr
 
+	ctx    context.Context
 	client *cloudfront.Client
+	plan   *plan.Plan
 	model  *invalidateModel
 }
 
@@ -56,9 +61,14 @@ func (ia *invalidateAction) AddProperty(name driverbottom.Identifier, value driv
 		ia.distribution = value
 	case "Paths":
 		if ia.paths != nil {
-			ia.tools.Reporter.Report(name.Loc().Offset, "duplicate definition of Distribution")
+			ia.tools.Reporter.Report(name.Loc().Offset, "duplicate definition of Paths")
 		}
 		ia.paths = value
+	case "Env":
+		if ia.env != nil {
+			ia.tools.Reporter.Report(name.Loc().Offset, "duplicate definition of Env")
+		}
+		ia.env = value
 	default:
 		ia.tools.Reporter.ReportAtf(name.Loc(), "cloudfront.invalidate does not have a parameter %s", name)
 	}
@@ -75,16 +85,21 @@ func (ia *invalidateAction) Resolve(r driverbottom.Resolver) driverbottom.Bindin
 	if ia.paths != nil {
 		ia.paths.Resolve(r)
 	}
+	if ia.env != nil {
+		ia.env.Resolve(r)
+	}
 	return driverbottom.MAY_BE_BOUND
 }
 
 func (ia *invalidateAction) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := ia.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.NamedEnv(ia.tools, ia.env)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
+	ia.ctx = awsEnv.Context()
 	ia.client = awsEnv.CFClient()
+	ia.plan = awsEnv.Plan()
 
 	distroId, ok := ia.tools.Storage.EvalAsStringer(ia.distribution)
 	if !ok {
@@ -108,22 +123,71 @@ func (ia *invalidateAction) ShouldDestroy() bool {
 func (ia *invalidateAction) UpdateReality() {
 	invalidateAt := time.Now().Format("20060102030405")
 	uniqueId := fmt.Sprintf("InvalidateAt%s", invalidateAt)
-	var paths []string
-	if len(ia.model.paths) == 0 {
-		paths = append(paths, "/*")
-	} else {
-		panic("unimplemented - processing of paths")
+	paths := []string{"/*"}
+	if ia.paths != nil {
+		var ok bool
+		paths, ok = ia.evalPaths()
+		if !ok {
+			return
+		}
+		if len(paths) == 0 {
+			log.Printf("no paths have changed; not invalidating %s\n", ia.model.distroId)
+			return
+		}
+		if len(paths) > maxInvalidationPaths {
+			// CloudFront will not take this many at once, and it is cheaper to do everything anyway
+			paths = []string{"/*"}
+		}
 	}
 	var lp int32 = int32(len(paths))
+	if ia.plan != nil {
+		ia.plan.Create("aws.CloudFront.Invalidation", ia.model.distroId, plan.Set("Paths", paths))
+		return
+	}
 	pathObj := types.Paths{Quantity: &lp, Items: paths}
 	input := cloudfront.CreateInvalidationInput{DistributionId: &ia.model.distroId, InvalidationBatch: &types.InvalidationBatch{CallerReference: &uniqueId, Paths: &pathObj}}
-	out, err := ia.client.CreateInvalidation(context.TODO(), &input)
+	ctx := env.About(ia.ctx, "aws.CloudFront.Invalidation", ia.model.distroId, nil)
+	out, err := ia.client.CreateInvalidation(ctx, &input)
 	if err != nil {
-		panic(err)
+		ia.tools.Reporter.ReportAtf(ia.loc, "could not invalidate distribution %s: %v", ia.model.distroId, err)
+		return
 	}
 	log.Printf("Created Invalidation List: %s %s\n", *out.Invalidation.Id, *out.Invalidation.Status)
 }
 
+// the most paths that CloudFront allows to be invalidated at once, other than with wildcards
+const maxInvalidationPaths = 3000
+
+// evalPaths works out the paths to invalidate, which may be a single path or a list (such
+// as the changedPaths of a bucket)
+func (ia *invalidateAction) evalPaths() ([]string, bool) {
+	var ret []string
+	switch v := ia.tools.Storage.Eval(ia.paths).(type) {
+	case []string:
+		ret = v
+	case []any:
+		for _, p := range v {
+			s, ok := p.(fmt.Stringer)
+			if !ok {
+				ia.tools.Reporter.ReportAtf(ia.loc, "paths must be strings, not %T", p)
+				return nil, false
+			}
+			ret = append(ret, s.String())
+		}
+	case fmt.Stringer:
+		ret = []string{v.String()}
+	default:
+		ia.tools.Reporter.ReportAtf(ia.loc, "Paths must be a path or a list of paths, not %T", v)
+		return nil, false
+	}
+	for i, p := range ret {
+		if !strings.HasPrefix(p, "/") {
+			ret[i] = "/" + p
+		}
+	}
+	return ret, true
+}
+
 func (ia *invalidateAction) TearDown() {
 }
 
@@ -3,6 +3,7 @@ package cfront
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
@@ -10,6 +11,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type OACCreator struct {
@@ -20,8 +22,11 @@ type OACCreator struct {
 	coin     corebottom.CoinId
 	teardown corebottom.TearDown
 
-	client *cloudfront.Client
-	props  map[driverbottom.Identifier]driverbottom.Expr
+	client  *cloudfront.Client
+	props   map[driverbottom.Identifier]driverbottom.Expr
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (oacc *OACCreator) Loc() *errorsink.Location {
@@ -48,18 +53,22 @@ func (oacc *OACCreator) CoinId() corebottom.CoinId {
 }
 
 func (oacc *OACCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := oacc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(oacc.tools, oacc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	oacc.client = awsEnv.CFClient()
+	oacc.ctx = awsEnv.Context()
+	oacc.timeout = env.ObtainTimeout(oacc.tools, oacc.props)
+	oacc.plan = awsEnv.Plan()
 
 	model := &oacModel{loc: oacc.loc, name: oacc.name, coin: oacc.coin}
 	found := false
-	fred, err := oacc.client.ListOriginAccessControls(context.TODO(), &cloudfront.ListOriginAccessControlsInput{})
+	fred, err := oacc.client.ListOriginAccessControls(oacc.ctx, &cloudfront.ListOriginAccessControlsInput{})
 	if err != nil {
-		log.Fatalf("could not list OACs")
+		oacc.tools.Reporter.ReportAtf(oacc.loc, "could not list OACs: %v", err)
+		return
 	}
 	for _, p := range fred.OriginAccessControlList.Items {
 		if p.Id != nil && p.Name != nil && *p.Name == oacc.name {
@@ -81,6 +90,7 @@ func (oacc *OACCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var sp driverbottom.Expr
 	for p, v := range oacc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "OriginAccessControlOriginType":
 			oacTy = v
 		case "SigningBehavior":
@@ -97,11 +107,18 @@ func (oacc *OACCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (oacc *OACCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(oacc.ctx, oacc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.OriginAccessControl", oacc.name, oacc.coin)
+
 	tmp := oacc.tools.Storage.GetCoin(oacc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*oacModel)
 		log.Printf("OAC %s already existed for %s\n", found.oacId, found.name)
+		if oacc.plan != nil {
+			oacc.plan.NoChange("aws.CloudFront.OriginAccessControl", oacc.name)
+		}
 		return
 	}
 
@@ -113,15 +130,23 @@ func (oacc *OACCreator) UpdateReality() {
 	sbs, ok2 := oacc.tools.Storage.EvalAsStringer(desired.signBehavior)
 	sps, ok3 := oacc.tools.Storage.EvalAsStringer(desired.signProt)
 	if !ok1 || !ok2 || !ok3 {
-		panic("not ok")
+		oacc.tools.Reporter.ReportAtf(oacc.loc, "OAC properties for %s must be strings", oacc.name)
+		return
 	}
 	ty := types.OriginAccessControlOriginTypes(acs.String())
 	sb := types.OriginAccessControlSigningBehaviors(sbs.String())
 	sp := types.OriginAccessControlSigningProtocols(sps.String())
 	oaccfg := types.OriginAccessControlConfig{Name: &oacc.name, OriginAccessControlOriginType: ty, SigningBehavior: sb, SigningProtocol: sp}
-	oac, err := oacc.client.CreateOriginAccessControl(context.TODO(), &cloudfront.CreateOriginAccessControlInput{OriginAccessControlConfig: &oaccfg})
+	if oacc.plan != nil {
+		oacc.plan.Create("aws.CloudFront.OriginAccessControl", oacc.name, plan.Set("OriginAccessControlOriginType", ty), plan.Set("SigningBehavior", sb), plan.Set("SigningProtocol", sp))
+		created.oacId = plan.Placeholder("aws.CloudFront.OriginAccessControl", oacc.name)
+		oacc.tools.Storage.Bind(oacc.coin, created)
+		return
+	}
+	oac, err := oacc.client.CreateOriginAccessControl(ctx, &cloudfront.CreateOriginAccessControlInput{OriginAccessControlConfig: &oaccfg})
 	if err != nil {
-		log.Fatalf("failed to create OAC for %s: %v\n", oacc.name, err)
+		oacc.tools.Reporter.ReportAtf(oacc.loc, "failed to create OAC for %s: %v", oacc.name, err)
+		return
 	}
 	created.oacId = *oac.OriginAccessControl.Id
 	log.Printf("created OAC for %s: %s\n", oacc.name, created.oacId)
@@ -130,18 +155,28 @@ func (oacc *OACCreator) UpdateReality() {
 }
 
 func (oacc *OACCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(oacc.ctx, oacc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.OriginAccessControl", oacc.name, oacc.coin)
+
 	tmp := oacc.tools.Storage.GetCoin(oacc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*oacModel)
 		log.Printf("you have asked to tear down OAC %s (id: %s) with mode %s\n", oacc.name, found.oacId, oacc.teardown.Mode())
-		x, err := oacc.client.GetOriginAccessControl(context.TODO(), &cloudfront.GetOriginAccessControlInput{Id: &found.oacId})
+		if oacc.plan != nil {
+			oacc.plan.Delete("aws.CloudFront.OriginAccessControl", oacc.name)
+			return
+		}
+		x, err := oacc.client.GetOriginAccessControl(ctx, &cloudfront.GetOriginAccessControlInput{Id: &found.oacId})
 		if err != nil {
-			log.Fatalf("could not get OAC %s: %v", found.oacId, err)
+			oacc.tools.Reporter.ReportAtf(oacc.loc, "could not get OAC %s: %v", found.oacId, err)
+			return
 		}
-		_, err = oacc.client.DeleteOriginAccessControl(context.TODO(), &cloudfront.DeleteOriginAccessControlInput{Id: &found.oacId, IfMatch: x.ETag})
+		_, err = oacc.client.DeleteOriginAccessControl(ctx, &cloudfront.DeleteOriginAccessControlInput{Id: &found.oacId, IfMatch: x.ETag})
 		if err != nil {
-			log.Fatalf("could not delete OAC %s: %v", found.oacId, err)
+			oacc.tools.Reporter.ReportAtf(oacc.loc, "could not delete OAC %s: %v", found.oacId, err)
+			return
 		}
 		log.Printf("deleted OAC %s\n", found.oacId)
 	} else {
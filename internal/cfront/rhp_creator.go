@@ -3,6 +3,7 @@ package cfront
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
@@ -10,6 +11,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type RHPCreator struct {
@@ -21,7 +23,10 @@ type RHPCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *cloudfront.Client
+	client  *cloudfront.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (rhpc *RHPCreator) Loc() *errorsink.Location {
@@ -47,24 +52,29 @@ func (rhpc *RHPCreator) CoinId() corebottom.CoinId {
 }
 
 func (rhpc *RHPCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := rhpc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(rhpc.tools, rhpc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	rhpc.client = awsEnv.CFClient()
+	rhpc.ctx = awsEnv.Context()
+	rhpc.timeout = env.ObtainTimeout(rhpc.tools, rhpc.props)
+	rhpc.plan = awsEnv.Plan()
 
-	zeb, err := rhpc.client.ListResponseHeadersPolicies(context.TODO(), &cloudfront.ListResponseHeadersPoliciesInput{})
+	zeb, err := rhpc.client.ListResponseHeadersPolicies(rhpc.ctx, &cloudfront.ListResponseHeadersPoliciesInput{})
 	if err != nil {
-		log.Fatalf("could not list RHPs")
+		rhpc.tools.Reporter.ReportAtf(rhpc.loc, "could not list RHPs: %v", err)
+		return
 	}
 	model := &rhpModel{loc: rhpc.loc, name: rhpc.name, coin: rhpc.coin}
 	found := false
 	for _, p := range zeb.ResponseHeadersPolicyList.Items {
 		if p.ResponseHeadersPolicy.Id != nil {
-			rhc, err := rhpc.client.GetResponseHeadersPolicyConfig(context.TODO(), &cloudfront.GetResponseHeadersPolicyConfigInput{Id: p.ResponseHeadersPolicy.Id})
+			rhc, err := rhpc.client.GetResponseHeadersPolicyConfig(rhpc.ctx, &cloudfront.GetResponseHeadersPolicyConfigInput{Id: p.ResponseHeadersPolicy.Id})
 			if err != nil {
-				log.Fatalf("could not recover RHP %s", *p.ResponseHeadersPolicy.Id)
+				rhpc.tools.Reporter.ReportAtf(rhpc.loc, "could not recover RHP %s: %v", *p.ResponseHeadersPolicy.Id, err)
+				return
 			}
 			if rhc.ResponseHeadersPolicyConfig.Name != nil && *rhc.ResponseHeadersPolicyConfig.Name == rhpc.name {
 				model.rpId = *p.ResponseHeadersPolicy.Id
@@ -86,6 +96,7 @@ func (rhpc *RHPCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var value driverbottom.Expr
 	for p, v := range rhpc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Header":
 			header = v
 		case "Value":
@@ -100,11 +111,18 @@ func (rhpc *RHPCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (rhpc *RHPCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(rhpc.ctx, rhpc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.ResponseHeadersPolicy", rhpc.name, rhpc.coin)
+
 	tmp := rhpc.tools.Storage.GetCoin(rhpc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*rhpModel)
 		log.Printf("RHP %s already existed for %s\n", found.rpId, found.name)
+		if rhpc.plan != nil {
+			rhpc.plan.NoChange("aws.CloudFront.ResponseHeadersPolicy", rhpc.name)
+		}
 		return
 	}
 
@@ -116,7 +134,8 @@ func (rhpc *RHPCreator) UpdateReality() {
 	ov := true
 	vt, ok2 := rhpc.tools.Storage.EvalAsStringer(desired.value)
 	if !ok1 || !ok2 {
-		panic("not ok")
+		rhpc.tools.Reporter.ReportAtf(rhpc.loc, "Header and Value for %s must be strings", rhpc.name)
+		return
 	}
 	h := ht.String()
 	v := vt.String()
@@ -124,9 +143,16 @@ func (rhpc *RHPCreator) UpdateReality() {
 	rhslen := int32(len(rhs))
 	ch := types.ResponseHeadersPolicyCustomHeadersConfig{Items: rhs, Quantity: &rhslen}
 	rhp := types.ResponseHeadersPolicyConfig{Name: &rhpc.name, CustomHeadersConfig: &ch}
-	crhp, err := rhpc.client.CreateResponseHeadersPolicy(context.TODO(), &cloudfront.CreateResponseHeadersPolicyInput{ResponseHeadersPolicyConfig: &rhp})
+	if rhpc.plan != nil {
+		rhpc.plan.Create("aws.CloudFront.ResponseHeadersPolicy", rhpc.name, plan.Set("Header", h+": "+v))
+		created.rpId = plan.Placeholder("aws.CloudFront.ResponseHeadersPolicy", rhpc.name)
+		rhpc.tools.Storage.Bind(rhpc.coin, created)
+		return
+	}
+	crhp, err := rhpc.client.CreateResponseHeadersPolicy(ctx, &cloudfront.CreateResponseHeadersPolicyInput{ResponseHeadersPolicyConfig: &rhp})
 	if err != nil {
-		log.Fatalf("failed to create CRHP %s: %v\n", rhpc.name, err)
+		rhpc.tools.Reporter.ReportAtf(rhpc.loc, "failed to create CRHP %s: %v", rhpc.name, err)
+		return
 	}
 	created.rpId = *crhp.ResponseHeadersPolicy.Id
 	log.Printf("created RHP for %s: %s\n", created.name, created.rpId)
@@ -135,18 +161,28 @@ func (rhpc *RHPCreator) UpdateReality() {
 }
 
 func (rhpc *RHPCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(rhpc.ctx, rhpc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.CloudFront.ResponseHeadersPolicy", rhpc.name, rhpc.coin)
+
 	tmp := rhpc.tools.Storage.GetCoin(rhpc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*rhpModel)
 		log.Printf("you have asked to tear down RHP %s (id: %s) with mode %s\n", found.name, found.rpId, rhpc.teardown.Mode())
-		x, err := rhpc.client.GetResponseHeadersPolicy(context.TODO(), &cloudfront.GetResponseHeadersPolicyInput{Id: &found.rpId})
+		if rhpc.plan != nil {
+			rhpc.plan.Delete("aws.CloudFront.ResponseHeadersPolicy", found.name)
+			return
+		}
+		x, err := rhpc.client.GetResponseHeadersPolicy(ctx, &cloudfront.GetResponseHeadersPolicyInput{Id: &found.rpId})
 		if err != nil {
-			log.Fatalf("could not get RHP %s: %v", found.rpId, err)
+			rhpc.tools.Reporter.ReportAtf(rhpc.loc, "could not get RHP %s: %v", found.rpId, err)
+			return
 		}
-		_, err = rhpc.client.DeleteResponseHeadersPolicy(context.TODO(), &cloudfront.DeleteResponseHeadersPolicyInput{Id: &found.rpId, IfMatch: x.ETag})
+		_, err = rhpc.client.DeleteResponseHeadersPolicy(ctx, &cloudfront.DeleteResponseHeadersPolicyInput{Id: &found.rpId, IfMatch: x.ETag})
 		if err != nil {
-			log.Fatalf("could not delete RHP %s: %v", found.rpId, err)
+			rhpc.tools.Reporter.ReportAtf(rhpc.loc, "could not delete RHP %s: %v", found.rpId, err)
+			return
 		}
 		log.Printf("deleted RHP %s\n", found.rpId)
 	} else {
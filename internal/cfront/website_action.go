@@ -9,6 +9,9 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/s3"
 )
 
 type websiteAction struct {
@@ -47,7 +50,8 @@ func (w *websiteAction) AddAdverb(adv driverbottom.Adverb, tokens []driverbottom
 			panic("invalid tokens")
 		}
 		w.teardown = &CFS3TearDown{mode: tokens[0].(driverbottom.Identifier).Id()}
-
+	} else if adv.Name() == "timeout" {
+		env.TimeoutAdverb(w.tools, w.props, adv, tokens)
 	}
 	return drivertop.NewDisallowInnerScope(w.tools.CoreTools)
 }
@@ -92,19 +96,22 @@ func (w *websiteAction) Resolve(r driverbottom.Resolver) driverbottom.BindingReq
 	getoac := coretop.MakeGetCoinMethod(w.named.Loc(), oaccoin)
 
 	cpcProps := w.useProps(notused, "MinTTL")
+	utils.CopyProps(cpcProps, w.props, notused, "Env", "DeployTimeout")
 	w.coins.cachePolicy = &CachePolicyCreator{tools: w.tools, teardown: teardown, loc: w.loc, coin: cpcoin, name: w.named.Text() + "-cpc", props: cpcProps}
 
 	oacOpts := make(map[driverbottom.Identifier]driverbottom.Expr)
 	oacOpts[drivertop.NewIdentifierToken(w.named.Loc(), "OriginAccessControlOriginType")] = drivertop.MakeString(w.named.Loc(), "s3")
 	oacOpts[drivertop.NewIdentifierToken(w.named.Loc(), "SigningBehavior")] = drivertop.MakeString(w.named.Loc(), "always")
 	oacOpts[drivertop.NewIdentifierToken(w.named.Loc(), "SigningProtocol")] = drivertop.MakeString(w.named.Loc(), "sigv4")
+	utils.CopyProps(oacOpts, w.props, notused, "Env", "DeployTimeout")
 	w.coins.originAccessControl = &OACCreator{tools: w.tools, teardown: teardown, loc: w.loc, coin: oaccoin, name: w.named.Text() + "-oac", props: oacOpts}
 
 	cblist := w.findProp(notused, "CacheBehaviors")
 	cbe := w.tools.Storage.Eval(cblist)
 	cbs, ok := cbe.([]any)
 	if !ok {
-		log.Fatalf("was %T", cbe)
+		w.tools.Reporter.ReportAtf(cblist.Loc(), "CacheBehaviors must be a list, not %T", cbe)
+		return driverbottom.ERROR_OCCURRED
 	}
 	cbcoins := []driverbottom.Expr{}
 	for _, cb := range cbs {
@@ -159,6 +166,7 @@ func (w *websiteAction) Resolve(r driverbottom.Resolver) driverbottom.BindingReq
 		rhpOpts := make(map[driverbottom.Identifier]driverbottom.Expr)
 		rhpOpts[drivertop.NewIdentifierToken(w.named.Loc(), "Header")] = drivertop.MakeString(w.named.Loc(), header)
 		rhpOpts[drivertop.NewIdentifierToken(w.named.Loc(), "Value")] = drivertop.MakeString(w.named.Loc(), value)
+		utils.CopyProps(rhpOpts, w.props, notused, "Env", "DeployTimeout")
 		rhpcoin := corebottom.CoinId(w.tools.Storage.NewObjId(w.named.Loc()))
 		rhp := &RHPCreator{tools: w.tools, teardown: teardown, loc: w.loc, coin: rhpcoin, name: rhpName, props: rhpOpts}
 
@@ -173,7 +181,7 @@ func (w *websiteAction) Resolve(r driverbottom.Resolver) driverbottom.BindingReq
 		cbcoins = append(cbcoins, getcb)
 	}
 
-	dprops := w.useProps(notused, "Certificate", "Comment", "DefaultRoot", "Domain", "TargetOriginId")
+	dprops := w.useProps(notused, "Certificate", "Comment", "DefaultRoot", "Domain", "Env", "TargetOriginId", "DeployTimeout")
 	dprops[drivertop.NewIdentifierToken(w.named.Loc(), "CacheBehaviors")] = drivertop.NewListExpr(w.named.Loc(), cbcoins)
 	dprops[drivertop.NewIdentifierToken(w.named.Loc(), "CachePolicy")] = drivertop.MakeInvokeExpr(getcp, drivertop.NewIdentifierToken(w.named.Loc(), "id"))
 	dprops[drivertop.NewIdentifierToken(w.named.Loc(), "OriginDNS")] = drivertop.MakeInvokeExpr(bucket, drivertop.NewIdentifierToken(w.named.Loc(), "dnsName"))
@@ -242,7 +250,8 @@ func (w *websiteAction) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	bucket := w.tools.Storage.Eval(w.bucket)
 	isBucket, ok := bucket.(corebottom.PolicyAttacher)
 	if !ok {
-		log.Fatalf("%v evaluated to %p, which was not a policy attacher but %T", w.bucket, bucket, bucket)
+		w.tools.Reporter.ReportAtf(w.loc, "%v evaluated to %p, which was not a policy attacher but %T", w.bucket, bucket, bucket)
+		return
 	}
 	w.policyAttacher = isBucket
 
@@ -269,13 +278,22 @@ func (w *websiteAction) UpdateReality() {
 	w.coins.distribution.UpdateReality()
 	// I think we can wait until now to build the actual policy, since its only variable is the distribution id
 
-	w.policyAttacher.Attach(w.makePolicy())
+	policy := w.makePolicy()
+	if policy == nil {
+		return
+	}
+	if owned, ok := w.policyAttacher.(s3.OwnedPolicyAttacher); ok {
+		owned.AttachAs(w.named.Text(), policy)
+		return
+	}
+	w.policyAttacher.Attach(policy)
 }
 
 func (w *websiteAction) makePolicy() corebottom.PolicyDocument {
 	allResources, ok := w.tools.Storage.EvalAsStringer(drivertop.MakeInvokeExpr(w.bucket, drivertop.NewIdentifierToken(w.loc, "allResources")))
 	if !ok {
-		log.Fatalf("allResources failed")
+		w.tools.Reporter.ReportAtf(w.loc, "could not find the resources for %v", w.bucket)
+		return nil
 	}
 	ret := coretop.NewPolicyDocument(w.loc)
 	item := ret.Item("Allow")
@@ -283,9 +301,13 @@ func (w *websiteAction) makePolicy() corebottom.PolicyDocument {
 	item.Resource(allResources.String())
 	item.Principal(coretop.NewPrincipal("Service", "cloudfront.amazonaws.com"))
 
-	distribution := w.tools.Storage.GetCoin(w.coins.distribution.coin, corebottom.UPDATE_REALITY_MODE).(*DistributionModel)
+	sourceArn := "(arn of the new distribution)"
+	// when planning, there is no distribution yet if it would have been created
+	if distribution, ok := w.tools.Storage.GetCoin(w.coins.distribution.coin, corebottom.UPDATE_REALITY_MODE).(*DistributionModel); ok {
+		sourceArn = distribution.arn
+	}
 	expr := map[string]any{}
-	expr["aws:sourceArn"] = distribution.arn
+	expr["aws:sourceArn"] = sourceArn
 	cond := map[string]any{}
 	cond["StringEquals"] = expr
 	item.AMore("Condition", cond)
@@ -13,7 +13,7 @@ func (b *TableBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id c
 }
 
 func (b *TableBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
-	return &tableCreator{tools: tools, loc: loc, name: named}
+	return &tableCreator{tools: tools, loc: loc, coin: id, name: named, props: props}
 }
 
 func (b *TableBlank) Loc() *errorsink.Location {
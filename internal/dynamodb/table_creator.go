@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	ht "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -12,8 +15,8 @@ import (
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
-	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type tableCreator struct {
@@ -25,7 +28,10 @@ type tableCreator struct {
 	teardown corebottom.TearDown
 	props    map[driverbottom.Identifier]driverbottom.Expr
 
-	client *dynamodb.Client
+	client  *dynamodb.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (tc *tableCreator) Loc() *errorsink.Location {
@@ -50,14 +56,21 @@ func (tc *tableCreator) CoinId() corebottom.CoinId {
 func (tc *tableCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	log.Printf("want to find dynamo table %s", tc.name)
 
-	ae := tc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := ae.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(tc.tools, tc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	tc.client = awsEnv.DynamoClient()
+	tc.ctx = awsEnv.Context()
+	tc.timeout = env.ObtainTimeout(tc.tools, tc.props)
+	tc.plan = awsEnv.Plan()
 
-	table := tc.findTableCalled(tc.name)
+	table, err := tc.findTableCalled(tc.ctx, tc.name)
+	if err != nil {
+		tc.tools.Reporter.ReportAtf(tc.loc, "could not describe table %s: %v", tc.name, err)
+		return
+	}
 	if table == nil {
 		log.Printf("no dynamo table found called %s\n", tc.name)
 		pres.NotFound()
@@ -72,10 +85,47 @@ func (tc *tableCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	for k, p := range tc.props {
 		v := tc.tools.Storage.Eval(p)
 		switch k.Id() {
+		case "Env", "DeployTimeout":
+		case "Stream":
+			str, ok := v.(string)
+			if !ok {
+				if sv, isStringer := v.(fmt.Stringer); isStringer {
+					str, ok = sv.String(), true
+				}
+			}
+			if !ok || !slices.Contains(types.StreamViewType("").Values(), types.StreamViewType(str)) {
+				tc.tools.Reporter.ReportAtf(p.Loc(), "Stream must be one of %v", types.StreamViewType("").Values())
+				return
+			}
+			model.streamViewType = types.StreamViewType(str)
+		case "BillingMode":
+			// tables are only ever created on demand, but one that is already provisioned is
+			// only changed if the script says so, since that changes what it costs
+			mode, ok := tc.tools.Storage.EvalAsStringer(p)
+			if !ok || mode.String() != string(types.BillingModePayPerRequest) {
+				tc.tools.Reporter.ReportAtf(p.Loc(), "BillingMode can only be %s", types.BillingModePayPerRequest)
+				return
+			}
+			model.billingMode = types.BillingModePayPerRequest
+		case "ReplaceStream":
+			switch b := v.(type) {
+			case bool:
+				model.replaceStream = b
+			case float64:
+				if b != 0 && b != 1 {
+					tc.tools.Reporter.ReportAtf(p.Loc(), "ReplaceStream must be 0 or 1, not %v", b)
+					return
+				}
+				model.replaceStream = b == 1
+			default:
+				tc.tools.Reporter.ReportAtf(p.Loc(), "ReplaceStream must be 0 or 1, not %T", v)
+				return
+			}
 		case "Fields":
 			list, ok := v.([]any)
 			if !ok {
-				panic("Fields was not a list")
+				tc.tools.Reporter.ReportAtf(p.Loc(), "Fields was not a list")
+				return
 			}
 			for _, le := range list {
 				dfe, ok := le.(*DynamoFieldExpr)
@@ -86,7 +136,8 @@ func (tc *tableCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 						model.keys = append(model.keys, tc.makeKey(dfe))
 					}
 				} else {
-					panic("field was not a *DynamoFieldExpr")
+					tc.tools.Reporter.ReportAtf(p.Loc(), "field was not a *DynamoFieldExpr but %T", le)
+					return
 				}
 			}
 		}
@@ -95,12 +146,16 @@ func (tc *tableCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (tc *tableCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(tc.ctx, tc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.DynamoDB.Table", tc.name, tc.coin)
+
 	tmp := tc.tools.Storage.GetCoin(tc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*tableModel)
 		log.Printf("table %s already existed for %s\n", found.arn, found.name)
-		tc.tools.Storage.Adopt(tc.coin, found)
+		tc.updateTable(ctx, found)
 		return
 	}
 
@@ -109,23 +164,134 @@ func (tc *tableCreator) UpdateReality() {
 	created := NewTableModel(desired.loc, tc.coin)
 	created.name = desired.name
 
+	if tc.plan != nil {
+		tc.plan.Create("aws.DynamoDB.Table", tc.name, plan.Set("BillingMode", types.BillingModePayPerRequest), plan.Set("KeySchema", describeKeys(desired.attrs, desired.keys)), plan.Set("Stream", desired.streamViewType))
+		created.arn = plan.Placeholder("aws.DynamoDB.Table", tc.name)
+		created.streamViewType = desired.streamViewType
+		if desired.streamViewType != "" {
+			created.streamArn = created.arn + "/stream"
+		}
+		tc.tools.Storage.Bind(tc.coin, created)
+		return
+	}
 	input := dynamodb.CreateTableInput{TableName: &created.name, BillingMode: types.BillingModePayPerRequest, AttributeDefinitions: desired.attrs, KeySchema: desired.keys}
-	table, err := tc.client.CreateTable(context.TODO(), &input)
+	if desired.streamViewType != "" {
+		input.StreamSpecification = &types.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: desired.streamViewType}
+	}
+	table, err := tc.client.CreateTable(ctx, &input)
 	if err != nil {
-		log.Printf("failed to create table %s: %v\n", tc.name, err)
-		panic("table creation failed")
+		tc.tools.Reporter.ReportAtf(tc.loc, "failed to create table %s: %v", tc.name, err)
+		return
 	}
 	log.Printf("asked to create table for %s: %s\n", tc.name, *table.TableDescription.TableArn)
 	created.arn = *table.TableDescription.TableArn
+	created.streamViewType = desired.streamViewType
+	created.streamArn = aws.ToString(table.TableDescription.LatestStreamArn)
 
-	utils.ExponentialBackoff(func() bool {
-		return tc.waitForTable(tc.name)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return tc.waitForTable(ctx, tc.name)
 	})
+	if failed != nil {
+		tc.tools.Reporter.ReportAtf(tc.loc, "failed waiting for table %s: %v", tc.name, failed)
+		return
+	}
 
 	log.Printf("created table %s for %s", created.arn, created.name)
 	tc.tools.Storage.Bind(tc.coin, created)
 }
 
+// updateTable compares an existing table with the script.  The keys of a table
+// cannot be changed, so if they are different the table has to be replaced by hand;
+// the billing mode can be changed in place, but only if the script gives one, as can
+// the stream if the table does not have one.  A stream is left alone unless the script asks for one; changing the view
+// type of an existing stream replaces it, losing what was in it, so the script has to
+// say ReplaceStream as well.
+func (tc *tableCreator) updateTable(ctx context.Context, found *tableModel) {
+	desired := tc.tools.Storage.GetCoin(tc.coin, corebottom.DETERMINE_DESIRED_MODE).(*tableModel)
+	foundKeys := describeKeys(found.attrs, found.keys)
+	desiredKeys := describeKeys(desired.attrs, desired.keys)
+	if !slices.Equal(foundKeys, desiredKeys) {
+		if tc.plan != nil {
+			tc.plan.Replace("aws.DynamoDB.Table", tc.name, plan.Compare("KeySchema", foundKeys, desiredKeys))
+			tc.tools.Storage.Adopt(tc.coin, found)
+			return
+		}
+		tc.tools.Reporter.ReportAtf(tc.loc, "cannot change the keys of table %s from %v to %v; it must be deleted and created again", tc.name, foundKeys, desiredKeys)
+		return
+	}
+	changeStream := desired.streamViewType != "" && desired.streamViewType != found.streamViewType
+	replaceStream := changeStream && found.streamViewType != ""
+	if tc.plan != nil {
+		var fields []plan.Field
+		if desired.billingMode != "" {
+			fields = append(fields, plan.Compare("BillingMode", found.billingMode, desired.billingMode))
+		}
+		if desired.streamViewType != "" {
+			fields = append(fields, plan.Compare("Stream", found.streamViewType, desired.streamViewType))
+		}
+		if replaceStream {
+			tc.plan.Replace("aws.DynamoDB.Table", tc.name, fields...)
+		} else {
+			tc.plan.Update("aws.DynamoDB.Table", tc.name, fields...)
+		}
+		tc.tools.Storage.Adopt(tc.coin, found)
+		return
+	}
+	if replaceStream && !desired.replaceStream {
+		tc.tools.Reporter.ReportAtf(tc.loc, "cannot change the stream of table %s from %s to %s without replacing it; say ReplaceStream 1 to allow this", tc.name, found.streamViewType, desired.streamViewType)
+		return
+	}
+	if desired.billingMode != "" && found.billingMode != desired.billingMode {
+		_, err := tc.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{TableName: &tc.name, BillingMode: desired.billingMode})
+		if err != nil {
+			tc.tools.Reporter.ReportAtf(tc.loc, "failed to update billing mode of table %s: %v", tc.name, err)
+			return
+		}
+		failed := env.Backoff(ctx, func() (bool, error) {
+			return tc.waitForActive(ctx, tc.name)
+		})
+		if failed != nil {
+			tc.tools.Reporter.ReportAtf(tc.loc, "failed waiting for table %s to be updated: %v", tc.name, failed)
+			return
+		}
+		log.Printf("changed billing mode of table %s to %s\n", tc.name, desired.billingMode)
+		found.billingMode = desired.billingMode
+	}
+	if changeStream {
+		if err := tc.updateStream(ctx, found, desired.streamViewType); err != nil {
+			tc.tools.Reporter.ReportAtf(tc.loc, "failed to update the stream of table %s: %v", tc.name, err)
+			return
+		}
+		log.Printf("changed the stream of table %s to %s\n", tc.name, found.streamViewType)
+	}
+	tc.tools.Storage.Adopt(tc.coin, found)
+}
+
+// updateStream enables the stream on a table with the given view type; the view type
+// of an existing stream cannot be changed, so it has to be disabled first, which means
+// that the stream will have a new ARN and anything still in the old one is lost
+func (tc *tableCreator) updateStream(ctx context.Context, found *tableModel, viewType types.StreamViewType) error {
+	specs := []*types.StreamSpecification{{StreamEnabled: aws.Bool(true), StreamViewType: viewType}}
+	if found.streamViewType != "" {
+		specs = append([]*types.StreamSpecification{{StreamEnabled: aws.Bool(false)}}, specs...)
+	}
+	for _, spec := range specs {
+		out, err := tc.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{TableName: &tc.name, StreamSpecification: spec})
+		if err != nil {
+			return err
+		}
+		failed := env.Backoff(ctx, func() (bool, error) {
+			return tc.waitForActive(ctx, tc.name)
+		})
+		if failed != nil {
+			return failed
+		}
+		found.streamArn = aws.ToString(out.TableDescription.LatestStreamArn)
+	}
+	found.streamViewType = viewType
+	return nil
+}
+
 func (tc *tableCreator) TearDown() {
 	// tmp := tc.tools.Storage.GetCoin(tc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
@@ -147,22 +313,62 @@ func (tc *tableCreator) TearDown() {
 	// }
 }
 
-func (tc *tableCreator) findTableCalled(name string) *tableModel {
-	table, err := tc.client.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{TableName: &name})
+func (tc *tableCreator) findTableCalled(ctx context.Context, name string) (*tableModel, error) {
+	table, err := tc.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &name})
 	if !tableExists(err) {
-		return nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	model := NewTableModel(tc.loc, tc.coin)
 	model.arn = *table.Table.TableArn
 	model.name = tc.name
-	return model
+	model.attrs = table.Table.AttributeDefinitions
+	model.keys = table.Table.KeySchema
+	// tables which have always been provisioned do not have a summary
+	model.billingMode = types.BillingModeProvisioned
+	if table.Table.BillingModeSummary != nil {
+		model.billingMode = table.Table.BillingModeSummary.BillingMode
+	}
+	if spec := table.Table.StreamSpecification; spec != nil && aws.ToBool(spec.StreamEnabled) {
+		model.streamViewType = spec.StreamViewType
+		model.streamArn = aws.ToString(table.Table.LatestStreamArn)
+	}
+	return model, nil
 }
 
-func (tc *tableCreator) waitForTable(name string) bool {
-	_, err := tc.client.DescribeTable(context.TODO(), &dynamodb.DescribeTableInput{TableName: &name})
-	return tableExists(err)
+func (tc *tableCreator) waitForTable(ctx context.Context, name string) (bool, error) {
+	_, err := tc.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &name})
+	if !tableExists(err) {
+		return false, nil
+	}
+	return true, err
 }
 
+func (tc *tableCreator) waitForActive(ctx context.Context, name string) (bool, error) {
+	table, err := tc.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &name})
+	if err != nil {
+		return true, err
+	}
+	return table.Table.TableStatus == types.TableStatusActive, nil
+}
+
+// describeKeys lists the keys of a table as "name type keytype", in the order AWS has them
+func describeKeys(attrs []types.AttributeDefinition, keys []types.KeySchemaElement) []string {
+	var ret []string
+	for _, k := range keys {
+		ty := types.ScalarAttributeType("")
+		for _, a := range attrs {
+			if *a.AttributeName == *k.AttributeName {
+				ty = a.AttributeType
+			}
+		}
+		ret = append(ret, fmt.Sprintf("%s %s %s", *k.AttributeName, ty, k.KeyType))
+	}
+	return ret
+}
+
+// tableExists is false only for a ResourceNotFoundException
 func tableExists(err error) bool {
 	if err == nil {
 		return true
@@ -170,22 +376,14 @@ func tableExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*ht.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 400 {
-				switch e4 := e2.Err.(type) {
-				case *types.ResourceNotFoundException:
-					return false
-				default:
-					log.Printf("error: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 400 {
+			switch e2.Err.(type) {
+			case *types.ResourceNotFoundException:
+				return false
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting clusters failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
 func (tc *tableCreator) String() string {
@@ -0,0 +1,186 @@
+package dynamodb_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/dynamodb"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+var loc = &errorsink.Location{}
+
+type adverb struct {
+	name string
+}
+
+func (a *adverb) Loc() *errorsink.Location {
+	return loc
+}
+
+func (a *adverb) Name() string {
+	return a.name
+}
+
+type parent struct {
+	value driverbottom.Expr
+}
+
+func (p *parent) AddProperty(name driverbottom.Identifier, value driverbottom.Expr) {
+	p.value = value
+}
+
+// fields reads the Fields of a table as a script would have them, each one
+// given as "name type" or "name type key"
+func fields(h *awstest.Harness, defns ...[]string) driverbottom.Expr {
+	p := &parent{}
+	fi := dynamodb.CreateFieldInterpreter(h.Tools().CoreTools, nil, p, drivertop.NewIdentifierToken(loc, "Fields"), nil)
+	for _, d := range defns {
+		attrs := fi.HaveTokens(nil, []driverbottom.Token{drivertop.NewIdentifierToken(loc, d[0]), drivertop.NewIdentifierToken(loc, d[1])})
+		if len(d) == 3 {
+			attrs.HaveTokens(nil, []driverbottom.Token{&adverb{name: "Key"}, drivertop.NewIdentifierToken(loc, d[2])})
+		}
+	}
+	fi.Completed()
+	return p.value
+}
+
+func TestTableIsKeyedByItsKeyFields(t *testing.T) {
+	h := awstest.New(t)
+	tbl := h.Coin("table")
+	props := h.Props(map[string]any{"Fields": fields(h, []string{"customer", "string", "hash"}, []string{"placed", "number", "range"}, []string{"total", "number"})})
+
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", props)
+	out, err := awsdynamodb.NewFromConfig(h.Fake.Config()).DescribeTable(context.Background(), &awsdynamodb.DescribeTableInput{TableName: aws.String("orders")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, k := range out.Table.KeySchema {
+		keys = append(keys, aws.ToString(k.AttributeName)+" "+string(k.KeyType))
+	}
+	if !slices.Equal(keys, []string{"customer HASH", "placed RANGE"}) {
+		t.Fatalf("table is keyed by %v", keys)
+	}
+
+	h.NextRun()
+	h.Calls()
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", props)
+	if calls := h.Calls(); slices.Contains(calls, "DynamoDB.CreateTable") {
+		t.Fatalf("table already existed: %v", calls)
+	}
+}
+
+func TestTableKeysAreNotChangedInPlace(t *testing.T) {
+	h := awstest.New(t)
+	tbl := h.Coin("table")
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(map[string]any{"Fields": fields(h, []string{"customer", "string", "hash"})}))
+
+	h.NextRun()
+	h.Calls()
+	rekeyed := h.Props(map[string]any{"Fields": fields(h, []string{"order", "string", "hash"})})
+	errs := h.Attempt(&dynamodb.TableBlank{}, tbl, "orders", rekeyed)
+	if len(errs) != 1 || !strings.Contains(errs[0], "cannot change the keys of table orders") {
+		t.Fatalf("changing the keys should have been refused, not %v", errs)
+	}
+	if calls := h.Calls(); slices.Contains(calls, "DynamoDB.UpdateTable") || slices.Contains(calls, "DynamoDB.CreateTable") {
+		t.Fatalf("table should have been left alone: %v", calls)
+	}
+
+	h.NextRun()
+	p := h.PlanOnly()
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", rekeyed)
+	if changes := p.Changes(); len(changes) != 1 || changes[0].Action != plan.Replace {
+		t.Fatalf("changing the keys should be planned as a replacement, not %v", changes)
+	}
+}
+
+func TestStreamIsOnlyReplacedWhenTheScriptSaysSo(t *testing.T) {
+	h := awstest.New(t)
+	tbl := h.Coin("table")
+	props := map[string]any{"Fields": fields(h, []string{"id", "string", "hash"}), "Stream": "NEW_IMAGE"}
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	h.Calls()
+
+	h.NextRun()
+	props["Stream"] = "NEW_AND_OLD_IMAGES"
+	errs := h.Attempt(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	if len(errs) != 1 || !strings.Contains(errs[0], "say ReplaceStream 1") {
+		t.Fatalf("the stream was replaced without asking: %v", errs)
+	}
+	if calls := h.Calls(); slices.Contains(calls, "DynamoDB.UpdateTable") {
+		t.Fatalf("the table was changed: %v", calls)
+	}
+
+	h.NextRun()
+	props["ReplaceStream"] = 1
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	if calls := h.Calls(); !slices.Contains(calls, "DynamoDB.UpdateTable") {
+		t.Fatalf("the stream was not replaced: %v", calls)
+	}
+
+	h.NextRun()
+	p := h.PlanOnly()
+	props["Stream"] = "KEYS_ONLY"
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	if changes := p.Changes(); len(changes) != 1 || changes[0].Action != plan.Replace {
+		t.Fatalf("changing the stream should replace it, not %v", changes)
+	}
+}
+
+func TestBillingModeIsOnlyChangedWhenTheScriptGivesOne(t *testing.T) {
+	h := awstest.New(t)
+	client := awsdynamodb.NewFromConfig(h.Fake.Config())
+	provisioned := func(name string) {
+		_, err := client.CreateTable(context.Background(), &awsdynamodb.CreateTableInput{
+			TableName:             aws.String(name),
+			BillingMode:           types.BillingModeProvisioned,
+			AttributeDefinitions:  []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeS}},
+			KeySchema:             []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+			ProvisionedThroughput: &types.ProvisionedThroughput{ReadCapacityUnits: aws.Int64(5), WriteCapacityUnits: aws.Int64(5)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	provisioned("orders")
+	provisioned("customers")
+	tbl := h.Coin("table")
+	props := map[string]any{"Fields": fields(h, []string{"id", "string", "hash"})}
+	h.Calls()
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	if calls := h.Calls(); slices.Contains(calls, "DynamoDB.UpdateTable") {
+		t.Fatalf("a provisioned table was changed without asking: %v", calls)
+	}
+
+	h.NextRun()
+	props["BillingMode"] = "PAY_PER_REQUEST"
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props))
+	if calls := h.Calls(); !slices.Contains(calls, "DynamoDB.UpdateTable") {
+		t.Fatalf("the billing mode was not changed: %v", calls)
+	}
+
+	h.NextRun()
+	props["BillingMode"] = "PROVISIONED"
+	if errs := h.Attempt(&dynamodb.TableBlank{}, tbl, "orders", h.Props(props)); len(errs) != 1 || !strings.Contains(errs[0], "BillingMode can only be PAY_PER_REQUEST") {
+		t.Fatalf("errors were %v", errs)
+	}
+
+	h.NextRun()
+	props["BillingMode"] = "PAY_PER_REQUEST"
+	p := h.PlanOnly()
+	h.Ensure(&dynamodb.TableBlank{}, tbl, "customers", h.Props(props))
+	if changes := p.Changes(); len(changes) != 1 || changes[0].Action != plan.Update {
+		t.Fatalf("changing the billing mode should be an update, not %v", changes)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
 )
 
 type tableModel struct {
@@ -15,8 +16,18 @@ type tableModel struct {
 	coin corebottom.CoinId
 	arn  string
 
-	attrs []types.AttributeDefinition
-	keys  []types.KeySchemaElement
+	attrs       []types.AttributeDefinition
+	keys        []types.KeySchemaElement
+	billingMode types.BillingMode
+
+	// streamViewType is what goes in the table's stream, if it has one; streamArn is
+	// only known once the table has been created with the stream enabled
+	streamViewType types.StreamViewType
+	streamArn      string
+
+	// replaceStream says that the script allows an existing stream to be replaced by
+	// one with a different view type
+	replaceStream bool
 }
 
 func (c *tableModel) Loc() *errorsink.Location {
@@ -36,10 +47,46 @@ func (c *tableModel) DumpTo(to driverbottom.IndentWriter) {
 
 func (acmc *tableModel) ObtainMethod(name string) driverbottom.Method {
 	switch name {
+	case "streamArn":
+		return &streamArnMethod{}
 	}
 	return nil
 }
 
+// streamArn is the ARN of the table's stream, for lambda event source mappings
+type streamArnMethod struct {
+}
+
+func (a *streamArnMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	model, ok := e.(*tableModel)
+	if !ok {
+		panic(fmt.Sprintf("streamArn can only be called on a table, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	if model.streamArn != "" {
+		return model.streamArn
+	}
+	return getStreamArnLater(s, model.coin)
+}
+
+func getStreamArnLater(s driverbottom.RuntimeStorage, coin corebottom.CoinId) fmt.Stringer {
+	return utils.DeferString(func() string {
+		curr := s.GetCoinFrom(coin, []int{1, 3})
+		if curr == nil {
+			panic("could not find find/create version of " + coin.VarName().Id())
+		}
+
+		currModel := curr.(*tableModel)
+		if currModel.streamArn == "" {
+			panic("table " + currModel.name + " does not have a stream")
+		}
+		return currModel.streamArn
+	})
+}
+
 func NewTableModel(loc *errorsink.Location, coin corebottom.CoinId) *tableModel {
 	return &tableModel{loc: loc, coin: coin}
 }
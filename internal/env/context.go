@@ -0,0 +1,62 @@
+package env
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// DefaultTimeout is how long a coin may spend updating or tearing down reality
+// when it does not have a DeployTimeout property.
+const DefaultTimeout = 30 * time.Minute
+
+// the longest we will leave between two calls in Backoff
+const maxBackoffDelay = 30 * time.Second
+
+var errInterrupted = errors.New("interrupted")
+
+// DeploymentContext returns the context for a whole deployment, which is cancelled
+// by Ctrl-C (or SIGTERM).  After that, the signals are handled as normal again,
+// so a second Ctrl-C will stop the deployer immediately.
+func DeploymentContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		cancel(errInterrupted)
+	}()
+	return ctx
+}
+
+// WithTimeout bounds ctx by timeout, in such a way that Backoff can say how long it waited
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %v", timeout))
+}
+
+// Backoff calls f repeatedly, leaving longer and longer between the calls, until it says
+// it is done or returns an error.
+// If ctx is done first, it returns the reason (e.g. "timed out after 20m0s").
+func Backoff(ctx context.Context, f func() (bool, error)) error {
+	delay := time.Second
+	for {
+		done, err := f()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxBackoffDelay)
+	}
+}
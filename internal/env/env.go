@@ -2,10 +2,10 @@ package env
 
 import (
 	"context"
-	"log"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/acm"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
@@ -19,9 +19,78 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/route53domains"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"ziniki.org/deployer/modules/aws/internal/events"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
+// ConfigLoader builds the aws.Config that an environment's clients are made from.
+// Normally, this is config.LoadDefaultConfig, but tests and offline demos can
+// provide their own to point at an emulator.
+type ConfigLoader func(ctx context.Context, opts ...func(*config.LoadOptions) error) (aws.Config, error)
+
+// FixedConfig returns a ConfigLoader which always uses cfg, apart from honouring
+// any region that has been asked for.
+func FixedConfig(cfg aws.Config) ConfigLoader {
+	return func(ctx context.Context, opts ...func(*config.LoadOptions) error) (aws.Config, error) {
+		var lo config.LoadOptions
+		for _, o := range opts {
+			if err := o(&lo); err != nil {
+				return aws.Config{}, err
+			}
+		}
+		ret := cfg.Copy()
+		if lo.Region != "" {
+			ret.Region = lo.Region
+		}
+		return ret, nil
+	}
+}
+
+// WithHTTPClient returns a ConfigLoader which loads configs with loader, but then sends
+// all their traffic through the client that client makes from each of them (for
+// example, to record it).
+func WithHTTPClient(loader ConfigLoader, client func(aws.Config) aws.HTTPClient) ConfigLoader {
+	return func(ctx context.Context, opts ...func(*config.LoadOptions) error) (aws.Config, error) {
+		cfg, err := loader(ctx, opts...)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.HTTPClient = client(cfg)
+		return cfg, nil
+	}
+}
+
+// Settings describe how to build the clients for an environment.
+// Empty fields leave the SDK defaults in place.
+type Settings struct {
+	Profile     string
+	Region      string
+	AssumeRole  string
+	SessionName string
+
+	// Endpoint overrides the endpoint for every service, and Endpoints overrides
+	// individual services, named as in Services (e.g. "s3")
+	Endpoint  string
+	Endpoints map[string]string
+}
+
+// Services are the names that can be used as keys in Settings.Endpoints
+var Services = []string{"acm", "apigatewayv2", "cloudfront", "dsql", "dynamodb", "ec2", "iam", "lambda", "neptune", "route53", "route53domains", "s3", "sts"}
+
 type AwsEnv struct {
+	ctx      context.Context
+	loader   ConfigLoader
+	settings Settings
+
+	// the environments declared with aws.env "name"; only the default env has these
+	named map[string]*AwsEnv
+
+	// if this is set, nothing is changed; the changes that would have been made are recorded instead
+	plan *plan.Plan
+
+	// if this is set, every change made to AWS is logged to it
+	events *events.Log
+
 	cfg                  aws.Config
 	acmclient            *acm.Client
 	apiGatewayV2Client   *apigatewayv2.Client
@@ -38,25 +107,115 @@ type AwsEnv struct {
 	stsClient            *sts.Client
 }
 
-func (a *AwsEnv) Init() {
+func (a *AwsEnv) Init() error {
+	var opts []func(*config.LoadOptions) error
+	if a.settings.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(a.settings.Profile))
+	}
+	if a.settings.Region != "" {
+		opts = append(opts, config.WithRegion(a.settings.Region))
+	}
 	var err error
-	a.cfg, err = config.LoadDefaultConfig(context.TODO())
+	a.cfg, err = a.loader(a.ctx, opts...)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if a.plan != nil {
+		a.cfg.APIOptions = append(a.cfg.APIOptions, plan.ReadOnly)
 	}
-	a.acmclient = acm.NewFromConfig(a.cfg)
-	a.apiGatewayV2Client = apigatewayv2.NewFromConfig(a.cfg)
-	a.auroraClient = dsql.NewFromConfig(a.cfg)
-	a.cfclient = cloudfront.NewFromConfig(a.cfg)
-	a.dynamoClient = dynamodb.NewFromConfig(a.cfg)
-	a.ec2Client = ec2.NewFromConfig(a.cfg)
-	a.iamclient = iam.NewFromConfig(a.cfg)
-	a.lambdaClient = lambda.NewFromConfig(a.cfg)
-	a.neptuneClient = neptune.NewFromConfig(a.cfg)
-	a.route53client = route53.NewFromConfig(a.cfg)
-	a.route53domainsclient = route53domains.NewFromConfig(a.cfg)
-	a.s3client = s3.NewFromConfig(a.cfg)
-	a.stsClient = sts.NewFromConfig(a.cfg)
+	if a.events != nil {
+		a.cfg.APIOptions = append(a.cfg.APIOptions, a.events.Record)
+	}
+	if a.settings.Endpoint != "" {
+		a.cfg.BaseEndpoint = aws.String(a.settings.Endpoint)
+	}
+	if a.settings.AssumeRole != "" {
+		// the credentials we loaded are only used to assume the role; everything else runs as the role
+		stsClient := sts.NewFromConfig(a.cfg, func(o *sts.Options) { a.override(&o.BaseEndpoint, "sts") })
+		provider := stscreds.NewAssumeRoleProvider(stsClient, a.settings.AssumeRole, func(o *stscreds.AssumeRoleOptions) {
+			if a.settings.SessionName != "" {
+				o.RoleSessionName = a.settings.SessionName
+			}
+		})
+		a.cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	a.acmclient = acm.NewFromConfig(a.cfg, func(o *acm.Options) { a.override(&o.BaseEndpoint, "acm") })
+	a.apiGatewayV2Client = apigatewayv2.NewFromConfig(a.cfg, func(o *apigatewayv2.Options) { a.override(&o.BaseEndpoint, "apigatewayv2") })
+	a.auroraClient = dsql.NewFromConfig(a.cfg, func(o *dsql.Options) { a.override(&o.BaseEndpoint, "dsql") })
+	a.cfclient = cloudfront.NewFromConfig(a.cfg, func(o *cloudfront.Options) { a.override(&o.BaseEndpoint, "cloudfront") })
+	a.dynamoClient = dynamodb.NewFromConfig(a.cfg, func(o *dynamodb.Options) { a.override(&o.BaseEndpoint, "dynamodb") })
+	a.ec2Client = ec2.NewFromConfig(a.cfg, func(o *ec2.Options) { a.override(&o.BaseEndpoint, "ec2") })
+	a.iamclient = iam.NewFromConfig(a.cfg, func(o *iam.Options) { a.override(&o.BaseEndpoint, "iam") })
+	a.lambdaClient = lambda.NewFromConfig(a.cfg, func(o *lambda.Options) { a.override(&o.BaseEndpoint, "lambda") })
+	a.neptuneClient = neptune.NewFromConfig(a.cfg, func(o *neptune.Options) { a.override(&o.BaseEndpoint, "neptune") })
+	a.route53client = route53.NewFromConfig(a.cfg, func(o *route53.Options) { a.override(&o.BaseEndpoint, "route53") })
+	a.route53domainsclient = route53domains.NewFromConfig(a.cfg, func(o *route53domains.Options) { a.override(&o.BaseEndpoint, "route53domains") })
+	a.s3client = s3.NewFromConfig(a.cfg, func(o *s3.Options) {
+		a.override(&o.BaseEndpoint, "s3")
+		// emulators don't generally do virtual-host style buckets
+		o.UsePathStyle = o.BaseEndpoint != nil
+	})
+	a.stsClient = sts.NewFromConfig(a.cfg, func(o *sts.Options) { a.override(&o.BaseEndpoint, "sts") })
+	return nil
+}
+
+func (a *AwsEnv) override(endpoint **string, service string) {
+	if ep, ok := a.settings.Endpoints[service]; ok {
+		*endpoint = aws.String(ep)
+	}
+}
+
+// Configure replaces the settings for this environment and rebuilds all the clients.
+func (a *AwsEnv) Configure(settings Settings) error {
+	a.settings = settings
+	return a.Init()
+}
+
+// Define returns the environment called name, creating it with the default settings
+// (and so with clients that can be used straight away) if it does not yet exist.
+func (a *AwsEnv) Define(name string) (*AwsEnv, error) {
+	if ret, ok := a.named[name]; ok {
+		return ret, nil
+	}
+	ret := &AwsEnv{ctx: a.ctx, loader: a.loader, plan: a.plan, events: a.events}
+	if err := ret.Init(); err != nil {
+		return nil, err
+	}
+	a.named[name] = ret
+	return ret, nil
+}
+
+func (a *AwsEnv) Named(name string) (*AwsEnv, bool) {
+	ret, ok := a.named[name]
+	return ret, ok
+}
+
+// PlanOnly makes this environment (and all the ones it defines) read-only: rather than
+// changing anything, the creators record what they would have done in p.
+func (a *AwsEnv) PlanOnly(p *plan.Plan) error {
+	a.plan = p
+	return a.Init()
+}
+
+// LogEvents makes this environment (and all the ones it defines) log every call it makes
+// which changes AWS to l.
+func (a *AwsEnv) LogEvents(l *events.Log) error {
+	a.events = l
+	return a.Init()
+}
+
+// Plan is where to record changes instead of making them; it is nil unless PlanOnly has been called.
+func (a *AwsEnv) Plan() *plan.Plan {
+	return a.plan
+}
+
+// Context is the context for the whole deployment, which is cancelled if the user interrupts it.
+func (a *AwsEnv) Context() context.Context {
+	return a.ctx
+}
+
+func (a *AwsEnv) Region() string {
+	return a.cfg.Region
 }
 
 func (a *AwsEnv) ACMClient() *acm.Client {
@@ -111,8 +270,17 @@ func (a *AwsEnv) STSClient() *sts.Client {
 	return a.stsClient
 }
 
-func InitAwsEnv() *AwsEnv {
-	ret := &AwsEnv{}
-	ret.Init()
-	return ret
+func InitAwsEnv() (*AwsEnv, error) {
+	return InitAwsEnvWith(DeploymentContext(), config.LoadDefaultConfig)
+}
+
+// InitAwsEnvWith creates the default environment using loader to obtain its configuration;
+// named environments will use the same loader.
+// All the AWS operations in the deployment are carried out within ctx.
+func InitAwsEnvWith(ctx context.Context, loader ConfigLoader) (*AwsEnv, error) {
+	ret := &AwsEnv{ctx: ctx, loader: loader, named: make(map[string]*AwsEnv)}
+	if err := ret.Init(); err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
@@ -0,0 +1,206 @@
+package env
+
+import (
+	"log"
+	"slices"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+)
+
+// envAction configures the aws.AwsEnv driver from the script.
+// Without a name, it configures the default environment; with a name, it
+// declares another environment which coins can select with an Env property.
+// It needs to come before any of the targets that use AWS, since they
+// obtain their clients during DetermineInitialState.
+type envAction struct {
+	tools *corebottom.Tools
+	loc   *errorsink.Location
+
+	name        driverbottom.Expr
+	profile     driverbottom.Expr
+	region      driverbottom.Expr
+	assumeRole  driverbottom.Expr
+	sessionName driverbottom.Expr
+	endpoint    driverbottom.Expr
+	endpoints   driverbottom.Expr
+}
+
+func (ea *envAction) Loc() *errorsink.Location {
+	return ea.loc
+}
+
+func (ea *envAction) ShortDescription() string {
+	if ea.name == nil {
+		return "EnvAction[]"
+	}
+	return "EnvAction[" + ea.name.String() + "]"
+}
+
+func (ea *envAction) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("EnvAction")
+	iw.AttrsWhere(ea)
+	if ea.name != nil {
+		iw.NestedAttr("name", ea.name)
+	}
+	if ea.profile != nil {
+		iw.NestedAttr("profile", ea.profile)
+	}
+	if ea.region != nil {
+		iw.NestedAttr("region", ea.region)
+	}
+	if ea.assumeRole != nil {
+		iw.NestedAttr("assumeRole", ea.assumeRole)
+	}
+	if ea.sessionName != nil {
+		iw.NestedAttr("sessionName", ea.sessionName)
+	}
+	if ea.endpoint != nil {
+		iw.NestedAttr("endpoint", ea.endpoint)
+	}
+	if ea.endpoints != nil {
+		iw.NestedAttr("endpoints", ea.endpoints)
+	}
+	iw.EndAttrs()
+}
+
+func (ea *envAction) AddAdverb(adv driverbottom.Adverb, tokens []driverbottom.Token) driverbottom.Interpreter {
+	ea.tools.Reporter.ReportAtf(adv.Loc(), "aws.env does not accept adverbs")
+	return drivertop.NewIgnoreInnerScope()
+}
+
+func (ea *envAction) AddProperty(name driverbottom.Identifier, value driverbottom.Expr) {
+	var slot *driverbottom.Expr
+	switch name.Id() {
+	case "Profile":
+		slot = &ea.profile
+	case "Region":
+		slot = &ea.region
+	case "AssumeRole":
+		slot = &ea.assumeRole
+	case "SessionName":
+		slot = &ea.sessionName
+	case "Endpoint":
+		slot = &ea.endpoint
+	case "Endpoints":
+		slot = &ea.endpoints
+	default:
+		ea.tools.Reporter.ReportAtf(name.Loc(), "aws.env does not have a parameter %s", name.Id())
+		return
+	}
+	if *slot != nil {
+		ea.tools.Reporter.ReportAtf(name.Loc(), "duplicate definition of %s", name.Id())
+		return
+	}
+	*slot = value
+}
+
+func (ea *envAction) Completed() {
+	if ea.sessionName != nil && ea.assumeRole == nil {
+		ea.tools.Reporter.ReportAtf(ea.sessionName.Loc(), "SessionName requires AssumeRole")
+	}
+}
+
+func (ea *envAction) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	for _, e := range []driverbottom.Expr{ea.name, ea.profile, ea.region, ea.assumeRole, ea.sessionName, ea.endpoint, ea.endpoints} {
+		if e != nil {
+			e.Resolve(r)
+		}
+	}
+	return driverbottom.MAY_BE_BOUND
+}
+
+func (ea *envAction) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := NamedEnv(ea.tools, nil)
+	if ea.name != nil {
+		name, ok := ea.evalString(ea.name)
+		if !ok {
+			return
+		}
+		defined, err := awsEnv.Define(name)
+		if err != nil {
+			ea.tools.Reporter.ReportAtf(ea.loc, "could not define aws env %s: %v", name, err)
+			return
+		}
+		awsEnv = defined
+	}
+
+	profile, ok1 := ea.evalString(ea.profile)
+	region, ok2 := ea.evalString(ea.region)
+	role, ok3 := ea.evalString(ea.assumeRole)
+	session, ok4 := ea.evalString(ea.sessionName)
+	endpoint, ok5 := ea.evalString(ea.endpoint)
+	endpoints, ok6 := ea.evalEndpoints()
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || !ok6 {
+		return
+	}
+
+	settings := Settings{Profile: profile, Region: region, AssumeRole: role, SessionName: session, Endpoint: endpoint, Endpoints: endpoints}
+	if err := awsEnv.Configure(settings); err != nil {
+		ea.tools.Reporter.ReportAtf(ea.loc, "could not configure aws env %s: %v", ea.describe(), err)
+		return
+	}
+	log.Printf("configured aws env %s: profile %q region %s role %q\n", ea.describe(), settings.Profile, awsEnv.Region(), settings.AssumeRole)
+}
+
+func (ea *envAction) evalEndpoints() (map[string]string, bool) {
+	if ea.endpoints == nil {
+		return nil, true
+	}
+	m, ok := ea.tools.Storage.Eval(ea.endpoints).(map[string]any)
+	if !ok {
+		ea.tools.Reporter.ReportAtf(ea.endpoints.Loc(), "Endpoints must be a map of service name to url")
+		return nil, false
+	}
+	ret := make(map[string]string)
+	for k, v := range m {
+		if !slices.Contains(Services, k) {
+			ea.tools.Reporter.ReportAtf(ea.endpoints.Loc(), "there is no service %s; use one of %v", k, Services)
+			return nil, false
+		}
+		url, ok := utils.AsStringer(v)
+		if !ok {
+			ea.tools.Reporter.ReportAtf(ea.endpoints.Loc(), "the endpoint for %s must be a string", k)
+			return nil, false
+		}
+		ret[k] = url.String()
+	}
+	return ret, true
+}
+
+func (ea *envAction) describe() string {
+	if ea.name == nil {
+		return "default"
+	}
+	return ea.name.String()
+}
+
+func (ea *envAction) evalString(e driverbottom.Expr) (string, bool) {
+	if e == nil {
+		return "", true
+	}
+	s, ok := ea.tools.Storage.EvalAsStringer(e)
+	if !ok {
+		ea.tools.Reporter.ReportAtf(e.Loc(), "must be a string value")
+		return "", false
+	}
+	return s.String(), true
+}
+
+func (ea *envAction) DetermineDesiredState(pres corebottom.ValuePresenter) {
+}
+
+func (ea *envAction) ShouldDestroy() bool {
+	return false
+}
+
+func (ea *envAction) UpdateReality() {
+}
+
+func (ea *envAction) TearDown() {
+}
+
+var _ corebottom.RealityShifter = &envAction{}
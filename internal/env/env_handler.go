@@ -0,0 +1,34 @@
+package env
+
+import (
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+)
+
+type envHandler struct {
+	tools *corebottom.Tools
+}
+
+func (eh *envHandler) Handle(attacher driverbottom.AttachResult, scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	var name driverbottom.Expr
+
+	if len(tokens) > 1 {
+		var ok bool
+		name, ok = eh.tools.Parser.Parse(scope, tokens[1:])
+		if !ok {
+			return drivertop.NewIgnoreInnerScope()
+		}
+	}
+
+	ea := &envAction{tools: eh.tools, loc: tokens[0].Loc(), name: name}
+	if err := attacher.Attach(ea); err != nil {
+		panic(err)
+	}
+
+	return drivertop.NewPropertiesInnerScope(eh.tools.CoreTools, ea)
+}
+
+func NewEnvHandler(tools *corebottom.Tools) driverbottom.VerbCommand {
+	return &envHandler{tools: tools}
+}
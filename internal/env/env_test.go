@@ -0,0 +1,144 @@
+package env_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+func emulator(t *testing.T, saw *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*saw = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testConfig() aws.Config {
+	return aws.Config{Region: "us-east-1", Credentials: credentials.NewStaticCredentialsProvider("test", "test", "")}
+}
+
+func TestFixedConfigHonoursRegion(t *testing.T) {
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(testConfig()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	if err := awsEnv.Configure(env.Settings{Region: "eu-west-2"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	if awsEnv.Region() != "eu-west-2" {
+		t.Fatalf("region was %s", awsEnv.Region())
+	}
+}
+
+func TestServiceEndpointUsesPathStyle(t *testing.T) {
+	var saw string
+	srv := emulator(t, &saw)
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(testConfig()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	if err := awsEnv.Configure(env.Settings{Endpoints: map[string]string{"s3": srv.URL}}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+
+	_, err = awsEnv.S3Client().HeadBucket(awsEnv.Context(), &s3.HeadBucketInput{Bucket: aws.String("my-bucket")})
+	if err != nil {
+		t.Fatalf("head bucket failed: %v", err)
+	}
+	if saw != "/my-bucket" {
+		t.Fatalf("request went to %s", saw)
+	}
+}
+
+func TestGlobalEndpoint(t *testing.T) {
+	var saw string
+	srv := emulator(t, &saw)
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(testConfig()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	if err := awsEnv.Configure(env.Settings{Endpoint: srv.URL}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+
+	_, err = awsEnv.S3Client().HeadBucket(awsEnv.Context(), &s3.HeadBucketInput{Bucket: aws.String("other")})
+	if err != nil {
+		t.Fatalf("head bucket failed: %v", err)
+	}
+	if saw != "/other" {
+		t.Fatalf("request went to %s", saw)
+	}
+}
+
+func TestPlanningRefusesChanges(t *testing.T) {
+	fake := fakeaws.New()
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(fake.Config()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	if err := awsEnv.PlanOnly(plan.New(nil)); err != nil {
+		t.Fatalf("plan only failed: %v", err)
+	}
+	// environments defined after planning starts plan too, and can be used before they are configured
+	other, err := awsEnv.Define("other")
+	if err != nil {
+		t.Fatalf("define failed: %v", err)
+	}
+
+	for _, e := range []*env.AwsEnv{awsEnv, other} {
+		_, err := e.S3Client().CreateBucket(e.Context(), &s3.CreateBucketInput{Bucket: aws.String("my-bucket")})
+		if err == nil || !strings.Contains(err.Error(), "S3.CreateBucket is not allowed while planning") {
+			t.Fatalf("create bucket gave %v", err)
+		}
+		_, err = e.S3Client().HeadBucket(e.Context(), &s3.HeadBucketInput{Bucket: aws.String("my-bucket")})
+		if err == nil || strings.Contains(err.Error(), "planning") {
+			t.Fatalf("head bucket gave %v", err)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 2 || calls[0] != "S3.HeadBucket" {
+		t.Fatalf("calls were %v", calls)
+	}
+}
+
+func TestBackoffGivesUpAtTimeout(t *testing.T) {
+	ctx, cancel := env.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	err := env.Backoff(ctx, func() (bool, error) {
+		calls++
+		return false, nil
+	})
+	if err == nil || err.Error() != "timed out after 50ms" {
+		t.Fatalf("error was %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("f was called %d times", calls)
+	}
+}
+
+func TestBackoffStopsOnError(t *testing.T) {
+	ctx, cancel := env.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	failed := errors.New("failed")
+	err := env.Backoff(ctx, func() (bool, error) {
+		return false, failed
+	})
+	if err != failed {
+		t.Fatalf("error was %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package env
+
+import (
+	"context"
+	"time"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/events"
+)
+
+// ObtainEnv finds the environment a coin should talk to: the one named by its
+// Env property, if it has one, or else the default environment.
+// If the Env cannot be found, an error is reported and nil is returned.
+// Since this is where Env is used, creators skip it when they read their other properties.
+func ObtainEnv(tools *corebottom.Tools, props map[driverbottom.Identifier]driverbottom.Expr) *AwsEnv {
+	return NamedEnv(tools, utils.FindProp(props, nil, "Env"))
+}
+
+// NamedEnv finds the environment whose name is the value of expr; if expr is nil, it is the default environment.
+func NamedEnv(tools *corebottom.Tools, expr driverbottom.Expr) *AwsEnv {
+	eq := tools.Recall.ObtainDriver("aws.AwsEnv")
+	awsEnv, ok := eq.(*AwsEnv)
+	if !ok {
+		panic("could not cast env to AwsEnv")
+	}
+	if expr == nil {
+		return awsEnv
+	}
+
+	name, ok := tools.Storage.EvalAsStringer(expr)
+	if !ok {
+		tools.Reporter.ReportAtf(expr.Loc(), "Env must be a string")
+		return nil
+	}
+	ret, ok := awsEnv.Named(name.String())
+	if !ok {
+		tools.Reporter.ReportAtf(expr.Loc(), "there is no aws.env called %s", name.String())
+		return nil
+	}
+	return ret
+}
+
+// ObtainTimeout finds how long a coin may spend updating or tearing down reality:
+// the value of its DeployTimeout property (e.g. "20m"), if it has one, or else DefaultTimeout.
+// If the DeployTimeout is not a valid duration, an error is reported and DefaultTimeout is used.
+// As with Env, creators skip DeployTimeout when they read their other properties.
+func ObtainTimeout(tools *corebottom.Tools, props map[driverbottom.Identifier]driverbottom.Expr) time.Duration {
+	expr := utils.FindProp(props, nil, "DeployTimeout")
+	if expr == nil {
+		return DefaultTimeout
+	}
+
+	s, ok := tools.Storage.EvalAsStringer(expr)
+	if !ok {
+		tools.Reporter.ReportAtf(expr.Loc(), "DeployTimeout must be a string")
+		return DefaultTimeout
+	}
+	ret, err := time.ParseDuration(s.String())
+	if err != nil || ret <= 0 {
+		tools.Reporter.ReportAtf(expr.Loc(), "DeployTimeout must be a duration such as 20m, not %s", s.String())
+		return DefaultTimeout
+	}
+	return ret
+}
+
+// TimeoutAdverb reads "@timeout 20m" on one of the actions of this module into the
+// DeployTimeout property that the action passes on to each of the coins it creates.
+func TimeoutAdverb(tools *corebottom.Tools, props map[driverbottom.Identifier]driverbottom.Expr, adv driverbottom.Adverb, tokens []driverbottom.Token) {
+	if len(tokens) != 1 {
+		tools.Reporter.ReportAtf(adv.Loc(), "@timeout <duration>")
+		return
+	}
+	var text string
+	switch t := tokens[0].(type) {
+	case driverbottom.String:
+		text = t.Text()
+	case driverbottom.Identifier:
+		text = t.Id()
+	default:
+		tools.Reporter.ReportAtf(tokens[0].Loc(), "@timeout must be a duration such as 20m")
+		return
+	}
+	if utils.FindProp(props, nil, "DeployTimeout") != nil {
+		tools.Reporter.ReportAtf(adv.Loc(), "cannot have both @timeout and DeployTimeout")
+		return
+	}
+	props[drivertop.NewIdentifierToken(adv.Loc(), "DeployTimeout")] = drivertop.MakeString(tokens[0].Loc(), text)
+}
+
+// About says which resource the AWS calls made with the returned context are for, so
+// that any changes they make can be logged against it.
+func About(ctx context.Context, kind, name string, coin corebottom.CoinId) context.Context {
+	r := events.Resource{Kind: kind, Name: name}
+	if coin != nil && coin.VarName() != nil {
+		r.Coin = coin.VarName().Id()
+	}
+	return events.About(ctx, r)
+}
@@ -0,0 +1,142 @@
+// Package events records every change that the module makes to AWS as a line of
+// JSON, so that dashboards and audit tools can see what a deployment did without
+// having to read its log.
+//
+// The events are written by middleware in the AWS clients, so that nothing which
+// changes AWS can be missed; the creators say which resource they are working on
+// by putting it in the context they make their calls with (see About).
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// A Resource is what a call to AWS is being made for, e.g. the aws.S3.Bucket "my-bucket"
+// which is bound to the coin "bucket".  The Name is what identifies it in AWS, so it is
+// what the events for it are logged against.
+type Resource struct {
+	Kind string
+	Name string
+	Coin string
+}
+
+// An Event is a single call which changed (or tried to change) something in AWS
+type Event struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Coin      string    `json:"coin,omitempty"`
+	Service   string    `json:"service"`
+	Operation string    `json:"operation"`
+	Action    string    `json:"action"`
+	RequestId string    `json:"requestId,omitempty"`
+	Duration  int64     `json:"durationMs"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type resourceKey struct{}
+
+// About returns a context which says that the calls made with it are for r
+func About(ctx context.Context, r Resource) context.Context {
+	return context.WithValue(ctx, resourceKey{}, r)
+}
+
+// A Log writes events to a stream, one per line
+type Log struct {
+	mu   sync.Mutex
+	out  io.Writer
+	path string
+}
+
+// New creates a log which writes to out
+func New(out io.Writer) *Log {
+	return &Log{out: out}
+}
+
+// Open creates a log which adds to the file at path, creating it if necessary.
+// The file is opened for each event and closed again, so that nothing has to be
+// done at the end of a run for the events to be kept, however the run ends.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path}, f.Close()
+}
+
+// Record is an API option which logs every call a client makes that could change AWS
+func (l *Log) Record(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("eventLog", l.observe), middleware.Before)
+}
+
+func (l *Log) observe(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := middleware.GetServiceID(ctx)
+	op := middleware.GetOperationName(ctx)
+	if !plan.Mutates(service, op) {
+		return next.HandleInitialize(ctx, in)
+	}
+
+	start := time.Now()
+	out, md, err := next.HandleInitialize(ctx, in)
+	if errors.Is(err, plan.ErrPlanning) {
+		// it was refused before it was sent, so nothing was changed or attempted
+		return out, md, err
+	}
+	r, _ := ctx.Value(resourceKey{}).(Resource)
+	ev := Event{Time: start.UTC(), Kind: r.Kind, Name: r.Name, Coin: r.Coin, Service: service, Operation: op, Action: actionOf(op), Duration: time.Since(start).Milliseconds(), Outcome: "ok"}
+	ev.RequestId, _ = awsmiddleware.GetRequestIDMetadata(md)
+	if err != nil {
+		ev.Outcome = "failed"
+		ev.Error = err.Error()
+	}
+	l.write(ev)
+	return out, md, err
+}
+
+func (l *Log) write(ev Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the log is a by-product: failing to write it should not stop the deployment
+	bs, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	bs = append(bs, '\n')
+	if l.path == "" {
+		l.out.Write(bs)
+		return
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	f.Write(bs)
+	f.Close()
+}
+
+// actionOf says what an operation does to a resource, going by its name
+func actionOf(op string) string {
+	for _, p := range []string{"Create", "Request", "Publish", "Add"} {
+		if strings.HasPrefix(op, p) {
+			return "create"
+		}
+	}
+	for _, p := range []string{"Delete", "Remove", "Detach"} {
+		if strings.HasPrefix(op, p) {
+			return "delete"
+		}
+	}
+	return "update"
+}
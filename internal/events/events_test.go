@@ -0,0 +1,90 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"ziniki.org/deployer/modules/aws/internal/events"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+func TestOnlyChangesAreLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log := events.New(&buf)
+	cfg := fakeaws.New().Config()
+	cfg.APIOptions = append(cfg.APIOptions, log.Record)
+	client := iam.NewFromConfig(cfg)
+
+	ctx := events.About(context.Background(), events.Resource{Kind: "aws.IAM.Role", Name: "lambda-role", Coin: "role"})
+	if _, err := client.CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("lambda-role"), AssumeRolePolicyDocument: aws.String("{}")}); err != nil {
+		t.Fatalf("create role failed: %v", err)
+	}
+	if _, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String("lambda-role")}); err != nil {
+		t.Fatalf("get role failed: %v", err)
+	}
+	if _, err := client.DeleteRole(context.Background(), &iam.DeleteRoleInput{RoleName: aws.String("other")}); err == nil {
+		t.Fatalf("deleting a missing role worked")
+	}
+
+	dec := json.NewDecoder(&buf)
+	var created, deleted events.Event
+	if err := dec.Decode(&created); err != nil {
+		t.Fatalf("could not decode first event: %v", err)
+	}
+	if err := dec.Decode(&deleted); err != nil {
+		t.Fatalf("could not decode second event: %v", err)
+	}
+	if dec.More() {
+		t.Fatalf("more than two events were logged")
+	}
+
+	if created.Kind != "aws.IAM.Role" || created.Name != "lambda-role" || created.Coin != "role" || created.Operation != "CreateRole" || created.Action != "create" || created.Outcome != "ok" {
+		t.Fatalf("create event was %+v", created)
+	}
+	if deleted.Kind != "" || deleted.Action != "delete" || deleted.Outcome != "failed" || deleted.Error == "" {
+		t.Fatalf("delete event was %+v", deleted)
+	}
+}
+
+func TestChangesRefusedWhilePlanningAreNotLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log := events.New(&buf)
+	cfg := fakeaws.New().Config()
+	cfg.APIOptions = append(cfg.APIOptions, plan.ReadOnly, log.Record)
+	client := iam.NewFromConfig(cfg)
+
+	if _, err := client.CreateRole(context.Background(), &iam.CreateRoleInput{RoleName: aws.String("lambda-role"), AssumeRolePolicyDocument: aws.String("{}")}); err == nil {
+		t.Fatalf("create role was not refused")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("refused call was logged: %s", buf.String())
+	}
+}
+
+func TestEventsAreInTheFileAsSoonAsTheyHappen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	log, err := events.Open(path)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	cfg := fakeaws.New().Config()
+	cfg.APIOptions = append(cfg.APIOptions, log.Record)
+	client := iam.NewFromConfig(cfg)
+
+	ctx := events.About(context.Background(), events.Resource{Kind: "aws.IAM.Role", Name: "lambda-role", Coin: "role"})
+	if _, err := client.CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("lambda-role"), AssumeRolePolicyDocument: aws.String("{}")}); err != nil {
+		t.Fatalf("create role failed: %v", err)
+	}
+	bs, _ := os.ReadFile(path)
+	var ev events.Event
+	if err := json.Unmarshal(bs, &ev); err != nil || ev.Name != "lambda-role" || ev.Action != "create" {
+		t.Fatalf("file had %s: %v", bs, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/env"
 	"ziniki.org/deployer/modules/aws/internal/lambda"
 )
 
@@ -50,6 +51,8 @@ func (a *apiAction) AddAdverb(adv driverbottom.Adverb, tokens []driverbottom.Tok
 			panic("invalid tokens")
 		}
 		a.teardown = &ApiTearDown{mode: tokens[0].(driverbottom.Identifier).Id()}
+	} else if adv.Name() == "timeout" {
+		env.TimeoutAdverb(a.tools, a.props, adv, tokens)
 	} else {
 		a.tools.Reporter.ReportAtf(adv.Loc(), "there is no adverb %s", adv.Name())
 	}
@@ -86,7 +89,7 @@ func (a *apiAction) Completed() {
 	apiCoin := corebottom.CoinId(a.tools.Storage.PendingObjId(a.named.Loc()))
 
 	// First create the Api itself
-	funcProps := utils.UseProps(a.props, notused, "IpAddressType", "Protocol", "RouteSelectionExpression")
+	funcProps := utils.UseProps(a.props, notused, "Env", "IpAddressType", "Protocol", "RouteSelectionExpression", "DeployTimeout")
 	ac := &apiCreator{tools: a.tools, teardown: a.teardown, loc: a.loc, coin: apiCoin, name: a.named.Text(), props: funcProps}
 	a.creators = append(a.creators, ac)
 
@@ -98,58 +101,67 @@ func (a *apiAction) Completed() {
 	integrationId := drivertop.NewIdentifierToken(a.named.Loc(), "integrationId")
 	region := drivertop.MakeString(a.named.Loc(), "us-east-1")
 	invokePerm := drivertop.MakeString(a.named.Loc(), "lambda:InvokeFunction")
+	envExpr := utils.FindProp(a.props, nil, "Env")
 
 	for _, i := range a.intgs {
 		name, ok := a.tools.Storage.EvalAsStringer(i.name)
 		if !ok {
-			panic("not ok")
+			a.tools.Reporter.ReportAtf(i.name.Loc(), "integration name must be a string")
+			return
 		}
 
 		// create the integration itself
 		i.coin = corebottom.CoinId(a.tools.Storage.PendingObjId(i.name.Loc()))
 		i.props[apiId] = drivertop.MakeInvokeExpr(getApi, arnId)
 		i.props[regionId] = region
+		utils.CopyProps(i.props, a.props, notused, "Env", "DeployTimeout")
 		ic := &integrationCreator{tools: a.tools, loc: i.name.Loc(), name: name.String(), coin: i.coin, props: i.props, teardown: a.teardown}
 		a.creators = append(a.creators, ic)
 
 		// add the invocation permission for the lambda
 		principal := coretop.NewPolicyPrincipalAction(a.tools, i.name.Loc(), drivertop.MakeString(i.name.Loc(), "Service"), drivertop.MakeString(i.name.Loc(), "apigateway.amazonaws.com"))
 		allowExection := coretop.NewPolicyAllowAction(a.tools, i.name.Loc(), []driverbottom.Expr{invokePerm}, []driverbottom.Expr{utils.FindProp(i.props, nil, "Uri")}, []corebottom.UpdatePolicyAllowAction{principal})
-		alp := lambda.AddLambdaPermissionsAction(a.tools, i.name.Loc(), i.name, []corebottom.PolicyRuleAction{allowExection})
+		alp := lambda.AddLambdaPermissionsAction(a.tools, i.name.Loc(), i.name, envExpr, []corebottom.PolicyRuleAction{allowExection})
 		a.creators = append(a.creators, alp)
 	}
 
 	for _, r := range a.routes {
 		path, ok := a.tools.Storage.EvalAsStringer(r.route)
 		if !ok {
-			panic("not ok")
+			a.tools.Reporter.ReportAtf(r.route.Loc(), "route must be a string")
+			return
 		}
 		intg, ok := a.tools.Storage.EvalAsStringer(r.integration)
 		if !ok {
-			panic("not ok")
+			a.tools.Reporter.ReportAtf(r.integration.Loc(), "route integration must be a string")
+			return
 		}
 
 		rcoin := corebottom.CoinId(a.tools.Storage.PendingObjId(r.route.Loc()))
 		rc := &routeCreator{tools: a.tools, loc: r.route.Loc(), path: path.String(), coin: rcoin, props: make(map[driverbottom.Identifier]driverbottom.Expr), teardown: a.teardown}
 		rc.props[apiId] = drivertop.MakeInvokeExpr(getApi, arnId)
 		rc.props[targetId] = drivertop.MakeInvokeExpr(a.getIntegrationCoin(r.integration.Loc(), intg.String()), integrationId)
+		utils.CopyProps(rc.props, a.props, notused, "Env", "DeployTimeout")
 		a.creators = append(a.creators, rc)
 	}
 
 	for _, s := range a.stages {
 		name, ok := a.tools.Storage.EvalAsStringer(s.name)
 		if !ok {
-			panic("not ok")
+			a.tools.Reporter.ReportAtf(s.name.Loc(), "stage name must be a string")
+			return
 		}
 
 		scoin := corebottom.CoinId(a.tools.Storage.PendingObjId(s.name.Loc()))
 		sc := &stageCreator{tools: a.tools, loc: s.name.Loc(), name: name.String(), coin: scoin, props: make(map[driverbottom.Identifier]driverbottom.Expr), teardown: a.teardown}
 		sc.props[apiId] = drivertop.MakeInvokeExpr(getApi, arnId)
+		utils.CopyProps(sc.props, a.props, notused, "Env", "DeployTimeout")
 		a.creators = append(a.creators, sc)
 
 		dcoin := corebottom.CoinId(a.tools.Storage.PendingObjId(s.name.Loc()))
 		dc := &deploymentCreator{tools: a.tools, loc: s.name.Loc(), name: name.String(), coin: dcoin, props: make(map[driverbottom.Identifier]driverbottom.Expr), teardown: a.teardown}
 		dc.props[apiId] = drivertop.MakeInvokeExpr(getApi, arnId)
+		utils.CopyProps(dc.props, a.props, notused, "Env", "DeployTimeout")
 		a.creators = append(a.creators, dc)
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	hterr "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 
@@ -14,6 +15,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type apiCreator struct {
@@ -25,7 +27,10 @@ type apiCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (ac *apiCreator) Loc() *errorsink.Location {
@@ -47,20 +52,24 @@ func (ac *apiCreator) CoinId() corebottom.CoinId {
 }
 
 func (ac *apiCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := ac.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(ac.tools, ac.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	ac.client = awsEnv.ApiGatewayV2Client()
+	ac.ctx = awsEnv.Context()
+	ac.timeout = env.ObtainTimeout(ac.tools, ac.props)
+	ac.plan = awsEnv.Plan()
 
 	var nextTok *string
 	var wanted *types.Api
 outer:
 	for {
-		curr, err := ac.client.GetApis(context.TODO(), &apigatewayv2.GetApisInput{NextToken: nextTok})
+		curr, err := ac.client.GetApis(ac.ctx, &apigatewayv2.GetApisInput{NextToken: nextTok})
 		if err != nil {
-			log.Fatalf("could not recover api list: %v\n", err)
+			ac.tools.Reporter.ReportAtf(ac.loc, "could not recover api list: %v", err)
+			return
 		}
 		for _, api := range curr.Items {
 			if *api.Name == ac.name {
@@ -88,6 +97,7 @@ func (ac *apiCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var rse driverbottom.Expr
 	for p, v := range ac.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "IpAddressType":
 			dualstack = v
 		case "Protocol":
@@ -106,7 +116,8 @@ func (ac *apiCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	if dualstack != nil {
 		ipat, ok := ac.tools.Storage.EvalAsStringer(dualstack)
 		if !ok {
-			panic("not ok")
+			ac.tools.Reporter.ReportAtf(ac.loc, "IpAddressType must be a string")
+			return
 		}
 
 		switch ipat.String() {
@@ -122,7 +133,8 @@ func (ac *apiCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 
 	prot, ok := ac.tools.Storage.EvalAsStringer(protocol)
 	if !ok {
-		panic("not ok")
+		ac.tools.Reporter.ReportAtf(ac.loc, "Protocol must be a string")
+		return
 	}
 
 	var pt types.ProtocolType
@@ -144,7 +156,8 @@ func (ac *apiCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	if rse != nil {
 		route, ok = ac.tools.Storage.EvalAsStringer(rse)
 		if !ok {
-			panic("not ok")
+			ac.tools.Reporter.ReportAtf(ac.loc, "RouteSelectionExpression must be a string")
+			return
 		}
 	}
 
@@ -153,6 +166,10 @@ func (ac *apiCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (ac *apiCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(ac.ctx, ac.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Api", ac.name, ac.coin)
+
 	tmp := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_DESIRED_MODE).(*ApiModel)
 	created := &ApiAWSModel{}
@@ -168,9 +185,22 @@ func (ac *apiCreator) UpdateReality() {
 		if desired.ipat != "" {
 			input.IpAddressType = desired.ipat
 		}
-		out, err := ac.client.UpdateApi(context.TODO(), input)
+		if ac.plan != nil {
+			var fields []plan.Field
+			if input.RouteSelectionExpression != nil {
+				fields = append(fields, plan.Compare("RouteSelectionExpression", found.api.RouteSelectionExpression, input.RouteSelectionExpression))
+			}
+			if input.IpAddressType != "" {
+				fields = append(fields, plan.Compare("IpAddressType", found.api.IpAddressType, input.IpAddressType))
+			}
+			ac.plan.Update("aws.ApiGatewayV2.Api", ac.name, fields...)
+			ac.tools.Storage.Adopt(ac.coin, found)
+			return
+		}
+		out, err := ac.client.UpdateApi(ctx, input)
 		if err != nil {
-			log.Fatalf("failed to update api %s: %v\n", ac.name, err)
+			ac.tools.Reporter.ReportAtf(ac.loc, "failed to update api %s: %v", ac.name, err)
+			return
 		}
 		created.api = &types.Api{Name: out.Name, ApiId: out.ApiId, ApiEndpoint: out.ApiEndpoint}
 		log.Printf("updated api %s for %s\n", *found.api.ApiId, *found.api.Name)
@@ -188,9 +218,17 @@ func (ac *apiCreator) UpdateReality() {
 	if desired.ipat != "" {
 		input.IpAddressType = desired.ipat
 	}
-	out, err := ac.client.CreateApi(context.TODO(), input)
+	if ac.plan != nil {
+		ac.plan.Create("aws.ApiGatewayV2.Api", ac.name, plan.Set("ProtocolType", input.ProtocolType), plan.Set("RouteSelectionExpression", input.RouteSelectionExpression), plan.Set("IpAddressType", input.IpAddressType))
+		placeholder := plan.Placeholder("aws.ApiGatewayV2.Api", ac.name)
+		created.api = &types.Api{Name: &ac.name, ApiId: &placeholder, ApiEndpoint: &placeholder}
+		ac.tools.Storage.Bind(ac.coin, created)
+		return
+	}
+	out, err := ac.client.CreateApi(ctx, input)
 	if err != nil {
-		log.Fatalf("failed to create api %s: %v\n", ac.name, err)
+		ac.tools.Reporter.ReportAtf(ac.loc, "failed to create api %s: %v", ac.name, err)
+		return
 	}
 	log.Printf("created api %s %s\n", *out.ApiId, *out.ApiEndpoint)
 	created.api = &types.Api{Name: out.Name, ApiId: out.ApiId, ApiEndpoint: out.ApiEndpoint}
@@ -198,21 +236,31 @@ func (ac *apiCreator) UpdateReality() {
 }
 
 func (ac *apiCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(ac.ctx, ac.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Api", ac.name, ac.coin)
+
 	tmp := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*ApiAWSModel)
 		log.Printf("you have asked to tear down api %s with mode %s\n", ac.name, ac.teardown.Mode())
+		if ac.plan != nil {
+			ac.plan.Delete("aws.ApiGatewayV2.Api", ac.name)
+			return
+		}
 
-		_, err := ac.client.DeleteApi(context.TODO(), &apigatewayv2.DeleteApiInput{ApiId: found.api.ApiId})
+		_, err := ac.client.DeleteApi(ctx, &apigatewayv2.DeleteApiInput{ApiId: found.api.ApiId})
 		if err != nil {
-			log.Fatalf("failed to delete api %s: %v\n", ac.name, err)
+			ac.tools.Reporter.ReportAtf(ac.loc, "failed to delete api %s: %v", ac.name, err)
+			return
 		}
 	} else {
 		log.Printf("no api existed called %s\n", ac.name)
 	}
 }
 
+// thingExists is false only for a 404 NotFoundException
 func thingExists(err error) bool {
 	if err == nil {
 		return true
@@ -220,22 +268,14 @@ func thingExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*hterr.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				switch e4 := e2.Err.(type) {
-				case *types.NotFoundException:
-					return false
-				default:
-					log.Printf("error: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			switch e2.Err.(type) {
+			case *types.NotFoundException:
+				return false
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting thing failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
 var _ corebottom.Ensurable = &apiCreator{}
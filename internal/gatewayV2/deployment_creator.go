@@ -3,14 +3,15 @@ package gatewayV2
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
-	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type deploymentCreator struct {
@@ -22,7 +23,10 @@ type deploymentCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (sc *deploymentCreator) Loc() *errorsink.Location {
@@ -45,12 +49,15 @@ func (sc *deploymentCreator) CoinId() corebottom.CoinId {
 }
 
 func (sc *deploymentCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := sc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(sc.tools, sc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	sc.client = awsEnv.ApiGatewayV2Client()
+	sc.ctx = awsEnv.Context()
+	sc.timeout = env.ObtainTimeout(sc.tools, sc.props)
+	sc.plan = awsEnv.Plan()
 
 	// Because there is no useful information about the deployment, there is nothing we can do
 	pres.NotFound()
@@ -60,6 +67,7 @@ func (sc *deploymentCreator) DetermineDesiredState(pres corebottom.ValuePresente
 	var api driverbottom.Expr
 	for p, v := range sc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Api":
 			api = v
 		default:
@@ -73,7 +81,8 @@ func (sc *deploymentCreator) DetermineDesiredState(pres corebottom.ValuePresente
 
 	apiStr, ok := sc.tools.Storage.EvalAsStringer(api)
 	if !ok {
-		panic("not ok")
+		sc.tools.Reporter.ReportAtf(sc.loc, "Api must be a string")
+		return
 	}
 
 	model := &DeploymentModel{name: sc.name, loc: sc.loc, coin: sc.coin, api: apiStr}
@@ -81,24 +90,40 @@ func (sc *deploymentCreator) DetermineDesiredState(pres corebottom.ValuePresente
 }
 
 func (sc *deploymentCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(sc.ctx, sc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Deployment", sc.name, sc.coin)
+
 	desired := sc.tools.Storage.GetCoin(sc.coin, corebottom.DETERMINE_DESIRED_MODE).(*DeploymentModel)
 	created := &DeploymentAWSModel{}
 	apiId := desired.api.String()
 
+	if sc.plan != nil {
+		sc.plan.Create("aws.ApiGatewayV2.Deployment", sc.name, plan.Set("ApiId", apiId))
+		created.name = sc.name
+		created.deploymentId = plan.Placeholder("aws.ApiGatewayV2.Deployment", sc.name)
+		sc.tools.Storage.Bind(sc.coin, created)
+		return
+	}
 	input := &apigatewayv2.CreateDeploymentInput{ApiId: &apiId, StageName: &sc.name}
-	out, err := sc.client.CreateDeployment(context.TODO(), input)
+	out, err := sc.client.CreateDeployment(ctx, input)
 	if err != nil {
-		log.Fatalf("failed to create api deployment %s: %v\n", sc.name, err)
+		sc.tools.Reporter.ReportAtf(sc.loc, "failed to create api deployment %s: %v", sc.name, err)
+		return
 	}
 	id := *out.DeploymentId
-	utils.ExponentialBackoff(func() bool {
-		out, err := sc.client.GetDeployment(context.TODO(), &apigatewayv2.GetDeploymentInput{ApiId: &apiId, DeploymentId: &id})
+	failed := env.Backoff(ctx, func() (bool, error) {
+		out, err := sc.client.GetDeployment(ctx, &apigatewayv2.GetDeploymentInput{ApiId: &apiId, DeploymentId: &id})
 		if err != nil {
-			panic(err)
+			return false, err
 		}
 		log.Printf("have status %s\n", out.DeploymentStatus)
-		return out.DeploymentStatus == types.DeploymentStatusDeployed
+		return out.DeploymentStatus == types.DeploymentStatusDeployed, nil
 	})
+	if failed != nil {
+		sc.tools.Reporter.ReportAtf(sc.loc, "could not recover status of api deployment %s: %v", sc.name, failed)
+		return
+	}
 	created.name = sc.name
 	created.deploymentId = *out.DeploymentId
 	sc.tools.Storage.Bind(sc.coin, created)
@@ -0,0 +1,86 @@
+package gatewayV2_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"ziniki.org/deployer/modules/aws/internal/gatewayV2"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestRouteTargetsItsIntegration(t *testing.T) {
+	h := awstest.New(t)
+	api := h.Coin("api")
+	integ := h.Coin("integ")
+	route := h.Coin("route")
+	apiProps := h.Props(map[string]any{"Protocol": "http"})
+	integProps := h.Props(map[string]any{"Api": h.Get(api, "id"), "Region": "us-east-1", "Type": "aws_proxy", "Uri": "arn:aws:lambda:us-east-1:123456789012:function:orders", "PayloadFormatVersion": "2.0"})
+	routeProps := h.Props(map[string]any{"Api": h.Get(api, "id"), "Target": h.Get(integ, "integrationId")})
+
+	h.Ensure(&gatewayV2.ApiBlank{}, api, "orders", apiProps)
+	h.Ensure(&gatewayV2.IntegrationBlank{}, integ, "orders-lambda", integProps)
+	h.Ensure(&gatewayV2.RouteBlank{}, route, "GET /orders", routeProps)
+
+	apiId, keys, ok := h.Fake.Api("orders")
+	if !ok || len(keys) != 1 || keys[0] != "GET /orders" {
+		t.Fatalf("api should have the one route GET /orders, not %v", keys)
+	}
+	client := apigatewayv2.NewFromConfig(h.Fake.Config())
+	integs, err := client.GetIntegrations(context.Background(), &apigatewayv2.GetIntegrationsInput{ApiId: &apiId})
+	if err != nil || len(integs.Items) != 1 {
+		t.Fatalf("api should have one integration: %v", err)
+	}
+	routes, err := client.GetRoutes(context.Background(), &apigatewayv2.GetRoutesInput{ApiId: &apiId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "integrations/" + aws.ToString(integs.Items[0].IntegrationId)
+	if got := aws.ToString(routes.Items[0].Target); got != want {
+		t.Fatalf("route targets %q, not %q", got, want)
+	}
+
+	h.NextRun()
+	h.Determine(&gatewayV2.ApiBlank{}, api, "orders", apiProps)
+	h.Determine(&gatewayV2.IntegrationBlank{}, integ, "orders-lambda", integProps)
+	h.TearDown(&gatewayV2.RouteBlank{}, route, "GET /orders", routeProps)
+	if _, keys, _ := h.Fake.Api("orders"); len(keys) != 0 {
+		t.Fatalf("route was not deleted: %v", keys)
+	}
+}
+
+func TestStageDescriptionIsUpdated(t *testing.T) {
+	h := awstest.New(t)
+	api := h.Coin("api")
+	stage := h.Coin("stage")
+	apiProps := h.Props(map[string]any{"Protocol": "http"})
+	deploy := func(description string) {
+		h.Ensure(&gatewayV2.ApiBlank{}, api, "orders", apiProps)
+		h.Ensure(&gatewayV2.StageBlank{}, stage, "live", h.Props(map[string]any{"Api": h.Get(api, "id"), "Description": description}))
+	}
+	description := func() string {
+		apiId, _, _ := h.Fake.Api("orders")
+		out, err := apigatewayv2.NewFromConfig(h.Fake.Config()).GetStage(context.Background(), &apigatewayv2.GetStageInput{ApiId: &apiId, StageName: aws.String("live")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aws.ToString(out.Description)
+	}
+
+	deploy("first")
+	if got := description(); got != "first" {
+		t.Fatalf("stage was created with description %q", got)
+	}
+
+	h.NextRun()
+	h.Calls()
+	deploy("second")
+	if calls := h.Calls(); slices.Contains(calls, "ApiGatewayV2.CreateStage") || slices.Contains(calls, "ApiGatewayV2.DeleteStage") {
+		t.Fatalf("stage should have been updated in place: %v", calls)
+	}
+	if got := description(); got != "second" {
+		t.Fatalf("stage has description %q", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
@@ -13,6 +14,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type integrationCreator struct {
@@ -24,7 +26,10 @@ type integrationCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (ic *integrationCreator) Loc() *errorsink.Location {
@@ -46,12 +51,15 @@ func (ic *integrationCreator) CoinId() corebottom.CoinId {
 }
 
 func (ic *integrationCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := ic.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(ic.tools, ic.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	ic.client = awsEnv.ApiGatewayV2Client()
+	ic.ctx = awsEnv.Context()
+	ic.timeout = env.ObtainTimeout(ic.tools, ic.props)
+	ic.plan = awsEnv.Plan()
 
 	if !utils.HasProp(ic.props, "Api") {
 		pres.NotFound()
@@ -66,18 +74,25 @@ func (ic *integrationCreator) DetermineInitialState(pres corebottom.ValuePresent
 		return
 	}
 	if !ok {
-		panic("not ok")
+		ic.tools.Reporter.ReportAtf(ic.loc, "Api must be a string")
+		return
 	}
 	apiId := apiStr.String()
+	if plan.IsPlaceholder(apiId) {
+		// the api is only planned, so nothing can have been added to it yet
+		pres.NotFound()
+		return
+	}
 
 	var nextTok *string
 	var wanted *types.Integration
 	dname := fmt.Sprintf("zd[%s]", ic.name)
 outer:
 	for {
-		curr, err := ic.client.GetIntegrations(context.TODO(), &apigatewayv2.GetIntegrationsInput{ApiId: &apiId, NextToken: nextTok})
+		curr, err := ic.client.GetIntegrations(ic.ctx, &apigatewayv2.GetIntegrationsInput{ApiId: &apiId, NextToken: nextTok})
 		if err != nil {
-			log.Fatalf("could not recover integration list: %v\n", err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "could not recover integration list: %v", err)
+			return
 		}
 		for _, intg := range curr.Items {
 			if intg.Description != nil && *intg.Description == dname {
@@ -111,6 +126,7 @@ func (ic *integrationCreator) DetermineDesiredState(pres corebottom.ValuePresent
 	var uri driverbottom.Expr
 	for p, v := range ic.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Description":
 			ic.tools.Reporter.ReportAtf(ic.loc, "Description is not allowed for Integration because we use it for Name")
 		case "Api":
@@ -150,26 +166,30 @@ func (ic *integrationCreator) DetermineDesiredState(pres corebottom.ValuePresent
 
 	apiStr, ok := ic.tools.Storage.EvalAsStringer(api)
 	if !ok {
-		panic("not ok")
+		ic.tools.Reporter.ReportAtf(ic.loc, "Api must be a string")
+		return
 	}
 
 	var pfvStr fmt.Stringer = nil
 	if pfv != nil {
 		pfvStr, ok = ic.tools.Storage.EvalAsStringer(pfv)
 		if !ok {
-			panic("not ok")
+			ic.tools.Reporter.ReportAtf(ic.loc, "PayloadFormatVersion must be a string")
+			return
 		}
 
 	}
 
 	regionStr, ok := ic.tools.Storage.EvalAsStringer(region)
 	if !ok {
-		panic("not ok")
+		ic.tools.Reporter.ReportAtf(ic.loc, "Region must be a string")
+		return
 	}
 
 	typeStr, ok := ic.tools.Storage.EvalAsStringer(itype)
 	if !ok {
-		panic("not ok")
+		ic.tools.Reporter.ReportAtf(ic.loc, "Type must be a string")
+		return
 	}
 
 	_, ok = ic.tools.Storage.EvalAsStringer(uri)
@@ -181,14 +201,16 @@ func (ic *integrationCreator) DetermineDesiredState(pres corebottom.ValuePresent
 	if connType != nil {
 		cType, ok = ic.tools.Storage.EvalAsStringer(connType)
 		if !ok {
-			panic("not ok")
+			ic.tools.Reporter.ReportAtf(ic.loc, "ConnectionType must be a string")
+			return
 		}
 	}
 	var cId fmt.Stringer
 	if connId != nil {
 		cId, ok = ic.tools.Storage.EvalAsStringer(connId)
 		if !ok {
-			panic("not ok")
+			ic.tools.Reporter.ReportAtf(ic.loc, "ConnectionId must be a string")
+			return
 		}
 	}
 
@@ -197,6 +219,10 @@ func (ic *integrationCreator) DetermineDesiredState(pres corebottom.ValuePresent
 }
 
 func (ic *integrationCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(ic.ctx, ic.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Integration", ic.name, ic.coin)
+
 	tmp := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_DESIRED_MODE).(*IntegrationModel)
 	apiId := desired.api.String()
@@ -219,7 +245,8 @@ func (ic *integrationCreator) UpdateReality() {
 	}
 	uriStr, ok := ic.tools.Storage.EvalAsStringer(desired.uri)
 	if !ok {
-		panic("not ok")
+		ic.tools.Reporter.ReportAtf(ic.loc, "Uri must be a string")
+		return
 	}
 	uri := uriStr.String()
 
@@ -237,9 +264,19 @@ func (ic *integrationCreator) UpdateReality() {
 		log.Printf("integration already existed for %s: %s\n", ic.name, *found.integration.IntegrationId)
 
 		input := &apigatewayv2.UpdateIntegrationInput{Description: &dname, ApiId: &apiId, IntegrationId: found.integration.IntegrationId, IntegrationType: types.IntegrationType(itype), IntegrationUri: &uri, PayloadFormatVersion: pfv}
-		out, err := ic.client.UpdateIntegration(context.TODO(), input)
+		if ic.plan != nil {
+			ic.plan.Update("aws.ApiGatewayV2.Integration", ic.name,
+				plan.Compare("Description", found.integration.Description, dname),
+				plan.Compare("IntegrationType", found.integration.IntegrationType, itype),
+				plan.Compare("IntegrationUri", found.integration.IntegrationUri, uri),
+				plan.Compare("PayloadFormatVersion", found.integration.PayloadFormatVersion, pfv))
+			ic.tools.Storage.Adopt(ic.coin, found)
+			return
+		}
+		out, err := ic.client.UpdateIntegration(ctx, input)
 		if err != nil {
-			log.Fatalf("failed to update api integration %s: %v\n", ic.name, err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "failed to update api integration %s: %v", ic.name, err)
+			return
 		}
 
 		log.Printf("updated api integration %s\n", *out.IntegrationId)
@@ -255,9 +292,16 @@ func (ic *integrationCreator) UpdateReality() {
 	if desired.connId != nil {
 		input.ConnectionId = aws.String(desired.connType.String())
 	}
-	out, err := ic.client.CreateIntegration(context.TODO(), input)
+	if ic.plan != nil {
+		ic.plan.Create("aws.ApiGatewayV2.Integration", ic.name, plan.Set("ApiId", apiId), plan.Set("IntegrationType", itype), plan.Set("IntegrationUri", uri), plan.Set("PayloadFormatVersion", pfv), plan.Set("ConnectionType", input.ConnectionType))
+		created.integration = &types.Integration{IntegrationId: aws.String(plan.Placeholder("aws.ApiGatewayV2.Integration", ic.name))}
+		ic.tools.Storage.Bind(ic.coin, created)
+		return
+	}
+	out, err := ic.client.CreateIntegration(ctx, input)
 	if err != nil {
-		log.Fatalf("failed to create api integration %s: %v\n", ic.name, err)
+		ic.tools.Reporter.ReportAtf(ic.loc, "failed to create api integration %s: %v", ic.name, err)
+		return
 	}
 	log.Printf("created api integration %s\n", *out.IntegrationId)
 	created.integration = &types.Integration{IntegrationId: out.IntegrationId}
@@ -265,6 +309,10 @@ func (ic *integrationCreator) UpdateReality() {
 }
 
 func (ic *integrationCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(ic.ctx, ic.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Integration", ic.name, ic.coin)
+
 	tmp := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_DESIRED_MODE).(*IntegrationModel)
 
@@ -272,10 +320,15 @@ func (ic *integrationCreator) TearDown() {
 	if tmp != nil {
 		found := tmp.(*IntegrationAWSModel)
 		log.Printf("you have asked to tear down api integration %s with mode %s\n", ic.name, ic.teardown.Mode())
+		if ic.plan != nil {
+			ic.plan.Delete("aws.ApiGatewayV2.Integration", ic.name)
+			return
+		}
 
-		_, err := ic.client.DeleteIntegration(context.TODO(), &apigatewayv2.DeleteIntegrationInput{ApiId: &apiId, IntegrationId: found.integration.IntegrationId})
+		_, err := ic.client.DeleteIntegration(ctx, &apigatewayv2.DeleteIntegrationInput{ApiId: &apiId, IntegrationId: found.integration.IntegrationId})
 		if err != nil {
-			log.Fatalf("failed to delete integration %s: %v\n", ic.name, err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "failed to delete integration %s: %v", ic.name, err)
+			return
 		}
 	} else {
 		log.Printf("no api integration existed called %s for api %s\n", ic.name, apiId)
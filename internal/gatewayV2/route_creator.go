@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
@@ -12,6 +13,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type routeCreator struct {
@@ -23,7 +25,10 @@ type routeCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (rc *routeCreator) Loc() *errorsink.Location {
@@ -46,12 +51,15 @@ func (rc *routeCreator) CoinId() corebottom.CoinId {
 }
 
 func (rc *routeCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := rc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(rc.tools, rc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	rc.client = awsEnv.ApiGatewayV2Client()
+	rc.ctx = awsEnv.Context()
+	rc.timeout = env.ObtainTimeout(rc.tools, rc.props)
+	rc.plan = awsEnv.Plan()
 
 	if !utils.HasProp(rc.props, "Api") {
 		pres.NotFound()
@@ -65,17 +73,24 @@ func (rc *routeCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 		return
 	}
 	if !ok {
-		panic("not ok")
+		rc.tools.Reporter.ReportAtf(rc.loc, "Api must be a string")
+		return
 	}
 	apiId := apiStr.String()
+	if plan.IsPlaceholder(apiId) {
+		// the api is only planned, so nothing can have been added to it yet
+		pres.NotFound()
+		return
+	}
 
 	var nextTok *string
 	var wanted *types.Route
 outer:
 	for {
-		curr, err := rc.client.GetRoutes(context.TODO(), &apigatewayv2.GetRoutesInput{ApiId: &apiId, NextToken: nextTok})
+		curr, err := rc.client.GetRoutes(rc.ctx, &apigatewayv2.GetRoutesInput{ApiId: &apiId, NextToken: nextTok})
 		if err != nil {
-			log.Fatalf("could not recover route list: %v\n", err)
+			rc.tools.Reporter.ReportAtf(rc.loc, "could not recover route list: %v", err)
+			return
 		}
 		for _, rt := range curr.Items {
 			if *rt.RouteKey == rc.path {
@@ -104,6 +119,7 @@ func (rc *routeCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var target driverbottom.Expr
 	for p, v := range rc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Api":
 			api = v
 		case "Target":
@@ -123,12 +139,14 @@ func (rc *routeCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 
 	apiStr, ok := rc.tools.Storage.EvalAsStringer(api)
 	if !ok {
-		panic("not ok")
+		rc.tools.Reporter.ReportAtf(rc.loc, "Api must be a string")
+		return
 	}
 
 	targetStr, ok := rc.tools.Storage.EvalAsStringer(target)
 	if !ok {
-		panic("not ok")
+		rc.tools.Reporter.ReportAtf(rc.loc, "Target must be a string")
+		return
 	}
 
 	model := &RouteModel{path: rc.path, loc: rc.loc, coin: rc.coin, api: apiStr, target: targetStr}
@@ -136,6 +154,10 @@ func (rc *routeCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (rc *routeCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(rc.ctx, rc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Route", rc.path, rc.coin)
+
 	tmp := rc.tools.Storage.GetCoin(rc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := rc.tools.Storage.GetCoin(rc.coin, corebottom.DETERMINE_DESIRED_MODE).(*RouteModel)
 	created := &RouteAWSModel{}
@@ -145,6 +167,9 @@ func (rc *routeCreator) UpdateReality() {
 
 		log.Printf("route already existed for %s: %s\n", rc.path, found.routeId)
 		log.Printf("not handling diffs yet; just copying ...")
+		if rc.plan != nil {
+			rc.plan.NoChange("aws.ApiGatewayV2.Route", rc.path)
+		}
 		rc.tools.Storage.Bind(rc.coin, created)
 		return
 	}
@@ -152,10 +177,17 @@ func (rc *routeCreator) UpdateReality() {
 	apiId := desired.api.String()
 	tgt := fmt.Sprintf("integrations/%s", desired.target.String())
 
+	if rc.plan != nil {
+		rc.plan.Create("aws.ApiGatewayV2.Route", rc.path, plan.Set("ApiId", apiId), plan.Set("Target", tgt))
+		created.routeId = plan.Placeholder("aws.ApiGatewayV2.Route", rc.path)
+		rc.tools.Storage.Bind(rc.coin, created)
+		return
+	}
 	input := &apigatewayv2.CreateRouteInput{ApiId: &apiId, RouteKey: &rc.path, Target: &tgt}
-	out, err := rc.client.CreateRoute(context.TODO(), input)
+	out, err := rc.client.CreateRoute(ctx, input)
 	if err != nil {
-		log.Fatalf("failed to create api route %s: %v\n", rc.path, err)
+		rc.tools.Reporter.ReportAtf(rc.loc, "failed to create api route %s: %v", rc.path, err)
+		return
 	}
 	log.Printf("created api route %s\n", *out.RouteId)
 	created.routeId = *out.RouteId
@@ -164,6 +196,10 @@ func (rc *routeCreator) UpdateReality() {
 }
 
 func (rc *routeCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(rc.ctx, rc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Route", rc.path, rc.coin)
+
 	tmp := rc.tools.Storage.GetCoin(rc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := rc.tools.Storage.GetCoin(rc.coin, corebottom.DETERMINE_DESIRED_MODE).(*RouteModel)
 
@@ -171,10 +207,15 @@ func (rc *routeCreator) TearDown() {
 	if tmp != nil {
 		found := tmp.(*RouteAWSModel)
 		log.Printf("you have asked to tear down api route %s with mode %s\n", rc.path, rc.teardown.Mode())
+		if rc.plan != nil {
+			rc.plan.Delete("aws.ApiGatewayV2.Route", rc.path)
+			return
+		}
 
-		_, err := rc.client.DeleteRoute(context.TODO(), &apigatewayv2.DeleteRouteInput{ApiId: &apiId, RouteId: &found.routeId})
+		_, err := rc.client.DeleteRoute(ctx, &apigatewayv2.DeleteRouteInput{ApiId: &apiId, RouteId: &found.routeId})
 		if err != nil {
-			log.Fatalf("failed to delete route %s: %v\n", rc.path, err)
+			rc.tools.Reporter.ReportAtf(rc.loc, "failed to delete route %s: %v", rc.path, err)
+			return
 		}
 	} else {
 		log.Printf("no api route existed called %s for api %s\n", rc.path, apiId)
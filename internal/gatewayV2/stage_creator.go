@@ -3,6 +3,7 @@ package gatewayV2
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
@@ -10,6 +11,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type stageCreator struct {
@@ -21,7 +23,10 @@ type stageCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (sc *stageCreator) Loc() *errorsink.Location {
@@ -44,12 +49,15 @@ func (sc *stageCreator) CoinId() corebottom.CoinId {
 }
 
 func (sc *stageCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := sc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(sc.tools, sc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	sc.client = awsEnv.ApiGatewayV2Client()
+	sc.ctx = awsEnv.Context()
+	sc.timeout = env.ObtainTimeout(sc.tools, sc.props)
+	sc.plan = awsEnv.Plan()
 
 	if !utils.HasProp(sc.props, "Api") {
 		pres.NotFound()
@@ -63,29 +71,43 @@ func (sc *stageCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 		return
 	}
 	if !ok {
-		panic("not ok")
+		sc.tools.Reporter.ReportAtf(sc.loc, "Api must be a string")
+		return
 	}
 	apiId := apiStr.String()
+	if plan.IsPlaceholder(apiId) {
+		// the api is only planned, so nothing can have been added to it yet
+		pres.NotFound()
+		return
+	}
 
-	_, err := sc.client.GetStage(context.TODO(), &apigatewayv2.GetStageInput{ApiId: &apiId, StageName: &sc.name})
+	out, err := sc.client.GetStage(sc.ctx, &apigatewayv2.GetStageInput{ApiId: &apiId, StageName: &sc.name})
 	if err != nil {
 		if !thingExists(err) {
 			pres.NotFound()
 			return
 		}
-		log.Fatalf("could not recover stage %s: %v\n", sc.name, err)
+		sc.tools.Reporter.ReportAtf(sc.loc, "could not recover stage %s: %v", sc.name, err)
+		return
 	}
 	log.Printf("found stage %s\n", sc.name)
 	model := &StageAWSModel{name: sc.name}
+	if out.Description != nil {
+		model.description = *out.Description
+	}
 	pres.Present(model)
 }
 
 func (sc *stageCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var api driverbottom.Expr
+	var desc driverbottom.Expr
 	for p, v := range sc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Api":
 			api = v
+		case "Description":
+			desc = v
 		default:
 			sc.tools.Reporter.ReportAtf(p.Loc(), "invalid property for Api stage: %s", p.Id())
 		}
@@ -97,14 +119,26 @@ func (sc *stageCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 
 	apiStr, ok := sc.tools.Storage.EvalAsStringer(api)
 	if !ok {
-		panic("not ok")
+		sc.tools.Reporter.ReportAtf(sc.loc, "Api must be a string")
+		return
 	}
 
 	model := &StageModel{name: sc.name, loc: sc.loc, coin: sc.coin, api: apiStr}
+	if desc != nil {
+		model.description, ok = sc.tools.Storage.EvalAsStringer(desc)
+		if !ok {
+			sc.tools.Reporter.ReportAtf(desc.Loc(), "Description must be a string")
+			return
+		}
+	}
 	pres.Present(model)
 }
 
 func (sc *stageCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(sc.ctx, sc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Stage", sc.name, sc.coin)
+
 	tmp := sc.tools.Storage.GetCoin(sc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := sc.tools.Storage.GetCoin(sc.coin, corebottom.DETERMINE_DESIRED_MODE).(*StageModel)
 	created := &StageAWSModel{}
@@ -113,17 +147,46 @@ func (sc *stageCreator) UpdateReality() {
 	if tmp != nil {
 		found := tmp.(*StageAWSModel)
 		created.name = found.name
+		created.description = found.description
 
 		log.Printf("stage already existed for %s: %s\n", apiId, sc.name)
-		log.Printf("not handling diffs yet; just copying ...")
+		// the description is only changed if the script says what it should be
+		if desired.description != nil {
+			desc := desired.description.String()
+			if sc.plan != nil {
+				sc.plan.Update("aws.ApiGatewayV2.Stage", sc.name, plan.Compare("Description", found.description, desc))
+			} else if desc != found.description {
+				_, err := sc.client.UpdateStage(ctx, &apigatewayv2.UpdateStageInput{ApiId: &apiId, StageName: &sc.name, Description: &desc})
+				if err != nil {
+					sc.tools.Reporter.ReportAtf(sc.loc, "failed to update api stage %s: %v", sc.name, err)
+					return
+				}
+				log.Printf("updated description of api stage %s\n", sc.name)
+				created.description = desc
+			}
+		} else if sc.plan != nil {
+			sc.plan.NoChange("aws.ApiGatewayV2.Stage", sc.name)
+		}
 		sc.tools.Storage.Bind(sc.coin, created)
 		return
 	}
 
 	input := &apigatewayv2.CreateStageInput{ApiId: &apiId, StageName: &sc.name}
-	out, err := sc.client.CreateStage(context.TODO(), input)
+	if desired.description != nil {
+		desc := desired.description.String()
+		input.Description = &desc
+		created.description = desc
+	}
+	if sc.plan != nil {
+		sc.plan.Create("aws.ApiGatewayV2.Stage", sc.name, plan.Set("ApiId", apiId), plan.Set("Description", input.Description))
+		created.name = sc.name
+		sc.tools.Storage.Bind(sc.coin, created)
+		return
+	}
+	out, err := sc.client.CreateStage(ctx, input)
 	if err != nil {
-		log.Fatalf("failed to create api stage %s: %v\n", sc.name, err)
+		sc.tools.Reporter.ReportAtf(sc.loc, "failed to create api stage %s: %v", sc.name, err)
+		return
 	}
 	log.Printf("created api stage %s\n", *out.StageName)
 	created.name = sc.name
@@ -132,6 +195,10 @@ func (sc *stageCreator) UpdateReality() {
 }
 
 func (sc *stageCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(sc.ctx, sc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.Stage", sc.name, sc.coin)
+
 	tmp := sc.tools.Storage.GetCoin(sc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := sc.tools.Storage.GetCoin(sc.coin, corebottom.DETERMINE_DESIRED_MODE).(*StageModel)
 
@@ -139,10 +206,15 @@ func (sc *stageCreator) TearDown() {
 	if tmp != nil {
 		// found := tmp.(*StageAWSModel)
 		log.Printf("you have asked to tear down api stage %s with mode %s\n", sc.name, sc.teardown.Mode())
+		if sc.plan != nil {
+			sc.plan.Delete("aws.ApiGatewayV2.Stage", sc.name)
+			return
+		}
 
-		_, err := sc.client.DeleteStage(context.TODO(), &apigatewayv2.DeleteStageInput{ApiId: &apiId, StageName: &sc.name})
+		_, err := sc.client.DeleteStage(ctx, &apigatewayv2.DeleteStageInput{ApiId: &apiId, StageName: &sc.name})
 		if err != nil {
-			log.Fatalf("failed to delete stage %s: %v\n", sc.name, err)
+			sc.tools.Reporter.ReportAtf(sc.loc, "failed to delete stage %s: %v", sc.name, err)
+			return
 		}
 	} else {
 		log.Printf("no api stage existed called %s for api %s\n", sc.name, apiId)
@@ -12,10 +12,12 @@ type StageModel struct {
 	loc  *errorsink.Location
 	coin corebottom.CoinId
 
-	api fmt.Stringer
+	api         fmt.Stringer
+	description fmt.Stringer
 }
 
 type StageAWSModel struct {
-	name string
+	name        string
+	description string
 	// coin corebottom.CoinId
 }
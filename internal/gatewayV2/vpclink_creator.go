@@ -3,14 +3,15 @@ package gatewayV2
 import (
 	"context"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
 	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
-	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type vpcLinkCreator struct {
@@ -22,7 +23,10 @@ type vpcLinkCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *apigatewayv2.Client
+	client  *apigatewayv2.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (ic *vpcLinkCreator) Loc() *errorsink.Location {
@@ -45,20 +49,24 @@ func (ic *vpcLinkCreator) CoinId() corebottom.CoinId {
 }
 
 func (ic *vpcLinkCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := ic.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(ic.tools, ic.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	ic.client = awsEnv.ApiGatewayV2Client()
+	ic.ctx = awsEnv.Context()
+	ic.timeout = env.ObtainTimeout(ic.tools, ic.props)
+	ic.plan = awsEnv.Plan()
 
 	var nextTok *string
 	var wanted *types.VpcLink
 outer:
 	for {
-		curr, err := ic.client.GetVpcLinks(context.TODO(), &apigatewayv2.GetVpcLinksInput{NextToken: nextTok})
+		curr, err := ic.client.GetVpcLinks(ic.ctx, &apigatewayv2.GetVpcLinksInput{NextToken: nextTok})
 		if err != nil {
-			log.Fatalf("could not recover integration list: %v\n", err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "could not recover integration list: %v", err)
+			return
 		}
 		for _, vl := range curr.Items {
 			if vl.Name != nil && *vl.Name == ic.name {
@@ -88,6 +96,7 @@ func (ic *vpcLinkCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 	var groups driverbottom.Expr
 	for p, v := range ic.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "Subnets":
 			subnets = v
 		case "SecurityGroups":
@@ -110,6 +119,10 @@ func (ic *vpcLinkCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 }
 
 func (ic *vpcLinkCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(ic.ctx, ic.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.VPCLink", ic.name, ic.coin)
+
 	tmp := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_DESIRED_MODE).(*VPCLinkModel)
 	created := &VPCLinkAWSModel{}
@@ -123,40 +136,65 @@ func (ic *vpcLinkCreator) UpdateReality() {
 		log.Printf("vpclink already existed called %s\n", ic.name)
 		log.Printf("not handling diffs yet; just copying ...")
 		ic.tools.Storage.Bind(ic.coin, created)
+		if ic.plan != nil {
+			ic.plan.NoChange("aws.ApiGatewayV2.VPCLink", ic.name)
+			return
+		}
 	} else {
+		if ic.plan != nil {
+			ic.plan.Create("aws.ApiGatewayV2.VPCLink", ic.name, plan.Set("SubnetIds", subnets), plan.Set("SecurityGroupIds", groups))
+			id := plan.Placeholder("aws.ApiGatewayV2.VPCLink", ic.name)
+			created.link = &types.VpcLink{Name: &ic.name, VpcLinkId: &id}
+			ic.tools.Storage.Bind(ic.coin, created)
+			return
+		}
 		input := &apigatewayv2.CreateVpcLinkInput{Name: &ic.name, SubnetIds: subnets, SecurityGroupIds: groups}
-		out, err := ic.client.CreateVpcLink(context.TODO(), input)
+		out, err := ic.client.CreateVpcLink(ctx, input)
 		if err != nil {
-			log.Fatalf("failed to create vpc link %s: %v\n", ic.name, err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "failed to create vpc link %s: %v", ic.name, err)
+			return
 		}
 		created.link = &types.VpcLink{Name: &ic.name, VpcLinkId: out.VpcLinkId}
 		ic.tools.Storage.Bind(ic.coin, created)
 	}
-	utils.ExponentialBackoff(func() bool {
-		stat, err := ic.client.GetVpcLink(context.TODO(), &apigatewayv2.GetVpcLinkInput{VpcLinkId: created.link.VpcLinkId})
+	failed := env.Backoff(ctx, func() (bool, error) {
+		stat, err := ic.client.GetVpcLink(ctx, &apigatewayv2.GetVpcLinkInput{VpcLinkId: created.link.VpcLinkId})
 		if err != nil {
-			panic(err)
+			return false, err
 		}
 		if stat.VpcLinkStatus == types.VpcLinkStatusAvailable {
-			return true
+			return true, nil
 		}
 		log.Printf("waiting for VPC Link to be available, stat = %v\n", stat.VpcLinkStatus)
-		return false
+		return false, nil
 	})
+	if failed != nil {
+		ic.tools.Reporter.ReportAtf(ic.loc, "could not recover status of vpc link %s: %v", ic.name, failed)
+		return
+	}
 
 	log.Printf("created vpc link %s\n", *created.link.VpcLinkId)
 }
 
 func (ic *vpcLinkCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(ic.ctx, ic.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.ApiGatewayV2.VPCLink", ic.name, ic.coin)
+
 	tmp := ic.tools.Storage.GetCoin(ic.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*VPCLinkAWSModel)
 		log.Printf("you have asked to tear down vpc link %s with mode %s\n", ic.name, ic.teardown.Mode())
+		if ic.plan != nil {
+			ic.plan.Delete("aws.ApiGatewayV2.VPCLink", ic.name)
+			return
+		}
 
-		_, err := ic.client.DeleteVpcLink(context.TODO(), &apigatewayv2.DeleteVpcLinkInput{VpcLinkId: found.link.VpcLinkId})
+		_, err := ic.client.DeleteVpcLink(ctx, &apigatewayv2.DeleteVpcLinkInput{VpcLinkId: found.link.VpcLinkId})
 		if err != nil {
-			log.Fatalf("failed to delete vpc link %s: %v\n", ic.name, err)
+			ic.tools.Reporter.ReportAtf(ic.loc, "failed to delete vpc link %s: %v", ic.name, err)
+			return
 		}
 	} else {
 		log.Printf("no vpc link existed called %s\n", ic.name)
@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	"ziniki.org/deployer/modules/aws/internal/policyjson"
 )
 
@@ -25,6 +27,9 @@ type policyCreator struct {
 	policyDoc corebottom.PolicyDocument
 
 	client        *iam.Client
+	ctx           context.Context
+	timeout       time.Duration
+	plan          *plan.Plan
 	alreadyExists bool
 }
 
@@ -48,13 +53,16 @@ func (b *policyCreator) CoinId() corebottom.CoinId {
 }
 
 func (p *policyCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := p.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(p.tools, p.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	p.client = awsEnv.IAMClient()
+	p.ctx = awsEnv.Context()
+	p.timeout = env.ObtainTimeout(p.tools, p.props)
+	p.plan = awsEnv.Plan()
 }
 
 func (p *policyCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
@@ -77,6 +85,7 @@ func (p *policyCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	seenErr := false
 	for prop, v := range p.props {
 		switch prop.Id() {
+		case "Env", "DeployTimeout":
 		case "Policy":
 			policy = v
 		default:
@@ -113,13 +122,27 @@ func (p *policyCreator) UpdateReality() {
 
 	if p.alreadyExists {
 		log.Printf("policy %s already existed\n", p.name)
+		if p.plan != nil {
+			p.plan.NoChange("aws.IAM.Policy", p.name)
+		}
 		return
 	}
 
-	policy := CreatePolicy(p.client, p.name, json)
-	if policy != nil {
-		log.Printf("created policy %s as %s with ARN %s\n", p.name, policy.Id, policy.ARN)
+	if p.plan != nil {
+		p.plan.Create("aws.IAM.Policy", p.name, plan.Set("PolicyDocument", json))
+		return
+	}
+
+	ctx, cancel := env.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.IAM.Policy", p.name, p.coin)
+
+	policy, err := CreatePolicy(ctx, p.client, p.name, json)
+	if err != nil {
+		p.tools.Reporter.ReportAtf(p.loc, "failed to create policy %s: %v", p.name, err)
+		return
 	}
+	log.Printf("created policy %s as %s with ARN %s\n", p.name, policy.Id, policy.ARN)
 }
 
 func (p *policyCreator) TearDown() {
@@ -136,10 +159,10 @@ type asAWS struct {
 	ARN  string
 }
 
-func CreatePolicy(client *iam.Client, name string, text string) *asAWS {
-	pol, err := client.CreatePolicy(context.TODO(), &iam.CreatePolicyInput{PolicyName: &name, PolicyDocument: &text})
+func CreatePolicy(ctx context.Context, client *iam.Client, name string, text string) (*asAWS, error) {
+	pol, err := client.CreatePolicy(ctx, &iam.CreatePolicyInput{PolicyName: &name, PolicyDocument: &text})
 	if err != nil {
-		log.Fatalf("failed to create policy: %v", err)
+		return nil, err
 	}
-	return &asAWS{Name: *pol.Policy.PolicyName, Id: *pol.Policy.PolicyId, ARN: *pol.Policy.Arn}
+	return &asAWS{Name: *pol.Policy.PolicyName, Id: *pol.Policy.PolicyId, ARN: *pol.Policy.Arn}, nil
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -17,6 +19,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	"ziniki.org/deployer/modules/aws/internal/policyjson"
 )
 
@@ -36,8 +39,11 @@ type roleCreator struct {
 	managed []driverbottom.Expr
 	inline  []corebottom.PolicyActionList
 
-	client *iam.Client
-	sts    *sts.Client
+	client  *iam.Client
+	sts     *sts.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (r *roleCreator) Loc() *errorsink.Location {
@@ -65,27 +71,32 @@ func (r *roleCreator) AddPolicies(managed []driverbottom.Expr, inline []corebott
 }
 
 func (r *roleCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := r.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(r.tools, r.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	r.client = awsEnv.IAMClient()
 	r.sts = awsEnv.STSClient()
+	r.ctx = awsEnv.Context()
+	r.timeout = env.ObtainTimeout(r.tools, r.props)
+	r.plan = awsEnv.Plan()
 
-	resp, err := r.client.GetRole(context.TODO(), &iam.GetRoleInput{RoleName: &r.name})
+	resp, err := r.client.GetRole(r.ctx, &iam.GetRoleInput{RoleName: &r.name})
 	if err != nil {
 		if !roleExists(err) {
 			pres.NotFound()
 			return
 		}
-		log.Fatalf("failed to recover role %s", r.name)
+		r.tools.Reporter.ReportAtf(r.loc, "failed to recover role %s: %v", r.name, err)
+		return
 	}
 
-	policies, err := r.client.ListRolePolicies(context.TODO(), &iam.ListRolePoliciesInput{RoleName: &r.name})
+	policies, err := r.client.ListRolePolicies(r.ctx, &iam.ListRolePoliciesInput{RoleName: &r.name})
 	if err != nil {
-		log.Fatalf("failed to recover role %s", r.name)
+		r.tools.Reporter.ReportAtf(r.loc, "failed to recover policies for role %s: %v", r.name, err)
+		return
 	}
 
 	pres.Present(&RoleAWSModel{role: resp.Role, policies: policies.PolicyNames})
@@ -103,23 +114,34 @@ func (r *roleCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	case corebottom.PolicyActionList:
 		assumeList = ac
 	default:
-		panic("not a PAL")
+		r.tools.Reporter.ReportAtf(assumption.Loc(), "Assume must be a list of policy actions, not %T", ac)
+		return
 	}
 	if utils.HasProp(r.props, "Inline") {
 		switch il := utils.FindProp(r.props, nil, "Inline").(type) {
 		case corebottom.PolicyActionList:
 			r.inline = append(r.inline, il)
 		default:
-			log.Fatalf("cannot handle Inline prop %T\n", il)
+			r.tools.Reporter.ReportAtf(il.Loc(), "cannot handle Inline prop %T", il)
+			return
 		}
 	}
 	pres.Present(&RoleModel{name: r.name, coin: r.coin, assumption: assumeList, inline: r.inline, managed: r.managed})
 }
 
 func (r *roleCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.IAM.Role", r.name, r.coin)
+
 	tmp := r.tools.Storage.GetCoin(r.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := r.tools.Storage.GetCoin(r.coin, corebottom.DETERMINE_DESIRED_MODE).(*RoleModel)
 
+	if r.plan != nil {
+		r.planChanges(ctx, tmp, desired)
+		return
+	}
+
 	created := &RoleAWSModel{}
 	if tmp == nil {
 		log.Printf("creating role %s\n", r.name)
@@ -127,11 +149,13 @@ func (r *roleCreator) UpdateReality() {
 		desired.assumption.ApplyTo(assume)
 		assumeJson, err := policyjson.BuildFrom("", assume, policyjson.AssumeRoleRules())
 		if err != nil {
-			log.Fatalf("could not generate policy: %v", err)
+			r.tools.Reporter.ReportAtf(r.loc, "could not generate assume role policy for %s: %v", r.name, err)
+			return
 		}
-		out, err := r.client.CreateRole(context.TODO(), &iam.CreateRoleInput{RoleName: &r.name, AssumeRolePolicyDocument: &assumeJson})
+		out, err := r.client.CreateRole(ctx, &iam.CreateRoleInput{RoleName: &r.name, AssumeRolePolicyDocument: &assumeJson})
 		if err != nil {
-			log.Fatalf("failed to create role %s: %v\n", r.name, err)
+			r.tools.Reporter.ReportAtf(r.loc, "failed to create role %s: %v", r.name, err)
+			return
 		}
 		created.role = out.Role
 	} else {
@@ -144,16 +168,18 @@ func (r *roleCreator) UpdateReality() {
 	for _, mp := range desired.managed {
 		name, ok := r.tools.Storage.EvalAsStringer(mp)
 		if !ok {
-			panic(ok)
+			r.tools.Reporter.ReportAtf(mp.Loc(), "managed policy name must be a string")
+			return
 		}
 		managed[name.String()] = "--needed--"
 	}
 
 	var marker *string
 	for {
-		list, err := r.client.ListPolicies(context.TODO(), &iam.ListPoliciesInput{Marker: marker})
+		list, err := r.client.ListPolicies(ctx, &iam.ListPoliciesInput{Marker: marker})
 		if err != nil {
-			panic(err)
+			r.tools.Reporter.ReportAtf(r.loc, "could not list managed policies: %v", err)
+			return
 		}
 		for _, mp := range list.Policies {
 			if managed[*mp.PolicyName] == "--needed--" {
@@ -171,7 +197,7 @@ func (r *roleCreator) UpdateReality() {
 		}
 	}
 	for _, a := range managed {
-		r.client.AttachRolePolicy(context.TODO(), &iam.AttachRolePolicyInput{RoleName: &r.name, PolicyArn: &a})
+		r.client.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{RoleName: &r.name, PolicyArn: &a})
 	}
 
 	for k, ip := range desired.inline {
@@ -180,11 +206,13 @@ func (r *roleCreator) UpdateReality() {
 		pname := fmt.Sprintf("%s-%d", desired.name, k)
 		ps, err := policyjson.BuildFrom(strings.ReplaceAll(pname, "-", ""), policy, policyjson.StandardRules())
 		if err != nil {
-			log.Fatalf("could not generate policy: %v", err)
+			r.tools.Reporter.ReportAtf(ip.Loc(), "could not generate policy %s: %v", pname, err)
+			return
 		}
-		_, err = r.client.PutRolePolicy(context.TODO(), &iam.PutRolePolicyInput{RoleName: &r.name, PolicyName: &pname, PolicyDocument: &ps})
+		_, err = r.client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{RoleName: &r.name, PolicyName: &pname, PolicyDocument: &ps})
 		if err != nil {
-			log.Fatalf("could not generate policy: %v", err)
+			r.tools.Reporter.ReportAtf(ip.Loc(), "could not attach policy %s to role %s: %v", pname, r.name, err)
+			return
 		}
 		log.Printf("attached policy %s", pname)
 	}
@@ -192,6 +220,10 @@ func (r *roleCreator) UpdateReality() {
 }
 
 func (r *roleCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(r.ctx, r.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.IAM.Role", r.name, r.coin)
+
 	tmp := r.tools.Storage.GetCoin(r.coin, corebottom.DETERMINE_INITIAL_MODE)
 	if tmp == nil {
 		log.Printf("there was no role %s\n", r.name)
@@ -199,23 +231,80 @@ func (r *roleCreator) TearDown() {
 	}
 
 	found := tmp.(*RoleAWSModel)
+	if r.plan != nil {
+		r.plan.Delete("aws.IAM.Role", r.name)
+		return
+	}
 	for _, p := range found.policies {
-		_, err := r.client.DeleteRolePolicy(context.TODO(), &iam.DeleteRolePolicyInput{RoleName: &r.name, PolicyName: &p})
+		_, err := r.client.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{RoleName: &r.name, PolicyName: &p})
 		if err != nil {
-			log.Fatalf("failed to delete role policy %s %s: %v", r.name, p, err)
+			r.tools.Reporter.ReportAtf(r.loc, "failed to delete role policy %s %s: %v", r.name, p, err)
+			return
 		}
 	}
-	_, err := r.client.DeleteRole(context.TODO(), &iam.DeleteRoleInput{RoleName: &r.name})
+	_, err := r.client.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: &r.name})
 	if err != nil {
-		log.Fatalf("failed to delete role %s: %v", r.name, err)
+		r.tools.Reporter.ReportAtf(r.loc, "failed to delete role %s: %v", r.name, err)
+		return
 	}
 	log.Printf("deleted role %s\n", r.name)
 }
 
+// planChanges records what UpdateReality would do to the role, without doing it.
+// Policies are only ever added to a role, so the ones it already has are kept.
+func (r *roleCreator) planChanges(ctx context.Context, tmp any, desired *RoleModel) {
+	var managed []string
+	for _, mp := range desired.managed {
+		name, ok := r.tools.Storage.EvalAsStringer(mp)
+		if !ok {
+			r.tools.Reporter.ReportAtf(mp.Loc(), "managed policy name must be a string")
+			return
+		}
+		managed = append(managed, name.String())
+	}
+	var inline []string
+	for k := range desired.inline {
+		inline = append(inline, fmt.Sprintf("%s-%d", desired.name, k))
+	}
+	if tmp == nil {
+		r.plan.Create("aws.IAM.Role", r.name, plan.Set("ManagedPolicies", managed), plan.Set("InlinePolicies", inline))
+		arn := plan.Placeholder("aws.IAM.Role", r.name)
+		r.tools.Storage.Bind(r.coin, &RoleAWSModel{role: &types.Role{RoleName: &r.name, Arn: &arn}, policies: inline})
+		return
+	}
+
+	found := tmp.(*RoleAWSModel)
+	attached, err := r.client.ListAttachedRolePolicies(ctx, &iam.ListAttachedRolePoliciesInput{RoleName: &r.name})
+	if err != nil {
+		r.tools.Reporter.ReportAtf(r.loc, "could not list managed policies for role %s: %v", r.name, err)
+		return
+	}
+	var has []string
+	for _, ap := range attached.AttachedPolicies {
+		has = append(has, *ap.PolicyName)
+	}
+	r.plan.Update("aws.IAM.Role", r.name, plan.Compare("ManagedPolicies", sortedUnion(has), sortedUnion(has, managed)), plan.Compare("InlinePolicies", sortedUnion(found.policies), sortedUnion(found.policies, inline)))
+	r.tools.Storage.Adopt(r.coin, found)
+}
+
+func sortedUnion(lists ...[]string) []string {
+	var ret []string
+	for _, l := range lists {
+		for _, s := range l {
+			if !slices.Contains(ret, s) {
+				ret = append(ret, s)
+			}
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
 func (r *roleCreator) String() string {
 	return fmt.Sprintf("EnsureRole[%s]", r.name)
 }
 
+// roleExists is false only for NoSuchEntity
 func roleExists(err error) bool {
 	if err == nil {
 		return true
@@ -223,22 +312,14 @@ func roleExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*http.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				switch e4 := e2.Err.(type) {
-				case *types.NoSuchEntityException:
-					return false
-				default:
-					log.Printf("error: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			switch e2.Err.(type) {
+			case *types.NoSuchEntityException:
+				return false
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting lambda failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
 var _ AcceptPolicies = &roleCreator{}
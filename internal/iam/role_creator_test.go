@@ -0,0 +1,57 @@
+package iam_test
+
+import (
+	"slices"
+	"testing"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/iam"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+var loc = &errorsink.Location{}
+
+func allow(h *awstest.Harness, action string, resource driverbottom.Expr, principal ...string) corebottom.PolicyActionList {
+	var more []corebottom.UpdatePolicyAllowAction
+	if len(principal) == 2 {
+		more = append(more, coretop.NewPolicyPrincipalAction(h.Tools(), loc, drivertop.MakeString(loc, principal[0]), drivertop.MakeString(loc, principal[1])))
+	}
+	var resources []driverbottom.Expr
+	if resource != nil {
+		resources = append(resources, resource)
+	}
+	ret := coretop.NewPolicyActionList(loc)
+	ret.Add(coretop.NewPolicyAllowAction(h.Tools(), loc, []driverbottom.Expr{drivertop.MakeString(loc, action)}, resources, more))
+	return ret
+}
+
+func TestRoleCarriesItsInlinePolicy(t *testing.T) {
+	h := awstest.New(t)
+	role := h.Coin("role")
+	props := h.Props(map[string]any{
+		"Assume": allow(h, "sts:AssumeRole", nil, "Service", "lambda.amazonaws.com"),
+		"Inline": allow(h, "s3:GetObject", drivertop.MakeString(loc, "arn:aws:s3:::site/*")),
+	})
+
+	h.Ensure(&iam.RoleBlank{}, role, "runner", props)
+	if inline, _ := h.Fake.RolePolicies("runner"); len(inline) != 1 {
+		t.Fatalf("role should have one inline policy, not %v", inline)
+	}
+
+	h.NextRun()
+	h.Calls()
+	h.Ensure(&iam.RoleBlank{}, role, "runner", props)
+	if calls := h.Calls(); slices.Contains(calls, "IAM.CreateRole") {
+		t.Fatalf("role already existed: %v", calls)
+	}
+
+	h.NextRun()
+	h.TearDown(&iam.RoleBlank{}, role, "runner", props)
+	if h.Fake.HasRole("runner") {
+		t.Fatalf("role was not deleted: %v", h.Calls())
+	}
+}
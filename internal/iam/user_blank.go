@@ -0,0 +1,25 @@
+package iam
+
+import (
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// UserBlank can only find users that already exist
+type UserBlank struct{}
+
+func (b *UserBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr, teardown corebottom.TearDown) corebottom.Ensurable {
+	tools.Reporter.ReportAtf(loc, "cannot create users at this time")
+	return nil
+}
+
+func (b *UserBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
+	return &userFinder{tools: tools, loc: loc, name: named, coin: id, props: props}
+}
+
+func (b *UserBlank) ShortDescription() string {
+	return "aws.IAM.UserBlank[]"
+}
+
+var _ corebottom.Blank = &UserBlank{}
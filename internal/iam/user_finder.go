@@ -2,46 +2,97 @@ package iam
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"reflect"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
-	"ziniki.org/deployer/coremod/pkg/corepkg"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
 )
 
-type UserFinder struct {
-	Client *iam.Client
+type userFinder struct {
+	tools *corebottom.Tools
+
+	loc   *errorsink.Location
+	name  string
+	coin  corebottom.CoinId
+	props map[driverbottom.Identifier]driverbottom.Expr
+
+	client *iam.Client
+}
+
+func (u *userFinder) Loc() *errorsink.Location {
+	return u.loc
+}
+
+func (u *userFinder) ShortDescription() string {
+	return "aws.IAM.User[" + u.name + "]"
 }
 
-func (u *UserFinder) DetermineInitialState(creator *corepkg.CoreCreator, pres corebottom.ValuePresenter) {
-	creator.GetEnv("aws.AwsEnv", reflect.TypeFor[*env.AwsEnv](), "IAMClient", "Client")
-	model := u.findUserNamed(creator.Name())
+func (u *userFinder) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("aws.IAM.User[")
+	iw.AttrsWhere(u)
+	iw.TextAttr("named", u.name)
+	iw.EndAttrs()
+}
+
+func (u *userFinder) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := env.ObtainEnv(u.tools, u.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
+	}
+	u.client = awsEnv.IAMClient()
+
+	model, err := u.findUserNamed(awsEnv.Context(), u.name)
+	if err != nil {
+		u.tools.Reporter.ReportAtf(u.loc, "could not get user %s: %v", u.name, err)
+		return
+	}
 	if model == nil {
-		log.Printf("user %s not found\n", creator.Name())
+		log.Printf("user %s not found\n", u.name)
 		pres.NotFound()
 	} else {
-		log.Printf("user found for %s\n", creator.Name())
+		log.Printf("user found for %s\n", u.name)
 		pres.Present(model)
 	}
 }
 
 type userAWSModel struct {
+	loc  *errorsink.Location
 	arn  string
 	name string
 }
 
-func (cc *UserFinder) findUserNamed(name string) *userAWSModel {
-	user, err := cc.Client.GetUser(context.TODO(), &iam.GetUserInput{UserName: &name})
-	if err != nil {
-		panic(err)
-	}
-	if user != nil {
-		return &userAWSModel{arn: *user.User.Arn, name: name}
-	} else {
-		return nil
+func (m *userAWSModel) Loc() *errorsink.Location {
+	return m.loc
+}
+
+func (m *userAWSModel) ShortDescription() string {
+	return fmt.Sprintf("aws.IAM.User[%s]", m.name)
+}
+
+func (m *userAWSModel) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("aws.IAM.User[%s]", m.name)
+	to.AttrsWhere(m)
+	to.TextAttr("arn", m.arn)
+	to.EndAttrs()
+}
+
+func (u *userFinder) findUserNamed(ctx context.Context, name string) (*userAWSModel, error) {
+	user, err := u.client.GetUser(ctx, &iam.GetUserInput{UserName: &name})
+	var nse *types.NoSuchEntityException
+	if errors.As(err, &nse) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
+	return &userAWSModel{loc: u.loc, arn: *user.User.Arn, name: name}, nil
 }
 
-var _ corepkg.FindStrategy = &UserFinder{}
+var _ corebottom.FindCoin = &userFinder{}
+var _ driverbottom.Describable = &userAWSModel{}
@@ -2,9 +2,12 @@ package lambda
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
@@ -14,16 +17,20 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type addPermsAction struct {
 	tools *corebottom.Tools
 	loc   *errorsink.Location
 	named driverbottom.String
+	env   driverbottom.Expr
 
 	actions []corebottom.PolicyRuleAction
 
+	ctx    context.Context
 	client *lambda.Client
+	plan   *plan.Plan
 }
 
 func (a *addPermsAction) Loc() *errorsink.Location {
@@ -52,16 +59,20 @@ func (a *addPermsAction) Resolve(r driverbottom.Resolver) driverbottom.BindingRe
 	for _, pra := range a.actions {
 		ret = ret.Merge(pra.Resolve(r))
 	}
+	if a.env != nil {
+		ret = ret.Merge(a.env.Resolve(r))
+	}
 	return ret
 }
 
 func (a *addPermsAction) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := a.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.NamedEnv(a.tools, a.env)
+	if awsEnv == nil {
+		return
 	}
+	a.ctx = awsEnv.Context()
 	a.client = awsEnv.LambdaClient()
+	a.plan = awsEnv.Plan()
 
 	// TODO: there is some "GetPolicy" thing we can do ...
 }
@@ -80,21 +91,31 @@ func (a *addPermsAction) UpdateReality() {
 		pra.ApplyTo(doc)
 		for _, effect := range doc.Items() {
 			if effect.Effect() != "Allow" {
-				panic("should be Allow")
+				a.tools.Reporter.ReportAtf(a.loc, "lambda permissions can only Allow, not %s", effect.Effect())
+				return
 			}
+			sourceArn, sourceAccount := sourceOf(effect.More()["Condition"])
 			for _, act := range effect.Actions() {
 				for _, res := range effect.Resources() {
 					for _, pri := range effect.Principals() {
 						stmtId := fmt.Sprintf("%sSid%d", a.named, cnt)
 						priName := pri.Value()
-						input := &lambda.AddPermissionInput{StatementId: &stmtId, Action: &act, FunctionName: &res, Principal: &priName}
-						_, err := a.client.AddPermission(context.TODO(), input)
-						if err != nil {
-							if !alreadyExists(err) {
-								panic(err)
+						if a.plan != nil {
+							fields := []plan.Field{plan.Set("Action", act), plan.Set("Principal", priName)}
+							if sourceArn != nil {
+								fields = append(fields, plan.Set("SourceArn", *sourceArn))
+							}
+							if sourceAccount != nil {
+								fields = append(fields, plan.Set("SourceAccount", *sourceAccount))
 							}
-							// } else {
-							// 	log.Printf("out = %s", *out.Statement)
+							a.plan.Create("aws.Lambda.Permission", res+":"+stmtId, fields...)
+							cnt++
+							continue
+						}
+						input := &lambda.AddPermissionInput{StatementId: &stmtId, Action: &act, FunctionName: &res, Principal: &priName, SourceArn: sourceArn, SourceAccount: sourceAccount}
+						if err := a.addPermission(env.About(a.ctx, "aws.Lambda.Permission", res+":"+stmtId, nil), input); err != nil {
+							a.tools.Reporter.ReportAtf(a.loc, "failed to add permission %s to %s: %v", stmtId, res, err)
+							return
 						}
 						cnt++
 					}
@@ -104,13 +125,120 @@ func (a *addPermsAction) UpdateReality() {
 	}
 }
 
+// addPermission adds the statement in input to the function's policy; if there is already
+// a statement with its id which grants something else, that is removed first
+func (a *addPermsAction) addPermission(ctx context.Context, input *lambda.AddPermissionInput) error {
+	_, err := a.client.AddPermission(ctx, input)
+	if err == nil || !alreadyExists(err) {
+		return err
+	}
+	policy, err := a.client.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: input.FunctionName})
+	if err != nil {
+		return err
+	}
+	if grants(aws.ToString(policy.Policy), input) {
+		return nil
+	}
+	log.Printf("permission %s on %s has changed; replacing it\n", *input.StatementId, *input.FunctionName)
+	if _, err := a.client.RemovePermission(ctx, &lambda.RemovePermissionInput{FunctionName: input.FunctionName, StatementId: input.StatementId}); err != nil {
+		return err
+	}
+	_, err = a.client.AddPermission(ctx, input)
+	return err
+}
+
 func (a *addPermsAction) TearDown() {
 }
 
-func AddLambdaPermissionsAction(tools *corebottom.Tools, loc *errorsink.Location, name driverbottom.String, actions []corebottom.PolicyRuleAction) corebottom.RealityShifter {
-	return &addPermsAction{tools: tools, loc: loc, named: name, actions: actions}
+func AddLambdaPermissionsAction(tools *corebottom.Tools, loc *errorsink.Location, name driverbottom.String, env driverbottom.Expr, actions []corebottom.PolicyRuleAction) corebottom.RealityShifter {
+	return &addPermsAction{tools: tools, loc: loc, named: name, env: env, actions: actions}
+}
+
+// sourceOf finds the aws:SourceArn and aws:SourceAccount in the conditions of a statement,
+// which is how lambda permissions are limited to (e.g.) a single bucket
+func sourceOf(conds []any) (arn *string, account *string) {
+	for _, c := range conds {
+		ops, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, op := range ops {
+			keys, ok := op.(map[string]any)
+			if !ok {
+				continue
+			}
+			for k, v := range keys {
+				str, ok := v.(string)
+				if s, isStringer := v.(fmt.Stringer); isStringer {
+					str, ok = s.String(), true
+				}
+				if !ok {
+					continue
+				}
+				switch strings.ToLower(k) {
+				case "aws:sourcearn":
+					arn = &str
+				case "aws:sourceaccount":
+					account = &str
+				}
+			}
+		}
+	}
+	return arn, account
+}
+
+// grants says whether the statement in policy with the id of input grants exactly what input does
+func grants(policy string, input *lambda.AddPermissionInput) bool {
+	var doc struct {
+		Statement []struct {
+			Sid       string
+			Principal any
+			Action    any
+			Condition map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return false
+	}
+	for _, stmt := range doc.Statement {
+		if stmt.Sid != *input.StatementId {
+			continue
+		}
+		var arn, account string
+		for _, keys := range stmt.Condition {
+			for k, v := range keys {
+				switch strings.ToLower(k) {
+				case "aws:sourcearn":
+					arn, _ = v.(string)
+				case "aws:sourceaccount":
+					account, _ = v.(string)
+				}
+			}
+		}
+		return stmt.Action == *input.Action && isPrincipal(stmt.Principal, *input.Principal) &&
+			arn == aws.ToString(input.SourceArn) && account == aws.ToString(input.SourceAccount)
+	}
+	return false
 }
 
+// isPrincipal says whether the principal of a policy statement is the service or account p
+func isPrincipal(principal any, p string) bool {
+	if principal == p {
+		return true
+	}
+	m, ok := principal.(map[string]any)
+	if !ok {
+		return false
+	}
+	for _, v := range m {
+		if v == p || v == "arn:aws:iam::"+p+":root" {
+			return true
+		}
+	}
+	return false
+}
+
+// alreadyExists is true when the statement id is already in the policy
 func alreadyExists(err error) bool {
 	if err == nil {
 		return true
@@ -118,22 +246,14 @@ func alreadyExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*http.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 409 {
-				switch e4 := e2.Err.(type) {
-				case *types.ResourceConflictException:
-					return true
-				default:
-					log.Printf("error: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 409 {
+			switch e2.Err.(type) {
+			case *types.ResourceConflictException:
+				return true
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting lambda failed: %T %v", err, err)
-	panic("failed")
+	return false
 }
 
 var _ corebottom.Action = &addPermsAction{}
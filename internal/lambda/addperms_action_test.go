@@ -0,0 +1,71 @@
+package lambda_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+// fromBucket lets S3 invoke the handler for one bucket in one account
+type fromBucket struct {
+	bucket string
+}
+
+func (f *fromBucket) ApplyTo(doc corebottom.PolicyDocument) {
+	item := doc.Item("Allow")
+	item.Action("lambda:InvokeFunction")
+	item.Resource("handler")
+	item.Principal(coretop.NewPrincipal("Service", "s3.amazonaws.com"))
+	item.AMore("Condition", map[string]any{
+		"ArnLike":      map[string]any{"aws:SourceArn": "arn:aws:s3:::" + f.bucket},
+		"StringEquals": map[string]any{"aws:SourceAccount": "123456789012"},
+	})
+}
+
+func (f *fromBucket) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	return driverbottom.MAY_BE_BOUND
+}
+
+func allow(h *awstest.Harness, bucket string) {
+	loc := &errorsink.Location{}
+	perms := lambda.AddLambdaPermissionsAction(h.Tools(), loc, drivertop.MakeString(loc, "S3-uploads"), nil, []corebottom.PolicyRuleAction{&fromBucket{bucket: bucket}})
+	perms.DetermineInitialState(coretop.NewDummyPresenter())
+	perms.UpdateReality()
+}
+
+func TestAPermissionWhoseTargetChangesIsReplaced(t *testing.T) {
+	h := awstest.New(t)
+	handler(t, h)
+	allow(h, "uploads")
+	allow(h, "uploads")
+	if calls := h.Calls(); slices.Contains(calls, "Lambda.RemovePermission") {
+		t.Fatalf("an unchanged permission was replaced: %v", calls)
+	}
+
+	allow(h, "images")
+	if calls := h.Calls(); !slices.Contains(calls, "Lambda.RemovePermission") {
+		t.Fatalf("the permission was not replaced: %v", calls)
+	}
+	if errs := h.Reported(); len(errs) != 0 {
+		t.Fatalf("errors were %v", errs)
+	}
+	out, err := awslambda.NewFromConfig(h.Fake.Config()).GetPolicy(context.Background(), &awslambda.GetPolicyInput{FunctionName: aws.String("handler")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := aws.ToString(out.Policy)
+	if !strings.Contains(policy, "arn:aws:s3:::images") || strings.Contains(policy, "arn:aws:s3:::uploads") || !strings.Contains(policy, `"AWS:SourceAccount":"123456789012"`) {
+		t.Fatalf("policy was %s", policy)
+	}
+}
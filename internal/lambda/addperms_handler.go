@@ -11,8 +11,8 @@ type addPermsHandler struct {
 }
 
 func (wh *addPermsHandler) Handle(attacher driverbottom.AttachResult, scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
-	if len(tokens) != 2 {
-		wh.tools.Reporter.Report(tokens[0].Loc().Offset, "lambda.addPermissions: statement-name")
+	if len(tokens) < 2 {
+		wh.tools.Reporter.Report(tokens[0].Loc().Offset, "lambda.addPermissions: statement-name [env]")
 		return drivertop.NewIgnoreInnerScope()
 	}
 
@@ -22,7 +22,15 @@ func (wh *addPermsHandler) Handle(attacher driverbottom.AttachResult, scope driv
 		return drivertop.NewIgnoreInnerScope()
 	}
 
-	apa := &addPermsAction{tools: wh.tools, loc: tokens[0].Loc(), named: name}
+	var envName driverbottom.Expr
+	if len(tokens) > 2 {
+		envName, ok = wh.tools.Parser.Parse(scope, tokens[2:])
+		if !ok {
+			return drivertop.NewIgnoreInnerScope()
+		}
+	}
+
+	apa := &addPermsAction{tools: wh.tools, loc: tokens[0].Loc(), named: name, env: envName}
 	if err := attacher.Attach(apa); err != nil {
 		panic(err)
 	}
@@ -1,9 +1,6 @@
 package lambda
 
 import (
-	"context"
-	"log"
-
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
@@ -45,26 +42,28 @@ func (lc *aliasFinder) CoinId() corebottom.CoinId {
 }
 
 func (lc *aliasFinder) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := lc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(lc.tools, lc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	lc.client = awsEnv.LambdaClient()
 
 	// TODO: needs proper processing
 	fnStr, ok := lc.tools.Storage.EvalAsStringer(utils.FindProp(lc.props, nil, "FunctionName"))
 	if !ok {
-		panic("not ok to not be able to <find> something")
+		lc.tools.Reporter.ReportAtf(lc.loc, "FunctionName must be a string")
+		return
 	}
 
-	req, err := lc.client.GetAlias(context.TODO(), &lambda.GetAliasInput{Name: &lc.name, FunctionName: aws.String(fnStr.String())})
+	req, err := lc.client.GetAlias(awsEnv.Context(), &lambda.GetAliasInput{Name: &lc.name, FunctionName: aws.String(fnStr.String())})
 	if err != nil {
 		if !lambdaExists(err) {
 			pres.NotFound()
 			return
 		}
-		log.Fatalf("error trying to find alias %s: %v\n", lc.name, err)
+		lc.tools.Reporter.ReportAtf(lc.loc, "error trying to find alias %s: %v", lc.name, err)
+		return
 	}
 	if req == nil {
 		pres.NotFound()
@@ -0,0 +1,314 @@
+package lambda
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+// MaxZipFileSize is the largest zip that is sent straight to lambda; anything
+// bigger has to be staged in a bucket first
+const MaxZipFileSize = 50 * 1024 * 1024
+
+// sourceTag is put on functions whose code was in S3 to record the ETag of the object
+// it came from along with the hash it had, since lambda does not remember either
+const sourceTag = "deployer:code-source"
+
+// imageURI matches the URI of an image in ECR, which is the only place lambda can take images from
+var imageURI = regexp.MustCompile(`^[0-9]{12}\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com(\.cn)?/[^:@]+(:[^:@]+|@sha256:[0-9a-f]{64})$`)
+
+// isImage says whether the Code of a function is a container image rather than a local path
+func isImage(code string) bool {
+	return imageURI.MatchString(code)
+}
+
+// pinned says whether an image URI refers to exactly one image; a tag may have moved since it was deployed
+func pinned(image string) bool {
+	return strings.Contains(image, "@sha256:")
+}
+
+// functionCode is where the code of a function comes from: a zip in S3 (either as it
+// was given in the script, or staged there because it was too big to send directly),
+// a zip made from local files, or an image
+type functionCode struct {
+	bucket string
+	key    string
+	bundle *bundle
+	image  string
+
+	// what S3 says about the object, if that is where the code is
+	etag     string
+	checksum string
+}
+
+func (c *functionCode) forCreate() (*types.FunctionCode, types.PackageType) {
+	switch {
+	case c.image != "":
+		return &types.FunctionCode{ImageUri: &c.image}, types.PackageTypeImage
+	case c.bucket != "":
+		return &types.FunctionCode{S3Bucket: &c.bucket, S3Key: &c.key}, types.PackageTypeZip
+	default:
+		return &types.FunctionCode{ZipFile: c.bundle.zip}, types.PackageTypeZip
+	}
+}
+
+func (c *functionCode) applyTo(input *lambda.UpdateFunctionCodeInput) {
+	switch {
+	case c.image != "":
+		input.ImageUri = &c.image
+	case c.bucket != "":
+		input.S3Bucket = &c.bucket
+		input.S3Key = &c.key
+	default:
+		input.ZipFile = c.bundle.zip
+	}
+}
+
+// unchanged says whether the function already has this code; images that are only
+// known by tag may always have changed
+func (c *functionCode) unchanged(found *LambdaAWSModel) bool {
+	sha := aws.ToString(found.config.CodeSha256)
+	switch {
+	case c.bundle != nil:
+		return sha == c.bundle.sha
+	case c.image != "":
+		return pinned(c.image) && found.image == c.image
+	case c.wholeChecksum():
+		return sha == c.checksum
+	case c.etag != "":
+		return found.codeSource == c.source(sha)
+	}
+	return false
+}
+
+// source is what is recorded in the sourceTag once the function has the code with the
+// hash sha; it is only needed when the code is in S3 and lambda cannot tell from its hash
+func (c *functionCode) source(sha string) string {
+	if c.bundle != nil || c.image != "" || c.etag == "" || c.wholeChecksum() {
+		return ""
+	}
+	return c.etag + " " + sha
+}
+
+// layerContent is the code as a layer wants it; layers cannot be images
+func (c *functionCode) layerContent() *types.LayerVersionContentInput {
+	if c.bucket != "" {
+		return &types.LayerVersionContentInput{S3Bucket: &c.bucket, S3Key: &c.key}
+	}
+	return &types.LayerVersionContentInput{ZipFile: c.bundle.zip}
+}
+
+// sha is the hash lambda would report for this code, if it is known
+func (c *functionCode) sha() string {
+	if c.bundle != nil {
+		return c.bundle.sha
+	}
+	if c.wholeChecksum() {
+		return c.checksum
+	}
+	return ""
+}
+
+// wholeChecksum says whether the object in S3 was uploaded with a SHA256 of the whole
+// object (rather than of its parts), which is the same as lambda's hash of the code
+func (c *functionCode) wholeChecksum() bool {
+	return c.checksum != "" && !strings.Contains(c.checksum, "-")
+}
+
+// found is what the function has now, in the form of String
+func (c *functionCode) found(found *LambdaAWSModel) any {
+	if c.image != "" {
+		if !pinned(c.image) {
+			// the tag may have moved, so show which image it was
+			return found.image + " (" + aws.ToString(found.config.CodeSha256) + ")"
+		}
+		return found.image
+	}
+	return found.config.CodeSha256
+}
+
+func (c *functionCode) String() string {
+	switch {
+	case c.image != "":
+		return c.image
+	case c.bundle != nil:
+		return c.bundle.sha
+	default:
+		return "s3://" + c.bucket + "/" + c.key
+	}
+}
+
+// codeFrom works out where some code is coming from: an aws.S3.Location, or else a local
+// directory, zip or image; local files are packaged here, so that their hash can be
+// compared with what is deployed
+func codeFrom(ctx context.Context, tools *corebottom.Tools, client *awss3.Client, loc *errorsink.Location, name string, at *s3.S3Location, source string) (*functionCode, bool) {
+	if at != nil {
+		b1, ok := tools.Storage.EvalAsStringer(at.Bucket)
+		if !ok {
+			tools.Reporter.ReportAtf(loc, "Code bucket must be a string")
+			return nil, false
+		}
+		b2, ok := tools.Storage.EvalAsStringer(at.Key)
+		if !ok {
+			tools.Reporter.ReportAtf(loc, "Code key must be a string")
+			return nil, false
+		}
+		code := &functionCode{bucket: b1.String(), key: b2.String()}
+		// the object may not be there yet if it is only being created in this plan,
+		// in which case lambda will complain about it soon enough
+		head, err := s3.FindObject(ctx, client, code.bucket, code.key)
+		if err != nil {
+			log.Printf("could not find the code for %s in %s: %v\n", name, code, err)
+		} else if head != nil {
+			code.etag = aws.ToString(head.ETag)
+			code.checksum = aws.ToString(head.ChecksumSHA256)
+		}
+		return code, true
+	}
+	if isImage(source) {
+		return &functionCode{image: source}, true
+	}
+	bundle, err := packageCode(source)
+	if err != nil {
+		tools.Reporter.ReportAtf(loc, "could not package the code for %s: %v", name, err)
+		return nil, false
+	}
+	return &functionCode{bundle: bundle}, true
+}
+
+// stageCode puts code that is too big to send directly to lambda in the bucket given
+// by bucketExpr, which is the CodeBucket of whatever it is for
+func stageCode(ctx context.Context, tools *corebottom.Tools, client *awss3.Client, name string, bucketExpr driverbottom.Expr, code *functionCode) error {
+	if code.bundle == nil || len(code.bundle.zip) <= MaxZipFileSize {
+		return nil
+	}
+	if bucketExpr == nil {
+		return fmt.Errorf("the code is %d bytes, so it must be staged in a CodeBucket", len(code.bundle.zip))
+	}
+	b := tools.Storage.Eval(bucketExpr)
+	bucket, ok := s3.BucketName(b)
+	if !ok {
+		return fmt.Errorf("CodeBucket must be a bucket or the name of one, not %T", b)
+	}
+	key := code.bundle.stagingKey(name)
+	if _, err := s3.PutObject(ctx, client, nil, bucket, key, bytes.NewReader(code.bundle.zip), nil); err != nil {
+		return err
+	}
+	code.bucket, code.key = bucket, key
+	return nil
+}
+
+// hashObject reads the object at bucket/key to find the hash lambda would give it
+func hashObject(ctx context.Context, client *awss3.Client, bucket, key string) (string, error) {
+	out, err := client.GetObject(ctx, &awss3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, out.Body); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// bundle is a zip of code to give to lambda, along with its hash in the form lambda
+// reports as CodeSha256, so that it is only uploaded if it has changed
+type bundle struct {
+	zip []byte
+	sha string
+}
+
+// packageCode reads the zip at path, or zips up the directory at path
+func packageCode(path string) (*bundle, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var zipped []byte
+	if info.IsDir() {
+		zipped, err = zipDir(path)
+	} else if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		zipped, err = os.ReadFile(path)
+	} else {
+		return nil, fmt.Errorf("%s is neither a directory nor a zip", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(zipped)
+	return &bundle{zip: zipped, sha: base64.StdEncoding.EncodeToString(sum[:])}, nil
+}
+
+// stagingKey is where a bundle that is too big to send directly is put in the staging bucket
+func (b *bundle) stagingKey(name string) string {
+	sum, _ := base64.StdEncoding.DecodeString(b.sha)
+	return "lambda/" + name + "/" + hex.EncodeToString(sum) + ".zip"
+}
+
+// zipDir zips the files under dir in a way that only depends on their names, contents and
+// whether they are executable, so that the same code always has the same hash
+func zipDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr := &zip.FileHeader{Name: filepath.ToSlash(rel), Method: zip.Deflate}
+		if info.Mode()&0111 != 0 {
+			hdr.SetMode(0755)
+		} else {
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
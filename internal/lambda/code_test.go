@@ -0,0 +1,177 @@
+package lambda_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+// writeFiles writes files into dir in the order given, giving them all the modification time at
+func writeFiles(t *testing.T, dir string, at time.Time, files ...string) {
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("contents of "+f), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// putCode puts a zip of code in the bucket "code", with a checksum of the whole object if asked for
+func putCode(t *testing.T, h *awstest.Harness, key, contents string, checksum bool) {
+	client := awss3.NewFromConfig(h.Fake.Config())
+	in := &awss3.PutObjectInput{Bucket: aws.String("code"), Key: aws.String(key), Body: strings.NewReader(contents)}
+	if checksum {
+		sum := sha256.Sum256([]byte(contents))
+		in.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	if _, err := client.PutObject(context.Background(), in); err != nil {
+		t.Fatal(err)
+	}
+	h.Calls()
+}
+
+func inS3(key string) *s3.S3Location {
+	loc := &errorsink.Location{}
+	return &s3.S3Location{Locatable: drivertop.NewIdentifierToken(loc, "Code"), Bucket: drivertop.MakeString(loc, "code"), Key: drivertop.MakeString(loc, key)}
+}
+
+func codeUpdated(h *awstest.Harness) bool {
+	return slices.Contains(h.Calls(), "Lambda.UpdateFunctionCode")
+}
+
+func TestZippedDirectoriesOnlyDependOnTheirFiles(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	role := runner(t, h)
+	first := t.TempDir()
+	writeFiles(t, first, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "bootstrap", "lib/a.so", "lib/b.so")
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(map[string]any{"Runtime": "go", "Code": first, "Role": role}))
+	h.Calls()
+
+	// the same files, written in another order at another time
+	second := t.TempDir()
+	writeFiles(t, second, time.Now(), "lib/b.so", "bootstrap", "lib/a.so")
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(map[string]any{"Runtime": "go", "Code": second, "Role": role}))
+	if codeUpdated(h) {
+		t.Fatalf("the code was the same, but was updated")
+	}
+
+	if err := os.WriteFile(filepath.Join(second, "lib/a.so"), []byte("new contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(map[string]any{"Runtime": "go", "Code": second, "Role": role}))
+	if !codeUpdated(h) {
+		t.Fatalf("the code had changed, but was not updated")
+	}
+}
+
+func TestOnlyImagesPinnedByDigestAreKnownToBeUnchanged(t *testing.T) {
+	h := awstest.New(t)
+	role := runner(t, h)
+	repo := "123456789012.dkr.ecr.us-east-1.amazonaws.com/orders"
+	for _, c := range []struct {
+		image  string
+		always bool
+	}{
+		{repo + "@sha256:" + strings.Repeat("ab", 32), false},
+		{repo + ":latest", true},
+	} {
+		fn := h.Coin("fn")
+		props := h.Props(map[string]any{"Code": c.image, "Role": role})
+		h.NextRun()
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", props)
+		h.Calls()
+		h.NextRun()
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", props)
+		if updated := codeUpdated(h); updated != c.always {
+			t.Fatalf("when nothing had changed, updating the code of %s was %v", c.image, updated)
+		}
+	}
+
+	// anything that is not in ECR is taken to be a local path
+	h.NextRun()
+	errs := h.Attempt(&lambda.FunctionBlank{}, h.Coin("other"), "other", h.Props(map[string]any{"Runtime": "go", "Code": "docker.io/library/orders:latest", "Role": role}))
+	if len(errs) != 1 || !strings.Contains(errs[0], "could not package the code") {
+		t.Fatalf("an image from outside ECR gave %v", errs)
+	}
+}
+
+func TestCodeInS3IsOnlyUpdatedWhenTheObjectChanges(t *testing.T) {
+	for _, checksum := range []bool{true, false} {
+		h := awstest.New(t)
+		role := runner(t, h)
+		if _, err := s3.CreateBucket(context.Background(), awss3.NewFromConfig(h.Fake.Config()), "code"); err != nil {
+			t.Fatal(err)
+		}
+		fn := h.Coin("fn")
+		props := h.Props(map[string]any{"Runtime": "go", "Code": inS3("handler.zip"), "Role": role})
+		putCode(t, h, "handler.zip", "v1", checksum)
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", props)
+		h.Calls()
+
+		h.NextRun()
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", props)
+		if codeUpdated(h) {
+			t.Fatalf("the object had not changed (checksum: %v), but the code was updated", checksum)
+		}
+
+		putCode(t, h, "handler.zip", "v2", checksum)
+		h.NextRun()
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", props)
+		if !codeUpdated(h) {
+			t.Fatalf("the object had changed (checksum: %v), but the code was not updated", checksum)
+		}
+	}
+}
+
+func TestBigCodeIsStagedInTheCodeBucket(t *testing.T) {
+	h := awstest.New(t)
+	role := runner(t, h)
+	if _, err := s3.CreateBucket(context.Background(), awss3.NewFromConfig(h.Fake.Config()), "staging"); err != nil {
+		t.Fatal(err)
+	}
+	// random bytes do not compress, so the zip is bigger than lambda will take
+	big := make([]byte, lambda.MaxZipFileSize+1024)
+	rand.NewChaCha8([32]byte{}).Read(big)
+	dir := codeDir(t, "v1")
+	if err := os.WriteFile(filepath.Join(dir, "data"), big, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := h.Attempt(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": dir, "Role": role}))
+	if len(errs) != 1 || !strings.Contains(errs[0], "must be staged in a CodeBucket") {
+		t.Fatalf("big code without a CodeBucket gave %v", errs)
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": dir, "Role": role, "CodeBucket": "staging"}))
+	if calls := h.Calls(); !slices.Contains(calls, "S3.PutObject") && !slices.Contains(calls, "S3.CompleteMultipartUpload") {
+		t.Fatalf("the code was not staged: %v", calls)
+	}
+	if !h.Fake.HasFunction("handler") {
+		t.Fatalf("the function was not created from the staged code")
+	}
+}
@@ -0,0 +1,197 @@
+package lambda
+
+import (
+	"fmt"
+	"slices"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// eventSourceProps are the properties of an aws.Lambda.EventSourceMapping that can be
+// given for each of the EventSources of a function; its Function is the one they are on
+var eventSourceProps = []string{"Source", "BatchSize", "BatchingWindow", "Filters", "Enabled", "StartingPosition"}
+
+// EventSourcesInterpreter reads the queues and streams a function reads from, one per line:
+//
+//	EventSources <- aws.Lambda.EventSources
+//		orders
+//			@Source "arn:aws:sqs:us-east-1:123456789012:orders"
+//			@BatchSize 10
+//			@BatchingWindow 5
+//		changes
+//			@Source (users -> streamArn)
+//			@StartingPosition "TRIM_HORIZON"
+//			@Filters "{\"eventName\": [\"INSERT\"]}"
+//			@Enabled 0
+type EventSourcesInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model *EventSourcesExpr
+}
+
+func (e *EventSourcesInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	if len(tokens) != 1 {
+		e.tools.Reporter.Report(tokens[0].Loc().Offset, "<event-source-id>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var id string
+	switch tok := tokens[0].(type) {
+	case driverbottom.Identifier:
+		id = tok.Id()
+	case driverbottom.String:
+		id = tok.Text()
+	default:
+		e.tools.Reporter.Report(tokens[0].Loc().Offset, "event source id must be an Identifier or a String")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	source := &EventSourceExpr{loc: tokens[0].Loc(), id: id, props: make(map[string]driverbottom.Expr)}
+	e.model.sources = append(e.model.sources, source)
+	return &EventSourceInterpreter{tools: e.tools, source: source}
+}
+
+func (e *EventSourcesInterpreter) Completed() {
+	e.parent.AddProperty(e.prop, e.model)
+}
+
+type EventSourceInterpreter struct {
+	tools  *driverbottom.CoreTools
+	source *EventSourceExpr
+}
+
+func (e *EventSourceInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok || len(tokens) < 2 {
+		e.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@<attribute> <value> ...")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	if !slices.Contains(eventSourceProps, adv.Name()) {
+		e.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid event source attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	if e.source.props[adv.Name()] != nil {
+		e.tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on event source %s", adv.Name(), e.source.id)
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var exprs []driverbottom.Expr
+	for _, t := range tokens[1:] {
+		ex, ok := t.(driverbottom.Expr)
+		if !ok {
+			e.tools.Reporter.Reportf(t.Loc().Offset, "@%s <value>", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		exprs = append(exprs, ex)
+	}
+	switch {
+	case adv.Name() == "Filters":
+		e.source.props[adv.Name()] = drivertop.NewListExpr(adv.Loc(), exprs)
+	case len(exprs) != 1:
+		e.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@%s <value>", adv.Name())
+		return drivertop.NewIgnoreInnerScope()
+	default:
+		e.source.props[adv.Name()] = exprs[0]
+	}
+	return drivertop.NewDisallowInnerScope(e.tools)
+}
+
+func (e *EventSourceInterpreter) Completed() {
+	if e.source.props["Source"] == nil {
+		e.tools.Reporter.ReportAtf(e.source.loc, "event source %s must have @Source", e.source.id)
+	}
+}
+
+// EventSourcesExpr is all the event sources of a function; lambda.function turns each
+// of them into an aws.Lambda.EventSourceMapping
+type EventSourcesExpr struct {
+	loc     *errorsink.Location
+	sources []*EventSourceExpr
+}
+
+func (e *EventSourcesExpr) Loc() *errorsink.Location {
+	return e.loc
+}
+
+func (e *EventSourcesExpr) ShortDescription() string {
+	return fmt.Sprintf("EventSources[%d]", len(e.sources))
+}
+
+func (e *EventSourcesExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("EventSourcesExpr")
+	to.AttrsWhere(e)
+	for _, s := range e.sources {
+		to.NestedAttr(s.id, s)
+	}
+	to.EndAttrs()
+}
+
+func (e *EventSourcesExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, s := range e.sources {
+		ret = ret.Merge(s.Resolve(r))
+	}
+	return ret
+}
+
+func (e *EventSourcesExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// each source is evaluated by its mapping
+	return e
+}
+
+func (e *EventSourcesExpr) String() string {
+	return e.ShortDescription()
+}
+
+// EventSourceExpr is one event source as it appears in the script
+type EventSourceExpr struct {
+	loc   *errorsink.Location
+	id    string
+	props map[string]driverbottom.Expr
+}
+
+func (e *EventSourceExpr) Loc() *errorsink.Location {
+	return e.loc
+}
+
+func (e *EventSourceExpr) ShortDescription() string {
+	return fmt.Sprintf("EventSource[%s]", e.id)
+}
+
+func (e *EventSourceExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("EventSourceExpr")
+	to.AttrsWhere(e)
+	to.TextAttr("id", e.id)
+	for _, p := range eventSourceProps {
+		if e.props[p] != nil {
+			to.NestedAttr(p, e.props[p])
+		}
+	}
+	to.EndAttrs()
+}
+
+func (e *EventSourceExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, p := range e.props {
+		ret = ret.Merge(p.Resolve(r))
+	}
+	return ret
+}
+
+func (e *EventSourceExpr) Eval(s driverbottom.RuntimeStorage) any {
+	return e
+}
+
+func (e *EventSourceExpr) String() string {
+	return e.ShortDescription()
+}
+
+func CreateEventSourcesInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &EventSourcesInterpreter{tools: tools, parent: parent, prop: prop, model: &EventSourcesExpr{loc: prop.Loc()}}
+}
+
+var _ driverbottom.Interpreter = &EventSourcesInterpreter{}
+var _ driverbottom.Interpreter = &EventSourceInterpreter{}
+var _ driverbottom.Expr = &EventSourcesExpr{}
+var _ driverbottom.Expr = &EventSourceExpr{}
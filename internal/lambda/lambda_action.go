@@ -9,6 +9,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/env"
 	"ziniki.org/deployer/modules/aws/internal/iam"
 )
 
@@ -46,6 +47,8 @@ func (l *lambdaAction) AddAdverb(adv driverbottom.Adverb, tokens []driverbottom.
 			panic("invalid tokens")
 		}
 		l.teardown = &LambdaTearDown{mode: tokens[0].(driverbottom.Identifier).Id()}
+	} else if adv.Name() == "timeout" {
+		env.TimeoutAdverb(l.tools, l.props, adv, tokens)
 	} else {
 		l.tools.Reporter.ReportAtf(adv.Loc(), "there is no adverb %s", adv.Name())
 	}
@@ -85,7 +88,7 @@ func (l *lambdaAction) Completed() {
 	lambdaCoin := corebottom.CoinId(l.tools.Storage.PendingObjId(l.named.Loc()))
 
 	role := utils.FindProp(l.props, notused, "Role")
-	funcProps := utils.UseProps(l.props, notused, "Code", "Handler", "Runtime", "VpcConfig")
+	funcProps := utils.UseProps(l.props, notused, "Code", "CodeBucket", "Env", "Handler", "Runtime", "Timeout", "DeployTimeout", "VpcConfig", "MemorySize", "Environment", "Architectures", "EphemeralStorage", "Description", "Tags", "Layers")
 	switch v := role.(type) {
 	case *iam.WithRole:
 		l.coins.withRole = v
@@ -93,6 +96,7 @@ func (l *lambdaAction) Completed() {
 		l.coins.roleCoin = roleCoin
 		rprops := make(map[driverbottom.Identifier]driverbottom.Expr)
 		rprops[drivertop.NewIdentifierToken(role.Loc(), "Assume")] = v.Assumes
+		utils.CopyProps(rprops, l.props, notused, "Env", "DeployTimeout")
 		l.coins.roleCreator = (&iam.RoleBlank{}).Mint(l.tools, l.coins.withRole.Loc(), roleCoin, l.coins.withRole.Name(), rprops, l.teardown)
 		l.coins.roleCreator.(iam.AcceptPolicies).AddPolicies(v.Managed, v.Inline)
 		roleId := utils.PropId(l.props, "Role")
@@ -105,7 +109,7 @@ func (l *lambdaAction) Completed() {
 
 	if utils.HasProp(l.props, "PublishVersion", "Alias") {
 		versionerCoin := corebottom.CoinId(l.tools.Storage.PendingObjId(l.loc))
-		props := utils.UseProps(l.props, notused, "PublishVersion", "Alias")
+		props := utils.UseProps(l.props, notused, "PublishVersion", "Alias", "Env", "DeployTimeout")
 		nameId := drivertop.NewIdentifierToken(l.named.Loc(), "Name")
 		getLambda := coretop.MakeGetCoinMethod(l.named.Loc(), l.coins.lambda.coin)
 		arnId := drivertop.NewIdentifierToken(l.named.Loc(), "arn")
@@ -113,6 +117,22 @@ func (l *lambdaAction) Completed() {
 		l.coins.versioner = &lambdaVersioner{tools: l.tools, coin: versionerCoin, props: props}
 	}
 
+	if sources, ok := utils.FindProp(l.props, notused, "EventSources").(*EventSourcesExpr); ok {
+		getLambda := coretop.MakeGetCoinMethod(l.named.Loc(), l.coins.lambda.coin)
+		for _, es := range sources.sources {
+			props := make(map[driverbottom.Identifier]driverbottom.Expr)
+			props[drivertop.NewIdentifierToken(es.loc, "Function")] = drivertop.MakeInvokeExpr(getLambda, drivertop.NewIdentifierToken(es.loc, "arn"))
+			for _, p := range eventSourceProps {
+				if es.props[p] != nil {
+					props[drivertop.NewIdentifierToken(es.loc, p)] = es.props[p]
+				}
+			}
+			utils.CopyProps(props, l.props, notused, "Env", "DeployTimeout")
+			mappingCoin := corebottom.CoinId(l.tools.Storage.PendingObjId(es.loc))
+			l.coins.mappings = append(l.coins.mappings, &mappingCreator{tools: l.tools, teardown: l.teardown, loc: es.loc, coin: mappingCoin, name: l.named.Text() + ":" + es.id, props: props})
+		}
+	}
+
 	// check all properties specified have been used
 	for k, id := range notused {
 		if id != nil {
@@ -130,6 +150,9 @@ func (l *lambdaAction) Resolve(r driverbottom.Resolver) driverbottom.BindingRequ
 		l.coins.versioner.coin.Resolve(l.tools.Storage)
 		l.coins.versioner.Resolve(r)
 	}
+	for _, m := range l.coins.mappings {
+		ret = ret.Merge(m.Resolve(r))
+	}
 	for _, p := range l.props {
 		ret = ret.Merge(p.Resolve(r))
 	}
@@ -145,6 +168,9 @@ func (l *lambdaAction) DetermineInitialState(pres corebottom.ValuePresenter) {
 	if l.coins.versioner != nil {
 		l.coins.versioner.DetermineInitialState(mypres)
 	}
+	for _, m := range l.coins.mappings {
+		m.DetermineInitialState(mypres)
+	}
 	pres.Present(mypres.lambda)
 }
 
@@ -157,6 +183,9 @@ func (l *lambdaAction) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	if l.coins.versioner != nil {
 		l.coins.versioner.DetermineDesiredState(mypres)
 	}
+	for _, m := range l.coins.mappings {
+		m.DetermineDesiredState(mypres)
+	}
 	pres.Present(mypres.lambda)
 }
 
@@ -172,9 +201,15 @@ func (l *lambdaAction) UpdateReality() {
 	if l.coins.versioner != nil {
 		l.coins.versioner.UpdateReality()
 	}
+	for _, m := range l.coins.mappings {
+		m.UpdateReality()
+	}
 }
 
 func (l *lambdaAction) TearDown() {
+	for _, m := range l.coins.mappings {
+		m.TearDown()
+	}
 	if l.coins.versioner != nil {
 		l.coins.versioner.TearDown()
 	}
@@ -229,6 +264,10 @@ func (c *coinPresenter) Present(value any) {
 	case *publishVersionModel:
 		c.publishVersion = value
 		l.tools.Storage.Bind(l.coins.versioner.coin, value)
+	case *EventSourceMappingAWSModel:
+		l.tools.Storage.Bind(value.coin, value)
+	case *EventSourceMappingModel:
+		l.tools.Storage.Bind(value.coin, value)
 	default:
 		log.Fatalf("need to handle present(%T %v)\n", value, value)
 	}
@@ -11,4 +11,5 @@ type lambdaCoins struct {
 	roleCreator   corebottom.Ensurable
 	versioner     *lambdaVersioner
 	lambda        *lambdaCreator
+	mappings      []*mappingCreator
 }
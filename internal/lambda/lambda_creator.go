@@ -3,17 +3,21 @@ package lambda
 import (
 	"context"
 	"log"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/smithy-go"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
-	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	"ziniki.org/deployer/modules/aws/internal/s3"
 )
 
@@ -26,7 +30,11 @@ type lambdaCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *lambda.Client
+	client  *lambda.Client
+	staging *awss3.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (lc *lambdaCreator) Loc() *errorsink.Location {
@@ -49,26 +57,39 @@ func (lc *lambdaCreator) CoinId() corebottom.CoinId {
 }
 
 func (lc *lambdaCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := lc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(lc.tools, lc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	lc.client = awsEnv.LambdaClient()
+	lc.staging = awsEnv.S3Client()
+	lc.ctx = awsEnv.Context()
+	lc.timeout = env.ObtainTimeout(lc.tools, lc.props)
+	lc.plan = awsEnv.Plan()
 
-	req, err := lc.client.GetFunction(context.TODO(), &lambda.GetFunctionInput{FunctionName: &lc.name})
+	req, err := lc.client.GetFunction(lc.ctx, &lambda.GetFunctionInput{FunctionName: &lc.name})
 	if err != nil {
 		if !lambdaExists(err) {
 			pres.NotFound()
 			return
 		}
-		log.Fatalf("could not recover function %s: %v\n", lc.name, err)
+		lc.tools.Reporter.ReportAtf(lc.loc, "could not recover function %s: %v", lc.name, err)
+		return
 	}
 	if req == nil {
 		pres.NotFound()
 		return
 	}
-	model := &LambdaAWSModel{name: lc.name, config: req.Configuration}
+	model := &LambdaAWSModel{name: lc.name, config: req.Configuration, tags: req.Tags}
+	if req.Code != nil && req.Code.ImageUri != nil {
+		model.image = *req.Code.ImageUri
+	}
+	// this is ours, not the script's
+	if source, ok := model.tags[sourceTag]; ok {
+		model.codeSource = source
+		delete(model.tags, sourceTag)
+	}
 	pres.Present(model)
 }
 
@@ -78,12 +99,42 @@ func (lc *lambdaCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	var role driverbottom.Expr
 	var vpcConfig driverbottom.Expr
 	var code *s3.S3Location
+	model := &LambdaModel{name: lc.name, loc: lc.loc, coin: lc.coin}
 	for p, v := range lc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
+		case "Timeout":
+			model.timeout = v
+		case "MemorySize":
+			model.memorySize = v
+		case "Environment":
+			model.environment = v
+		case "Architectures":
+			model.architectures = v
+		case "EphemeralStorage":
+			model.ephemeralStorage = v
+		case "Description":
+			model.description = v
+		case "Tags":
+			model.tags = v
+		case "Layers":
+			model.layers = v
 		case "Runtime":
 			runtime = v
 		case "Code":
-			code = v.(*s3.S3Location)
+			if loc, ok := v.(*s3.S3Location); ok {
+				code = loc
+				break
+			}
+			// a local directory or zip, or an image
+			str, ok := lc.tools.Storage.EvalAsStringer(v)
+			if !ok {
+				lc.tools.Reporter.ReportAtf(v.Loc(), "Code must be an aws.S3.Location, a directory, a zip or an image")
+				break
+			}
+			model.source = str.String()
+		case "CodeBucket":
+			model.codeBucket = v
 		case "Handler":
 			handler = v
 		case "Role":
@@ -94,78 +145,59 @@ func (lc *lambdaCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 			lc.tools.Reporter.ReportAtf(p.Loc(), "invalid property for Lambda: %s", p.Id())
 		}
 	}
-	if code == nil {
+	if code == nil && model.source == "" {
 		lc.tools.Reporter.ReportAtf(lc.loc, "Code was not defined")
 	}
-	if runtime == nil {
+	if isImage(model.source) {
+		if runtime != nil || handler != nil {
+			lc.tools.Reporter.ReportAtf(lc.loc, "cannot specify Runtime or Handler for a function from an image")
+		}
+	} else if runtime == nil {
 		lc.tools.Reporter.ReportAtf(lc.loc, "Runtime was not defined")
 	}
 	if role == nil {
 		lc.tools.Reporter.ReportAtf(lc.loc, "Role was not defined")
 	}
 
-	model := &LambdaModel{name: lc.name, loc: lc.loc, coin: lc.coin, code: code, handler: handler, runtime: runtime, role: role, vpcConfig: vpcConfig}
+	model.code = code
+	model.handler = handler
+	model.runtime = runtime
+	model.role = role
+	model.vpcConfig = vpcConfig
 	pres.Present(model)
 }
 
 func (lc *lambdaCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(lc.ctx, lc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.Function", lc.name, lc.coin)
+
 	tmp := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_INITIAL_MODE)
 	desired := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_DESIRED_MODE).(*LambdaModel)
 	created := &LambdaAWSModel{name: lc.name}
 
-	var handler string
-	if desired.handler != nil {
-		h, ok := lc.tools.Storage.EvalAsStringer(desired.handler)
-		if !ok {
-			log.Fatalf("Failed to get handler")
-		}
-		handler = h.String()
-	}
-
-	rt, ok := lc.tools.Storage.EvalAsStringer(desired.runtime)
-	if !ok {
-		log.Fatalf("Failed to get runtime")
-	}
+	// functions from images have neither runtime nor handler
 	var runtime types.Runtime
-	switch rt.String() {
-	case "go":
-		runtime = types.RuntimeProvidedal2023
-		if handler == "" {
-			handler = "main-point"
-		}
-	default:
-		for _, r := range types.RuntimeProvided.Values() {
-			if string(r) == rt.String() {
-				runtime = types.Runtime(rt.String())
-				break
-			}
-		}
-		if runtime == "" {
-			lc.tools.Reporter.ReportAtf(lc.loc, "invalid runtime: %s", rt.String())
+	var handler *string
+	if !isImage(desired.source) {
+		var ok bool
+		runtime, handler, ok = lc.runtime(desired)
+		if !ok {
 			return
 		}
 	}
-	b1, ok := lc.tools.Storage.EvalAsStringer(desired.code.Bucket)
-	if !ok {
-		log.Fatalf("Failed to get bucket")
-	}
-	b2, ok := lc.tools.Storage.EvalAsStringer(desired.code.Key)
+
+	code, ok := codeFrom(ctx, lc.tools, lc.staging, lc.loc, lc.name, desired.code, desired.source)
 	if !ok {
-		log.Fatalf("Failed to get key")
+		return
 	}
-	bucket := b1.String()
-	key := b2.String()
 
 	roleArn, ok := lc.tools.Storage.EvalAsStringer(desired.role)
 	if !ok {
-		log.Fatalf("Failed to evaluate role")
-	}
-	role := roleArn.String()
-
-	if handler == "" {
-		lc.tools.Reporter.ReportAtf(lc.loc, "must specify Handler for Runtime %s", rt.String())
+		lc.tools.Reporter.ReportAtf(desired.role.Loc(), "Role must be a string")
 		return
 	}
+	role := roleArn.String()
 
 	var vpcConfig *types.VpcConfig
 	if desired.vpcConfig != nil {
@@ -181,88 +213,281 @@ func (lc *lambdaCreator) UpdateReality() {
 			vpcConfig.Ipv6AllowedForDualStack = &dualStack
 		}
 	}
+	settings, err := settingsOf(lc.tools.Storage, desired)
+	if err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "%v", err)
+		return
+	}
+	if lc.plan != nil {
+		lc.planChanges(tmp, runtime, aws.ToString(handler), role, code, vpcConfig, settings)
+		return
+	}
+	if err := stageCode(ctx, lc.tools, lc.staging, lc.name, desired.codeBucket, code); err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "could not stage the code for %s: %v", lc.name, err)
+		return
+	}
+
 	var arn string
+	var failed error
+	action := "created"
 	if tmp != nil {
 		found := tmp.(*LambdaAWSModel)
-		created.config = found.config
+		action = "updated"
+		arn = *found.config.FunctionArn
 		log.Printf("lambda %s already existed for %s\n", *found.config.FunctionArn, found.name)
-		utils.ExponentialBackoff(func() bool {
-			input := lambda.UpdateFunctionConfigurationInput{FunctionName: &lc.name, Runtime: runtime, Handler: &handler, Role: &role, VpcConfig: vpcConfig}
-			out, err := lc.client.UpdateFunctionConfiguration(context.TODO(), &input)
-			if err != nil {
-				if invalidRole(err) {
-					log.Printf("failed to create lambda %s because role was unassumable, waiting...\n", lc.name)
-					return false
+		if !plan.Changed(configFields(found, runtime, aws.ToString(handler), role, vpcConfig, settings)...) {
+			log.Printf("configuration of %s has not changed\n", lc.name)
+		} else {
+			failed = env.Backoff(ctx, func() (bool, error) {
+				input := lambda.UpdateFunctionConfigurationInput{FunctionName: &lc.name, Runtime: runtime, Handler: handler, Role: &role, VpcConfig: vpcConfig}
+				settings.applyToUpdate(&input)
+				out, err := lc.client.UpdateFunctionConfiguration(ctx, &input)
+				if err != nil {
+					if invalidRole(err) {
+						log.Printf("failed to update lambda %s because role was unassumable, waiting...\n", lc.name)
+						return false, nil
+					}
+					return false, err
 				}
-				log.Fatalf("failed to create lambda %s: %v\n", lc.name, err)
+				arn = *out.FunctionArn
+				return true, nil
+			})
+			if failed != nil {
+				lc.tools.Reporter.ReportAtf(lc.loc, "failed to update lambda %s: %v", lc.name, failed)
+				return
 			}
-			arn = *out.FunctionArn
-			return true
-		})
-		lc.tools.Storage.Bind(lc.coin, created)
-
-		log.Printf("updating function code")
-		utils.ExponentialBackoff(func() bool {
+		}
 
-			_, err := lc.client.UpdateFunctionCode(context.TODO(), &lambda.UpdateFunctionCodeInput{FunctionName: &lc.name, S3Bucket: &bucket, S3Key: &key})
-			if err != nil {
-				if isUpdatingFunction(err) {
-					log.Printf("failed to update lambda code %s because already updating configuration, waiting...\n", lc.name)
-					return false
+		if code.unchanged(found) && !plan.Changed(settings.comparedArchitecture(found.config)...) {
+			log.Printf("function code for %s has not changed\n", lc.name)
+		} else {
+			log.Printf("updating function code")
+			var sha string
+			failed = env.Backoff(ctx, func() (bool, error) {
+				input := lambda.UpdateFunctionCodeInput{FunctionName: &lc.name, Architectures: settings.architectures()}
+				code.applyTo(&input)
+				out, err := lc.client.UpdateFunctionCode(ctx, &input)
+				if err != nil {
+					if isUpdatingFunction(err) {
+						log.Printf("failed to update lambda code %s because already updating configuration, waiting...\n", lc.name)
+						return false, nil
+					}
+					return false, err
 				}
-				log.Fatalf("failed to update function code: %v\n", err)
+				sha = aws.ToString(out.CodeSha256)
+				return true, nil
+			})
+			if failed != nil {
+				lc.tools.Reporter.ReportAtf(lc.loc, "failed to update function code for %s: %v", lc.name, failed)
+				return
 			}
-			return true
-		})
+			if err := lc.recordSource(ctx, arn, code, sha); err != nil {
+				lc.tools.Reporter.ReportAtf(lc.loc, "failed to tag lambda %s: %v", lc.name, err)
+				return
+			}
+		}
+
+		add, remove := settings.retag(found.tags)
+		if err := lc.retag(ctx, arn, add, remove); err != nil {
+			lc.tools.Reporter.ReportAtf(lc.loc, "failed to tag lambda %s: %v", lc.name, err)
+			return
+		}
 	} else {
-		utils.ExponentialBackoff(func() bool {
-			req, err := lc.client.CreateFunction(context.TODO(), &lambda.CreateFunctionInput{FunctionName: &lc.name, Runtime: runtime, Handler: &handler, Code: &types.FunctionCode{S3Bucket: &bucket, S3Key: &key}, Role: &role, VpcConfig: vpcConfig})
+		var sha string
+		failed = env.Backoff(ctx, func() (bool, error) {
+			fc, pkg := code.forCreate()
+			input := lambda.CreateFunctionInput{FunctionName: &lc.name, Runtime: runtime, Handler: handler, Code: fc, PackageType: pkg, Role: &role, VpcConfig: vpcConfig}
+			settings.applyToCreate(&input)
+			req, err := lc.client.CreateFunction(ctx, &input)
 			if err != nil {
 				if invalidRole(err) {
 					log.Printf("failed to create lambda %s because role was unassumable, waiting...\n", lc.name)
-					return false
+					return false, nil
 				}
-				log.Fatalf("failed to create lambda %s: %v\n", lc.name, err)
+				return false, err
 			}
 			arn = *req.FunctionArn
-			return true
+			sha = aws.ToString(req.CodeSha256)
+			return true, nil
 		})
+		if failed != nil {
+			lc.tools.Reporter.ReportAtf(lc.loc, "failed to create lambda %s: %v", lc.name, failed)
+			return
+		}
+		if err := lc.recordSource(ctx, arn, code, sha); err != nil {
+			lc.tools.Reporter.ReportAtf(lc.loc, "failed to tag lambda %s: %v", lc.name, err)
+			return
+		}
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		stat, err := lc.client.GetFunction(context.TODO(), &lambda.GetFunctionInput{FunctionName: &lc.name})
+	// once it is active, the function is read again, so that what is bound is what it is now
+	failed = env.Backoff(ctx, func() (bool, error) {
+		stat, err := lc.client.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: &lc.name})
 		if err != nil {
-			panic(err)
+			return false, err
 		}
 		if stat.Configuration.State == "Active" {
-			return true
+			created.config = stat.Configuration
+			created.tags = stat.Tags
+			return true, nil
 		}
 		log.Printf("waiting for lambda to be active, stat = %v\n", stat.Configuration.State)
-		return false
+		return false, nil
 	})
+	if failed != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "failed to recover state of lambda %s: %v", lc.name, failed)
+		return
+	}
 
-	log.Printf("created lambda %s: %s\n", lc.name, arn)
-	created.config = &types.FunctionConfiguration{FunctionArn: &arn}
-
+	log.Printf("%s lambda %s: %s\n", action, lc.name, arn)
 	lc.tools.Storage.Bind(lc.coin, created)
 }
 
 func (lc *lambdaCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(lc.ctx, lc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.Function", lc.name, lc.coin)
+
 	tmp := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*LambdaAWSModel)
 		log.Printf("you have asked to tear down lambda %s with mode %s\n", found.name, lc.teardown.Mode())
+		if lc.plan != nil {
+			lc.plan.Delete("aws.Lambda.Function", found.name)
+			return
+		}
 
-		_, err := lc.client.DeleteFunction(context.TODO(), &lambda.DeleteFunctionInput{FunctionName: &found.name})
+		_, err := lc.client.DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: &found.name})
 		if err != nil {
-			log.Fatalf("failed to delete lambda %s: %v\n", found.name, err)
+			lc.tools.Reporter.ReportAtf(lc.loc, "failed to delete lambda %s: %v", found.name, err)
 		}
 	} else {
 		log.Printf("no lambda existed for %s\n", lc.name)
 	}
 }
 
+// runtime works out the runtime and handler of a function that is not from an image
+func (lc *lambdaCreator) runtime(desired *LambdaModel) (types.Runtime, *string, bool) {
+	var handler string
+	if desired.handler != nil {
+		h, ok := lc.tools.Storage.EvalAsStringer(desired.handler)
+		if !ok {
+			lc.tools.Reporter.ReportAtf(desired.handler.Loc(), "Handler must be a string")
+			return "", nil, false
+		}
+		handler = h.String()
+	}
+
+	rt, ok := lc.tools.Storage.EvalAsStringer(desired.runtime)
+	if !ok {
+		lc.tools.Reporter.ReportAtf(desired.runtime.Loc(), "Runtime must be a string")
+		return "", nil, false
+	}
+	var runtime types.Runtime
+	switch rt.String() {
+	case "go":
+		runtime = types.RuntimeProvidedal2023
+		if handler == "" {
+			handler = "main-point"
+		}
+	default:
+		for _, r := range types.RuntimeProvided.Values() {
+			if string(r) == rt.String() {
+				runtime = types.Runtime(rt.String())
+				break
+			}
+		}
+		if runtime == "" {
+			lc.tools.Reporter.ReportAtf(lc.loc, "invalid runtime: %s", rt.String())
+			return "", nil, false
+		}
+	}
+	if handler == "" {
+		lc.tools.Reporter.ReportAtf(lc.loc, "must specify Handler for Runtime %s", rt.String())
+		return "", nil, false
+	}
+	return runtime, &handler, true
+}
+
+// recordSource tags the function with the ETag of the code it was given in S3, if
+// there is no other way of telling that it is the same code next time
+func (lc *lambdaCreator) recordSource(ctx context.Context, arn string, code *functionCode, sha string) error {
+	source := code.source(sha)
+	if source == "" {
+		return nil
+	}
+	_, err := lc.client.TagResource(ctx, &lambda.TagResourceInput{Resource: &arn, Tags: map[string]string{sourceTag: source}})
+	return err
+}
+
+// retag adds and removes the tags on an existing function so that they are as in the script
+func (lc *lambdaCreator) retag(ctx context.Context, arn string, add map[string]string, remove []string) error {
+	if len(add) > 0 {
+		_, err := lc.client.TagResource(ctx, &lambda.TagResourceInput{Resource: &arn, Tags: add})
+		if err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		_, err := lc.client.UntagResource(ctx, &lambda.UntagResourceInput{Resource: &arn, TagKeys: remove})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planChanges records what UpdateReality would do to the function, without doing it
+func (lc *lambdaCreator) planChanges(tmp any, runtime types.Runtime, handler, role string, code *functionCode, vpcConfig *types.VpcConfig, settings settings) {
+	var subnets, groups []string
+	if vpcConfig != nil {
+		subnets = vpcConfig.SubnetIds
+		groups = vpcConfig.SecurityGroupIds
+	}
+	if tmp == nil {
+		fields := []plan.Field{plan.Set("Runtime", runtime), plan.Set("Handler", handler), plan.Set("Role", role), plan.Set("Code", code), plan.Set("SubnetIds", subnets), plan.Set("SecurityGroupIds", groups)}
+		lc.plan.Create("aws.Lambda.Function", lc.name, append(fields, settings.planned()...)...)
+		arn := plan.Placeholder("aws.Lambda.Function", lc.name)
+		lc.tools.Storage.Bind(lc.coin, &LambdaAWSModel{name: lc.name, config: &types.FunctionConfiguration{FunctionName: &lc.name, FunctionArn: &arn}})
+		return
+	}
+
+	found := tmp.(*LambdaAWSModel)
+	fields := configFields(found, runtime, handler, role, vpcConfig, settings)
+	if !code.unchanged(found) {
+		fields = append(fields, plan.Compare("Code", code.found(found), code.String()))
+	}
+	fields = append(fields, settings.comparedArchitecture(found.config)...)
+	fields = append(fields, settings.comparedTags(found.tags)...)
+	lc.plan.Update("aws.Lambda.Function", lc.name, fields...)
+	lc.tools.Storage.Adopt(lc.coin, found)
+}
+
+// configFields are the fields of an existing function that UpdateFunctionConfiguration changes;
+// if none of them are different, there is no need to call it.  Lambda does not keep the
+// subnets and security groups in the order they were given, so they are compared sorted.
+func configFields(found *LambdaAWSModel, runtime types.Runtime, handler, role string, vpcConfig *types.VpcConfig, settings settings) []plan.Field {
+	var subnets, groups, foundSubnets, foundGroups []string
+	if vpcConfig != nil {
+		subnets = slices.Sorted(slices.Values(vpcConfig.SubnetIds))
+		groups = slices.Sorted(slices.Values(vpcConfig.SecurityGroupIds))
+	}
+	if found.config.VpcConfig != nil {
+		foundSubnets = slices.Sorted(slices.Values(found.config.VpcConfig.SubnetIds))
+		foundGroups = slices.Sorted(slices.Values(found.config.VpcConfig.SecurityGroupIds))
+	}
+	fields := []plan.Field{
+		plan.Compare("Runtime", found.config.Runtime, runtime),
+		plan.Compare("Handler", found.config.Handler, handler),
+		plan.Compare("Role", found.config.Role, role),
+		plan.Compare("SubnetIds", foundSubnets, subnets),
+		plan.Compare("SecurityGroupIds", foundGroups, groups),
+	}
+	return append(fields, settings.compared(found.config)...)
+}
+
+// lambdaExists is false only for a 404 ResourceNotFoundException
 func lambdaExists(err error) bool {
 	if err == nil {
 		return true
@@ -270,24 +495,18 @@ func lambdaExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*http.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				switch e4 := e2.Err.(type) {
-				case *types.ResourceNotFoundException:
-					return false
-				default:
-					log.Printf("error: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			switch e2.Err.(type) {
+			case *types.ResourceNotFoundException:
+				return false
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting lambda failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
+// invalidRole is true if the role we have given lambda cannot (yet) be assumed;
+// this usually means that it has only just been created and will become valid
 func invalidRole(err error) bool {
 	if err == nil {
 		return false
@@ -295,26 +514,14 @@ func invalidRole(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*http.ResponseError)
-		if ok {
-			// log.Printf("%v %s", e2, e2.Err)
-			if e2.ResponseError.Response.StatusCode == 400 {
-				switch e4 := e2.Err.(type) {
-				case *types.InvalidParameterValueException:
-					// log.Printf("error: %T %v %s", e4, e4, e4.ErrorMessage())
-					s := e4.ErrorMessage()
-					ret := strings.HasSuffix(s, "cannot be assumed by Lambda.")
-					return ret
-				default:
-					log.Printf("not invalid: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 400 {
+			switch e4 := e2.Err.(type) {
+			case *types.InvalidParameterValueException:
+				return strings.HasSuffix(e4.ErrorMessage(), "cannot be assumed by Lambda.")
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("not response error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("creating lambda failed: %T %v", err, err)
-	panic("failed")
+	return false
 }
 
 var _ corebottom.Ensurable = &lambdaCreator{}
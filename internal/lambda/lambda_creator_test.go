@@ -0,0 +1,159 @@
+package lambda_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsiam "github.com/aws/aws-sdk-go-v2/service/iam"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/internal/vpc"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+// runner creates a role for functions to run as, returning its ARN
+func runner(t *testing.T, h *awstest.Harness) string {
+	client := awsiam.NewFromConfig(h.Fake.Config())
+	out, err := client.CreateRole(context.Background(), &awsiam.CreateRoleInput{RoleName: aws.String("runner"), AssumeRolePolicyDocument: aws.String("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Calls()
+	return *out.Role.Arn
+}
+
+// codeDir makes a directory with the code for a function in it
+func codeDir(t *testing.T, contents string) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bootstrap"), []byte(contents), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGoFunctionRunsItsCodeFromS3(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	role := runner(t, h)
+	props := func(key string) map[string]any {
+		return map[string]any{"Runtime": "go", "Role": role, "Code": &s3.S3Location{Bucket: h.Expr("code"), Key: h.Expr(key)}}
+	}
+	get := func() *awslambda.GetFunctionOutput {
+		out, err := awslambda.NewFromConfig(h.Fake.Config()).GetFunction(context.Background(), &awslambda.GetFunctionInput{FunctionName: aws.String("handler")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props("v1.zip")))
+	got := get()
+	if got.Configuration.Runtime != "provided.al2023" || aws.ToString(got.Configuration.Handler) != "main-point" {
+		t.Fatalf("go function has runtime %s and handler %s", got.Configuration.Runtime, aws.ToString(got.Configuration.Handler))
+	}
+	if aws.ToString(got.Configuration.Role) != role || aws.ToString(got.Code.Location) != "v1.zip" {
+		t.Fatalf("function runs %s as %s", aws.ToString(got.Code.Location), aws.ToString(got.Configuration.Role))
+	}
+
+	h.NextRun()
+	h.Calls()
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props("v2.zip")))
+	if calls := h.Calls(); slices.Contains(calls, "Lambda.CreateFunction") {
+		t.Fatalf("function already existed: %v", calls)
+	}
+	if loc := aws.ToString(get().Code.Location); loc != "v2.zip" {
+		t.Fatalf("function still runs %s", loc)
+	}
+}
+
+// ids are the ids of subnets or security groups, in the order a script has them
+type ids []string
+
+func (i ids) Loc() *errorsink.Location {
+	return &errorsink.Location{}
+}
+
+func (i ids) ShortDescription() string {
+	return fmt.Sprintf("ids%v", []string(i))
+}
+
+func (i ids) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("ids")
+	to.EndAttrs()
+}
+
+func (i ids) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	return driverbottom.MAY_BE_BOUND
+}
+
+func (i ids) Eval(s driverbottom.RuntimeStorage) any {
+	return []string(i)
+}
+
+func (i ids) String() string {
+	return i.ShortDescription()
+}
+
+func TestFunctionIsOnlyChangedWhereTheScriptIs(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	loc := &errorsink.Location{}
+	// lambda does not give these back in the same order
+	network := &vpc.VPCConfig{Locatable: drivertop.NewIdentifierToken(loc, "VpcConfig"), Subnets: ids{"subnet-b", "subnet-a"}, SecurityGroups: ids{"sg-2", "sg-1"}}
+	props := map[string]any{
+		"Runtime":          "go",
+		"Code":             codeDir(t, "v1"),
+		"Role":             runner(t, h),
+		"MemorySize":       256,
+		"Timeout":          30,
+		"EphemeralStorage": 1024,
+		"Description":      "orders",
+		"Architectures":    "arm64",
+		"Environment":      tagged(h, "TABLE", "orders"),
+		"Tags":             tagged(h, "Team", "web"),
+		"VpcConfig":        network,
+	}
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	h.Calls()
+	changes := func() []string {
+		var ret []string
+		for _, c := range h.Calls() {
+			if c == "Lambda.UpdateFunctionConfiguration" || c == "Lambda.UpdateFunctionCode" || c == "Lambda.TagResource" || c == "Lambda.UntagResource" {
+				ret = append(ret, c)
+			}
+		}
+		return ret
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	if changed := changes(); len(changed) != 0 {
+		t.Fatalf("nothing had changed, but %v were called", changed)
+	}
+
+	for _, c := range []struct {
+		prop  string
+		value any
+		call  string
+	}{
+		{"MemorySize", 512, "Lambda.UpdateFunctionConfiguration"},
+		{"Code", codeDir(t, "v2"), "Lambda.UpdateFunctionCode"},
+		{"Tags", tagged(h, "Team", "api"), "Lambda.TagResource"},
+	} {
+		h.NextRun()
+		props[c.prop] = c.value
+		h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+		if changed := changes(); !slices.Equal(changed, []string{c.call}) {
+			t.Fatalf("changing %s should only have called %s, not %v", c.prop, c.call, changed)
+		}
+	}
+}
@@ -16,11 +16,23 @@ type LambdaModel struct {
 	loc  *errorsink.Location
 	coin corebottom.CoinId
 
-	code      *s3.S3Location
-	runtime   driverbottom.Expr
-	handler   driverbottom.Expr
-	role      driverbottom.Expr
-	vpcConfig driverbottom.Expr
+	code *s3.S3Location
+	// source is a local directory or zip, or an image, if the code is not in S3
+	source     string
+	codeBucket driverbottom.Expr
+	runtime    driverbottom.Expr
+	handler    driverbottom.Expr
+	role       driverbottom.Expr
+	vpcConfig  driverbottom.Expr
+
+	memorySize       driverbottom.Expr
+	timeout          driverbottom.Expr
+	environment      driverbottom.Expr
+	architectures    driverbottom.Expr
+	ephemeralStorage driverbottom.Expr
+	description      driverbottom.Expr
+	tags             driverbottom.Expr
+	layers           driverbottom.Expr
 }
 
 func (model *LambdaModel) ObtainMethod(name string) driverbottom.Method {
@@ -53,6 +65,10 @@ type LambdaAWSModel struct {
 	coin corebottom.CoinId
 
 	config *types.FunctionConfiguration
+	tags   map[string]string
+	image  string
+	// where the code came from in S3, as recorded in its sourceTag
+	codeSource string
 }
 
 // this is only the bit after "arn:aws:apigateway:api-region:" which is common to all
@@ -0,0 +1,265 @@
+package lambda
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// settings are the parts of a function's configuration other than its runtime, handler,
+// role and code; anything which is not given in the script is left as it is
+type settings struct {
+	memorySize       *int32
+	timeout          *int32
+	environment      map[string]string
+	architecture     types.Architecture
+	ephemeralStorage *int32
+	description      *string
+	tags             map[string]string
+	layers           []string
+}
+
+// settingsOf evaluates the settings in the desired model; this is done in UpdateReality
+// so that the Environment can refer to things (such as table names) created before it
+func settingsOf(s driverbottom.RuntimeStorage, desired *LambdaModel) (settings, error) {
+	var ret settings
+	var err error
+	if ret.memorySize, err = sized(s, desired.memorySize, "MemorySize", 128, 10240); err != nil {
+		return ret, err
+	}
+	if ret.timeout, err = sized(s, desired.timeout, "Timeout", 1, 900); err != nil {
+		return ret, err
+	}
+	if ret.ephemeralStorage, err = sized(s, desired.ephemeralStorage, "EphemeralStorage", 512, 10240); err != nil {
+		return ret, err
+	}
+	if desired.environment != nil {
+		vars, ok := desired.environment.Eval(s).(map[string]string)
+		if !ok {
+			return ret, fmt.Errorf("Environment must be defined with aws.Lambda.Environment")
+		}
+		ret.environment = vars
+	}
+	if desired.tags != nil {
+		tags, ok := desired.tags.Eval(s).(map[string]string)
+		if !ok {
+			return ret, fmt.Errorf("Tags must be defined with aws.Tags")
+		}
+		ret.tags = tags
+	}
+	if desired.description != nil {
+		str, ok := s.EvalAsStringer(desired.description)
+		if !ok {
+			return ret, fmt.Errorf("Description must be a string")
+		}
+		ret.description = aws.String(str.String())
+	}
+	if desired.layers != nil {
+		if ret.layers, err = layerArns(s, desired.layers); err != nil {
+			return ret, err
+		}
+	}
+	if desired.architectures != nil {
+		arch := desired.architectures.Eval(s)
+		// AWS takes a list, but it may only have one thing in it
+		if list, ok := arch.([]any); ok && len(list) == 1 {
+			arch = list[0]
+		}
+		str, ok := arch.(fmt.Stringer)
+		if ok {
+			arch = str.String()
+		}
+		a, ok := arch.(string)
+		if !ok || !slices.Contains(types.Architecture("").Values(), types.Architecture(a)) {
+			return ret, fmt.Errorf("Architectures must be one of %v", types.Architecture("").Values())
+		}
+		ret.architecture = types.Architecture(a)
+	}
+	return ret, nil
+}
+
+// layerArns evaluates the Layers of a function, which may be layer coins or the ARNs of
+// versions of layers defined elsewhere; AWS applies them in this order
+func layerArns(s driverbottom.RuntimeStorage, e driverbottom.Expr) ([]string, error) {
+	v := e.Eval(s)
+	items, isList := v.([]any)
+	if !isList {
+		items = []any{v}
+	}
+	ret := []string{}
+	for _, item := range items {
+		switch layer := item.(type) {
+		case *LayerAWSModel:
+			ret = append(ret, layer.versionArn)
+		case *LayerModel:
+			ret = append(ret, getLayerArnLater(s, layer.coin, true).String())
+		case string:
+			ret = append(ret, layer)
+		case fmt.Stringer:
+			ret = append(ret, layer.String())
+		default:
+			return nil, fmt.Errorf("Layers must be layers or the ARNs of layer versions, not %T", item)
+		}
+	}
+	if len(ret) > 5 {
+		return nil, fmt.Errorf("a function can have at most 5 Layers, not %d", len(ret))
+	}
+	return ret, nil
+}
+
+func sized(s driverbottom.RuntimeStorage, e driverbottom.Expr, what string, from, to int32) (*int32, error) {
+	if e == nil {
+		return nil, nil
+	}
+	n := s.EvalAsNumber(e).F64()
+	if n < float64(from) || n > float64(to) || n != float64(int32(n)) {
+		return nil, fmt.Errorf("%s must be a whole number from %d to %d, not %v", what, from, to, n)
+	}
+	return aws.Int32(int32(n)), nil
+}
+
+func (s settings) architectures() []types.Architecture {
+	if s.architecture == "" {
+		return nil
+	}
+	return []types.Architecture{s.architecture}
+}
+
+func (s settings) env() *types.Environment {
+	if s.environment == nil {
+		return nil
+	}
+	return &types.Environment{Variables: s.environment}
+}
+
+func (s settings) storage() *types.EphemeralStorage {
+	if s.ephemeralStorage == nil {
+		return nil
+	}
+	return &types.EphemeralStorage{Size: s.ephemeralStorage}
+}
+
+func (s settings) applyToCreate(input *lambda.CreateFunctionInput) {
+	input.MemorySize = s.memorySize
+	input.Timeout = s.timeout
+	input.Environment = s.env()
+	input.Architectures = s.architectures()
+	input.EphemeralStorage = s.storage()
+	input.Description = s.description
+	input.Tags = s.tags
+	input.Layers = s.layers
+}
+
+// applyToUpdate sets everything except the architecture, which can only be changed
+// along with the code, and the tags, which are set on the function's ARN separately
+func (s settings) applyToUpdate(input *lambda.UpdateFunctionConfigurationInput) {
+	input.MemorySize = s.memorySize
+	input.Timeout = s.timeout
+	input.Environment = s.env()
+	input.EphemeralStorage = s.storage()
+	input.Description = s.description
+	input.Layers = s.layers
+}
+
+// planned describes the settings of a function that would be created
+func (s settings) planned() []plan.Field {
+	return []plan.Field{
+		plan.Set("MemorySize", s.memorySize),
+		plan.Set("Timeout", s.timeout),
+		plan.Set("Environment", describeMap(s.environment)),
+		plan.Set("Architectures", s.architecture),
+		plan.Set("EphemeralStorage", s.ephemeralStorage),
+		plan.Set("Description", s.description),
+		plan.Set("Tags", describeMap(s.tags)),
+		plan.Set("Layers", s.layers),
+	}
+}
+
+// compared describes the settings which are in the script and are changed by
+// UpdateFunctionConfiguration alongside what the function has now
+func (s settings) compared(found *types.FunctionConfiguration) []plan.Field {
+	var ret []plan.Field
+	if s.memorySize != nil {
+		ret = append(ret, plan.Compare("MemorySize", found.MemorySize, s.memorySize))
+	}
+	if s.timeout != nil {
+		ret = append(ret, plan.Compare("Timeout", found.Timeout, s.timeout))
+	}
+	if s.environment != nil {
+		var vars map[string]string
+		if found.Environment != nil {
+			vars = found.Environment.Variables
+		}
+		ret = append(ret, plan.Compare("Environment", describeMap(vars), describeMap(s.environment)))
+	}
+	if s.ephemeralStorage != nil {
+		var size *int32
+		if found.EphemeralStorage != nil {
+			size = found.EphemeralStorage.Size
+		}
+		ret = append(ret, plan.Compare("EphemeralStorage", size, s.ephemeralStorage))
+	}
+	if s.description != nil {
+		ret = append(ret, plan.Compare("Description", found.Description, s.description))
+	}
+	if s.layers != nil {
+		layers := []string{}
+		for _, l := range found.Layers {
+			layers = append(layers, aws.ToString(l.Arn))
+		}
+		ret = append(ret, plan.Compare("Layers", layers, s.layers))
+	}
+	return ret
+}
+
+// comparedArchitecture describes the architecture, which is changed along with the code
+func (s settings) comparedArchitecture(found *types.FunctionConfiguration) []plan.Field {
+	if s.architecture == "" {
+		return nil
+	}
+	return []plan.Field{plan.Compare("Architectures", found.Architectures, s.architectures())}
+}
+
+// comparedTags describes the tags, which are changed on the function's ARN
+func (s settings) comparedTags(found map[string]string) []plan.Field {
+	if s.tags == nil {
+		return nil
+	}
+	return []plan.Field{plan.Compare("Tags", describeMap(found), describeMap(s.tags))}
+}
+
+// retag works out which tags need to be added to (or changed on) a function, and which removed
+func (s settings) retag(found map[string]string) (add map[string]string, remove []string) {
+	if s.tags == nil {
+		return nil, nil
+	}
+	for k, v := range s.tags {
+		if fv, ok := found[k]; !ok || fv != v {
+			if add == nil {
+				add = make(map[string]string)
+			}
+			add[k] = v
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(found)) {
+		if _, ok := s.tags[k]; !ok {
+			remove = append(remove, k)
+		}
+	}
+	return add, remove
+}
+
+func describeMap(m map[string]string) string {
+	var ret []string
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		ret = append(ret, k+"="+m[k])
+	}
+	return strings.Join(ret, ", ")
+}
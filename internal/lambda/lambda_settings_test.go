@@ -0,0 +1,155 @@
+package lambda_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/internal/tags"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+type parent struct {
+	value driverbottom.Expr
+}
+
+func (p *parent) AddProperty(name driverbottom.Identifier, value driverbottom.Expr) {
+	p.value = value
+}
+
+// tagged reads Tags as a script would have them, given as key, value, key, value ...
+func tagged(h *awstest.Harness, kvs ...string) driverbottom.Expr {
+	loc := &errorsink.Location{}
+	p := &parent{}
+	ti := tags.CreateInterpreter(h.Tools().CoreTools, nil, p, drivertop.NewIdentifierToken(loc, "Tags"), nil)
+	for i := 0; i < len(kvs); i += 2 {
+		ti.HaveTokens(nil, []driverbottom.Token{drivertop.NewIdentifierToken(loc, kvs[i]), drivertop.MakeString(loc, kvs[i+1])})
+	}
+	ti.Completed()
+	return p.value
+}
+
+func functionTags(t *testing.T, h *awstest.Harness, name string) map[string]string {
+	got, err := awslambda.NewFromConfig(h.Fake.Config()).GetFunction(context.Background(), &awslambda.GetFunctionInput{FunctionName: aws.String(name)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got.Tags
+}
+
+func TestSettingsAreCheckedBeforeAnythingIsCreated(t *testing.T) {
+	h := awstest.New(t)
+	role := runner(t, h)
+	code := codeDir(t, "v1")
+	for _, c := range []struct {
+		prop  string
+		value any
+		err   string
+	}{
+		{"MemorySize", 64, "MemorySize must be a whole number from 128 to 10240"},
+		{"MemorySize", 128.5, "MemorySize must be a whole number from 128 to 10240"},
+		{"Timeout", 901, "Timeout must be a whole number from 1 to 900"},
+		{"EphemeralStorage", 20480, "EphemeralStorage must be a whole number from 512 to 10240"},
+		{"Architectures", "sparc", "Architectures must be one of"},
+		{"Architectures", []string{"x86_64", "arm64"}, "Architectures must be one of"},
+	} {
+		h.NextRun()
+		props := map[string]any{"Runtime": "go", "Code": code, "Role": role, c.prop: c.value}
+		errs := h.Attempt(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(props))
+		if len(errs) != 1 || !strings.Contains(errs[0], c.err) {
+			t.Fatalf("%s of %v gave %v", c.prop, c.value, errs)
+		}
+	}
+	if calls := h.Calls(); slices.Contains(calls, "Lambda.CreateFunction") {
+		t.Fatalf("a function was created with invalid settings: %v", calls)
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": code, "Role": role, "Architectures": []string{"arm64"}}))
+	got, err := awslambda.NewFromConfig(h.Fake.Config()).GetFunction(context.Background(), &awslambda.GetFunctionInput{FunctionName: aws.String("handler")})
+	if err != nil || !slices.Equal(got.Configuration.Architectures, []types.Architecture{types.ArchitectureArm64}) {
+		t.Fatalf("function was not made for arm64: %v", err)
+	}
+}
+
+func TestTagsAreAddedChangedAndRemoved(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	props := map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": runner(t, h), "Tags": tagged(h, "Team", "web", "Stage", "dev")}
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	h.Calls()
+
+	h.NextRun()
+	props["Tags"] = tagged(h, "Team", "api", "Owner", "orders")
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	calls := h.Calls()
+	if !slices.Contains(calls, "Lambda.TagResource") || !slices.Contains(calls, "Lambda.UntagResource") {
+		t.Fatalf("tags were not added and removed: %v", calls)
+	}
+	if got := functionTags(t, h, "handler"); !maps.Equal(got, map[string]string{"Team": "api", "Owner": "orders"}) {
+		t.Fatalf("tags were %v", got)
+	}
+
+	// tags which are not in the script are left as they are
+	h.NextRun()
+	delete(props, "Tags")
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	calls = h.Calls()
+	if slices.Contains(calls, "Lambda.TagResource") || slices.Contains(calls, "Lambda.UntagResource") {
+		t.Fatalf("tags were changed when the script did not have any: %v", calls)
+	}
+	if got := functionTags(t, h, "handler"); len(got) != 2 {
+		t.Fatalf("tags were %v", got)
+	}
+}
+
+func TestOnlyTheSettingsInTheScriptAreCompared(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	props := map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": runner(t, h), "MemorySize": 512, "Timeout": 30, "Description": "orders"}
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+
+	h.NextRun()
+	p := h.PlanOnly()
+	delete(props, "MemorySize")
+	delete(props, "Description")
+	props["Timeout"] = 60
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	changes := p.Changes()
+	if len(changes) != 1 || changes[0].Action != plan.Update {
+		t.Fatalf("expected the function to be updated, not %v", changes)
+	}
+	if fields := changes[0].Fields; len(fields) != 1 || fields[0] != (plan.Field{Name: "Timeout", Found: "30", Desired: "60"}) {
+		t.Fatalf("only the Timeout should have changed, not %v", fields)
+	}
+}
+
+func TestMemorySizeIsChangedInPlace(t *testing.T) {
+	h := awstest.New(t)
+	fn := h.Coin("fn")
+	props := map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": runner(t, h), "MemorySize": 128}
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+
+	h.NextRun()
+	h.Calls()
+	props["MemorySize"] = 256
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(props))
+	calls := h.Calls()
+	if slices.Contains(calls, "Lambda.CreateFunction") || !slices.Contains(calls, "Lambda.UpdateFunctionConfiguration") {
+		t.Fatalf("function should have been updated, not created again: %v", calls)
+	}
+	got, err := awslambda.NewFromConfig(h.Fake.Config()).GetFunction(context.Background(), &awslambda.GetFunctionInput{FunctionName: aws.String("handler")})
+	if err != nil || aws.ToInt32(got.Configuration.MemorySize) != 256 {
+		t.Fatalf("function was not given more memory: %v", err)
+	}
+}
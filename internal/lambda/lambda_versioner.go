@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
@@ -14,6 +15,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type lambdaVersioner struct {
@@ -24,7 +26,10 @@ type lambdaVersioner struct {
 
 	defaultPV float64
 
-	client *lambda.Client
+	client  *lambda.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (v *lambdaVersioner) AddAdverb(adverb driverbottom.Adverb, args []driverbottom.Token) driverbottom.Interpreter {
@@ -65,12 +70,15 @@ func (v *lambdaVersioner) CoinId() corebottom.CoinId {
 }
 
 func (v *lambdaVersioner) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := v.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(v.tools, v.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 	v.client = awsEnv.LambdaClient()
+	v.ctx = awsEnv.Context()
+	v.timeout = env.ObtainTimeout(v.tools, v.props)
+	v.plan = awsEnv.Plan()
 
 	alias := ""
 	if utils.HasProp(v.props, "Alias") {
@@ -91,14 +99,15 @@ func (v *lambdaVersioner) DetermineInitialState(pres corebottom.ValuePresenter)
 	}
 	fname := name.String()
 
-	out, err := v.client.GetAlias(context.TODO(), &lambda.GetAliasInput{FunctionName: &fname, Name: &alias})
+	out, err := v.client.GetAlias(v.ctx, &lambda.GetAliasInput{FunctionName: &fname, Name: &alias})
 	if err != nil {
 		if !lambdaExists(err) {
 			log.Printf("no alias found for %s:%s\n", fname, name)
 			pres.NotFound()
 			return
 		}
-		log.Fatalf("failed to get alias %s:%s: %v\n", fname, alias, err)
+		v.tools.Reporter.ReportAtf(v.loc, "failed to get alias %s:%s: %v", fname, alias, err)
+		return
 	}
 
 	log.Printf("found alias version %s for %s\n", *out.FunctionVersion, *out.Name)
@@ -136,6 +145,9 @@ func (v *lambdaVersioner) ShouldDestroy() bool {
 }
 
 func (v *lambdaVersioner) UpdateReality() {
+	ctx, cancel := env.WithTimeout(v.ctx, v.timeout)
+	defer cancel()
+
 	tmp := v.tools.Storage.GetCoin(v.coin, corebottom.DETERMINE_INITIAL_MODE)
 	var found *publishVersionAWS
 	if tmp != nil {
@@ -144,34 +156,45 @@ func (v *lambdaVersioner) UpdateReality() {
 	desired := v.tools.Storage.GetCoin(v.coin, corebottom.DETERMINE_DESIRED_MODE).(*publishVersionModel)
 	created := &publishVersionAWS{}
 	name := desired.name.String()
+	ctx = env.About(ctx, "aws.Lambda.Alias", name, v.coin)
+	if v.plan != nil {
+		v.planChanges(found, desired, name)
+		return
+	}
 	if desired.publish.F64() != 0 {
-		utils.ExponentialBackoff(func() bool {
-			out, err := v.client.PublishVersion(context.TODO(), &lambda.PublishVersionInput{FunctionName: &name})
+		failed := env.Backoff(ctx, func() (bool, error) {
+			out, err := v.client.PublishVersion(ctx, &lambda.PublishVersionInput{FunctionName: &name})
 			if err != nil {
 				if isUpdatingFunction(err) {
 					log.Printf("still updating function code; cannot publish yet")
-					return false
+					return false, nil
 				}
-				log.Fatalf("failed to publish new version of %s: %v", name, err)
+				return false, err
 			}
 			log.Printf("published version %s of %s\n", *out.Version, name)
 			created.publishedVersion = *out.Version
-			return true
+			return true, nil
 		})
+		if failed != nil {
+			v.tools.Reporter.ReportAtf(v.loc, "failed to publish new version of %s: %v", name, failed)
+			return
+		}
 	}
 	if alias := desired.asAlias.String(); alias != "" {
 		if found == nil || found.aliasVersion == "" {
-			out, err := v.client.CreateAlias(context.TODO(), &lambda.CreateAliasInput{FunctionName: &name, Name: &alias, FunctionVersion: &created.publishedVersion})
+			out, err := v.client.CreateAlias(ctx, &lambda.CreateAliasInput{FunctionName: &name, Name: &alias, FunctionVersion: &created.publishedVersion})
 			if err != nil {
-				log.Fatalf("failed to create alias %s:%s %v", name, alias, err)
+				v.tools.Reporter.ReportAtf(v.loc, "failed to create alias %s:%s: %v", name, alias, err)
+				return
 			}
 			log.Printf("alias returned %s for version %s\n", *out.AliasArn, *out.FunctionVersion)
 			created.aliasVersion = *out.FunctionVersion
 			created.aliasRevId = *out.RevisionId
 		} else {
-			out, err := v.client.UpdateAlias(context.TODO(), &lambda.UpdateAliasInput{FunctionName: &name, Name: &alias, FunctionVersion: &created.publishedVersion})
+			out, err := v.client.UpdateAlias(ctx, &lambda.UpdateAliasInput{FunctionName: &name, Name: &alias, FunctionVersion: &created.publishedVersion})
 			if err != nil {
-				log.Fatalf("failed to create alias %s:%s %v", name, alias, err)
+				v.tools.Reporter.ReportAtf(v.loc, "failed to update alias %s:%s: %v", name, alias, err)
+				return
 			}
 			log.Printf("alias returned %s for version %s\n", *out.AliasArn, *out.FunctionVersion)
 			created.aliasVersion = *out.FunctionVersion
@@ -182,13 +205,22 @@ func (v *lambdaVersioner) UpdateReality() {
 }
 
 func (v *lambdaVersioner) TearDown() {
+	ctx, cancel := env.WithTimeout(v.ctx, v.timeout)
+	defer cancel()
+
 	tmp := v.tools.Storage.GetCoin(v.coin, corebottom.DETERMINE_INITIAL_MODE)
 	var found *publishVersionAWS
 	if tmp != nil {
 		found = tmp.(*publishVersionAWS)
-		_, err := v.client.DeleteAlias(context.TODO(), &lambda.DeleteAliasInput{FunctionName: &found.functionName, Name: &found.aliasName})
+		ctx = env.About(ctx, "aws.Lambda.Alias", found.functionName, v.coin)
+		if v.plan != nil {
+			v.plan.Delete("aws.Lambda.Alias", found.functionName+":"+found.aliasName)
+			return
+		}
+		_, err := v.client.DeleteAlias(ctx, &lambda.DeleteAliasInput{FunctionName: &found.functionName, Name: &found.aliasName})
 		if err != nil {
-			log.Fatalf("failed to create alias %s:%s %v", found.functionName, found.aliasName, err)
+			v.tools.Reporter.ReportAtf(v.loc, "failed to delete alias %s:%s: %v", found.functionName, found.aliasName, err)
+			return
 		}
 		log.Printf("deleted alias %s:%s\n", found.functionName, found.aliasName)
 	} else {
@@ -197,9 +229,33 @@ func (v *lambdaVersioner) TearDown() {
 	log.Printf("What would it mean to tear down a version?  I think cleaning up old versions is a separate op")
 }
 
+// planChanges records what UpdateReality would publish and alias, without doing it,
+// binding what it would have published
+func (v *lambdaVersioner) planChanges(found *publishVersionAWS, desired *publishVersionModel, name string) {
+	version := ""
+	if desired.publish.F64() != 0 {
+		version = plan.Placeholder("aws.Lambda.Version", name)
+		v.plan.Create("aws.Lambda.Version", name)
+	}
+	planned := &publishVersionAWS{publishedVersion: version}
+	defer v.tools.Storage.Bind(v.coin, planned)
+	alias := desired.asAlias.String()
+	if alias == "" {
+		return
+	}
+	planned.aliasVersion = version
+	if found == nil || found.aliasVersion == "" {
+		v.plan.Create("aws.Lambda.Alias", name+":"+alias, plan.Set("FunctionVersion", version))
+	} else {
+		v.plan.Update("aws.Lambda.Alias", name+":"+alias, plan.Compare("FunctionVersion", found.aliasVersion, version))
+	}
+}
+
 var _ corebottom.CoinProvider = &lambdaVersioner{}
 var _ corebottom.RealityShifter = &lambdaVersioner{}
 
+// isUpdatingFunction is true if err says that the function cannot be changed
+// because a previous update is still in progress
 func isUpdatingFunction(err error) bool {
 	if err == nil {
 		return false
@@ -207,25 +263,12 @@ func isUpdatingFunction(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*http.ResponseError)
-		if ok {
-			// log.Printf("%v %s", e2, e2.Err)
-			if e2.ResponseError.Response.StatusCode == 409 {
-				switch e4 := e2.Err.(type) {
-				case *types.ResourceConflictException:
-					// log.Printf("error: %T %v %s", e4, e4, e4.ErrorMessage())
-					s := e4.ErrorMessage()
-					if strings.Contains(s, "An update is in progress") {
-						return true
-					}
-				default:
-					log.Printf("not invalid: %T %v", e4, e4)
-					panic("what error?")
-				}
+		if ok && e2.ResponseError.Response.StatusCode == 409 {
+			switch e4 := e2.Err.(type) {
+			case *types.ResourceConflictException:
+				return strings.Contains(e4.ErrorMessage(), "An update is in progress")
 			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
 		}
-		log.Fatalf("not response error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("creating lambda failed: %T %v", err, err)
-	panic("failed")
+	return false
 }
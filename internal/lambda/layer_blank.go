@@ -0,0 +1,23 @@
+package lambda
+
+import (
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+type LayerBlank struct{}
+
+func (b *LayerBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr, teardown corebottom.TearDown) corebottom.Ensurable {
+	return &layerCreator{tools: tools, teardown: teardown, loc: loc, name: named, coin: id, props: props}
+}
+
+func (b *LayerBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
+	return &layerCreator{tools: tools, loc: loc, name: named, coin: id, props: props}
+}
+
+func (b *LayerBlank) ShortDescription() string {
+	return "aws.Lambda.Layer[]"
+}
+
+var _ corebottom.Blank = &LayerBlank{}
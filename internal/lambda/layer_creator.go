@@ -0,0 +1,318 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+// layerCreator publishes versions of a layer which functions can share:
+//
+//	ensure aws.Lambda.Layer "node-deps"
+//		Code "layers/node-deps.zip"
+//		CompatibleRuntimes "nodejs20.x" "nodejs22.x"
+//		CompatibleArchitectures "arm64"
+//
+// Versions cannot be changed once they are published, so a new one is only published
+// if the code (or anything else) is different from the latest one.
+type layerCreator struct {
+	tools *corebottom.Tools
+
+	loc      *errorsink.Location
+	name     string
+	coin     corebottom.CoinId
+	props    map[driverbottom.Identifier]driverbottom.Expr
+	teardown corebottom.TearDown
+
+	client  *lambda.Client
+	staging *awss3.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
+}
+
+func (lc *layerCreator) Loc() *errorsink.Location {
+	return lc.loc
+}
+
+func (lc *layerCreator) ShortDescription() string {
+	return "aws.Lambda.Layer[" + lc.name + "]"
+}
+
+func (lc *layerCreator) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("aws.Lambda.Layer[")
+	iw.AttrsWhere(lc)
+	iw.TextAttr("named", lc.name)
+	iw.EndAttrs()
+}
+
+func (lc *layerCreator) CoinId() corebottom.CoinId {
+	return lc.coin
+}
+
+func (lc *layerCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := env.ObtainEnv(lc.tools, lc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
+	}
+	lc.client = awsEnv.LambdaClient()
+	lc.staging = awsEnv.S3Client()
+	lc.ctx = awsEnv.Context()
+	lc.timeout = env.ObtainTimeout(lc.tools, lc.props)
+	lc.plan = awsEnv.Plan()
+
+	// the latest version comes first; a layer with no versions is not there at all
+	list, err := lc.client.ListLayerVersions(lc.ctx, &lambda.ListLayerVersionsInput{LayerName: &lc.name, MaxItems: aws.Int32(1)})
+	if err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "could not recover layer %s: %v", lc.name, err)
+		return
+	}
+	if len(list.LayerVersions) == 0 {
+		pres.NotFound()
+		return
+	}
+	latest, err := lc.client.GetLayerVersion(lc.ctx, &lambda.GetLayerVersionInput{LayerName: &lc.name, VersionNumber: &list.LayerVersions[0].Version})
+	if err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "could not recover layer %s: %v", lc.name, err)
+		return
+	}
+	model := &LayerAWSModel{name: lc.name, coin: lc.coin, arn: aws.ToString(latest.LayerArn), versionArn: aws.ToString(latest.LayerVersionArn), version: latest.Version,
+		runtimes: latest.CompatibleRuntimes, architectures: latest.CompatibleArchitectures, description: aws.ToString(latest.Description)}
+	if latest.Content != nil {
+		model.sha = aws.ToString(latest.Content.CodeSha256)
+	}
+	pres.Present(model)
+}
+
+func (lc *layerCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
+	model := &LayerModel{name: lc.name, loc: lc.loc, coin: lc.coin}
+	for p, v := range lc.props {
+		switch p.Id() {
+		case "Env", "DeployTimeout":
+		case "Code":
+			if loc, ok := v.(*s3.S3Location); ok {
+				model.code = loc
+				break
+			}
+			str, ok := lc.tools.Storage.EvalAsStringer(v)
+			if !ok || isImage(str.String()) {
+				lc.tools.Reporter.ReportAtf(v.Loc(), "Code must be an aws.S3.Location, a directory or a zip")
+				break
+			}
+			model.source = str.String()
+		case "CodeBucket":
+			model.codeBucket = v
+		case "CompatibleRuntimes":
+			model.runtimes = v
+		case "CompatibleArchitectures":
+			model.architectures = v
+		case "Description":
+			model.description = v
+		default:
+			lc.tools.Reporter.ReportAtf(p.Loc(), "invalid property for Layer: %s", p.Id())
+		}
+	}
+	if model.code == nil && model.source == "" {
+		lc.tools.Reporter.ReportAtf(lc.loc, "Code was not defined")
+	}
+	pres.Present(model)
+}
+
+func (lc *layerCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(lc.ctx, lc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.Layer", lc.name, lc.coin)
+
+	tmp := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	desired := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_DESIRED_MODE).(*LayerModel)
+
+	code, ok := codeFrom(ctx, lc.tools, lc.staging, lc.loc, lc.name, desired.code, desired.source)
+	if !ok {
+		return
+	}
+	if code.bucket != "" && !code.wholeChecksum() {
+		// versions cannot be tagged, so the only way to know if it is the same code is to read it
+		sum, err := hashObject(ctx, lc.staging, code.bucket, code.key)
+		if err != nil && lc.plan == nil {
+			lc.tools.Reporter.ReportAtf(lc.loc, "could not read the code for layer %s in %s: %v", lc.name, code, err)
+			return
+		}
+		code.checksum = sum
+	}
+
+	var runtimes []types.Runtime
+	var architectures []types.Architecture
+	var description string
+	if desired.runtimes != nil {
+		list, ok := stringsOf(lc.tools.Storage, desired.runtimes)
+		if !ok {
+			lc.tools.Reporter.ReportAtf(desired.runtimes.Loc(), "CompatibleRuntimes must be strings")
+			return
+		}
+		for _, r := range list {
+			if r == "go" {
+				r = string(types.RuntimeProvidedal2023)
+			}
+			if !slices.Contains(types.Runtime("").Values(), types.Runtime(r)) {
+				lc.tools.Reporter.ReportAtf(desired.runtimes.Loc(), "invalid runtime: %s", r)
+				return
+			}
+			runtimes = append(runtimes, types.Runtime(r))
+		}
+	}
+	if desired.architectures != nil {
+		list, ok := stringsOf(lc.tools.Storage, desired.architectures)
+		if !ok {
+			lc.tools.Reporter.ReportAtf(desired.architectures.Loc(), "CompatibleArchitectures must be strings")
+			return
+		}
+		for _, a := range list {
+			if !slices.Contains(types.Architecture("").Values(), types.Architecture(a)) {
+				lc.tools.Reporter.ReportAtf(desired.architectures.Loc(), "CompatibleArchitectures must be some of %v", types.Architecture("").Values())
+				return
+			}
+			architectures = append(architectures, types.Architecture(a))
+		}
+	}
+	if desired.description != nil {
+		str, ok := lc.tools.Storage.EvalAsStringer(desired.description)
+		if !ok {
+			lc.tools.Reporter.ReportAtf(desired.description.Loc(), "Description must be a string")
+			return
+		}
+		description = str.String()
+	}
+
+	if tmp != nil {
+		found := tmp.(*LayerAWSModel)
+		fields := []plan.Field{
+			plan.Compare("Code", found.sha, code.sha()),
+			plan.Compare("CompatibleRuntimes", found.runtimes, runtimes),
+			plan.Compare("CompatibleArchitectures", found.architectures, architectures),
+			plan.Compare("Description", found.description, description),
+		}
+		if lc.plan != nil {
+			lc.plan.Update("aws.Lambda.Layer", lc.name, fields...)
+			lc.tools.Storage.Adopt(lc.coin, found)
+			return
+		}
+		if !plan.Changed(fields...) {
+			log.Printf("layer %s has not changed since version %d\n", lc.name, found.version)
+			lc.tools.Storage.Bind(lc.coin, found)
+			return
+		}
+	} else if lc.plan != nil {
+		lc.plan.Create("aws.Lambda.Layer", lc.name, plan.Set("Code", code), plan.Set("CompatibleRuntimes", runtimes), plan.Set("CompatibleArchitectures", architectures), plan.Set("Description", description))
+		arn := plan.Placeholder("aws.Lambda.Layer", lc.name)
+		lc.tools.Storage.Bind(lc.coin, &LayerAWSModel{name: lc.name, coin: lc.coin, arn: arn, versionArn: arn + ":1", version: 1,
+			runtimes: runtimes, architectures: architectures, description: description})
+		return
+	}
+
+	if err := stageCode(ctx, lc.tools, lc.staging, lc.name, desired.codeBucket, code); err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "could not stage the code for %s: %v", lc.name, err)
+		return
+	}
+	input := &lambda.PublishLayerVersionInput{LayerName: &lc.name, Content: code.layerContent(), CompatibleRuntimes: runtimes, CompatibleArchitectures: architectures}
+	if description != "" {
+		input.Description = &description
+	}
+	out, err := lc.client.PublishLayerVersion(ctx, input)
+	if err != nil {
+		lc.tools.Reporter.ReportAtf(lc.loc, "failed to publish layer %s: %v", lc.name, err)
+		return
+	}
+	log.Printf("published version %d of layer %s\n", out.Version, lc.name)
+	created := &LayerAWSModel{name: lc.name, coin: lc.coin, arn: aws.ToString(out.LayerArn), versionArn: aws.ToString(out.LayerVersionArn), version: out.Version,
+		runtimes: out.CompatibleRuntimes, architectures: out.CompatibleArchitectures, description: aws.ToString(out.Description)}
+	if out.Content != nil {
+		created.sha = aws.ToString(out.Content.CodeSha256)
+	}
+	lc.tools.Storage.Bind(lc.coin, created)
+}
+
+// TearDown deletes all the versions of the layer, since that is the only way to delete it
+func (lc *layerCreator) TearDown() {
+	tmp := lc.tools.Storage.GetCoin(lc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	if tmp == nil {
+		log.Printf("no layer existed for %s\n", lc.name)
+		return
+	}
+	ctx, cancel := env.WithTimeout(lc.ctx, lc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.Layer", lc.name, lc.coin)
+
+	log.Printf("you have asked to tear down layer %s with mode %s\n", lc.name, lc.teardown.Mode())
+	switch lc.teardown.Mode() {
+	case "preserve":
+		log.Printf("not deleting layer %s because teardown mode is 'preserve'", lc.name)
+	case "delete":
+		if lc.plan != nil {
+			lc.plan.Delete("aws.Lambda.Layer", lc.name)
+			return
+		}
+		var versions []int64
+		pager := lambda.NewListLayerVersionsPaginator(lc.client, &lambda.ListLayerVersionsInput{LayerName: &lc.name})
+		for pager.HasMorePages() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				lc.tools.Reporter.ReportAtf(lc.loc, "failed to list versions of layer %s: %v", lc.name, err)
+				return
+			}
+			for _, v := range page.LayerVersions {
+				versions = append(versions, v.Version)
+			}
+		}
+		for _, v := range versions {
+			_, err := lc.client.DeleteLayerVersion(ctx, &lambda.DeleteLayerVersionInput{LayerName: &lc.name, VersionNumber: aws.Int64(v)})
+			if err != nil {
+				lc.tools.Reporter.ReportAtf(lc.loc, "failed to delete version %d of layer %s: %v", v, lc.name, err)
+				return
+			}
+		}
+	default:
+		log.Printf("cannot handle teardown mode '%s' for layer %s", lc.teardown.Mode(), lc.name)
+	}
+}
+
+func (lc *layerCreator) String() string {
+	return fmt.Sprintf("EnsureLayer[%s]", lc.name)
+}
+
+// stringsOf evaluates e as either a single string or a list of them
+func stringsOf(s driverbottom.RuntimeStorage, e driverbottom.Expr) ([]string, bool) {
+	v := s.Eval(e)
+	items, isList := v.([]any)
+	if !isList {
+		items = []any{v}
+	}
+	var ret []string
+	for _, item := range items {
+		switch str := item.(type) {
+		case string:
+			ret = append(ret, str)
+		case fmt.Stringer:
+			ret = append(ret, str.String())
+		default:
+			return nil, false
+		}
+	}
+	return ret, true
+}
+
+var _ corebottom.Ensurable = &layerCreator{}
+var _ corebottom.FindCoin = &layerCreator{}
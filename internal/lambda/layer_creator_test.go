@@ -0,0 +1,113 @@
+package lambda_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func published(h *awstest.Harness) int {
+	n := 0
+	for _, c := range h.Calls() {
+		if c == "Lambda.PublishLayerVersion" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLayerIsOnlyPublishedWhenItChanges(t *testing.T) {
+	h := awstest.New(t)
+	layer := h.Coin("layer")
+	props := map[string]any{"Code": codeDir(t, "v1"), "CompatibleRuntimes": "go", "CompatibleArchitectures": "arm64", "Description": "shared"}
+	h.Ensure(&lambda.LayerBlank{}, layer, "shared", h.Props(props))
+	if n := published(h); n != 1 {
+		t.Fatalf("%d versions were published", n)
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.LayerBlank{}, layer, "shared", h.Props(props))
+	if n := published(h); n != 0 {
+		t.Fatalf("nothing had changed, but %d versions were published", n)
+	}
+
+	for _, c := range []struct {
+		prop  string
+		value any
+	}{
+		{"Code", codeDir(t, "v2")},
+		{"CompatibleRuntimes", []string{"go", "python3.12"}},
+		{"CompatibleArchitectures", "x86_64"},
+		{"Description", "shared by everything"},
+	} {
+		h.NextRun()
+		props[c.prop] = c.value
+		h.Ensure(&lambda.LayerBlank{}, layer, "shared", h.Props(props))
+		if n := published(h); n != 1 {
+			t.Fatalf("changing %s published %d versions", c.prop, n)
+		}
+	}
+}
+
+func TestFunctionsHaveTheirLayersInOrder(t *testing.T) {
+	h := awstest.New(t)
+	loc := &errorsink.Location{}
+	role := runner(t, h)
+	layer := h.Coin("layer")
+	layerProps := h.Props(map[string]any{"Code": codeDir(t, "v1")})
+	other := "arn:aws:lambda:us-east-1:123456789012:layer:other:3"
+	arns := func(n int) []driverbottom.Expr {
+		var ret []driverbottom.Expr
+		for i := range n {
+			ret = append(ret, drivertop.MakeString(loc, fmt.Sprintf("arn:aws:lambda:us-east-1:123456789012:layer:extra%d:1", i)))
+		}
+		return ret
+	}
+
+	h.Ensure(&lambda.LayerBlank{}, layer, "shared", layerProps)
+	layers := drivertop.NewListExpr(loc, []driverbottom.Expr{drivertop.MakeString(loc, other), h.Value(layer)})
+	h.Ensure(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": role, "Layers": layers}))
+	got, err := awslambda.NewFromConfig(h.Fake.Config()).GetFunction(context.Background(), &awslambda.GetFunctionInput{FunctionName: aws.String("handler")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have []string
+	for _, l := range got.Configuration.Layers {
+		have = append(have, aws.ToString(l.Arn))
+	}
+	if len(have) != 2 || have[0] != other || !strings.HasSuffix(have[1], ":layer:shared:1") {
+		t.Fatalf("function had layers %v", have)
+	}
+
+	for _, c := range []struct {
+		layers driverbottom.Expr
+		err    string
+	}{
+		{drivertop.NewListExpr(loc, append(arns(5), h.Value(layer))), "a function can have at most 5 Layers, not 6"},
+		{drivertop.NewListExpr(loc, []driverbottom.Expr{h.Expr(3)}), "Layers must be layers or the ARNs of layer versions"},
+	} {
+		h.NextRun()
+		h.Ensure(&lambda.LayerBlank{}, layer, "shared", layerProps)
+		errs := h.Attempt(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": role, "Layers": c.layers}))
+		if len(errs) != 1 || !strings.Contains(errs[0], c.err) {
+			t.Fatalf("expected %q, not %v", c.err, errs)
+		}
+	}
+
+	// five is allowed
+	h.NextRun()
+	h.Ensure(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": role, "Layers": drivertop.NewListExpr(loc, arns(5))}))
+	if calls := h.Calls(); !slices.Contains(calls, "Lambda.UpdateFunctionConfiguration") {
+		t.Fatalf("the function was not given five layers: %v", calls)
+	}
+}
@@ -0,0 +1,118 @@
+package lambda
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+// LayerModel is the layer the script wants
+type LayerModel struct {
+	name string
+	loc  *errorsink.Location
+	coin corebottom.CoinId
+
+	code *s3.S3Location
+	// source is a local directory or zip, if the code is not in S3
+	source        string
+	codeBucket    driverbottom.Expr
+	runtimes      driverbottom.Expr
+	architectures driverbottom.Expr
+	description   driverbottom.Expr
+}
+
+func (model *LayerModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "arn", "versionArn":
+		return &desiredLayerArnMethod{versioned: name == "versionArn"}
+	}
+	return nil
+}
+
+type desiredLayerArnMethod struct {
+	versioned bool
+}
+
+func (a *desiredLayerArnMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	model, ok := e.(*LayerModel)
+	if !ok {
+		panic(fmt.Sprintf("arn can only be called on a layer, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+
+	// the version is not published yet ... return a deferString
+	return getLayerArnLater(s, model.coin, a.versioned)
+}
+
+// LayerAWSModel is the latest version of a layer, as it was found or published
+type LayerAWSModel struct {
+	name string
+	coin corebottom.CoinId
+
+	arn           string
+	versionArn    string
+	version       int64
+	sha           string
+	runtimes      []types.Runtime
+	architectures []types.Architecture
+	description   string
+}
+
+func (model *LayerAWSModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "arn", "versionArn":
+		return &layerArnMethod{versioned: name == "versionArn"}
+	}
+	return nil
+}
+
+// arn is the ARN of the layer, and versionArn the ARN of its latest version, which is
+// what functions need in their Layers
+type layerArnMethod struct {
+	versioned bool
+}
+
+func (a *layerArnMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	model, ok := e.(*LayerAWSModel)
+	if !ok {
+		panic(fmt.Sprintf("arn can only be called on a layer, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	return model.arnOf(a.versioned)
+}
+
+func (model *LayerAWSModel) arnOf(versioned bool) string {
+	if versioned {
+		return model.versionArn
+	}
+	return model.arn
+}
+
+func getLayerArnLater(s driverbottom.RuntimeStorage, coin corebottom.CoinId, versioned bool) fmt.Stringer {
+	return utils.DeferString(func() string {
+		curr := s.GetCoinFrom(coin, []int{1, 3})
+		if curr == nil {
+			panic("could not find find/create version of " + coin.VarName().Id())
+		}
+
+		currModel := curr.(*LayerAWSModel)
+		if currModel.versionArn == "" {
+			panic("layer version is still not published")
+		}
+		return currModel.arnOf(versioned)
+	})
+}
+
+var _ driverbottom.HasMethods = &LayerModel{}
+var _ driverbottom.HasMethods = &LayerAWSModel{}
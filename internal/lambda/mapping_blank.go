@@ -0,0 +1,23 @@
+package lambda
+
+import (
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+type EventSourceMappingBlank struct{}
+
+func (b *EventSourceMappingBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr, teardown corebottom.TearDown) corebottom.Ensurable {
+	return &mappingCreator{tools: tools, teardown: teardown, loc: loc, name: named, coin: id, props: props}
+}
+
+func (b *EventSourceMappingBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
+	return &mappingCreator{tools: tools, loc: loc, name: named, coin: id, props: props}
+}
+
+func (b *EventSourceMappingBlank) ShortDescription() string {
+	return "aws.Lambda.EventSourceMapping[]"
+}
+
+var _ corebottom.Blank = &EventSourceMappingBlank{}
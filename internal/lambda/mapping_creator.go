@@ -0,0 +1,548 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// mappingCreator has a function read from a queue or stream:
+//
+//	ensure aws.Lambda.EventSourceMapping "orders"
+//		Function handler
+//		Source (users -> streamArn)
+//		BatchSize 100
+//		BatchingWindow 5
+//		Filters "{\"eventName\": [\"INSERT\"]}"
+//		StartingPosition "TRIM_HORIZON"
+//		Enabled 1
+//
+// Lambda does not give mappings names, so the mapping is the one between the function
+// and the source; the name is only used to describe it.
+type mappingCreator struct {
+	tools *corebottom.Tools
+
+	loc      *errorsink.Location
+	name     string
+	coin     corebottom.CoinId
+	props    map[driverbottom.Identifier]driverbottom.Expr
+	teardown corebottom.TearDown
+
+	client  *lambda.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
+}
+
+func (mc *mappingCreator) Loc() *errorsink.Location {
+	return mc.loc
+}
+
+func (mc *mappingCreator) ShortDescription() string {
+	return "aws.Lambda.EventSourceMapping[" + mc.name + "]"
+}
+
+func (mc *mappingCreator) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("aws.Lambda.EventSourceMapping[")
+	iw.AttrsWhere(mc)
+	iw.TextAttr("named", mc.name)
+	iw.EndAttrs()
+}
+
+func (mc *mappingCreator) CoinId() corebottom.CoinId {
+	return mc.coin
+}
+
+func (mc *mappingCreator) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	mc.coin.Resolve(mc.tools.Storage)
+	for _, e := range mc.props {
+		ret = ret.Merge(e.Resolve(r))
+	}
+	return ret
+}
+
+func (mc *mappingCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := env.ObtainEnv(mc.tools, mc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
+	}
+	mc.client = awsEnv.LambdaClient()
+	mc.ctx = awsEnv.Context()
+	mc.timeout = env.ObtainTimeout(mc.tools, mc.props)
+	mc.plan = awsEnv.Plan()
+
+	// if either end has not been created yet, the mapping cannot exist
+	function, ok := arnNow(mc.tools.Storage, utils.FindProp(mc.props, nil, "Function"))
+	if !ok {
+		pres.NotFound()
+		return
+	}
+	source, ok := arnNow(mc.tools.Storage, utils.FindProp(mc.props, nil, "Source"))
+	if !ok {
+		pres.NotFound()
+		return
+	}
+
+	// the mappings are found by function, so that one left on an old stream of a table can be found too
+	var exact, stale []types.EventSourceMappingConfiguration
+	var marker *string
+	for {
+		list, err := mc.client.ListEventSourceMappings(mc.ctx, &lambda.ListEventSourceMappingsInput{FunctionName: &function, Marker: marker})
+		if err != nil {
+			if !lambdaExists(err) {
+				pres.NotFound()
+				return
+			}
+			mc.tools.Reporter.ReportAtf(mc.loc, "could not list event source mappings for %s: %v", function, err)
+			return
+		}
+		for _, m := range list.EventSourceMappings {
+			if aws.ToString(m.EventSourceArn) == source {
+				exact = append(exact, m)
+			} else if sameTable(aws.ToString(m.EventSourceArn), source) {
+				stale = append(stale, m)
+			}
+		}
+		if list.NextMarker == nil {
+			break
+		}
+		marker = list.NextMarker
+	}
+	var c types.EventSourceMappingConfiguration
+	switch {
+	case len(exact) == 1:
+		c = exact[0]
+	case len(exact) == 0 && len(stale) == 1:
+		c = stale[0]
+	case len(exact) == 0 && len(stale) == 0:
+		log.Printf("no event source mapping from %s to %s\n", source, function)
+		pres.NotFound()
+		return
+	default:
+		mc.tools.Reporter.ReportAtf(mc.loc, "there is more than one event source mapping from %s to %s", source, function)
+		return
+	}
+	model := &EventSourceMappingAWSModel{name: mc.name, coin: mc.coin, uuid: aws.ToString(c.UUID), functionArn: aws.ToString(c.FunctionArn), sourceArn: aws.ToString(c.EventSourceArn),
+		batchSize: c.BatchSize, batchingWindow: c.MaximumBatchingWindowInSeconds, state: aws.ToString(c.State)}
+	if c.FilterCriteria != nil {
+		model.filters = []string{}
+		for _, f := range c.FilterCriteria.Filters {
+			model.filters = append(model.filters, aws.ToString(f.Pattern))
+		}
+	}
+	pres.Present(model)
+}
+
+func (mc *mappingCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
+	model := &EventSourceMappingModel{name: mc.name, loc: mc.loc, coin: mc.coin}
+	for p, v := range mc.props {
+		switch p.Id() {
+		case "Env", "DeployTimeout":
+		case "Function":
+			model.function = v
+		case "Source":
+			model.source = v
+		case "BatchSize":
+			model.batchSize = v
+		case "BatchingWindow":
+			model.batchingWindow = v
+		case "Filters":
+			model.filters = v
+		case "Enabled":
+			model.enabled = v
+		case "StartingPosition":
+			model.startingPosition = v
+		default:
+			mc.tools.Reporter.ReportAtf(p.Loc(), "invalid property for EventSourceMapping: %s", p.Id())
+		}
+	}
+	if model.function == nil {
+		mc.tools.Reporter.ReportAtf(mc.loc, "Function was not defined")
+	}
+	if model.source == nil {
+		mc.tools.Reporter.ReportAtf(mc.loc, "Source was not defined")
+	}
+	pres.Present(model)
+}
+
+func (mc *mappingCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(mc.ctx, mc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.EventSourceMapping", mc.name, mc.coin)
+
+	tmp := mc.tools.Storage.GetCoin(mc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	desired := mc.tools.Storage.GetCoin(mc.coin, corebottom.DETERMINE_DESIRED_MODE).(*EventSourceMappingModel)
+
+	settings, err := mc.settingsOf(desired)
+	if err != nil {
+		mc.tools.Reporter.ReportAtf(mc.loc, "%v", err)
+		return
+	}
+
+	if tmp != nil && tmp.(*EventSourceMappingAWSModel).sourceArn != settings.source {
+		// the table has a new stream, and the source of a mapping cannot be changed
+		found := tmp.(*EventSourceMappingAWSModel)
+		if mc.plan != nil {
+			mc.plan.Replace("aws.Lambda.EventSourceMapping", mc.name, plan.Compare("Source", found.sourceArn, settings.source))
+			planned := &EventSourceMappingAWSModel{name: mc.name, coin: mc.coin, uuid: plan.Placeholder("aws.Lambda.EventSourceMapping", mc.name), functionArn: settings.function, sourceArn: settings.source}
+			settings.applyTo(planned)
+			mc.tools.Storage.Bind(mc.coin, planned)
+			return
+		}
+		if err := mc.deleteMapping(ctx, found.uuid); err != nil {
+			mc.tools.Reporter.ReportAtf(mc.loc, "failed to delete event source mapping %s from the old stream %s: %v", mc.name, found.sourceArn, err)
+			return
+		}
+		log.Printf("deleted event source mapping %s from the old stream %s\n", found.uuid, found.sourceArn)
+		tmp = nil
+	}
+
+	if tmp != nil {
+		found := tmp.(*EventSourceMappingAWSModel)
+		fields := settings.compared(found)
+		if mc.plan != nil {
+			mc.plan.Update("aws.Lambda.EventSourceMapping", mc.name, fields...)
+			mc.tools.Storage.Adopt(mc.coin, found)
+			return
+		}
+		if !plan.Changed(fields...) {
+			log.Printf("event source mapping %s has not changed\n", found.uuid)
+			mc.tools.Storage.Bind(mc.coin, found)
+			return
+		}
+		input := &lambda.UpdateEventSourceMappingInput{UUID: &found.uuid, BatchSize: settings.batchSize, MaximumBatchingWindowInSeconds: settings.batchingWindow, FilterCriteria: settings.filterCriteria(), Enabled: settings.enabled}
+		var out *lambda.UpdateEventSourceMappingOutput
+		failed := env.Backoff(ctx, func() (bool, error) {
+			out, err = mc.client.UpdateEventSourceMapping(ctx, input)
+			if mappingInUse(err) {
+				log.Printf("event source mapping %s is busy, waiting...\n", found.uuid)
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if failed != nil {
+			mc.tools.Reporter.ReportAtf(mc.loc, "failed to update event source mapping %s: %v", mc.name, failed)
+			return
+		}
+		updated := *found
+		settings.applyTo(&updated)
+		updated.state = aws.ToString(out.State)
+		mc.tools.Storage.Bind(mc.coin, &updated)
+		return
+	}
+
+	if mc.plan != nil {
+		mc.plan.Create("aws.Lambda.EventSourceMapping", mc.name, settings.planned()...)
+		planned := &EventSourceMappingAWSModel{name: mc.name, coin: mc.coin, uuid: plan.Placeholder("aws.Lambda.EventSourceMapping", mc.name), functionArn: settings.function, sourceArn: settings.source}
+		settings.applyTo(planned)
+		mc.tools.Storage.Bind(mc.coin, planned)
+		return
+	}
+	input := &lambda.CreateEventSourceMappingInput{FunctionName: &settings.function, EventSourceArn: &settings.source, BatchSize: settings.batchSize, MaximumBatchingWindowInSeconds: settings.batchingWindow,
+		FilterCriteria: settings.filterCriteria(), Enabled: settings.enabled, StartingPosition: settings.startingPosition}
+	var out *lambda.CreateEventSourceMappingOutput
+	failed := env.Backoff(ctx, func() (bool, error) {
+		out, err = mc.client.CreateEventSourceMapping(ctx, input)
+		if cannotReadSource(err) {
+			log.Printf("the role of %s cannot read from %s yet, waiting...\n", settings.function, settings.source)
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if failed != nil {
+		mc.tools.Reporter.ReportAtf(mc.loc, "failed to create event source mapping %s: %v", mc.name, failed)
+		return
+	}
+	log.Printf("created event source mapping %s from %s to %s\n", aws.ToString(out.UUID), settings.source, settings.function)
+	created := &EventSourceMappingAWSModel{name: mc.name, coin: mc.coin, uuid: aws.ToString(out.UUID), functionArn: aws.ToString(out.FunctionArn), sourceArn: settings.source, state: aws.ToString(out.State)}
+	settings.applyTo(created)
+	mc.tools.Storage.Bind(mc.coin, created)
+}
+
+func (mc *mappingCreator) TearDown() {
+	tmp := mc.tools.Storage.GetCoin(mc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	if tmp == nil {
+		log.Printf("no event source mapping existed for %s\n", mc.name)
+		return
+	}
+	found := tmp.(*EventSourceMappingAWSModel)
+	ctx, cancel := env.WithTimeout(mc.ctx, mc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Lambda.EventSourceMapping", mc.name, mc.coin)
+
+	log.Printf("you have asked to tear down event source mapping %s with mode %s\n", found.uuid, mc.teardown.Mode())
+	switch mc.teardown.Mode() {
+	case "preserve":
+		log.Printf("not deleting event source mapping %s because teardown mode is 'preserve'", mc.name)
+	case "delete":
+		if mc.plan != nil {
+			mc.plan.Delete("aws.Lambda.EventSourceMapping", mc.name)
+			return
+		}
+		if err := mc.deleteMapping(ctx, found.uuid); err != nil {
+			mc.tools.Reporter.ReportAtf(mc.loc, "failed to delete event source mapping %s: %v", mc.name, err)
+		}
+	default:
+		log.Printf("cannot handle teardown mode '%s' for event source mapping %s", mc.teardown.Mode(), mc.name)
+	}
+}
+
+func (mc *mappingCreator) deleteMapping(ctx context.Context, uuid string) error {
+	return env.Backoff(ctx, func() (bool, error) {
+		_, err := mc.client.DeleteEventSourceMapping(ctx, &lambda.DeleteEventSourceMappingInput{UUID: &uuid})
+		if mappingInUse(err) {
+			log.Printf("event source mapping %s is busy, waiting...\n", uuid)
+			return false, nil
+		}
+		if !lambdaExists(err) {
+			return true, nil
+		}
+		return true, err
+	})
+}
+
+// sameTable says if two ARNs are of streams of the same DynamoDB table, e.g.
+// ".../table/orders/stream/2025-01-01T00:00:00.000"; a table has a new stream when
+// its view type changes, so a mapping may still be on the old one
+func sameTable(arn, other string) bool {
+	table, _, ok := strings.Cut(other, "/stream/")
+	return ok && strings.Contains(table, ":dynamodb:") && strings.HasPrefix(arn, table+"/stream/")
+}
+
+// mappingSettings are the evaluated parts of the desired mapping
+type mappingSettings struct {
+	function         string
+	source           string
+	batchSize        *int32
+	batchingWindow   *int32
+	filters          []string
+	enabled          *bool
+	startingPosition types.EventSourcePosition
+}
+
+func (mc *mappingCreator) settingsOf(desired *EventSourceMappingModel) (mappingSettings, error) {
+	var ret mappingSettings
+	s := mc.tools.Storage
+	// when planning, the function and the source may not have been created
+	resolve := arnOf
+	if mc.plan != nil {
+		resolve = arnInPlan
+	}
+	var ok bool
+	if ret.function, ok = resolve(s, desired.function); !ok {
+		return ret, fmt.Errorf("Function must be a function or its name or ARN")
+	}
+	if ret.source, ok = resolve(s, desired.source); !ok {
+		return ret, fmt.Errorf("Source must be the ARN of a queue or stream")
+	}
+	var err error
+	if ret.batchSize, err = sized(s, desired.batchSize, "BatchSize", 1, 10000); err != nil {
+		return ret, err
+	}
+	if ret.batchingWindow, err = sized(s, desired.batchingWindow, "BatchingWindow", 0, 300); err != nil {
+		return ret, err
+	}
+	if desired.filters != nil {
+		list, ok := stringsOf(s, desired.filters)
+		if !ok {
+			return ret, fmt.Errorf("Filters must be JSON patterns")
+		}
+		ret.filters = append([]string{}, list...)
+	}
+	if desired.enabled != nil {
+		switch v := s.Eval(desired.enabled).(type) {
+		case bool:
+			ret.enabled = aws.Bool(v)
+		case float64:
+			if v != 0 && v != 1 {
+				return ret, fmt.Errorf("Enabled must be 0 or 1, not %v", v)
+			}
+			ret.enabled = aws.Bool(v == 1)
+		default:
+			return ret, fmt.Errorf("Enabled must be 0 or 1, not %T", v)
+		}
+	}
+	// streams have to say where to start reading; queues cannot
+	stream := strings.Contains(ret.source, ":kinesis:") || strings.Contains(ret.source, ":dynamodb:")
+	if desired.startingPosition != nil {
+		str, ok := s.EvalAsStringer(desired.startingPosition)
+		if !ok || !slices.Contains(types.EventSourcePosition("").Values(), types.EventSourcePosition(str.String())) {
+			return ret, fmt.Errorf("StartingPosition must be one of %v", types.EventSourcePosition("").Values())
+		}
+		if strings.Contains(ret.source, ":sqs:") {
+			return ret, fmt.Errorf("StartingPosition can only be given for a stream")
+		}
+		ret.startingPosition = types.EventSourcePosition(str.String())
+	} else if stream {
+		ret.startingPosition = types.EventSourcePositionLatest
+	}
+	return ret, nil
+}
+
+func (s mappingSettings) filterCriteria() *types.FilterCriteria {
+	if s.filters == nil {
+		return nil
+	}
+	ret := &types.FilterCriteria{Filters: []types.Filter{}}
+	for _, f := range s.filters {
+		ret.Filters = append(ret.Filters, types.Filter{Pattern: aws.String(f)})
+	}
+	return ret
+}
+
+// planned describes a mapping that would be created
+func (s mappingSettings) planned() []plan.Field {
+	return []plan.Field{
+		plan.Set("Function", s.function),
+		plan.Set("Source", s.source),
+		plan.Set("BatchSize", s.batchSize),
+		plan.Set("BatchingWindow", s.batchingWindow),
+		plan.Set("Filters", s.filters),
+		plan.Set("Enabled", s.enabled),
+		plan.Set("StartingPosition", s.startingPosition),
+	}
+}
+
+// compared describes the settings which are in the script alongside what the mapping
+// has now; the starting position cannot be changed once the mapping is created
+func (s mappingSettings) compared(found *EventSourceMappingAWSModel) []plan.Field {
+	var ret []plan.Field
+	if s.batchSize != nil {
+		ret = append(ret, plan.Compare("BatchSize", found.batchSize, s.batchSize))
+	}
+	if s.batchingWindow != nil {
+		ret = append(ret, plan.Compare("BatchingWindow", found.batchingWindow, s.batchingWindow))
+	}
+	if s.filters != nil {
+		// lambda keeps the filters in the order they were given, but any one of them
+		// matching is enough, so the order does not matter
+		ret = append(ret, plan.Compare("Filters", slices.Sorted(slices.Values(found.filters)), slices.Sorted(slices.Values(s.filters))))
+	}
+	if s.enabled != nil {
+		ret = append(ret, plan.Compare("Enabled", found.enabled(), *s.enabled))
+	}
+	return ret
+}
+
+// applyTo records the settings which were in the script on a mapping that has been created or updated
+func (s mappingSettings) applyTo(model *EventSourceMappingAWSModel) {
+	if s.batchSize != nil {
+		model.batchSize = s.batchSize
+	}
+	if s.batchingWindow != nil {
+		model.batchingWindow = s.batchingWindow
+	}
+	if s.filters != nil {
+		model.filters = s.filters
+	}
+}
+
+// arnNow is the ARN (or name) that e refers to, if it is known before anything has been
+// created; a coin that has not been created yet only has an ARN later
+func arnNow(s driverbottom.RuntimeStorage, e driverbottom.Expr) (string, bool) {
+	if e == nil {
+		return "", false
+	}
+	v := s.Eval(e)
+	if hm, ok := v.(driverbottom.HasMethods); ok {
+		if arn := hm.ObtainMethod("arn"); arn != nil {
+			v = arn.Invoke(s, e, nil)
+		}
+	}
+	str, ok := v.(string)
+	return str, ok && !plan.IsPlaceholder(str)
+}
+
+// arnOf is the ARN (or name) that e refers to, once everything it refers to has been created
+func arnOf(s driverbottom.RuntimeStorage, e driverbottom.Expr) (string, bool) {
+	v := s.Eval(e)
+	if hm, ok := v.(driverbottom.HasMethods); ok {
+		if arn := hm.ObtainMethod("arn"); arn != nil {
+			v = arn.Invoke(s, e, nil)
+		}
+	}
+	switch str := v.(type) {
+	case string:
+		return str, true
+	case fmt.Stringer:
+		return str.String(), true
+	}
+	return "", false
+}
+
+// arnInPlan is the ARN (or name) that e refers to if it is known, or else says it is not
+func arnInPlan(s driverbottom.RuntimeStorage, e driverbottom.Expr) (string, bool) {
+	if arn, ok := arnNow(s, e); ok {
+		return arn, true
+	}
+	v := s.Eval(e)
+	if _, ok := v.(driverbottom.HasMethods); ok {
+		return "(not created yet)", true
+	}
+	if _, ok := v.(fmt.Stringer); ok {
+		return "(not created yet)", true
+	}
+	return "", false
+}
+
+// mappingInUse says whether the mapping could not be changed because it is still
+// being created, updated or deleted
+func mappingInUse(err error) bool {
+	if err == nil {
+		return false
+	}
+	e1, ok := err.(*smithy.OperationError)
+	if ok {
+		e2, ok := e1.Err.(*http.ResponseError)
+		if ok && e2.ResponseError.Response.StatusCode == 400 {
+			switch e2.Err.(type) {
+			case *types.ResourceInUseException:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cannotReadSource says whether lambda refused to create a mapping because the
+// function's role cannot read from the source, which may be because it is new
+func cannotReadSource(err error) bool {
+	if err == nil {
+		return false
+	}
+	e1, ok := err.(*smithy.OperationError)
+	if ok {
+		e2, ok := e1.Err.(*http.ResponseError)
+		if ok && e2.ResponseError.Response.StatusCode == 400 {
+			switch e4 := e2.Err.(type) {
+			case *types.InvalidParameterValueException:
+				return strings.Contains(e4.ErrorMessage(), "execution role does not have permissions")
+			}
+		}
+	}
+	return false
+}
+
+func (mc *mappingCreator) String() string {
+	return fmt.Sprintf("EnsureEventSourceMapping[%s]", mc.name)
+}
+
+var _ corebottom.Ensurable = &mappingCreator{}
+var _ corebottom.FindCoin = &mappingCreator{}
@@ -0,0 +1,147 @@
+package lambda_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+const (
+	queue  = "arn:aws:sqs:us-east-1:123456789012:orders"
+	stream = "arn:aws:dynamodb:us-east-1:123456789012:table/orders/stream/2024-01-01T00:00:00.000"
+)
+
+// handler creates a function for mappings to read into
+func handler(t *testing.T, h *awstest.Harness) {
+	h.Ensure(&lambda.FunctionBlank{}, h.Coin("fn"), "handler", h.Props(map[string]any{"Runtime": "go", "Code": codeDir(t, "v1"), "Role": runner(t, h)}))
+	h.Calls()
+}
+
+// mappingFrom is the mapping lambda has from source to the handler
+func mappingFrom(t *testing.T, h *awstest.Harness, source string) types.EventSourceMappingConfiguration {
+	out, err := awslambda.NewFromConfig(h.Fake.Config()).ListEventSourceMappings(context.Background(), &awslambda.ListEventSourceMappingsInput{FunctionName: aws.String("handler"), EventSourceArn: aws.String(source)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.EventSourceMappings) != 1 {
+		t.Fatalf("there were %d mappings from %s", len(out.EventSourceMappings), source)
+	}
+	return out.EventSourceMappings[0]
+}
+
+func TestOnlyStreamsHaveAStartingPosition(t *testing.T) {
+	h := awstest.New(t)
+	handler(t, h)
+
+	h.Ensure(&lambda.EventSourceMappingBlank{}, h.Coin("changes"), "changes", h.Props(map[string]any{"Function": "handler", "Source": stream}))
+	if got := mappingFrom(t, h, stream).StartingPosition; got != types.EventSourcePositionLatest {
+		t.Fatalf("a stream with no StartingPosition started at %q", got)
+	}
+	h.Calls()
+
+	errs := h.Attempt(&lambda.EventSourceMappingBlank{}, h.Coin("orders"), "orders", h.Props(map[string]any{"Function": "handler", "Source": queue, "StartingPosition": "TRIM_HORIZON"}))
+	if len(errs) != 1 || !strings.Contains(errs[0], "StartingPosition can only be given for a stream") {
+		t.Fatalf("a queue with a StartingPosition gave %v", errs)
+	}
+	if calls := h.Calls(); slices.Contains(calls, "Lambda.CreateEventSourceMapping") {
+		t.Fatalf("a mapping was created from the queue: %v", calls)
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.EventSourceMappingBlank{}, h.Coin("orders"), "orders", h.Props(map[string]any{"Function": "handler", "Source": queue}))
+	if got := mappingFrom(t, h, queue).StartingPosition; got != "" {
+		t.Fatalf("a queue was given the StartingPosition %q", got)
+	}
+}
+
+func TestEnabledIsZeroOrOne(t *testing.T) {
+	h := awstest.New(t)
+	handler(t, h)
+	for _, c := range []struct {
+		value any
+		err   string
+	}{
+		{2, "Enabled must be 0 or 1, not 2"},
+		{"yes", "Enabled must be 0 or 1, not string"},
+	} {
+		h.NextRun()
+		errs := h.Attempt(&lambda.EventSourceMappingBlank{}, h.Coin("orders"), "orders", h.Props(map[string]any{"Function": "handler", "Source": queue, "Enabled": c.value}))
+		if len(errs) != 1 || !strings.Contains(errs[0], c.err) {
+			t.Fatalf("Enabled of %v gave %v", c.value, errs)
+		}
+	}
+
+	for _, c := range []struct {
+		enabled bool
+		state   string
+	}{
+		{false, "Disabled"},
+		{true, "Enabled"},
+	} {
+		h.NextRun()
+		h.Ensure(&lambda.EventSourceMappingBlank{}, h.Coin("orders"), "orders", h.Props(map[string]any{"Function": "handler", "Source": queue, "Enabled": c.enabled}))
+		if got := aws.ToString(mappingFrom(t, h, queue).State); got != c.state {
+			t.Fatalf("Enabled %v left the mapping %s", c.enabled, got)
+		}
+	}
+}
+
+func TestFiltersAreTheSameInAnyOrder(t *testing.T) {
+	h := awstest.New(t)
+	handler(t, h)
+	inserts := `{"eventName": ["INSERT"]}`
+	removes := `{"eventName": ["REMOVE"]}`
+	modifies := `{"eventName": ["MODIFY"]}`
+	mapping := h.Coin("changes")
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": stream, "Filters": []string{inserts, removes}}))
+	h.Calls()
+
+	h.NextRun()
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": stream, "Filters": []string{removes, inserts}}))
+	if calls := h.Calls(); slices.Contains(calls, "Lambda.UpdateEventSourceMapping") {
+		t.Fatalf("the filters were only in another order, but were updated: %v", calls)
+	}
+
+	h.NextRun()
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": stream, "Filters": []string{removes, modifies}}))
+	if calls := h.Calls(); !slices.Contains(calls, "Lambda.UpdateEventSourceMapping") {
+		t.Fatalf("the filters had changed, but were not updated: %v", calls)
+	}
+}
+
+func TestAMappingOnTheOldStreamOfATableIsMovedToTheNewOne(t *testing.T) {
+	h := awstest.New(t)
+	handler(t, h)
+	mapping := h.Coin("changes")
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": stream}))
+
+	replaced := strings.Replace(stream, "2024-01-01", "2025-06-01", 1)
+	h.NextRun()
+	p := h.PlanOnly()
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": replaced}))
+	if changes := p.Changes(); len(changes) != 1 || changes[0].Action != plan.Replace {
+		t.Fatalf("moving the mapping should be planned as a replacement, not %v", changes)
+	}
+
+	h = awstest.New(t)
+	handler(t, h)
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": stream}))
+	old := aws.ToString(mappingFrom(t, h, stream).UUID)
+	h.NextRun()
+	h.Ensure(&lambda.EventSourceMappingBlank{}, mapping, "changes", h.Props(map[string]any{"Function": "handler", "Source": replaced}))
+	if aws.ToString(mappingFrom(t, h, replaced).UUID) == old {
+		t.Fatalf("the old mapping was kept")
+	}
+	out, err := awslambda.NewFromConfig(h.Fake.Config()).ListEventSourceMappings(context.Background(), &awslambda.ListEventSourceMappingsInput{FunctionName: aws.String("handler")})
+	if err != nil || len(out.EventSourceMappings) != 1 {
+		t.Fatalf("the mapping on the old stream was left behind: %v %v", out, err)
+	}
+}
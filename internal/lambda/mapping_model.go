@@ -0,0 +1,97 @@
+package lambda
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+)
+
+// EventSourceMappingModel is the mapping the script wants; everything is evaluated
+// in UpdateReality, since the function and the source may only just have been created
+type EventSourceMappingModel struct {
+	name string
+	loc  *errorsink.Location
+	coin corebottom.CoinId
+
+	function         driverbottom.Expr
+	source           driverbottom.Expr
+	batchSize        driverbottom.Expr
+	batchingWindow   driverbottom.Expr
+	filters          driverbottom.Expr
+	enabled          driverbottom.Expr
+	startingPosition driverbottom.Expr
+}
+
+func (model *EventSourceMappingModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "uuid":
+		return &mappingUuidMethod{}
+	}
+	return nil
+}
+
+// EventSourceMappingAWSModel is a mapping as lambda has it
+type EventSourceMappingAWSModel struct {
+	name string
+	coin corebottom.CoinId
+
+	uuid           string
+	functionArn    string
+	sourceArn      string
+	batchSize      *int32
+	batchingWindow *int32
+	filters        []string
+	state          string
+}
+
+func (model *EventSourceMappingAWSModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "uuid":
+		return &mappingUuidMethod{}
+	}
+	return nil
+}
+
+// enabled says whether the mapping is (or soon will be) reading from its source
+func (model *EventSourceMappingAWSModel) enabled() bool {
+	return model.state != "Disabled" && model.state != "Disabling"
+}
+
+type mappingUuidMethod struct {
+}
+
+func (a *mappingUuidMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	switch model := e.(type) {
+	case *EventSourceMappingAWSModel:
+		return model.uuid
+	case *EventSourceMappingModel:
+		return getMappingUuidLater(s, model.coin)
+	default:
+		panic(fmt.Sprintf("uuid can only be called on an event source mapping, not a %T", e))
+	}
+}
+
+func getMappingUuidLater(s driverbottom.RuntimeStorage, coin corebottom.CoinId) fmt.Stringer {
+	return utils.DeferString(func() string {
+		curr := s.GetCoinFrom(coin, []int{1, 3})
+		if curr == nil {
+			panic("could not find find/create version of " + coin.VarName().Id())
+		}
+
+		currModel := curr.(*EventSourceMappingAWSModel)
+		if currModel.uuid == "" {
+			panic("event source mapping is still not created")
+		}
+		return currModel.uuid
+	})
+}
+
+var _ driverbottom.HasMethods = &EventSourceMappingModel{}
+var _ driverbottom.HasMethods = &EventSourceMappingAWSModel{}
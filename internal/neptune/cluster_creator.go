@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	ht "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/neptune"
@@ -12,8 +13,8 @@ import (
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
-	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type clusterCreator struct {
@@ -27,7 +28,10 @@ type clusterCreator struct {
 	teardown corebottom.TearDown
 	props    map[driverbottom.Identifier]driverbottom.Expr
 
-	client *neptune.Client
+	client  *neptune.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cc *clusterCreator) Loc() *errorsink.Location {
@@ -51,15 +55,22 @@ func (cc *clusterCreator) CoinId() corebottom.CoinId {
 
 func (cc *clusterCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	log.Printf("want to find neptune cluster %s", cc.name)
-	ae := cc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := ae.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	cc.client = awsEnv.NeptuneClient()
+	cc.ctx = awsEnv.Context()
+	cc.timeout = env.ObtainTimeout(cc.tools, cc.props)
+	cc.plan = awsEnv.Plan()
 
-	model := cc.findClustersNamed(cc.name)
+	model, err := cc.findClustersNamed(cc.ctx, cc.name)
+	if err != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not describe cluster %s: %v", cc.name, err)
+		return
+	}
 
 	if model == nil {
 		log.Printf("cluster %s not found\n", cc.name)
@@ -75,10 +86,12 @@ func (cc *clusterCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 	for k, p := range cc.props {
 		v := cc.tools.Storage.Eval(p)
 		switch k.Id() {
+		case "Env", "DeployTimeout":
 		case "SubnetGroupName":
 			subnetGroup, ok := v.(*subnetModel)
 			if !ok {
-				log.Fatalf("SubnetGroupName did not point to a subnet model")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "SubnetGroupName did not point to a subnet model")
+				return
 			}
 			model.subnetGroup = subnetGroup.name
 		case "MinCapacity":
@@ -92,7 +105,7 @@ func (cc *clusterCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 				model.maxCapacity = cap
 			}
 		default:
-			log.Fatalf("neptune cluster does not support a parameter %s\n", k.Id())
+			cc.tools.Reporter.ReportAtf(k.Loc(), "neptune cluster does not support a parameter %s", k.Id())
 		}
 	}
 	if model.subnetGroup == "" {
@@ -110,11 +123,18 @@ func (cc *clusterCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 }
 
 func (cc *clusterCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Neptune.Cluster", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*clusterModel)
 		log.Printf("cluster %s already existed for %s\n", found.arn, found.name)
+		if cc.plan != nil {
+			cc.plan.NoChange("aws.Neptune.Cluster", cc.name)
+		}
 		cc.tools.Storage.Adopt(cc.coin, found)
 		return
 	}
@@ -131,22 +151,37 @@ func (cc *clusterCreator) UpdateReality() {
 		scaling := &types.ServerlessV2ScalingConfiguration{MinCapacity: &minCap, MaxCapacity: &maxCap}
 		ci.ServerlessV2ScalingConfiguration = scaling
 	}
-	create, err := cc.client.CreateDBCluster(context.TODO(), ci)
+	if cc.plan != nil {
+		cc.plan.Create("aws.Neptune.Cluster", cc.name, plan.Set("DBSubnetGroupName", desired.subnetGroup), plan.Set("ServerlessV2ScalingConfiguration", ci.ServerlessV2ScalingConfiguration))
+		created.arn = plan.Placeholder("aws.Neptune.Cluster", cc.name)
+		cc.tools.Storage.Bind(cc.coin, created)
+		return
+	}
+	create, err := cc.client.CreateDBCluster(ctx, ci)
 	if err != nil {
-		log.Fatalf("failed to create cluster %s: %v\n", cc.name, err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed to create cluster %s: %v", cc.name, err)
+		return
 	}
 	created.arn = *create.DBCluster.DBClusterArn
 	log.Printf("initiated request to create cluster %s: %s %s\n", cc.name, *create.DBCluster.Status, *create.DBCluster.DBClusterArn)
 
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForCreation(created)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForCreation(ctx, created)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for cluster %s: %v", cc.name, failed)
+		return
+	}
 
 	log.Printf("created neptune cluster %s %s", created.name, created.arn)
 	cc.tools.Storage.Bind(cc.coin, created)
 }
 
 func (cc *clusterCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Neptune.Cluster", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
@@ -156,6 +191,12 @@ func (cc *clusterCreator) TearDown() {
 
 	found := tmp.(*clusterModel)
 	log.Printf("you have asked to tear down neptune cluster for %s (arn: %s) with mode %s\n", found.name, found.arn, cc.teardown.Mode())
+	if cc.plan != nil {
+		if cc.teardown.Mode() == "delete" {
+			cc.plan.Delete("aws.Neptune.Cluster", found.name)
+		}
+		return
+	}
 	// todo: allow @teardown finalSnapshot
 	// will require @finalShapshotIdentifier
 	switch cc.teardown.Mode() {
@@ -163,34 +204,44 @@ func (cc *clusterCreator) TearDown() {
 		log.Printf("not deleting cluster %s because teardown mode is 'preserve'", found.name)
 	case "delete":
 		log.Printf("deleting cluster for %s with teardown mode 'delete'", found.name)
-		cc.deleteCluster(found, "")
+		err := cc.deleteCluster(ctx, found, "")
+		if err != nil {
+			cc.tools.Reporter.ReportAtf(cc.loc, "deleting cluster %s failed: %v", found.name, err)
+			return
+		}
 	default:
 		log.Printf("cannot handle teardown mode '%s' for bucket %s", cc.teardown.Mode(), found.name)
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForDeletion(found)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForDeletion(ctx, found)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for cluster %s to be deleted: %v", found.name, failed)
+		return
+	}
 
 	log.Printf("deleted neptune cluster %s", found.name)
 }
 
-func (cc *clusterCreator) findClustersNamed(name string) *clusterModel {
-	clusters, err := cc.client.DescribeDBClusters(context.TODO(), &neptune.DescribeDBClustersInput{DBClusterIdentifier: &name})
+func (cc *clusterCreator) findClustersNamed(ctx context.Context, name string) (*clusterModel, error) {
+	clusters, err := cc.client.DescribeDBClusters(ctx, &neptune.DescribeDBClustersInput{DBClusterIdentifier: &name})
 	if !clusterExists(err) {
-		return nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	if len(clusters.DBClusters) == 0 {
-		return nil
+		return nil, nil
 	} else if len(clusters.DBClusters) > 1 {
-		log.Fatalf("More than one cluster called %s found", name)
-		panic("multiple clusters")
+		return nil, fmt.Errorf("more than one cluster called %s found", name)
 	} else {
 		c1 := clusters.DBClusters[0]
-		return NewClusterModel(cc.loc, cc.coin, *c1.DBClusterIdentifier, *c1.DBClusterArn)
+		return NewClusterModel(cc.loc, cc.coin, *c1.DBClusterIdentifier, *c1.DBClusterArn), nil
 	}
 }
 
+// clusterExists is false only when neptune answers 404
 func clusterExists(err error) bool {
 	if err == nil {
 		return true
@@ -198,19 +249,14 @@ func clusterExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*ht.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				return false
-			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			return false
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting clusters failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
-func (cc *clusterCreator) deleteCluster(cluster *clusterModel, finalSnapshotId string) {
+func (cc *clusterCreator) deleteCluster(ctx context.Context, cluster *clusterModel, finalSnapshotId string) error {
 	args := &neptune.DeleteDBClusterInput{DBClusterIdentifier: &cluster.name}
 	if finalSnapshotId != "" {
 		args.FinalDBSnapshotIdentifier = &finalSnapshotId
@@ -218,47 +264,49 @@ func (cc *clusterCreator) deleteCluster(cluster *clusterModel, finalSnapshotId s
 		skip := true
 		args.SkipFinalSnapshot = &skip
 	}
-	_, err := cc.client.DeleteDBCluster(context.TODO(), args)
-	if err != nil {
-		log.Fatalf("deleting cluster failed: %T %v", err, err)
-	}
+	_, err := cc.client.DeleteDBCluster(ctx, args)
+	return err
 }
 
-func (cc *clusterCreator) waitForCreation(cluster *clusterModel) bool {
-	clusters, err := cc.client.DescribeDBClusters(context.TODO(), &neptune.DescribeDBClustersInput{DBClusterIdentifier: &cluster.name})
-	if !clusterExists(err) || len(clusters.DBClusters) == 0 {
+func (cc *clusterCreator) waitForCreation(ctx context.Context, cluster *clusterModel) (bool, error) {
+	clusters, err := cc.client.DescribeDBClusters(ctx, &neptune.DescribeDBClustersInput{DBClusterIdentifier: &cluster.name})
+	if !clusterExists(err) || (err == nil && len(clusters.DBClusters) == 0) {
 		log.Printf("no clusters found with name %s\n", cluster.name)
-		return false
+		return false, nil
+	} else if err != nil {
+		return true, err
 	}
 	c := clusters.DBClusters[0]
 	if c.Status != nil {
 		if *c.Status == "available" {
-			return true
+			return true, nil
 		} else {
 			log.Printf("status was %s, not available", *c.Status)
 		}
 	} else {
 		log.Printf("status was nil")
 	}
-	return false
+	return false, nil
 }
 
-func (cc *clusterCreator) waitForDeletion(cluster *clusterModel) bool {
-	clusters, err := cc.client.DescribeDBClusters(context.TODO(), &neptune.DescribeDBClustersInput{DBClusterIdentifier: &cluster.name})
-	if !clusterExists(err) || len(clusters.DBClusters) == 0 {
-		return true
+func (cc *clusterCreator) waitForDeletion(ctx context.Context, cluster *clusterModel) (bool, error) {
+	clusters, err := cc.client.DescribeDBClusters(ctx, &neptune.DescribeDBClustersInput{DBClusterIdentifier: &cluster.name})
+	if !clusterExists(err) || (err == nil && len(clusters.DBClusters) == 0) {
+		return true, nil
+	} else if err != nil {
+		return true, err
 	}
 	c := clusters.DBClusters[0]
 	if c.Status != nil {
 		if *c.Status == "deleting" || *c.Status == "available" {
 			log.Printf("cluster %s still exists with status %s\n", cluster.name, *c.Status)
 		} else {
-			log.Fatalf("status was %s, not available or deleting", *c.Status)
+			return true, fmt.Errorf("status was %s, not available or deleting", *c.Status)
 		}
 	} else {
 		log.Printf("cluster %s still exists with nil status\n", cluster.name)
 	}
-	return false
+	return false, nil
 }
 
 func (cc *clusterCreator) String() string {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	ht "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/neptune"
@@ -14,6 +15,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type instanceCreator struct {
@@ -27,7 +29,10 @@ type instanceCreator struct {
 	teardown corebottom.TearDown
 	props    map[driverbottom.Identifier]driverbottom.Expr
 
-	client *neptune.Client
+	client  *neptune.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cc *instanceCreator) Loc() *errorsink.Location {
@@ -51,15 +56,22 @@ func (cc *instanceCreator) CoinId() corebottom.CoinId {
 
 func (cc *instanceCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	log.Printf("want to find neptune instance %s", cc.name)
-	ae := cc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := ae.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	cc.client = awsEnv.NeptuneClient()
+	cc.ctx = awsEnv.Context()
+	cc.timeout = env.ObtainTimeout(cc.tools, cc.props)
+	cc.plan = awsEnv.Plan()
 
-	model := cc.findInstancesNamed(cc.name)
+	model, err := cc.findInstancesNamed(cc.ctx, cc.name)
+	if err != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not describe instance %s: %v", cc.name, err)
+		return
+	}
 
 	if model == nil {
 		log.Printf("instance %s not found\n", cc.name)
@@ -75,21 +87,23 @@ func (cc *instanceCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 	for k, p := range cc.props {
 		v := cc.tools.Storage.Eval(p)
 		switch k.Id() {
+		case "Env", "DeployTimeout":
 		case "Cluster":
 			cluster, ok := v.(*clusterModel)
 			if !ok {
-				log.Fatalf("Cluster did not point to a cluster model")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "Cluster did not point to a cluster model")
+				return
 			}
 			model.cluster = cluster.name
 		case "InstanceClass":
 			clz, ok := utils.AsStringer(v)
 			if !ok {
-				log.Fatalf("ValidationMethod must be a string")
+				cc.tools.Reporter.ReportAtf(p.Loc(), "InstanceClass must be a string")
 				return
 			}
 			model.instanceClz = clz
 		default:
-			log.Fatalf("neptune instance does not support a parameter %s\n", k.Id())
+			cc.tools.Reporter.ReportAtf(k.Loc(), "neptune instance does not support a parameter %s", k.Id())
 		}
 	}
 	// if model.subnetGroup == "" {
@@ -101,15 +115,28 @@ func (cc *instanceCreator) DetermineDesiredState(pres corebottom.ValuePresenter)
 }
 
 func (cc *instanceCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Neptune.Instance", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*instanceModel)
 		log.Printf("instance %s already existed for %s\n", found.arn, found.name)
+		if cc.plan != nil {
+			cc.plan.NoChange("aws.Neptune.Instance", cc.name)
+			cc.tools.Storage.Adopt(cc.coin, found)
+			return
+		}
 		if found.status != "available" {
-			utils.ExponentialBackoff(func() bool {
-				return cc.waitForCreation(found)
+			failed := env.Backoff(ctx, func() (bool, error) {
+				return cc.waitForCreation(ctx, found)
 			})
+			if failed != nil {
+				cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for instance %s: %v", cc.name, failed)
+				return
+			}
 		}
 		cc.tools.Storage.Adopt(cc.coin, found)
 		return
@@ -124,22 +151,37 @@ func (cc *instanceCreator) UpdateReality() {
 	if !strings.HasPrefix(instClz, "db.") {
 		instClz = "db." + instClz
 	}
-	create, err := cc.client.CreateDBInstance(context.TODO(), &neptune.CreateDBInstanceInput{DBInstanceIdentifier: &cc.name, Engine: &neptuneName, DBClusterIdentifier: &desired.cluster, DBInstanceClass: &instClz})
+	if cc.plan != nil {
+		cc.plan.Create("aws.Neptune.Instance", cc.name, plan.Set("DBClusterIdentifier", desired.cluster), plan.Set("DBInstanceClass", instClz))
+		created.arn = plan.Placeholder("aws.Neptune.Instance", cc.name)
+		cc.tools.Storage.Bind(cc.coin, created)
+		return
+	}
+	create, err := cc.client.CreateDBInstance(ctx, &neptune.CreateDBInstanceInput{DBInstanceIdentifier: &cc.name, Engine: &neptuneName, DBClusterIdentifier: &desired.cluster, DBInstanceClass: &instClz})
 	if err != nil {
-		log.Fatalf("failed to create instance %s: %v\n", cc.name, err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed to create instance %s: %v", cc.name, err)
+		return
 	}
 	created.arn = *create.DBInstance.DBInstanceArn
 	log.Printf("initiated request to create instance %s: %s %s\n", cc.name, *create.DBInstance.DBInstanceStatus, *create.DBInstance.DBInstanceArn)
 
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForCreation(created)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForCreation(ctx, created)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for instance %s: %v", cc.name, failed)
+		return
+	}
 
 	log.Printf("created neptune instance %s %s", created.name, created.arn)
 	cc.tools.Storage.Bind(cc.coin, created)
 }
 
 func (cc *instanceCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Neptune.Instance", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
@@ -149,6 +191,12 @@ func (cc *instanceCreator) TearDown() {
 
 	found := tmp.(*instanceModel)
 	log.Printf("you have asked to tear down neptune instance for %s (arn: %s) with mode %s\n", found.name, found.arn, cc.teardown.Mode())
+	if cc.plan != nil {
+		if cc.teardown.Mode() == "delete" {
+			cc.plan.Delete("aws.Neptune.Instance", found.name)
+		}
+		return
+	}
 	// todo: allow @teardown finalSnapshot
 	// will require @finalShapshotIdentifier
 	switch cc.teardown.Mode() {
@@ -156,36 +204,46 @@ func (cc *instanceCreator) TearDown() {
 		log.Printf("not deleting instance %s because teardown mode is 'preserve'", found.name)
 	case "delete":
 		log.Printf("deleting instance for %s with teardown mode 'delete'", found.name)
-		cc.deleteInstance(found, "")
+		err := cc.deleteInstance(ctx, found, "")
+		if err != nil {
+			cc.tools.Reporter.ReportAtf(cc.loc, "deleting instance %s failed: %v", found.name, err)
+			return
+		}
 	default:
 		log.Printf("cannot handle teardown mode '%s' for bucket %s", cc.teardown.Mode(), found.name)
 	}
 
-	utils.ExponentialBackoff(func() bool {
-		return cc.waitForDeletion(found)
+	failed := env.Backoff(ctx, func() (bool, error) {
+		return cc.waitForDeletion(ctx, found)
 	})
+	if failed != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "failed waiting for instance %s to be deleted: %v", found.name, failed)
+		return
+	}
 
 	log.Printf("deleted neptune instance %s", found.name)
 }
 
-func (cc *instanceCreator) findInstancesNamed(name string) *instanceModel {
-	instances, err := cc.client.DescribeDBInstances(context.TODO(), &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &name})
+func (cc *instanceCreator) findInstancesNamed(ctx context.Context, name string) (*instanceModel, error) {
+	instances, err := cc.client.DescribeDBInstances(ctx, &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &name})
 	if !instanceExists(err) {
-		return nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	if len(instances.DBInstances) == 0 {
-		return nil
+		return nil, nil
 	} else if len(instances.DBInstances) > 1 {
-		log.Fatalf("More than one instance called %s found", name)
-		panic("multiple instances")
+		return nil, fmt.Errorf("more than one instance called %s found", name)
 	} else {
 		c1 := instances.DBInstances[0]
 		ret := NewInstanceModel(cc.loc, cc.coin, *c1.DBInstanceIdentifier, *c1.DBInstanceArn)
 		ret.status = *instances.DBInstances[0].DBInstanceStatus
-		return ret
+		return ret, nil
 	}
 }
 
+// instanceExists is false only when neptune answers 404
 func instanceExists(err error) bool {
 	if err == nil {
 		return true
@@ -193,19 +251,14 @@ func instanceExists(err error) bool {
 	e1, ok := err.(*smithy.OperationError)
 	if ok {
 		e2, ok := e1.Err.(*ht.ResponseError)
-		if ok {
-			if e2.ResponseError.Response.StatusCode == 404 {
-				return false
-			}
-			log.Fatalf("error: %T %v %T %v", e2.Response.Status, e2.Response.Status, e2.ResponseError.Response.StatusCode, e2.ResponseError.Response.StatusCode)
+		if ok && e2.ResponseError.Response.StatusCode == 404 {
+			return false
 		}
-		log.Fatalf("error: %T %v", e1.Err, e1.Err)
 	}
-	log.Fatalf("getting clusters failed: %T %v", err, err)
-	panic("failed")
+	return true
 }
 
-func (cc *instanceCreator) deleteInstance(instance *instanceModel, finalSnapshotId string) {
+func (cc *instanceCreator) deleteInstance(ctx context.Context, instance *instanceModel, finalSnapshotId string) error {
 	args := &neptune.DeleteDBInstanceInput{DBInstanceIdentifier: &instance.name}
 	if finalSnapshotId != "" {
 		args.FinalDBSnapshotIdentifier = &finalSnapshotId
@@ -213,35 +266,37 @@ func (cc *instanceCreator) deleteInstance(instance *instanceModel, finalSnapshot
 		skip := true
 		args.SkipFinalSnapshot = &skip
 	}
-	_, err := cc.client.DeleteDBInstance(context.TODO(), args)
-	if err != nil {
-		log.Fatalf("deleting instance failed: %T %v", err, err)
-	}
+	_, err := cc.client.DeleteDBInstance(ctx, args)
+	return err
 }
 
-func (cc *instanceCreator) waitForCreation(instance *instanceModel) bool {
-	instances, err := cc.client.DescribeDBInstances(context.TODO(), &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &instance.name})
-	if !instanceExists(err) || len(instances.DBInstances) == 0 {
+func (cc *instanceCreator) waitForCreation(ctx context.Context, instance *instanceModel) (bool, error) {
+	instances, err := cc.client.DescribeDBInstances(ctx, &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &instance.name})
+	if !instanceExists(err) || (err == nil && len(instances.DBInstances) == 0) {
 		log.Printf("no instances found with name %s\n", instance.name)
-		return false
+		return false, nil
+	} else if err != nil {
+		return true, err
 	}
 	c := instances.DBInstances[0]
 	if c.DBInstanceStatus != nil {
 		if *c.DBInstanceStatus == "available" {
-			return true
+			return true, nil
 		} else {
 			log.Printf("status was %s, not available", *c.DBInstanceStatus)
 		}
 	} else {
 		log.Printf("status was nil")
 	}
-	return false
+	return false, nil
 }
 
-func (cc *instanceCreator) waitForDeletion(instance *instanceModel) bool {
-	instances, err := cc.client.DescribeDBInstances(context.TODO(), &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &instance.name})
-	if !instanceExists(err) || len(instances.DBInstances) == 0 {
-		return true
+func (cc *instanceCreator) waitForDeletion(ctx context.Context, instance *instanceModel) (bool, error) {
+	instances, err := cc.client.DescribeDBInstances(ctx, &neptune.DescribeDBInstancesInput{DBInstanceIdentifier: &instance.name})
+	if !instanceExists(err) || (err == nil && len(instances.DBInstances) == 0) {
+		return true, nil
+	} else if err != nil {
+		return true, err
 	}
 	/*
 		c := instances.DBInstances[0]
@@ -255,7 +310,7 @@ func (cc *instanceCreator) waitForDeletion(instance *instanceModel) bool {
 				log.Printf("instance %s still exists with nil status\n", instance.name)
 			}
 	*/
-	return false
+	return false, nil
 }
 
 func (cc *instanceCreator) String() string {
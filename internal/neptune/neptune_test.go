@@ -0,0 +1,50 @@
+package neptune_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsneptune "github.com/aws/aws-sdk-go-v2/service/neptune"
+	"ziniki.org/deployer/modules/aws/internal/neptune"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestInstanceIsPlacedInItsCluster(t *testing.T) {
+	h := awstest.New(t)
+	h.Fake.AddNeptuneSubnetGroup("graph-subnets", "subnet-1", "subnet-2")
+	subnets := h.Coin("subnets")
+	cluster := h.Coin("cluster")
+	instance := h.Coin("instance")
+	clusterProps := h.Props(map[string]any{"SubnetGroupName": h.Value(subnets), "MinCapacity": 1, "MaxCapacity": 2})
+	instanceProps := h.Props(map[string]any{"Cluster": h.Value(cluster), "InstanceClass": "serverless"})
+
+	h.Find(&neptune.SubnetBlank{}, subnets, "graph-subnets", nil)
+	h.Ensure(&neptune.ClusterBlank{}, cluster, "graph", clusterProps)
+	h.Ensure(&neptune.InstanceBlank{}, instance, "graph-1", instanceProps)
+
+	client := awsneptune.NewFromConfig(h.Fake.Config())
+	clusters, err := client.DescribeDBClusters(context.Background(), &awsneptune.DescribeDBClustersInput{DBClusterIdentifier: aws.String("graph")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sg := aws.ToString(clusters.DBClusters[0].DBSubnetGroup); sg != "graph-subnets" {
+		t.Fatalf("cluster was put in subnet group %q", sg)
+	}
+	instances, err := client.DescribeDBInstances(context.Background(), &awsneptune.DescribeDBInstancesInput{DBInstanceIdentifier: aws.String("graph-1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := aws.ToString(instances.DBInstances[0].DBClusterIdentifier); c != "graph" {
+		t.Fatalf("instance was put in cluster %q", c)
+	}
+
+	h.NextRun()
+	h.Find(&neptune.SubnetBlank{}, subnets, "graph-subnets", nil)
+	h.Determine(&neptune.ClusterBlank{}, cluster, "graph", clusterProps)
+	h.TearDown(&neptune.InstanceBlank{}, instance, "graph-1", instanceProps)
+	h.TearDown(&neptune.ClusterBlank{}, cluster, "graph", clusterProps)
+	if h.Fake.HasNeptuneInstance("graph-1") || h.Fake.HasNeptuneCluster("graph") {
+		t.Fatalf("cluster and instance were not deleted: %v", h.Calls())
+	}
+}
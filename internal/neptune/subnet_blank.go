@@ -15,7 +15,7 @@ func (b *SubnetBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id
 }
 
 func (b *SubnetBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
-	return &subnetCreator{tools: tools, loc: loc, name: named}
+	return &subnetCreator{tools: tools, loc: loc, name: named, props: props}
 }
 
 func (b *SubnetBlank) ShortDescription() string {
@@ -19,7 +19,7 @@ type subnetCreator struct {
 	name string
 	coin corebottom.CoinId
 	// teardown corebottom.TearDown
-	// props    map[driverbottom.Identifier]driverbottom.Expr
+	props map[driverbottom.Identifier]driverbottom.Expr
 
 	client *neptune.Client
 }
@@ -45,15 +45,19 @@ func (cc *subnetCreator) CoinId() corebottom.CoinId {
 
 func (cc *subnetCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	log.Printf("want to find neptune cluster %s", cc.name)
-	ae := cc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := ae.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	cc.client = awsEnv.NeptuneClient()
 
-	model := cc.findSubnetsNamed(cc.name)
+	model, err := cc.findSubnetsNamed(awsEnv.Context(), cc.name)
+	if err != nil {
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not describe subnet group %s: %v", cc.name, err)
+		return
+	}
 
 	if model == nil {
 		log.Printf("subnet %s not found\n", cc.name)
@@ -76,19 +80,20 @@ func (cc *subnetCreator) TearDown() {
 	panic("should not come in here (yet) - i.e. implement this")
 }
 
-func (cc *subnetCreator) findSubnetsNamed(name string) *subnetModel {
-	clusters, err := cc.client.DescribeDBSubnetGroups(context.TODO(), &neptune.DescribeDBSubnetGroupsInput{DBSubnetGroupName: &name})
+func (cc *subnetCreator) findSubnetsNamed(ctx context.Context, name string) (*subnetModel, error) {
+	clusters, err := cc.client.DescribeDBSubnetGroups(ctx, &neptune.DescribeDBSubnetGroupsInput{DBSubnetGroupName: &name})
 	if !clusterExists(err) {
-		return nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	if len(clusters.DBSubnetGroups) == 0 {
-		return nil
+		return nil, nil
 	} else if len(clusters.DBSubnetGroups) > 1 {
-		log.Fatalf("More than one subnet group called %s found", name)
-		panic("multiple subnet groups")
+		return nil, fmt.Errorf("more than one subnet group called %s found", name)
 	} else {
 		c1 := clusters.DBSubnetGroups[0]
-		return NewSubnetGroupModel(cc.loc, cc.coin, *c1.DBSubnetGroupName, *c1.DBSubnetGroupArn)
+		return NewSubnetGroupModel(cc.loc, cc.coin, *c1.DBSubnetGroupName, *c1.DBSubnetGroupArn), nil
 	}
 }
 
@@ -0,0 +1,185 @@
+// Package plan describes what a deployment would do to AWS without doing it.
+//
+// When an environment is planning, each creator compares what it found with what
+// is desired and records the outcome here instead of calling any of the AWS APIs
+// that change things; the clients are also made read-only, so that anything which
+// is missed fails rather than changing AWS.
+package plan
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Action says what would happen to a resource
+type Action string
+
+const (
+	Create   Action = "create"
+	Update   Action = "update"
+	NoChange Action = "no-op"
+	Replace  Action = "replace"
+	Delete   Action = "delete"
+)
+
+// A Field is a property of a resource that would be set or changed; Found is
+// empty for resources that would be created
+type Field struct {
+	Name    string
+	Found   string
+	Desired string
+}
+
+// A Change is what would happen to a single resource, e.g. an aws.S3.Bucket
+type Change struct {
+	Kind   string
+	Name   string
+	Action Action
+	Fields []Field
+}
+
+// A Plan collects the changes of a whole deployment, and writes each one out as
+// it is recorded
+type Plan struct {
+	mu      sync.Mutex
+	out     io.Writer
+	changes []Change
+}
+
+// New creates an empty plan which writes to out (if it is not nil)
+func New(out io.Writer) *Plan {
+	return &Plan{out: out}
+}
+
+// Set describes a field of a resource that would be created
+func Set(name string, value any) Field {
+	return Field{Name: name, Desired: show(value)}
+}
+
+// Compare describes a field of a resource that already exists
+func Compare(name string, found, desired any) Field {
+	return Field{Name: name, Found: show(found), Desired: show(desired)}
+}
+
+// Placeholder stands in for the ARN or id that AWS would give a resource when it was
+// created, so that the things which refer to it can still be planned
+func Placeholder(kind, name string) string {
+	return "(new " + kind + "[" + name + "])"
+}
+
+// IsPlaceholder says whether an ARN or id is a Placeholder, for a resource which does
+// not exist yet, and so cannot have anything attached to it
+func IsPlaceholder(s string) bool {
+	return strings.HasPrefix(s, "(new ") && strings.HasSuffix(s, "])")
+}
+
+// Changed says whether any of the fields of a resource that already exists differ
+func Changed(fields ...Field) bool {
+	for _, f := range fields {
+		if f.Found != f.Desired {
+			return true
+		}
+	}
+	return false
+}
+
+// Create records that a resource would be created, with the given fields; fields with no value are left out
+func (p *Plan) Create(kind, name string, fields ...Field) {
+	var set []Field
+	for _, f := range fields {
+		if f.Desired != "" {
+			set = append(set, f)
+		}
+	}
+	p.record(Change{Kind: kind, Name: name, Action: Create, Fields: set})
+}
+
+// Update records that a resource would be updated, showing the fields that differ;
+// if none of them do, it is recorded as not changing
+func (p *Plan) Update(kind, name string, fields ...Field) {
+	var changed []Field
+	for _, f := range fields {
+		if f.Found != f.Desired {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		p.NoChange(kind, name)
+		return
+	}
+	p.record(Change{Kind: kind, Name: name, Action: Update, Fields: changed})
+}
+
+// Replace records that a resource cannot be changed to match the script, because
+// the fields that differ cannot be updated in place
+func (p *Plan) Replace(kind, name string, fields ...Field) {
+	var changed []Field
+	for _, f := range fields {
+		if f.Found != f.Desired {
+			changed = append(changed, f)
+		}
+	}
+	p.record(Change{Kind: kind, Name: name, Action: Replace, Fields: changed})
+}
+
+// NoChange records that a resource already exists and would be left alone
+func (p *Plan) NoChange(kind, name string) {
+	p.record(Change{Kind: kind, Name: name, Action: NoChange})
+}
+
+// Delete records that a resource would be deleted
+func (p *Plan) Delete(kind, name string) {
+	p.record(Change{Kind: kind, Name: name, Action: Delete})
+}
+
+// Changes returns everything that has been recorded, in order
+func (p *Plan) Changes() []Change {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Change(nil), p.changes...)
+}
+
+func (p *Plan) record(c Change) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, c)
+	if p.out != nil {
+		fmt.Fprint(p.out, c.String())
+	}
+}
+
+func (c Change) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "plan: %s %s[%s]\n", c.Action, c.Kind, c.Name)
+	for _, f := range c.Fields {
+		if c.Action == Create {
+			fmt.Fprintf(&sb, "    %s: %s\n", f.Name, f.Desired)
+		} else {
+			fmt.Fprintf(&sb, "    %s: %s -> %s\n", f.Name, f.Found, f.Desired)
+		}
+	}
+	return sb.String()
+}
+
+// show formats a value for a field, looking through the pointers the SDK uses everywhere
+func show(v any) string {
+	if v == nil {
+		return ""
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return ""
+		}
+		if _, ok := v.(fmt.Stringer); !ok {
+			return show(rv.Elem().Interface())
+		}
+	}
+	if rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,52 @@
+package plan_test
+
+import (
+	"strings"
+	"testing"
+
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+func TestUpdateOnlyShowsDifferences(t *testing.T) {
+	var sb strings.Builder
+	p := plan.New(&sb)
+	role := "arn:aws:iam::123456789012:role/r"
+	p.Update("aws.Lambda.Function", "f", plan.Compare("Role", &role, role), plan.Compare("Handler", "old", "new"))
+	p.Update("aws.Lambda.Function", "g", plan.Compare("Role", &role, role), plan.Compare("SubnetIds", []string{}, nil))
+
+	cs := p.Changes()
+	if len(cs) != 2 || cs[0].Action != plan.Update || len(cs[0].Fields) != 1 || cs[1].Action != plan.NoChange {
+		t.Fatalf("changes were %v", cs)
+	}
+	want := "plan: update aws.Lambda.Function[f]\n    Handler: old -> new\nplan: no-op aws.Lambda.Function[g]\n"
+	if sb.String() != want {
+		t.Fatalf("plan printed %q", sb.String())
+	}
+}
+
+func TestCreateLeavesOutEmptyFields(t *testing.T) {
+	p := plan.New(nil)
+	var key *string
+	p.Create("aws.S3.Bucket", "b", plan.Set("Key", key), plan.Set("Region", "us-east-1"))
+	if s := p.Changes()[0].String(); s != "plan: create aws.S3.Bucket[b]\n    Region: us-east-1\n" {
+		t.Fatalf("change was %q", s)
+	}
+}
+
+func TestReplaceShowsWhatCannotChange(t *testing.T) {
+	p := plan.New(nil)
+	p.Replace("aws.S3.Bucket", "b", plan.Compare("Region", "us-east-1", "eu-west-2"), plan.Compare("Policy", "", ""))
+	if s := p.Changes()[0].String(); s != "plan: replace aws.S3.Bucket[b]\n    Region: us-east-1 -> eu-west-2\n" {
+		t.Fatalf("change was %q", s)
+	}
+}
+
+func TestChangedLooksThroughPointers(t *testing.T) {
+	size := int32(128)
+	if plan.Changed(plan.Compare("MemorySize", &size, size), plan.Compare("Handler", "main", "main")) {
+		t.Fatalf("nothing should have changed")
+	}
+	if !plan.Changed(plan.Compare("MemorySize", &size, int32(256))) {
+		t.Fatalf("MemorySize should have changed")
+	}
+}
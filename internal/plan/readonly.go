@@ -0,0 +1,45 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// the operations which only look at things; STS is allowed as a whole because
+// assuming a role changes nothing
+var readOnlyPrefixes = []string{"Describe", "Get", "Head", "List"}
+
+// ErrPlanning is the error given for calls that are refused because they could change something
+var ErrPlanning = errors.New("not allowed while planning")
+
+// ReadOnly is an API option which stops clients from calling any operation that
+// could change anything in AWS
+func ReadOnly(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("planReadOnly", refuseChanges), middleware.Before)
+}
+
+// Mutates says whether an operation (e.g. "CreateBucket" on "S3") could change anything in AWS
+func Mutates(service, op string) bool {
+	if service == "STS" {
+		return false
+	}
+	for _, p := range readOnlyPrefixes {
+		if strings.HasPrefix(op, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func refuseChanges(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	service := middleware.GetServiceID(ctx)
+	op := middleware.GetOperationName(ctx)
+	if !Mutates(service, op) {
+		return next.HandleInitialize(ctx, in)
+	}
+	return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("%s.%s is %w", service, op, ErrPlanning)
+}
@@ -18,20 +18,33 @@ func BuildFrom(name string, policy corebottom.PolicyDocument, rules PolicyRules)
 
 type PolicyRules interface {
 	AllowResources() bool
+	// OwnedSids says whether the Sids should only be made of letters and digits, so that
+	// the statements can be found again by SidPrefix when merged with other statements
+	OwnedSids() bool
 }
 
 type assemblyRules struct {
 	allowResources bool
+	ownedSids      bool
 }
 
 func (r *assemblyRules) AllowResources() bool {
 	return r.allowResources
 }
 
+func (r *assemblyRules) OwnedSids() bool {
+	return r.ownedSids
+}
+
 func StandardRules() PolicyRules {
 	return &assemblyRules{allowResources: true}
 }
 
+// BucketRules are for resource policies which several things may attach statements to (see Merge)
+func BucketRules() PolicyRules {
+	return &assemblyRules{allowResources: true, ownedSids: true}
+}
+
 func AssumeRoleRules() PolicyRules {
 	return &assemblyRules{allowResources: false}
 }
@@ -0,0 +1,131 @@
+package policyjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Merge adds the statements of addition to the policy in existing, so that several
+// things can attach statements to the same resource without overwriting each other.
+//
+// A statement with the same Sid as one that is already there replaces it; a statement
+// which is the same as one already there apart from its Sid is a duplicate and is left
+// out. A statement whose Sid starts with prefix (see SidPrefix) but which is not in
+// addition is left over from an earlier version of it, and is removed; any other
+// statement belongs to someone else and is kept.
+//
+// It returns the merged policy and whether it is any different from existing.
+func Merge(existing, addition, prefix string) (string, bool, error) {
+	if existing == "" {
+		return addition, addition != "", nil
+	}
+	have, err := parsePolicy(existing)
+	if err != nil {
+		return "", false, fmt.Errorf("existing policy: %w", err)
+	}
+	add, err := parsePolicy(addition)
+	if err != nil {
+		return "", false, fmt.Errorf("new policy: %w", err)
+	}
+	var stmts []map[string]any
+	changed := false
+	for _, h := range have.statements {
+		if stale(h, prefix, add.statements) {
+			changed = true
+			continue
+		}
+		stmts = append(stmts, h)
+	}
+outer:
+	for _, s := range add.statements {
+		for i, h := range stmts {
+			if h["Sid"] != nil && h["Sid"] == s["Sid"] {
+				if !reflect.DeepEqual(h, s) {
+					stmts[i] = s
+					changed = true
+				}
+				continue outer
+			}
+		}
+		for _, h := range stmts {
+			if sameApartFromSid(h, s) {
+				continue outer
+			}
+		}
+		stmts = append(stmts, s)
+		changed = true
+	}
+	if !changed {
+		return existing, false, nil
+	}
+	have.doc["Statement"] = stmts
+	bs, err := json.MarshalIndent(have.doc, "", "  ")
+	if err != nil {
+		return "", false, err
+	}
+	return string(bs), true, nil
+}
+
+type parsedPolicy struct {
+	doc        map[string]any
+	statements []map[string]any
+}
+
+func parsePolicy(s string) (*parsedPolicy, error) {
+	ret := &parsedPolicy{}
+	if err := json.Unmarshal([]byte(s), &ret.doc); err != nil {
+		return nil, err
+	}
+	// AWS allows a single statement to be given on its own rather than in a list
+	switch st := ret.doc["Statement"].(type) {
+	case nil:
+	case map[string]any:
+		ret.statements = []map[string]any{st}
+	case []any:
+		for _, e := range st {
+			m, ok := e.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("statement was not an object but %T", e)
+			}
+			ret.statements = append(ret.statements, m)
+		}
+	default:
+		return nil, fmt.Errorf("Statement was not a list but %T", st)
+	}
+	return ret, nil
+}
+
+// stale says whether h is one of our statements which is no longer in the policy
+func stale(h map[string]any, prefix string, now []map[string]any) bool {
+	sid, ok := h["Sid"].(string)
+	if !ok || prefix == "" || !strings.HasPrefix(sid, prefix) {
+		return false
+	}
+	for _, s := range now {
+		if s["Sid"] == sid {
+			return false
+		}
+	}
+	return true
+}
+
+func sameApartFromSid(a, b map[string]any) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	ac := make(map[string]any, len(a))
+	for k, v := range a {
+		if k != "Sid" {
+			ac[k] = v
+		}
+	}
+	bc := make(map[string]any, len(b))
+	for k, v := range b {
+		if k != "Sid" {
+			bc[k] = v
+		}
+	}
+	return reflect.DeepEqual(ac, bc)
+}
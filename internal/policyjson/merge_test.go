@@ -0,0 +1,72 @@
+package policyjson_test
+
+import (
+	"strings"
+	"testing"
+
+	"ziniki.org/deployer/modules/aws/internal/policyjson"
+)
+
+const readByCloudFront = `{"Version": "2012-10-17", "Statement": [{"Sid": "cf", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::site/*", "Principal": {"Service": "cloudfront.amazonaws.com"}}]}`
+const readByPartner = `{"Version": "2012-10-17", "Statement": [{"Sid": "partner", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::site/*", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}}]}`
+
+func TestStatementsFromDifferentPoliciesAreKept(t *testing.T) {
+	merged, changed, err := policyjson.Merge(readByCloudFront, readByPartner, "partner")
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if !changed {
+		t.Fatalf("adding a statement did not change the policy")
+	}
+	if !strings.Contains(merged, `"cf"`) || !strings.Contains(merged, `"partner"`) {
+		t.Fatalf("merged policy was %s", merged)
+	}
+}
+
+func TestAttachingTheSamePolicyAgainChangesNothing(t *testing.T) {
+	merged, changed, err := policyjson.Merge(readByCloudFront, readByCloudFront, "cf")
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if changed || merged != readByCloudFront {
+		t.Fatalf("policy was changed to %s", merged)
+	}
+	renamed := strings.Replace(readByCloudFront, `"cf"`, `"other"`, 1)
+	if _, changed, _ := policyjson.Merge(readByCloudFront, renamed, "other"); changed {
+		t.Fatalf("a duplicate statement with a different Sid was added")
+	}
+}
+
+func TestStatementWithTheSameSidIsReplaced(t *testing.T) {
+	updated := strings.Replace(readByCloudFront, "s3:GetObject", "s3:ListBucket", 1)
+	merged, changed, err := policyjson.Merge(readByCloudFront, updated, "cf")
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if !changed || strings.Contains(merged, "s3:GetObject") || strings.Count(merged, `"Sid"`) != 1 {
+		t.Fatalf("merged policy was %s", merged)
+	}
+}
+
+func TestAStatementChangedTwiceIsOnlyThereOnce(t *testing.T) {
+	prefix := policyjson.SidPrefix("my-site")
+	policy := readByPartner
+	for _, action := range []string{"s3:GetObject", "s3:ListBucket", "s3:GetObjectVersion"} {
+		ours := `{"Version": "2012-10-17", "Statement": [{"Sid": "` + prefix + `0", "Effect": "Allow", "Action": "` + action + `", "Resource": "arn:aws:s3:::site/*", "Principal": {"Service": "cloudfront.amazonaws.com"}}]}`
+		merged, _, err := policyjson.Merge(policy, ours, prefix)
+		if err != nil {
+			t.Fatalf("merge failed: %v", err)
+		}
+		policy = merged
+	}
+	if strings.Count(policy, `"Sid"`) != 2 || strings.Count(policy, prefix) != 1 || !strings.Contains(policy, "s3:GetObjectVersion") || !strings.Contains(policy, `"partner"`) {
+		t.Fatalf("merged policy was %s", policy)
+	}
+
+	// statements which are no longer attached at all are removed too
+	none := `{"Version": "2012-10-17", "Statement": []}`
+	merged, changed, err := policyjson.Merge(policy, none, prefix)
+	if err != nil || !changed || strings.Contains(merged, prefix) || !strings.Contains(merged, `"partner"`) {
+		t.Fatalf("merged policy was %s (%v)", merged, err)
+	}
+}
@@ -3,6 +3,8 @@ package policyjson
 import (
 	"fmt"
 	"log"
+	"strings"
+	"unicode"
 
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 )
@@ -17,7 +19,11 @@ func makePolicyJson(name string, policy corebottom.PolicyDocument, rules PolicyR
 	ret.Version = "2012-10-17"
 	ret.Statement = []stmtJson{}
 	for k, item := range policy.Items() {
-		ret.Statement = append(ret.Statement, makeStmtJson(name, k, item, rules))
+		stmt := makeStmtJson(name, k, item, rules)
+		if rules.OwnedSids() {
+			stmt.Sid = fmt.Sprintf("%s%d", SidPrefix(name), k)
+		}
+		ret.Statement = append(ret.Statement, stmt)
 	}
 	return ret
 }
@@ -81,6 +87,18 @@ func makeStmtJson(policyName string, k int, item corebottom.PolicyEffect, rules
 	return ret
 }
 
+// SidPrefix is how the Sids of the statements in the policy called policyName begin,
+// so that they can be told apart from statements which were put there by anything else
+func SidPrefix(policyName string) string {
+	// Sids can only contain letters and digits
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return -1
+	}, policyName) + "Sid"
+}
+
 func makePrincipal(p corebottom.PolicyPrincipal) map[string]string {
 	ret := map[string]string{}
 	ret[p.Key()] = p.Value()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
@@ -11,6 +13,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type aliasCreator struct {
@@ -22,7 +25,10 @@ type aliasCreator struct {
 	props    map[driverbottom.Identifier]driverbottom.Expr
 	teardown corebottom.TearDown
 
-	client *route53.Client
+	client  *route53.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (ac *aliasCreator) Loc() *errorsink.Location {
@@ -50,6 +56,7 @@ func (ac *aliasCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	seenErr := false
 	for p, v := range ac.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "PointsTo":
 			// ignoe this
 		case "AliasZone":
@@ -70,28 +77,34 @@ func (ac *aliasCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 
 	updZoneId, ok := ac.tools.Storage.EvalAsStringer(updZone)
 	if !ok {
-		panic("hello, world")
+		ac.tools.Reporter.ReportAtf(ac.loc, "UpdateZone must be a string")
+		return
 	}
 
-	aliasZoneId, ok := ac.tools.Storage.EvalAsStringer(aliasZone)
-	if !ok {
-		panic("hello, world")
+	// the zone it is in is only checked here; what it actually is comes from the record
+	if _, ok := ac.tools.Storage.EvalAsStringer(aliasZone); !ok {
+		ac.tools.Reporter.ReportAtf(ac.loc, "AliasZone must be a string")
+		return
 	}
 
-	eq := ac.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(ac.tools, ac.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	// cc.domainsClient = awsEnv.Route53DomainsClient()
 	ac.client = awsEnv.Route53Client()
+	ac.ctx = awsEnv.Context()
+	ac.timeout = env.ObtainTimeout(ac.tools, ac.props)
+	ac.plan = awsEnv.Plan()
 
 	uz := updZoneId.String()
 	log.Printf("scanning zone %s\n", uz)
-	rrs, err := ac.client.ListResourceRecordSets(context.TODO(), &route53.ListResourceRecordSetsInput{HostedZoneId: &uz})
+	rrs, err := ac.client.ListResourceRecordSets(ac.ctx, &route53.ListResourceRecordSetsInput{HostedZoneId: &uz})
 	if err != nil {
-		panic(err)
+		ac.tools.Reporter.ReportAtf(ac.loc, "could not list records in zone %s: %v", uz, err)
+		return
 	}
 
 	for _, r := range rrs.ResourceRecordSets {
@@ -99,9 +112,8 @@ func (ac *aliasCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 			continue
 		}
 		if r.Type == "A" && *r.Name == ac.name+"." {
-			// TODO: we should also handle the case where it has changed
 			log.Printf("already have A %s %v\n", *r.Name, *r.AliasTarget.DNSName)
-			model := &aliasModel{loc: ac.loc, name: ac.name, otherDomain: *r.AliasTarget.DNSName, aliasZoneId: aliasZoneId.String(), updateZoneId: updZoneId.String()}
+			model := &aliasModel{loc: ac.loc, name: ac.name, otherDomain: *r.AliasTarget.DNSName, aliasZoneId: *r.AliasTarget.HostedZoneId, updateZoneId: updZoneId.String()}
 			pres.Present(model)
 			return
 		}
@@ -117,6 +129,7 @@ func (ac *aliasCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	seenErr := false
 	for p, v := range ac.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "PointsTo":
 			pointsTo = v
 		case "UpdateZone":
@@ -140,12 +153,14 @@ func (ac *aliasCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 
 	updZoneId, ok := ac.tools.Storage.EvalAsStringer(updZone)
 	if !ok {
-		panic("hello, world")
+		ac.tools.Reporter.ReportAtf(ac.loc, "UpdateZone must be a string")
+		return
 	}
 
 	aliasZoneId, ok := ac.tools.Storage.EvalAsStringer(aliasZone)
 	if !ok {
-		panic("hello, world")
+		ac.tools.Reporter.ReportAtf(ac.loc, "AliasZone must be a string")
+		return
 	}
 
 	pt := pointsTo.Eval(ac.tools.Storage)
@@ -155,39 +170,66 @@ func (ac *aliasCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (ac *aliasCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(ac.ctx, ac.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Route53.ALIAS", ac.name, ac.coin)
+
 	tmp := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_INITIAL_MODE)
+	desired := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_DESIRED_MODE).(*aliasModel)
 
-	if tmp != nil {
-		found := tmp.(*aliasModel)
-		log.Printf("alias %s already exists\n", found.name)
+	if tmp == nil && ac.plan != nil {
+		// what it points to may not have been created yet, so is not necessarily known
+		ac.plan.Create("aws.Route53.ALIAS", ac.name, plan.Set("HostedZoneId", desired.updateZoneId), plan.Set("DNSName", desired.otherDomain), plan.Set("AliasZoneId", desired.aliasZoneId))
+		ac.tools.Storage.Bind(ac.coin, &aliasModel{name: ac.name, loc: ac.loc})
 		return
 	}
 
-	log.Printf("creating alias %s\n", ac.name)
-	desired := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_DESIRED_MODE).(*aliasModel)
-
 	created := &aliasModel{name: ac.name, loc: ac.loc}
 
 	od, ok := desired.otherDomain.(string)
 	if !ok {
 		str, ok := desired.otherDomain.(fmt.Stringer)
 		if !ok {
-			panic("not a string or Stringer)")
+			ac.tools.Reporter.ReportAtf(ac.loc, "alias %s must point to a string, not %T", ac.name, desired.otherDomain)
+			return
 		}
 		od = str.String()
 	}
 
+	action := r53types.ChangeActionCreate
+	if tmp != nil {
+		found := tmp.(*aliasModel)
+		log.Printf("alias %s already exists\n", found.name)
+		fd := found.otherDomain.(string)
+		if ac.plan != nil {
+			ac.plan.Update("aws.Route53.ALIAS", ac.name, plan.Compare("DNSName", canonicalDomain(fd), canonicalDomain(od)), plan.Compare("AliasZoneId", found.aliasZoneId, desired.aliasZoneId))
+			return
+		}
+		if canonicalDomain(fd) == canonicalDomain(od) && found.aliasZoneId == desired.aliasZoneId {
+			return
+		}
+		log.Printf("alias %s points to %s, not %s\n", ac.name, fd, od)
+		action = r53types.ChangeActionUpsert
+	} else {
+		log.Printf("creating alias %s\n", ac.name)
+	}
+
 	changes := r53types.ResourceRecordSet{Name: &ac.name, Type: "A", AliasTarget: &r53types.AliasTarget{DNSName: &od, HostedZoneId: &desired.aliasZoneId}}
-	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: "CREATE", ResourceRecordSet: &changes}}}
-	_, err := ac.client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{HostedZoneId: &desired.updateZoneId, ChangeBatch: &cb})
+	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: action, ResourceRecordSet: &changes}}}
+	_, err := ac.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &desired.updateZoneId, ChangeBatch: &cb})
 	if err != nil {
-		panic(err)
+		ac.tools.Reporter.ReportAtf(ac.loc, "could not %s alias %s: %v", strings.ToLower(string(action)), ac.name, err)
+		return
 	}
 
 	ac.tools.Storage.Bind(ac.coin, created)
 }
 
 func (ac *aliasCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(ac.ctx, ac.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Route53.ALIAS", ac.name, ac.coin)
+
 	tmp := ac.tools.Storage.GetCoin(ac.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
@@ -197,22 +239,33 @@ func (ac *aliasCreator) TearDown() {
 
 	found := tmp.(*aliasModel)
 	log.Printf("need to remove an alias record for %s\n", ac.name)
+	if ac.plan != nil {
+		ac.plan.Delete("aws.Route53.ALIAS", ac.name)
+		return
+	}
 	od, ok := found.otherDomain.(string)
 	if !ok {
 		str, ok := found.otherDomain.(fmt.Stringer)
 		if !ok {
-			panic("not a string or Stringer)")
+			ac.tools.Reporter.ReportAtf(ac.loc, "alias %s must point to a string, not %T", ac.name, found.otherDomain)
+			return
 		}
 		od = str.String()
 	}
 	changes := r53types.ResourceRecordSet{Name: &ac.name, Type: "A", AliasTarget: &r53types.AliasTarget{DNSName: &od, HostedZoneId: &found.aliasZoneId}}
 	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: "DELETE", ResourceRecordSet: &changes}}}
-	_, err := ac.client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{HostedZoneId: &found.updateZoneId, ChangeBatch: &cb})
+	_, err := ac.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &found.updateZoneId, ChangeBatch: &cb})
 	if err != nil {
-		panic(err)
+		ac.tools.Reporter.ReportAtf(ac.loc, "could not delete alias %s: %v", ac.name, err)
 	}
 }
 
+// canonicalDomain makes names comparable; Route53 gives them back in lower case with
+// a trailing dot, whatever they were set to
+func canonicalDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
 func (ac *aliasCreator) String() string {
 	return fmt.Sprintf("EnsureAlias[%s:%s]", "" /* eb.env.Region */, ac.name)
 }
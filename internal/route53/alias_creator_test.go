@@ -0,0 +1,49 @@
+package route53_test
+
+import (
+	"strings"
+	"testing"
+
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"ziniki.org/deployer/modules/aws/internal/route53"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+// cloudFrontZone is the zone that CloudFront distributions are always in
+const cloudFrontZone = "Z2FDTNDATAQYW2"
+
+func TestAliasIsUpsertedWhenItsTargetMoves(t *testing.T) {
+	h := awstest.New(t)
+	zone := h.Fake.AddDomain("example.com")
+	alias := h.Coin("alias")
+	props := func(target string) map[string]any {
+		return map[string]any{"UpdateZone": zone, "AliasZone": cloudFrontZone, "PointsTo": target}
+	}
+	aliases := func() []r53types.AliasTarget {
+		var ret []r53types.AliasTarget
+		for _, r := range h.Fake.Records(zone) {
+			if *r.Name == "example.com." && r.Type == "A" {
+				ret = append(ret, *r.AliasTarget)
+			}
+		}
+		return ret
+	}
+
+	h.Ensure(&route53.ALIASBlank{}, alias, "example.com", h.Props(props("d1.cloudfront.net")))
+
+	h.NextRun()
+	h.Calls()
+	h.Ensure(&route53.ALIASBlank{}, alias, "example.com", h.Props(props("D1.cloudfront.net.")))
+	for _, c := range h.Calls() {
+		if c == "Route 53.ChangeResourceRecordSets" {
+			t.Fatalf("alias already pointed at d1.cloudfront.net")
+		}
+	}
+
+	h.NextRun()
+	h.Ensure(&route53.ALIASBlank{}, alias, "example.com", h.Props(props("d2.cloudfront.net")))
+	got := aliases()
+	if len(got) != 1 || !strings.HasPrefix(*got[0].DNSName, "d2.cloudfront.net") {
+		t.Fatalf("alias should only point at d2.cloudfront.net, not %v", got)
+	}
+}
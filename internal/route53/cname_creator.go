@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
@@ -11,6 +13,7 @@ import (
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type cnameCreator struct {
@@ -21,7 +24,10 @@ type cnameCreator struct {
 	coin  corebottom.CoinId
 	props map[driverbottom.Identifier]driverbottom.Expr
 
-	client *route53.Client
+	client  *route53.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 }
 
 func (cc *cnameCreator) Loc() *errorsink.Location {
@@ -48,6 +54,7 @@ func (cc *cnameCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	seenErr := false
 	for p, v := range cc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "PointsTo":
 		case "Zone":
 			zone = v
@@ -58,29 +65,33 @@ func (cc *cnameCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 	if !seenErr && zone == nil {
 		cc.tools.Reporter.ReportAtf(cc.loc, "no Zone property was specified for %s", cc.name)
 	}
-	eq := cc.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(cc.tools, cc.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	cc.client = awsEnv.Route53Client()
+	cc.ctx = awsEnv.Context()
+	cc.timeout = env.ObtainTimeout(cc.tools, cc.props)
+	cc.plan = awsEnv.Plan()
 	fred, ok := cc.tools.Storage.EvalAsStringer(zone)
 	if !ok {
-		panic("hello, world")
+		cc.tools.Reporter.ReportAtf(cc.loc, "Zone must be a string")
+		return
 	}
 
 	z := fred.String()
 	log.Printf("scanning zone %s\n", z)
-	rrs, err := cc.client.ListResourceRecordSets(context.TODO(), &route53.ListResourceRecordSetsInput{HostedZoneId: &z})
+	rrs, err := cc.client.ListResourceRecordSets(cc.ctx, &route53.ListResourceRecordSetsInput{HostedZoneId: &z})
 	if err != nil {
-		panic(err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not list records in zone %s: %v", z, err)
+		return
 	}
 
 	for _, r := range rrs.ResourceRecordSets {
 		// log.Printf("found rrs %s %s", *r.Name, *r.ResourceRecords[0].Value)
 		if r.Type == "CNAME" && *r.Name == cc.name+"." {
-			// TODO: we should also handle the case where it has changed
 			log.Printf("already have %s %v\n", *r.Name, *r.ResourceRecords[0].Value)
 			model := &cnameModel{loc: cc.loc, name: cc.name, pointsTo: *r.ResourceRecords[0].Value, updateZoneId: z}
 			pres.Present(model)
@@ -97,6 +108,7 @@ func (cc *cnameCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 	seenErr := false
 	for p, v := range cc.props {
 		switch p.Id() {
+		case "Env", "DeployTimeout":
 		case "PointsTo":
 			pointsTo = v
 		case "Zone":
@@ -115,7 +127,8 @@ func (cc *cnameCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 
 	zoneId, ok := cc.tools.Storage.EvalAsStringer(zone)
 	if !ok {
-		panic("hello, world")
+		cc.tools.Reporter.ReportAtf(cc.loc, "Zone must be a string")
+		return
 	}
 	pt := pointsTo.Eval(cc.tools.Storage)
 
@@ -125,17 +138,20 @@ func (cc *cnameCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
 }
 
 func (cc *cnameCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Route53.CNAME", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
+	desired := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_DESIRED_MODE).(*cnameModel)
 
-	if tmp != nil {
-		found := tmp.(*cnameModel)
-		log.Printf("CNAME %s already exists\n", found.name)
+	if tmp == nil && cc.plan != nil {
+		// what it points to may not have been created yet, so is not necessarily known
+		cc.plan.Create("aws.Route53.CNAME", cc.name, plan.Set("HostedZoneId", desired.updateZoneId), plan.Set("Value", desired.pointsTo))
+		cc.tools.Storage.Bind(cc.coin, &cnameModel{name: cc.name, loc: cc.loc})
 		return
 	}
 
-	log.Printf("creating CNAME %s\n", cc.name)
-	desired := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_DESIRED_MODE).(*cnameModel)
-
 	created := &cnameModel{name: cc.name, loc: cc.loc}
 
 	var ttl int64 = 300
@@ -143,23 +159,46 @@ func (cc *cnameCreator) UpdateReality() {
 	if !ok {
 		str, ok := desired.pointsTo.(fmt.Stringer)
 		if !ok {
-			log.Printf("pointsto was %T %p", desired.pointsTo, desired.pointsTo)
-			panic("not a string or Stringer")
+			cc.tools.Reporter.ReportAtf(cc.loc, "CNAME %s must point to a string, not %T", cc.name, desired.pointsTo)
+			return
 		}
 		od = str.String()
 	}
 
+	action := r53types.ChangeActionCreate
+	if tmp != nil {
+		found := tmp.(*cnameModel)
+		log.Printf("CNAME %s already exists\n", found.name)
+		fd := found.pointsTo.(string)
+		if cc.plan != nil {
+			cc.plan.Update("aws.Route53.CNAME", cc.name, plan.Compare("Value", canonicalDomain(fd), canonicalDomain(od)))
+			return
+		}
+		if canonicalDomain(fd) == canonicalDomain(od) {
+			return
+		}
+		log.Printf("CNAME %s points to %s, not %s\n", cc.name, fd, od)
+		action = r53types.ChangeActionUpsert
+	} else {
+		log.Printf("creating CNAME %s\n", cc.name)
+	}
+
 	changes := r53types.ResourceRecordSet{Name: &cc.name, Type: "CNAME", TTL: &ttl, ResourceRecords: []r53types.ResourceRecord{{Value: &od}}}
-	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: "CREATE", ResourceRecordSet: &changes}}}
-	_, err := cc.client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{HostedZoneId: &desired.updateZoneId, ChangeBatch: &cb})
+	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: action, ResourceRecordSet: &changes}}}
+	_, err := cc.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &desired.updateZoneId, ChangeBatch: &cb})
 	if err != nil {
-		panic(err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not %s CNAME %s: %v", strings.ToLower(string(action)), cc.name, err)
+		return
 	}
 
 	cc.tools.Storage.Bind(cc.coin, created)
 }
 
 func (cc *cnameCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(cc.ctx, cc.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.Route53.CNAME", cc.name, cc.coin)
+
 	tmp := cc.tools.Storage.GetCoin(cc.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
@@ -169,21 +208,25 @@ func (cc *cnameCreator) TearDown() {
 
 	found := tmp.(*cnameModel)
 	log.Printf("need to remove a CNAME record for %s\n", cc.name)
+	if cc.plan != nil {
+		cc.plan.Delete("aws.Route53.CNAME", cc.name)
+		return
+	}
 	od, ok := found.pointsTo.(string)
 	if !ok {
 		str, ok := found.pointsTo.(fmt.Stringer)
 		if !ok {
-			log.Printf("pointsto was %T %p", found.pointsTo, found.pointsTo)
-			panic("not a string or Stringer")
+			cc.tools.Reporter.ReportAtf(cc.loc, "CNAME %s must point to a string, not %T", cc.name, found.pointsTo)
+			return
 		}
 		od = str.String()
 	}
 	var ttl int64 = 300
 	changes := r53types.ResourceRecordSet{Name: &cc.name, Type: "CNAME", TTL: &ttl, ResourceRecords: []r53types.ResourceRecord{{Value: &od}}}
 	cb := r53types.ChangeBatch{Changes: []r53types.Change{{Action: "DELETE", ResourceRecordSet: &changes}}}
-	_, err := cc.client.ChangeResourceRecordSets(context.TODO(), &route53.ChangeResourceRecordSetsInput{HostedZoneId: &found.updateZoneId, ChangeBatch: &cb})
+	_, err := cc.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &found.updateZoneId, ChangeBatch: &cb})
 	if err != nil {
-		panic(err)
+		cc.tools.Reporter.ReportAtf(cc.loc, "could not delete CNAME %s: %v", cc.name, err)
 	}
 }
 
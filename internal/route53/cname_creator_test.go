@@ -0,0 +1,58 @@
+package route53_test
+
+import (
+	"testing"
+
+	"ziniki.org/deployer/modules/aws/internal/route53"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestCNAMEPointsAtItsTarget(t *testing.T) {
+	h := awstest.New(t)
+	zone := h.Fake.AddDomain("example.com")
+	other := h.Fake.AddDomain("example.org")
+	cname := h.Coin("cname")
+	props := h.Props(map[string]any{"Zone": zone, "PointsTo": "d1.cloudfront.net"})
+	pointsAt := func(zone string) string {
+		for _, r := range h.Fake.Records(zone) {
+			if *r.Name == "www.example.com." && r.Type == "CNAME" {
+				return *r.ResourceRecords[0].Value
+			}
+		}
+		return ""
+	}
+
+	h.Ensure(&route53.CNAMEBlank{}, cname, "www.example.com", props)
+	if got := pointsAt(zone); got != "d1.cloudfront.net" {
+		t.Fatalf("CNAME points at %q", got)
+	}
+	if got := pointsAt(other); got != "" {
+		t.Fatalf("CNAME was put in the wrong zone")
+	}
+
+	h.NextRun()
+	h.TearDown(&route53.CNAMEBlank{}, cname, "www.example.com", props)
+	if got := pointsAt(zone); got != "" {
+		t.Fatalf("CNAME was not deleted: %q", got)
+	}
+}
+
+func TestCNAMEIsRepointed(t *testing.T) {
+	h := awstest.New(t)
+	zone := h.Fake.AddDomain("example.com")
+	cname := h.Coin("cname")
+
+	h.Ensure(&route53.CNAMEBlank{}, cname, "www.example.com", h.Props(map[string]any{"Zone": zone, "PointsTo": "d1.cloudfront.net"}))
+
+	h.NextRun()
+	h.Ensure(&route53.CNAMEBlank{}, cname, "www.example.com", h.Props(map[string]any{"Zone": zone, "PointsTo": "d2.cloudfront.net"}))
+	var values []string
+	for _, r := range h.Fake.Records(zone) {
+		if *r.Name == "www.example.com." && r.Type == "CNAME" {
+			values = append(values, *r.ResourceRecords[0].Value)
+		}
+	}
+	if len(values) != 1 || values[0] != "d2.cloudfront.net" {
+		t.Fatalf("CNAME should only point at d2.cloudfront.net, not %v", values)
+	}
+}
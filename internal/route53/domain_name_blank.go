@@ -14,7 +14,7 @@ func (b *DomainNameBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location,
 }
 
 func (b *DomainNameBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
-	return &domainNameFinder{tools: tools, loc: loc, name: named}
+	return &domainNameFinder{tools: tools, loc: loc, name: named, props: props}
 }
 
 func (b *DomainNameBlank) ShortDescription() string {
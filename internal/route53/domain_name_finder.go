@@ -1,7 +1,6 @@
 package route53
 
 import (
-	"context"
 	e "errors"
 	"fmt"
 	"log"
@@ -18,6 +17,9 @@ import (
 
 type ExportedDomain interface {
 	HostedZoneId() string
+
+	// the client for the account that hosts the zone, which may not be the one asking
+	Route53Client() *route53.Client
 }
 
 type domainNameFinder struct {
@@ -26,6 +28,7 @@ type domainNameFinder struct {
 	loc           *errorsink.Location
 	name          string
 	coin          corebottom.CoinId
+	props         map[driverbottom.Identifier]driverbottom.Expr
 	route53Client *route53.Client
 	domainsClient *route53domains.Client
 }
@@ -50,15 +53,16 @@ func (acmc *domainNameFinder) CoinId() corebottom.CoinId {
 }
 
 func (dnf *domainNameFinder) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := dnf.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(dnf.tools, dnf.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	dnf.domainsClient = awsEnv.Route53DomainsClient()
 	dnf.route53Client = awsEnv.Route53Client()
-	detail, err := dnf.domainsClient.GetDomainDetail(context.TODO(), &route53domains.GetDomainDetailInput{DomainName: &dnf.name})
+	ctx := awsEnv.Context()
+	detail, err := dnf.domainsClient.GetDomainDetail(ctx, &route53domains.GetDomainDetailInput{DomainName: &dnf.name})
 	if err != nil {
 		var api smithy.APIError
 		if e.As(err, &api) {
@@ -66,16 +70,19 @@ func (dnf *domainNameFinder) DetermineInitialState(pres corebottom.ValuePresente
 				dnf.tools.Reporter.ReportAtf(dnf.loc, "domain does not belong to this account: %s\n", dnf.name)
 				return
 			} else {
-				log.Fatal(err)
+				dnf.tools.Reporter.ReportAtf(dnf.loc, "could not find domain %s: %v", dnf.name, err)
+				return
 			}
 		} else {
-			log.Fatal(err)
+			dnf.tools.Reporter.ReportAtf(dnf.loc, "could not find domain %s: %v", dnf.name, err)
+			return
 		}
 	}
 
-	zones, err := dnf.route53Client.ListHostedZones(context.TODO(), &route53.ListHostedZonesInput{})
+	zones, err := dnf.route53Client.ListHostedZones(ctx, &route53.ListHostedZonesInput{})
 	if err != nil {
-		panic(err)
+		dnf.tools.Reporter.ReportAtf(dnf.loc, "could not list hosted zones: %v", err)
+		return
 	}
 	var hzid string
 	for _, z := range zones.HostedZones {
@@ -85,9 +92,10 @@ func (dnf *domainNameFinder) DetermineInitialState(pres corebottom.ValuePresente
 		}
 	}
 	if hzid == "" {
-		log.Fatalf("No hosted zone found for %s", dnf.name)
+		dnf.tools.Reporter.ReportAtf(dnf.loc, "no hosted zone found for %s", dnf.name)
+		return
 	}
-	model := CreateDomainModel(dnf.loc, detail, hzid)
+	model := CreateDomainModel(dnf.loc, detail, hzid, dnf.route53Client)
 	pres.Present(model)
 }
 
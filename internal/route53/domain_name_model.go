@@ -3,14 +3,16 @@ package route53
 import (
 	"fmt"
 
+	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53domains"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 )
 
 type domainModel struct {
-	loc  *errorsink.Location
-	hzid string
+	loc    *errorsink.Location
+	hzid   string
+	client *route53.Client
 }
 
 func (d *domainModel) Loc() *errorsink.Location {
@@ -32,8 +34,12 @@ func (d *domainModel) HostedZoneId() string {
 	return d.hzid
 }
 
-func CreateDomainModel(loc *errorsink.Location, details *route53domains.GetDomainDetailOutput, hzid string) *domainModel {
-	return &domainModel{loc: loc, hzid: hzid}
+func (d *domainModel) Route53Client() *route53.Client {
+	return d.client
+}
+
+func CreateDomainModel(loc *errorsink.Location, details *route53domains.GetDomainDetailOutput, hzid string, client *route53.Client) *domainModel {
+	return &domainModel{loc: loc, hzid: hzid, client: client}
 }
 
 func (dnf *domainModel) ObtainMethod(name string) driverbottom.Method {
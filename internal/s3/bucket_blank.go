@@ -6,14 +6,17 @@ import (
 	"ziniki.org/deployer/driver/pkg/errorsink"
 )
 
-type BucketBlank struct{}
+type BucketBlank struct {
+	// LambdaPermissions lets S3 invoke the functions that notifications are sent to
+	LambdaPermissions AddPermissions
+}
 
 func (b *BucketBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr, teardown corebottom.TearDown) corebottom.Ensurable {
-	return &bucketCreator{tools: tools, teardown: teardown, loc: loc, coin: id, name: named, props: props}
+	return &bucketCreator{tools: tools, teardown: teardown, loc: loc, coin: id, name: named, props: props, uploads: &bucketUploads{}, lambdaPermissions: b.LambdaPermissions}
 }
 
 func (b *BucketBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
-	return &bucketCreator{tools: tools, loc: loc, coin: id, name: named}
+	return &bucketCreator{tools: tools, loc: loc, coin: id, name: named, uploads: &bucketUploads{}}
 }
 
 func (b *BucketBlank) Loc() *errorsink.Location {
@@ -0,0 +1,349 @@
+package s3
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// BucketConfig is the configuration of a bucket beyond its name and region.
+//
+// In a desired config, the zero value of a field means that the script did not say
+// anything about it, and whatever the bucket has is left alone; an empty (but not nil)
+// Lifecycle, Tags, Website, CORS or Notifications means that there should not be any.
+type BucketConfig struct {
+	Versioning        *bool
+	Encryption        string // "SSE-S3" or "SSE-KMS"
+	KMSKey            string
+	BlockPublicAccess *bool
+	ObjectOwnership   string
+	Lifecycle         []LifecycleRule
+	Tags              map[string]string
+	Website           *Website
+	CORS              []CORSRule
+	Notifications     []Notification
+}
+
+// A LifecycleRule expires or moves the objects whose keys start with Prefix;
+// days that are zero are not part of the rule
+type LifecycleRule struct {
+	Id                   string
+	Prefix               string
+	ExpireDays           int32
+	NoncurrentExpireDays int32
+	Transitions          []Transition
+}
+
+// A Transition moves objects to a cheaper storage class once they are Days old
+type Transition struct {
+	Days         int32
+	StorageClass string
+}
+
+func (r LifecycleRule) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s[%s]", r.Id, r.Prefix)
+	for _, t := range r.Transitions {
+		fmt.Fprintf(&sb, " %s@%d", t.StorageClass, t.Days)
+	}
+	if r.ExpireDays != 0 {
+		fmt.Fprintf(&sb, " expire@%d", r.ExpireDays)
+	}
+	if r.NoncurrentExpireDays != 0 {
+		fmt.Fprintf(&sb, " noncurrent@%d", r.NoncurrentExpireDays)
+	}
+	return sb.String()
+}
+
+// ReadBucketConfig finds out how a bucket is configured now; things which have not
+// been configured come back empty
+func ReadBucketConfig(ctx context.Context, client *s3.Client, name string) (*BucketConfig, error) {
+	ret := &BucketConfig{}
+	bucket := aws.String(name)
+
+	vers, err := client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: bucket})
+	if err != nil {
+		return nil, err
+	}
+	ret.Versioning = aws.Bool(vers.Status == types.BucketVersioningStatusEnabled)
+
+	enc, err := client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: bucket})
+	if err != nil && !notConfigured(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return nil, err
+	} else if err == nil && enc.ServerSideEncryptionConfiguration != nil {
+		for _, r := range enc.ServerSideEncryptionConfiguration.Rules {
+			if d := r.ApplyServerSideEncryptionByDefault; d != nil {
+				switch d.SSEAlgorithm {
+				case types.ServerSideEncryptionAes256:
+					ret.Encryption = "SSE-S3"
+				case types.ServerSideEncryptionAwsKms:
+					ret.Encryption = "SSE-KMS"
+					ret.KMSKey = aws.ToString(d.KMSMasterKeyID)
+				}
+			}
+		}
+	}
+
+	pab, err := client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: bucket})
+	if err != nil && !notConfigured(err, "NoSuchPublicAccessBlockConfiguration") {
+		return nil, err
+	}
+	ret.BlockPublicAccess = aws.Bool(false)
+	if err == nil && pab.PublicAccessBlockConfiguration != nil {
+		c := pab.PublicAccessBlockConfiguration
+		ret.BlockPublicAccess = aws.Bool(aws.ToBool(c.BlockPublicAcls) && aws.ToBool(c.BlockPublicPolicy) && aws.ToBool(c.IgnorePublicAcls) && aws.ToBool(c.RestrictPublicBuckets))
+	}
+
+	own, err := client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: bucket})
+	if err != nil && !notConfigured(err, "OwnershipControlsNotFoundError") {
+		return nil, err
+	} else if err == nil && own.OwnershipControls != nil {
+		for _, r := range own.OwnershipControls.Rules {
+			ret.ObjectOwnership = string(r.ObjectOwnership)
+		}
+	}
+
+	lc, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: bucket})
+	if err != nil && !notConfigured(err, "NoSuchLifecycleConfiguration") {
+		return nil, err
+	}
+	ret.Lifecycle = []LifecycleRule{}
+	if err == nil {
+		for _, r := range lc.Rules {
+			ret.Lifecycle = append(ret.Lifecycle, lifecycleRuleFrom(r))
+		}
+	}
+
+	tags, err := client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket})
+	if err != nil && !notConfigured(err, "NoSuchTagSet") {
+		return nil, err
+	}
+	ret.Tags = map[string]string{}
+	if err == nil {
+		for _, t := range tags.TagSet {
+			ret.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+	}
+
+	if ret.Website, err = readWebsite(ctx, client, bucket); err != nil {
+		return nil, err
+	}
+	if ret.CORS, err = readCORS(ctx, client, bucket); err != nil {
+		return nil, err
+	}
+	if ret.Notifications, err = readNotifications(ctx, client, bucket); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Fields describes the parts of the configuration that the script asks for, compared
+// with what was found; if found is nil, the bucket is going to be created
+func (c *BucketConfig) Fields(found *BucketConfig) []plan.Field {
+	var ret []plan.Field
+	field := func(name string, desired, has string) {
+		if found == nil {
+			ret = append(ret, plan.Set(name, desired))
+		} else {
+			ret = append(ret, plan.Compare(name, has, desired))
+		}
+	}
+	if found == nil {
+		found = &BucketConfig{}
+	}
+	if c.Versioning != nil {
+		field("Versioning", versioningStatus(c.Versioning), versioningStatus(found.Versioning))
+	}
+	if c.Encryption != "" {
+		field("Encryption", c.describeEncryption(), found.describeEncryption())
+	}
+	if c.BlockPublicAccess != nil {
+		field("BlockPublicAccess", fmt.Sprint(*c.BlockPublicAccess), fmt.Sprint(aws.ToBool(found.BlockPublicAccess)))
+	}
+	if c.ObjectOwnership != "" {
+		field("ObjectOwnership", c.ObjectOwnership, found.ObjectOwnership)
+	}
+	if c.Lifecycle != nil {
+		field("Lifecycle", describeLifecycle(c.Lifecycle), describeLifecycle(found.Lifecycle))
+	}
+	if c.Tags != nil {
+		field("Tags", describeTags(c.Tags), describeTags(found.Tags))
+	}
+	if c.Website != nil {
+		field("Website", c.Website.String(), found.Website.String())
+	}
+	if c.CORS != nil {
+		field("CORS", describeCORS(c.CORS), describeCORS(found.CORS))
+	}
+	if c.Notifications != nil {
+		field("Notifications", describeNotifications(c.Notifications), describeNotifications(found.Notifications))
+	}
+	return ret
+}
+
+// ApplyBucketConfig changes each part of the configuration of a bucket that the
+// script asks for and which is not already as found
+func ApplyBucketConfig(ctx context.Context, client *s3.Client, name string, desired, found *BucketConfig) error {
+	bucket := aws.String(name)
+	if desired.Versioning != nil && versioningStatus(desired.Versioning) != versioningStatus(found.Versioning) {
+		_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{Bucket: bucket, VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatus(versioningStatus(desired.Versioning))}})
+		if err != nil {
+			return fmt.Errorf("setting versioning: %w", err)
+		}
+	}
+	if desired.Encryption != "" && desired.describeEncryption() != found.describeEncryption() {
+		def := &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAes256}
+		if desired.Encryption == "SSE-KMS" {
+			def = &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAwsKms, KMSMasterKeyID: aws.String(desired.KMSKey)}
+		}
+		rule := types.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: def, BucketKeyEnabled: aws.Bool(desired.Encryption == "SSE-KMS")}
+		_, err := client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{Bucket: bucket, ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{Rules: []types.ServerSideEncryptionRule{rule}}})
+		if err != nil {
+			return fmt.Errorf("setting encryption: %w", err)
+		}
+	}
+	if desired.BlockPublicAccess != nil && *desired.BlockPublicAccess != aws.ToBool(found.BlockPublicAccess) {
+		var err error
+		if *desired.BlockPublicAccess {
+			block := aws.Bool(true)
+			_, err = client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{Bucket: bucket, PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{BlockPublicAcls: block, BlockPublicPolicy: block, IgnorePublicAcls: block, RestrictPublicBuckets: block}})
+		} else {
+			_, err = client.DeletePublicAccessBlock(ctx, &s3.DeletePublicAccessBlockInput{Bucket: bucket})
+		}
+		if err != nil {
+			return fmt.Errorf("setting public access block: %w", err)
+		}
+	}
+	if desired.ObjectOwnership != "" && desired.ObjectOwnership != found.ObjectOwnership {
+		_, err := client.PutBucketOwnershipControls(ctx, &s3.PutBucketOwnershipControlsInput{Bucket: bucket, OwnershipControls: &types.OwnershipControls{Rules: []types.OwnershipControlsRule{{ObjectOwnership: types.ObjectOwnership(desired.ObjectOwnership)}}}})
+		if err != nil {
+			return fmt.Errorf("setting object ownership: %w", err)
+		}
+	}
+	if desired.Lifecycle != nil && describeLifecycle(desired.Lifecycle) != describeLifecycle(found.Lifecycle) {
+		var err error
+		if len(desired.Lifecycle) == 0 {
+			_, err = client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: bucket})
+		} else {
+			var rules []types.LifecycleRule
+			for _, r := range desired.Lifecycle {
+				rules = append(rules, r.awsRule())
+			}
+			_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{Bucket: bucket, LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules}})
+		}
+		if err != nil {
+			return fmt.Errorf("setting lifecycle rules: %w", err)
+		}
+	}
+	if desired.Tags != nil && describeTags(desired.Tags) != describeTags(found.Tags) {
+		var err error
+		if len(desired.Tags) == 0 {
+			_, err = client.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{Bucket: bucket})
+		} else {
+			var tags []types.Tag
+			for _, k := range slices.Sorted(maps.Keys(desired.Tags)) {
+				tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(desired.Tags[k])})
+			}
+			_, err = client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{Bucket: bucket, Tagging: &types.Tagging{TagSet: tags}})
+		}
+		if err != nil {
+			return fmt.Errorf("setting tags: %w", err)
+		}
+	}
+	if desired.Website != nil && desired.Website.String() != found.Website.String() {
+		if err := applyWebsite(ctx, client, bucket, desired.Website); err != nil {
+			return fmt.Errorf("setting website: %w", err)
+		}
+	}
+	if desired.CORS != nil && describeCORS(desired.CORS) != describeCORS(found.CORS) {
+		if err := applyCORS(ctx, client, bucket, desired.CORS); err != nil {
+			return fmt.Errorf("setting CORS rules: %w", err)
+		}
+	}
+	if desired.Notifications != nil && describeNotifications(desired.Notifications) != describeNotifications(found.Notifications) {
+		if err := applyNotifications(ctx, client, bucket, desired.Notifications); err != nil {
+			return fmt.Errorf("setting notifications: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r LifecycleRule) awsRule() types.LifecycleRule {
+	ret := types.LifecycleRule{ID: aws.String(r.Id), Status: types.ExpirationStatusEnabled, Filter: &types.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)}}
+	if r.ExpireDays != 0 {
+		ret.Expiration = &types.LifecycleExpiration{Days: aws.Int32(r.ExpireDays)}
+	}
+	if r.NoncurrentExpireDays != 0 {
+		ret.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(r.NoncurrentExpireDays)}
+	}
+	for _, t := range r.Transitions {
+		ret.Transitions = append(ret.Transitions, types.Transition{Days: aws.Int32(t.Days), StorageClass: types.TransitionStorageClass(t.StorageClass)})
+	}
+	return ret
+}
+
+func lifecycleRuleFrom(r types.LifecycleRule) LifecycleRule {
+	ret := LifecycleRule{Id: aws.ToString(r.ID), Prefix: aws.ToString(r.Prefix)}
+	if r.Filter != nil && r.Filter.Prefix != nil {
+		ret.Prefix = *r.Filter.Prefix
+	}
+	if r.Expiration != nil {
+		ret.ExpireDays = aws.ToInt32(r.Expiration.Days)
+	}
+	if r.NoncurrentVersionExpiration != nil {
+		ret.NoncurrentExpireDays = aws.ToInt32(r.NoncurrentVersionExpiration.NoncurrentDays)
+	}
+	for _, t := range r.Transitions {
+		ret.Transitions = append(ret.Transitions, Transition{Days: aws.ToInt32(t.Days), StorageClass: string(t.StorageClass)})
+	}
+	return ret
+}
+
+// versioningStatus is what S3 calls the state of versioning; a bucket which has never had it is "Suspended" as far as we are concerned
+func versioningStatus(v *bool) string {
+	if aws.ToBool(v) {
+		return string(types.BucketVersioningStatusEnabled)
+	}
+	return string(types.BucketVersioningStatusSuspended)
+}
+
+func (c *BucketConfig) describeEncryption() string {
+	if c.Encryption == "SSE-KMS" {
+		return c.Encryption + ":" + c.KMSKey
+	}
+	return c.Encryption
+}
+
+// the order of the rules does not matter to S3, so it does not matter to us either
+func describeLifecycle(rules []LifecycleRule) string {
+	var ret []string
+	for _, r := range rules {
+		ret = append(ret, r.String())
+	}
+	slices.Sort(ret)
+	return strings.Join(ret, ", ")
+}
+
+func describeTags(tags map[string]string) string {
+	var ret []string
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		ret = append(ret, k+"="+tags[k])
+	}
+	return strings.Join(ret, ", ")
+}
+
+// notConfigured says whether err is S3 telling us that a bucket does not have something configured
+func notConfigured(err error, code string) bool {
+	var api smithy.APIError
+	return e.As(err, &api) && api.ErrorCode() == code
+}
@@ -0,0 +1,183 @@
+package s3_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestBucketIsConfiguredToMatchTheScript(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	if _, err := mys3.CreateBucket(ctx, client, "logs"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	initial, err := mys3.ReadBucketConfig(ctx, client, "logs")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if initial.Encryption != "SSE-S3" || !*initial.BlockPublicAccess || *initial.Versioning {
+		t.Fatalf("new bucket was configured as %+v", initial)
+	}
+
+	desired := &mys3.BucketConfig{
+		Versioning: aws.Bool(true),
+		Encryption: "SSE-KMS",
+		KMSKey:     "alias/logs",
+		Lifecycle: []mys3.LifecycleRule{
+			{Id: "archive", Prefix: "old/", ExpireDays: 365, NoncurrentExpireDays: 30, Transitions: []mys3.Transition{{Days: 30, StorageClass: "STANDARD_IA"}}},
+		},
+		Tags: map[string]string{"Team": "platform"},
+	}
+	if err := mys3.ApplyBucketConfig(ctx, client, "logs", desired, initial); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	found, err := mys3.ReadBucketConfig(ctx, client, "logs")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	p := plan.New(nil)
+	p.Update("aws.S3.Bucket", "logs", desired.Fields(found)...)
+	if c := p.Changes()[0]; c.Action != plan.NoChange {
+		t.Fatalf("bucket still needed changing: %s", c)
+	}
+	if !*found.BlockPublicAccess {
+		t.Fatalf("public access block was changed even though it was not asked for")
+	}
+}
+
+func TestEmptyTagsRemoveAllTheTags(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucket(ctx, client, "tagged")
+	none, _ := mys3.ReadBucketConfig(ctx, client, "tagged")
+	mys3.ApplyBucketConfig(ctx, client, "tagged", &mys3.BucketConfig{Tags: map[string]string{"a": "b"}}, none)
+	tagged, _ := mys3.ReadBucketConfig(ctx, client, "tagged")
+	if err := mys3.ApplyBucketConfig(ctx, client, "tagged", &mys3.BucketConfig{Tags: map[string]string{}}, tagged); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	found, err := mys3.ReadBucketConfig(ctx, client, "tagged")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if len(found.Tags) != 0 {
+		t.Fatalf("bucket still had tags %v", found.Tags)
+	}
+}
+
+func TestBucketCanBeAWebsite(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucketIn(ctx, client, "www.example.com", "eu-west-2")
+	regional := mys3.RegionalClient(client, "eu-west-2")
+	initial, err := mys3.ReadBucketConfig(ctx, regional, "www.example.com")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	desired := &mys3.BucketConfig{
+		Website: &mys3.Website{Index: "index.html", Error: "404.html", Rules: []mys3.RedirectRule{{WhenPrefix: "docs/", ReplacePrefix: "documents/", Code: "301"}}},
+		CORS:    []mys3.CORSRule{{Id: "fonts", Origins: []string{"https://example.com"}, Methods: []string{"GET"}, MaxAge: 3000}},
+	}
+	if err := mys3.ApplyBucketConfig(ctx, regional, "www.example.com", desired, initial); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	found, err := mys3.ReadBucketConfig(ctx, regional, "www.example.com")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	p := plan.New(nil)
+	p.Update("aws.S3.Bucket", "www.example.com", desired.Fields(found)...)
+	if c := p.Changes()[0]; c.Action != plan.NoChange {
+		t.Fatalf("bucket still needed changing: %s", c)
+	}
+
+	if ep := mys3.WebsiteEndpoint("www.example.com", "eu-west-2"); ep != "www.example.com.s3-website.eu-west-2.amazonaws.com" {
+		t.Fatalf("endpoint was %s", ep)
+	}
+	if ep := mys3.WebsiteEndpoint("www.example.com", "us-east-1"); ep != "www.example.com.s3-website-us-east-1.amazonaws.com" {
+		t.Fatalf("endpoint was %s", ep)
+	}
+}
+
+func TestWebsiteCannotMixRedirectAllWithDocuments(t *testing.T) {
+	w := &mys3.Website{Index: "index.html", RedirectAllTo: "example.com"}
+	if err := w.Validate(); err == nil {
+		t.Fatalf("website was valid")
+	}
+}
+
+func TestNotificationsNeedPermissionToInvokeTheFunction(t *testing.T) {
+	fake, client := fakeClient()
+	ctx := context.Background()
+	fns := lambda.NewFromConfig(fake.Config())
+	iam.NewFromConfig(fake.Config()).CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("runner"), AssumeRolePolicyDocument: aws.String("{}")})
+	fn, err := fns.CreateFunction(ctx, &lambda.CreateFunctionInput{FunctionName: aws.String("thumbnailer"), Role: aws.String("arn:aws:iam::123456789012:role/runner"), Code: &lambdatypes.FunctionCode{S3Bucket: aws.String("b"), S3Key: aws.String("k")}})
+	if err != nil {
+		t.Fatalf("create function failed: %v", err)
+	}
+
+	mys3.CreateBucket(ctx, client, "uploads")
+	initial, _ := mys3.ReadBucketConfig(ctx, client, "uploads")
+	desired := &mys3.BucketConfig{Notifications: []mys3.Notification{
+		{Id: "thumbnails", Events: []string{"s3:ObjectCreated:*"}, Prefix: "images/", Suffix: ".jpg", Lambda: *fn.FunctionArn},
+	}}
+	if err := mys3.ApplyBucketConfig(ctx, client, "uploads", desired, initial); err == nil {
+		t.Fatalf("notification was set up without permission to invoke the function")
+	}
+
+	fns.AddPermission(ctx, &lambda.AddPermissionInput{FunctionName: fn.FunctionArn, StatementId: aws.String("s3"), Action: aws.String("lambda:InvokeFunction"), Principal: aws.String("s3.amazonaws.com"), SourceArn: aws.String("arn:aws:s3:::uploads")})
+	if err := mys3.ApplyBucketConfig(ctx, client, "uploads", desired, initial); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	found, err := mys3.ReadBucketConfig(ctx, client, "uploads")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	p := plan.New(nil)
+	p.Update("aws.S3.Bucket", "uploads", desired.Fields(found)...)
+	if c := p.Changes()[0]; c.Action != plan.NoChange {
+		t.Fatalf("bucket still needed changing: %s", c)
+	}
+}
+
+func TestFlagsMustBeBooleans(t *testing.T) {
+	for _, prop := range []string{"BlockPublicAccess", "Versioning", "DeleteStaleObjects"} {
+		for _, v := range []any{2, "yes", "1"} {
+			h := awstest.New(t)
+			errs := h.Attempt(&mys3.BucketBlank{}, h.Coin("bucket"), "site", h.Props(map[string]any{prop: v}))
+			if len(errs) != 1 || !strings.Contains(errs[0], prop+" must be 0 or 1") {
+				t.Fatalf("%s %v gave errors %v", prop, v, errs)
+			}
+			if calls := h.Calls(); slices.Contains(calls, "S3.CreateBucket") || slices.Contains(calls, "S3.DeletePublicAccessBlock") {
+				t.Fatalf("%s %v still changed the bucket: %v", prop, v, calls)
+			}
+		}
+	}
+	h := awstest.New(t)
+	h.Ensure(&mys3.BucketBlank{}, h.Coin("bucket"), "site", h.Props(map[string]any{"BlockPublicAccess": "true", "Versioning": "false", "DeleteStaleObjects": 1}))
+}
+
+func TestAnUnknownWebsiteZoneIsReported(t *testing.T) {
+	h := awstest.New(t)
+	bucket := h.Coin("bucket")
+	h.Ensure(&mys3.BucketBlank{}, bucket, "www.example.com", h.Props(map[string]any{"Region": "xx-new-1"}))
+	if id := h.Tools().Storage.Eval(h.Get(bucket, "websiteZoneId")); id != "" {
+		t.Fatalf("zone id was %v", id)
+	}
+	if errs := h.Reported(); len(errs) != 1 || !strings.Contains(errs[0], "no known website hosted zone for xx-new-1") {
+		t.Fatalf("errors were %v", errs)
+	}
+}
@@ -5,15 +5,24 @@ import (
 	e "errors"
 	"fmt"
 	"log"
+	"net/http"
+	"slices"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/aws/smithy-go"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
 	"ziniki.org/deployer/driver/pkg/utils"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 )
 
 type bucketCreator struct {
@@ -24,8 +33,17 @@ type bucketCreator struct {
 	teardown corebottom.TearDown
 	name     string // name is here (as well as?) the model because it's core to who we are
 	props    map[driverbottom.Identifier]driverbottom.Expr
+	uploads  *bucketUploads
 
-	client *s3.Client
+	// the notifications can only be worked out once the functions they go to have been created
+	notifications     []*NotificationExpr
+	lambdaPermissions AddPermissions
+
+	client  *s3.Client
+	sts     *sts.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
 	// alreadyExists bool
 	// model         *bucketModel
 	// cloud *BucketCloud
@@ -57,16 +75,27 @@ func (b *bucketCreator) CoinId() corebottom.CoinId {
 }
 
 func (b *bucketCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := b.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(b.tools, b.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	b.client = awsEnv.S3Client()
-	_, err := b.client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
+	b.sts = awsEnv.STSClient()
+	b.ctx = awsEnv.Context()
+	b.timeout = env.ObtainTimeout(b.tools, b.props)
+	b.plan = awsEnv.Plan()
+	client := b.client
+	_, err := client.HeadBucket(b.ctx, &s3.HeadBucketInput{
 		Bucket: aws.String(b.name),
 	})
+	var moved *awshttp.ResponseError
+	if e.As(err, &moved) && moved.HTTPStatusCode() == http.StatusMovedPermanently {
+		// it is in another region, which S3 tells us about; everything else has to be done there
+		client = RegionalClient(client, moved.Response.Header.Get("X-Amz-Bucket-Region"))
+		_, err = client.HeadBucket(b.ctx, &s3.HeadBucketInput{Bucket: aws.String(b.name)})
+	}
 	if err != nil {
 		var api smithy.APIError
 		if e.As(err, &api) {
@@ -75,70 +104,402 @@ func (b *bucketCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
 				log.Printf("bucket does not exist: %s", b.name)
 				pres.NotFound()
 			} else {
-				log.Fatal(err)
+				b.tools.Reporter.ReportAtf(b.loc, "could not find bucket %s: %v", b.name, err)
 			}
 		} else {
-			log.Fatal(err)
+			b.tools.Reporter.ReportAtf(b.loc, "could not find bucket %s: %v", b.name, err)
 		}
 	} else {
-		log.Printf("bucket exists: %s", b.name)
-		model := &bucketModel{loc: b.loc, storage: b.tools.Storage, id: b.coin, client: b.client, name: b.name}
+		region, err := BucketRegion(b.ctx, client, b.name)
+		if err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "could not find region of bucket %s: %v", b.name, err)
+			return
+		}
+		log.Printf("bucket exists: %s in %s", b.name, region)
+		model := &bucketModel{loc: b.loc, tools: b.tools, storage: b.tools.Storage, id: b.coin, ctx: b.ctx, client: RegionalClient(client, region), plan: b.plan, name: b.name, uploads: b.uploads}
+		model.region, _ = utils.AsStringer(region)
+		model.config, err = ReadBucketConfig(b.ctx, model.client, b.name)
+		if err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "could not read configuration of bucket %s: %v", b.name, err)
+			return
+		}
 		pres.Present(model)
 	}
 }
 
 func (b *bucketCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
+	// buckets are created in the region of the client, so that is where they are unless we are told otherwise
 	region, _ := utils.AsStringer("us-east-1")
-	model := &bucketModel{loc: b.loc, storage: b.tools.Storage, id: b.coin, client: b.client, name: b.name}
+	if b.client != nil {
+		region, _ = utils.AsStringer(b.client.Options().Region)
+	}
+	model := &bucketModel{loc: b.loc, tools: b.tools, storage: b.tools.Storage, id: b.coin, ctx: b.ctx, client: b.client, plan: b.plan, name: b.name, uploads: b.uploads}
+	config := &BucketConfig{}
 	// TODO: should this be an earlier phase?
 	for i, e := range b.props {
 		v := b.tools.Storage.Eval(e)
 		switch i.Id() {
+		case "Env", "DeployTimeout":
 		case "Region":
 			var ok bool
-			region, ok = v.(fmt.Stringer)
+			region, ok = utils.AsStringer(v)
 			if !ok {
 				b.tools.Reporter.ReportAtf(e.Loc(), "must be a string value")
 				return
 			}
+		case "Versioning":
+			on, ok := asBool(v)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Versioning must be 0 or 1, or false or true")
+				return
+			}
+			config.Versioning = aws.Bool(on)
+		case "Encryption":
+			enc, ok := v.(fmt.Stringer)
+			if !ok || (enc.String() != "SSE-S3" && enc.String() != "SSE-KMS") {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Encryption must be SSE-S3 or SSE-KMS")
+				return
+			}
+			config.Encryption = enc.String()
+		case "KMSKey":
+			key, ok := b.tools.Storage.EvalAsStringer(e)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "must be a string value")
+				return
+			}
+			config.KMSKey = key.String()
+		case "BlockPublicAccess":
+			on, ok := asBool(v)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "BlockPublicAccess must be 0 or 1, or false or true")
+				return
+			}
+			config.BlockPublicAccess = aws.Bool(on)
+		case "ObjectOwnership":
+			own, ok := v.(fmt.Stringer)
+			if !ok || !slices.Contains(types.ObjectOwnership("").Values(), types.ObjectOwnership(own.String())) {
+				b.tools.Reporter.ReportAtf(e.Loc(), "ObjectOwnership must be one of %v", types.ObjectOwnership("").Values())
+				return
+			}
+			config.ObjectOwnership = own.String()
+		case "Lifecycle":
+			list, ok := v.([]any)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Lifecycle was not a list")
+				return
+			}
+			config.Lifecycle = []LifecycleRule{}
+			for _, le := range list {
+				lre, ok := le.(*LifecycleRuleExpr)
+				if !ok {
+					b.tools.Reporter.ReportAtf(e.Loc(), "lifecycle rule was not a *LifecycleRuleExpr but %T", le)
+					return
+				}
+				rule, err := lre.Rule(b.tools.Storage)
+				if err != nil {
+					b.tools.Reporter.ReportAtf(lre.Loc(), "%v", err)
+					return
+				}
+				config.Lifecycle = append(config.Lifecycle, rule)
+			}
+		case "Tags":
+			tags, ok := v.(map[string]string)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Tags must be defined with aws.Tags")
+				return
+			}
+			config.Tags = tags
+		case "DeleteStaleObjects":
+			on, ok := asBool(v)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "DeleteStaleObjects must be 0 or 1, or false or true")
+				return
+			}
+			b.uploads.opts.Delete = on
+		case "UploadConcurrency":
+			b.uploads.opts.Concurrency = int(b.tools.Storage.EvalAsNumber(e).F64())
+		case "UploadPartSizeMB":
+			size := int64(b.tools.Storage.EvalAsNumber(e).F64() * 1024 * 1024)
+			if size < MinPartSize {
+				b.tools.Reporter.ReportAtf(e.Loc(), "UploadPartSizeMB must be at least %d", MinPartSize/1024/1024)
+				return
+			}
+			b.uploads.opts.PartSize = size
+		case "UploadPartConcurrency":
+			b.uploads.opts.PartConcurrency = int(b.tools.Storage.EvalAsNumber(e).F64())
+		case "Uploads":
+			list, ok := v.([]any)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Uploads was not a list")
+				return
+			}
+			b.uploads.opts.Rules = nil
+			for _, le := range list {
+				ure, ok := le.(*UploadRuleExpr)
+				if !ok {
+					b.tools.Reporter.ReportAtf(e.Loc(), "upload rule was not a *UploadRuleExpr but %T", le)
+					return
+				}
+				rule, err := ure.Rule(b.tools.Storage)
+				if err != nil {
+					b.tools.Reporter.ReportAtf(ure.Loc(), "%v", err)
+					return
+				}
+				b.uploads.opts.Rules = append(b.uploads.opts.Rules, rule)
+			}
+		case "Notifications":
+			list, ok := v.([]any)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Notifications was not a list")
+				return
+			}
+			b.notifications = []*NotificationExpr{}
+			for _, le := range list {
+				ne, ok := le.(*NotificationExpr)
+				if !ok {
+					b.tools.Reporter.ReportAtf(e.Loc(), "notification was not a *NotificationExpr but %T", le)
+					return
+				}
+				b.notifications = append(b.notifications, ne)
+			}
+		case "Website":
+			we, ok := v.(*WebsiteExpr)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "Website must be defined with aws.S3.Website")
+				return
+			}
+			website, err := we.Website(b.tools.Storage)
+			if err != nil {
+				b.tools.Reporter.ReportAtf(e.Loc(), "%v", err)
+				return
+			}
+			config.Website = website
+		case "CORS":
+			list, ok := v.([]any)
+			if !ok {
+				b.tools.Reporter.ReportAtf(e.Loc(), "CORS was not a list")
+				return
+			}
+			config.CORS = []CORSRule{}
+			for _, le := range list {
+				cre, ok := le.(*CORSRuleExpr)
+				if !ok {
+					b.tools.Reporter.ReportAtf(e.Loc(), "CORS rule was not a *CORSRuleExpr but %T", le)
+					return
+				}
+				rule, err := cre.Rule(b.tools.Storage)
+				if err != nil {
+					b.tools.Reporter.ReportAtf(cre.Loc(), "%v", err)
+					return
+				}
+				config.CORS = append(config.CORS, rule)
+			}
+		default:
+			b.tools.Reporter.ReportAtf(i.Loc(), "invalid property for Bucket: %s", i.Id())
+			return
 		}
 	}
+	if config.Encryption == "SSE-KMS" && config.KMSKey == "" {
+		b.tools.Reporter.ReportAtf(b.loc, "SSE-KMS encryption needs a KMSKey")
+		return
+	}
+	if config.KMSKey != "" && config.Encryption != "SSE-KMS" {
+		b.tools.Reporter.ReportAtf(b.loc, "KMSKey can only be used with SSE-KMS encryption")
+		return
+	}
 	model.region = region
+	model.config = config
+	if b.client != nil {
+		model.client = RegionalClient(b.client, region.String())
+	}
 
 	pres.Present(model)
 }
 
 func (b *bucketCreator) UpdateReality() {
+	ctx, cancel := env.WithTimeout(b.ctx, b.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.S3.Bucket", b.name, b.coin)
+
 	tmp := b.tools.Storage.GetCoin(b.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp != nil {
 		found := tmp.(*bucketModel)
 		log.Printf("bucket %s already existed\n", found.name)
+		b.checkBucket(ctx, found)
+		return
+	}
+
+	desired := b.tools.Storage.GetCoin(b.coin, corebottom.DETERMINE_DESIRED_MODE).(*bucketModel)
+	if !b.resolveNotifications(desired.config) || !b.allowNotifications(desired.config) {
+		return
+	}
+	if b.plan != nil {
+		b.plan.Create("aws.S3.Bucket", b.name, append([]plan.Field{plan.Set("Region", desired.region)}, desired.config.Fields(nil)...)...)
 		return
 	}
 
-	bucket := CreateBucket(b.client, b.name)
-	if bucket != nil {
-		log.Printf("created bucket %s\n", *bucket.Location)
+	bucket, err := CreateBucketIn(ctx, b.client, b.name, desired.region.String())
+	if err != nil {
+		b.tools.Reporter.ReportAtf(b.loc, "error creating bucket %s: %v", b.name, err)
+		return
+	}
+	log.Printf("created bucket %s in %s\n", *bucket.Location, desired.region)
+
+	// new buckets come with some configuration of their own, which we need to compare with
+	initial, err := ReadBucketConfig(ctx, desired.client, b.name)
+	if err != nil {
+		b.tools.Reporter.ReportAtf(b.loc, "could not read configuration of bucket %s: %v", b.name, err)
+		return
+	}
+	if err := ApplyBucketConfig(ctx, desired.client, b.name, desired.config, initial); err != nil {
+		b.tools.Reporter.ReportAtf(b.loc, "error configuring bucket %s: %v", b.name, err)
 	}
 }
 
+// checkBucket compares an existing bucket with the script; the region cannot be
+// changed, because buckets cannot be moved, but the rest of the configuration can
+func (b *bucketCreator) checkBucket(ctx context.Context, found *bucketModel) {
+	desired := b.tools.Storage.GetCoin(b.coin, corebottom.DETERMINE_DESIRED_MODE).(*bucketModel)
+	if !b.resolveNotifications(desired.config) {
+		return
+	}
+	if found.region != nil && found.region.String() != desired.region.String() {
+		if b.plan != nil {
+			b.plan.Replace("aws.S3.Bucket", b.name, plan.Compare("Region", found.region, desired.region))
+			return
+		}
+		b.tools.Reporter.ReportAtf(b.loc, "bucket %s is in %s, not %s; it must be deleted and created again to move it", b.name, found.region, desired.region)
+		return
+	}
+	if desired.config.Notifications != nil && describeNotifications(desired.config.Notifications) != describeNotifications(found.config.Notifications) {
+		if !b.allowNotifications(desired.config) {
+			return
+		}
+	}
+	if b.plan != nil {
+		b.plan.Update("aws.S3.Bucket", b.name, desired.config.Fields(found.config)...)
+		return
+	}
+	if err := ApplyBucketConfig(ctx, found.client, b.name, desired.config, found.config); err != nil {
+		b.tools.Reporter.ReportAtf(b.loc, "error configuring bucket %s: %v", b.name, err)
+	}
+}
+
+// resolveNotifications works out where the notifications go, now that the functions
+// they go to have been created
+func (b *bucketCreator) resolveNotifications(config *BucketConfig) bool {
+	if b.notifications == nil {
+		return true
+	}
+	config.Notifications = []Notification{}
+	for _, ne := range b.notifications {
+		n, err := ne.Notification(b.tools.Storage)
+		if err == nil && n.Lambda == "" && n.Queue == "" && n.Topic == "" && b.plan != nil {
+			// when planning, there is no function yet if it would have been created
+			n.Lambda = "(arn of the new function)"
+		}
+		if err == nil {
+			err = n.Validate()
+		}
+		if err != nil {
+			b.tools.Reporter.ReportAtf(ne.Loc(), "%v", err)
+			return false
+		}
+		config.Notifications = append(config.Notifications, n)
+	}
+	return true
+}
+
+// allowNotifications lets S3 invoke the functions that notifications go to, which has
+// to be done before the notifications are set up, because S3 checks it can
+func (b *bucketCreator) allowNotifications(config *BucketConfig) bool {
+	account := ""
+	for _, n := range config.Notifications {
+		if n.Lambda == "" {
+			continue
+		}
+		if b.lambdaPermissions == nil {
+			b.tools.Reporter.ReportAtf(b.loc, "cannot give bucket %s permission to invoke %s", b.name, n.Lambda)
+			return false
+		}
+		if account == "" {
+			// the bucket is ours, so it is owned by the account we are deploying as
+			id, err := b.sts.GetCallerIdentity(b.ctx, &sts.GetCallerIdentityInput{})
+			if err != nil {
+				b.tools.Reporter.ReportAtf(b.loc, "cannot find the account which owns bucket %s: %v", b.name, err)
+				return false
+			}
+			account = aws.ToString(id.Account)
+		}
+		name := drivertop.MakeString(b.loc, permissionName(b.name, n.Id))
+		perms := b.lambdaPermissions(b.tools, b.loc, name, utils.FindProp(b.props, nil, "Env"), []corebottom.PolicyRuleAction{&invokeFromBucket{function: n.Lambda, bucket: b.name, account: account}})
+		perms.DetermineInitialState(coretop.NewDummyPresenter())
+		perms.UpdateReality()
+	}
+	return true
+}
+
+// booleans in scripts are the numbers 0 and 1, or the strings "false" and "true";
+// anything else is not a boolean, rather than being false
+func asBool(v any) (bool, bool) {
+	if f, ok := v.(float64); ok {
+		return f == 1, f == 0 || f == 1
+	}
+	if s, ok := utils.AsStringer(v); ok {
+		switch s.String() {
+		case "false":
+			return false, true
+		case "true":
+			return true, true
+		}
+	}
+	return false, false
+}
+
 func (b *bucketCreator) TearDown() {
+	ctx, cancel := env.WithTimeout(b.ctx, b.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.S3.Bucket", b.name, b.coin)
+
 	tmp := b.tools.Storage.GetCoin(b.coin, corebottom.DETERMINE_INITIAL_MODE)
 
 	if tmp == nil {
 		log.Printf("bucket %s does not exist\n", b.name)
 		return
 	}
+	found := tmp.(*bucketModel)
 	log.Printf("you have asked to tear down bucket %s %s\n", b.name, b.teardown.Mode())
 	switch b.teardown.Mode() {
 	case "preserve":
 		log.Printf("not deleting bucket %s because teardown mode is 'preserve'", b.name)
-		// case "empty" seems like it might be a reasonable option
+	case "empty":
+		if b.plan != nil {
+			n, err := CountVersions(ctx, found.client, b.name)
+			if err != nil {
+				b.tools.Reporter.ReportAtf(b.loc, "error listing bucket %s: %v", b.name, err)
+				return
+			}
+			b.plan.Update("aws.S3.Bucket", b.name, plan.Compare("Objects", n, 0))
+			return
+		}
+		log.Printf("emptying bucket %s with teardown mode 'empty'", b.name)
+		if err := EmptyBucket(ctx, found.client, b.name); err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "error emptying bucket %s: %v", b.name, err)
+		}
 	case "delete":
+		if b.plan != nil {
+			b.plan.Delete("aws.S3.Bucket", b.name)
+			return
+		}
 		log.Printf("deleting bucket %s with teardown mode 'delete'", b.name)
-		EmptyBucket(b.client, b.name)
-		DeleteBucket(b.client, b.name)
+		if err := EmptyBucket(ctx, found.client, b.name); err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "error emptying bucket %s: %v", b.name, err)
+			return
+		}
+		if err := DeleteBucket(ctx, found.client, b.name); err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "error deleting bucket %s: %v", b.name, err)
+		}
 	default:
 		log.Printf("cannot handle teardown mode '%s' for bucket %s", b.teardown.Mode(), b.name)
 	}
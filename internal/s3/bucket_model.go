@@ -4,38 +4,129 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	"ziniki.org/deployer/modules/aws/internal/policyjson"
 )
 
 type bucketModel struct {
 	loc     *errorsink.Location
+	tools   *corebottom.Tools
 	storage driverbottom.RuntimeStorage
 	id      corebottom.CoinId
 	// May I say how much I hate that this is here, but we need it for Attach ...
+	ctx    context.Context
 	client *s3.Client
+	plan   *plan.Plan
 
 	name   string
 	region fmt.Stringer
+	config *BucketConfig
 
 	policy string
+
+	// shared by all the models of the same bucket, so that the files copied into it can be tracked
+	uploads *bucketUploads
+}
+
+// bucketUploads are how files are copied into a bucket, and what has been copied into it
+// so far in this run.  Each copy into the bucket is synced on its own (see bucketTransfer),
+// but the objects that any of them copied must not be deleted as stale by the others.
+type bucketUploads struct {
+	opts SyncOptions
+	// keys of objects the script creates itself (with aws.S3.Object) or which have already
+	// been copied into the bucket, which must not be deleted as stale
+	kept []string
+	// keys of the objects which the copies have changed
+	changed []string
+}
+
+// keep stops the object key from being deleted as stale
+func (u *bucketUploads) keep(key string) {
+	if !slices.Contains(u.kept, key) {
+		u.kept = append(u.kept, key)
+	}
+}
+
+// finish waits for the files copied by s to be uploaded and deletes what is stale (if asked to)
+func (u *bucketUploads) finish(s *Sync) error {
+	for _, k := range u.kept {
+		s.Keep(k)
+	}
+	changed, err := s.Finish()
+	u.changed = append(u.changed, changed...)
+	for _, k := range s.Seen() {
+		u.keep(k)
+	}
+	return err
+}
+
+// BucketName finds the name of the bucket v refers to, which may be a bucket coin or just its name
+func BucketName(v any) (string, bool) {
+	switch b := v.(type) {
+	case *bucketModel:
+		return b.name, true
+	case fmt.Stringer:
+		return b.String(), true
+	case string:
+		return b, true
+	}
+	return "", false
+}
+
+// OwnedPolicyAttacher is a PolicyAttacher which can remember who attached each statement,
+// so that when one of them changes what it attaches, its old statements can be removed
+type OwnedPolicyAttacher interface {
+	AttachAs(owner string, doc corebottom.PolicyDocument)
 }
 
+// Attach adds the statements in doc to the bucket's policy as if the bucket owned them
 func (b *bucketModel) Attach(doc corebottom.PolicyDocument) {
-	// TODO: I assume we either have to merge or do duplicate detection
-	policyJson, err := policyjson.BuildFrom(b.name, doc, policyjson.StandardRules())
+	b.AttachAs(b.name, doc)
+}
+
+// AttachAs adds the statements in doc to the bucket's policy; several things (e.g. two
+// distributions) can attach to the same bucket, so it is merged with what is there, and
+// only the statements that owner attached before are replaced
+func (b *bucketModel) AttachAs(owner string, doc corebottom.PolicyDocument) {
+	policyJson, err := policyjson.BuildFrom(owner, doc, policyjson.BucketRules())
 	if err != nil {
-		log.Fatalf("could not build policy: %v", err)
+		b.tools.Reporter.ReportAtf(b.loc, "could not build policy for bucket %s: %v", b.name, err)
+		return
 	}
-	newbm := &bucketModel{loc: b.loc, storage: b.storage, id: b.id, name: b.name, client: b.client, policy: policyJson}
+	existing := b.policy
+	if existing == "" {
+		existing, err = BucketPolicy(b.ctx, b.client, b.name)
+		if err != nil {
+			b.tools.Reporter.ReportAtf(b.loc, "could not read policy of bucket %s: %v", b.name, err)
+			return
+		}
+	}
+	merged, changed, err := policyjson.Merge(existing, policyJson, policyjson.SidPrefix(owner))
+	if err != nil {
+		b.tools.Reporter.ReportAtf(b.loc, "could not merge policy for bucket %s: %v", b.name, err)
+		return
+	}
+	newbm := &bucketModel{loc: b.loc, tools: b.tools, storage: b.storage, id: b.id, name: b.name, region: b.region, config: b.config, ctx: b.ctx, client: b.client, plan: b.plan, policy: merged, uploads: b.uploads}
 	b.storage.Bind(b.id, newbm)
-	_, err = b.client.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{Bucket: &b.name, Policy: &policyJson})
+	if b.plan != nil {
+		b.plan.Update("aws.S3.Bucket", b.name, plan.Compare("Policy", existing, merged))
+		return
+	}
+	if !changed {
+		log.Printf("policy of bucket %s already has all its statements\n", b.name)
+		return
+	}
+	_, err = b.client.PutBucketPolicy(env.About(b.ctx, "aws.S3.Bucket", b.name, b.id), &s3.PutBucketPolicyInput{Bucket: &b.name, Policy: &merged})
 	if err != nil {
-		log.Fatalf("Failed to attach policy to bucket %s: %v", b.name, err)
+		b.tools.Reporter.ReportAtf(b.loc, "failed to attach policy to bucket %s: %v", b.name, err)
+		return
 	}
 	log.Printf("attached policy to bucket %s\n", b.name)
 }
@@ -46,12 +137,20 @@ func (b *bucketModel) ObtainMethod(name string) driverbottom.Method {
 		return &allResourcesMethod{}
 	case "dnsName":
 		return &dnsNameMethod{}
+	case "websiteEndpoint":
+		return &websiteEndpointMethod{}
+	case "websiteZoneId":
+		return &websiteZoneIdMethod{}
+	case "changedPaths":
+		return &changedPathsMethod{}
 	}
 	return nil
 }
 
 func (b *bucketModel) ObtainDest() corebottom.FileDest {
-	return NewBucketTransfer(b.client, b.name)
+	sync := NewSync(b.ctx, b.client, b.name, "", b.uploads.opts)
+	sync.plan = b.plan
+	return &bucketTransfer{bucket: b, sync: sync}
 }
 
 type allResourcesMethod struct {
@@ -85,8 +184,71 @@ func (a *dnsNameMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Ex
 	return fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket.name, bucket.region)
 }
 
+// return something like "news.consolidator.info.s3-website-us-east-1.amazonaws.com"
+type websiteEndpointMethod struct {
+}
+
+func (a *websiteEndpointMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	bucket, ok := e.(*bucketModel)
+	if !ok {
+		panic(fmt.Sprintf("websiteEndpoint can only be called on a bucket, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	return WebsiteEndpoint(bucket.name, bucket.region.String())
+}
+
+// the hosted zone of the website endpoint, to use as the AliasZone of an ALIAS record
+type websiteZoneIdMethod struct {
+}
+
+func (a *websiteZoneIdMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	bucket, ok := e.(*bucketModel)
+	if !ok {
+		panic(fmt.Sprintf("websiteZoneId can only be called on a bucket, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	id, ok := WebsiteZoneId(bucket.region.String())
+	if !ok {
+		// the region may just be newer than the table, so the zone can be given to the ALIAS directly
+		bucket.tools.Reporter.ReportAtf(on.Loc(), "there is no known website hosted zone for %s; give the AliasZone id directly", bucket.region)
+		return ""
+	}
+	return id
+}
+
+// the paths of the objects which have been changed by the copies into the bucket so far,
+// e.g. "/index.html", to use as the Paths of a cloudfront.invalidate
+type changedPathsMethod struct {
+}
+
+func (a *changedPathsMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	e := on.Eval(s)
+	bucket, ok := e.(*bucketModel)
+	if !ok {
+		panic(fmt.Sprintf("changedPaths can only be called on a bucket, not a %T", e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	changed := bucket.uploads.changed
+	ret := make([]string, len(changed))
+	for i, k := range changed {
+		ret[i] = "/" + k
+	}
+	return ret
+}
+
 var _ driverbottom.HasMethods = &bucketModel{}
 var _ driverbottom.Method = &allResourcesMethod{}
 var _ driverbottom.Method = &dnsNameMethod{}
+var _ driverbottom.Method = &websiteEndpointMethod{}
+var _ driverbottom.Method = &websiteZoneIdMethod{}
+var _ driverbottom.Method = &changedPathsMethod{}
 var _ corebottom.PolicyAttacher = &bucketModel{}
 var _ corebottom.DestHolder = &bucketModel{}
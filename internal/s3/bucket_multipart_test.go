@@ -0,0 +1,78 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+// the parts are much smaller than S3 allows, but the fake does not mind
+var smallParts = mys3.SyncOptions{PartSize: 1024, PartConcurrency: 3}
+
+// a reader which cannot be seeked, like a pipe
+type streamed struct{ io.Reader }
+
+func TestLargeObjectsAreUploadedInParts(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+	big := strings.Repeat("0123456789", 1000)
+
+	s := mys3.NewSync(context.Background(), fakeClientFor(fake), "site", "", smallParts)
+	if err := s.Put("lambda.zip", streamed{strings.NewReader(big)}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := s.Finish(); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if obj, _ := fake.Object("site", "lambda.zip"); string(obj) != big {
+		t.Fatalf("object was %d bytes", len(obj))
+	}
+	if !slices.Contains(fake.Calls(), "S3.CompleteMultipartUpload") {
+		t.Fatalf("object was not uploaded in parts: %v", fake.Calls())
+	}
+
+	// the ETag of a multipart object is not its MD5, but it is still recognised as the same
+	if changed := syncFiles(t, fake, smallParts, map[string]string{"lambda.zip": big}); len(changed) != 0 {
+		t.Fatalf("second sync changed %v", changed)
+	}
+}
+
+func TestFailedPartsAreSentAgain(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+	big := bytes.Repeat([]byte{'x'}, 5000)
+
+	fake.Fail("S3.UploadPart", 2)
+	if changed := syncFiles(t, fake, smallParts, map[string]string{"media.mp4": string(big)}); !slices.Equal(changed, []string{"media.mp4"}) {
+		t.Fatalf("sync changed %v", changed)
+	}
+	if obj, _ := fake.Object("site", "media.mp4"); !bytes.Equal(obj, big) {
+		t.Fatalf("object was %d bytes", len(obj))
+	}
+}
+
+func TestUploadIsAbortedWhenAPartKeepsFailing(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+
+	fake.Fail("S3.UploadPart", 100)
+	s := mys3.NewSync(context.Background(), fakeClientFor(fake), "site", "", smallParts)
+	s.Put("media.mp4", strings.NewReader(strings.Repeat("x", 5000)))
+	if _, err := s.Finish(); err == nil {
+		t.Fatalf("sync did not fail")
+	}
+	out, err := client.ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{Bucket: aws.String("site")})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(out.Uploads) != 0 {
+		t.Fatalf("upload was left behind")
+	}
+}
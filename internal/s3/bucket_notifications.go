@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// A Notification sends the events on objects whose keys match Prefix and Suffix to
+// exactly one of a Lambda function, an SQS queue or an SNS topic (given by their ARNs).
+//
+// S3 checks that it is allowed to send to the target when the notification is set up;
+// the bucket adds the permission for Lambda functions itself, but the policies of queues
+// and topics must already allow it.
+type Notification struct {
+	Id     string
+	Events []string
+	Prefix string
+	Suffix string
+	Lambda string
+	Queue  string
+	Topic  string
+}
+
+func (n Notification) Validate() error {
+	targets := 0
+	for _, t := range []string{n.Lambda, n.Queue, n.Topic} {
+		if t != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("notification %s must have exactly one of @Lambda, @Queue and @Topic", n.Id)
+	}
+	if len(n.Events) == 0 {
+		return fmt.Errorf("notification %s must have some @Events", n.Id)
+	}
+	return nil
+}
+
+func (n Notification) String() string {
+	target := "lambda=" + n.Lambda
+	if n.Queue != "" {
+		target = "queue=" + n.Queue
+	} else if n.Topic != "" {
+		target = "topic=" + n.Topic
+	}
+	events := slices.Clone(n.Events)
+	slices.Sort(events)
+	return fmt.Sprintf("%s[%s %s*%s -> %s]", n.Id, strings.Join(events, " "), n.Prefix, n.Suffix, target)
+}
+
+func describeNotifications(ns []Notification) string {
+	var ret []string
+	for _, n := range ns {
+		ret = append(ret, n.String())
+	}
+	slices.Sort(ret)
+	return strings.Join(ret, ", ")
+}
+
+func readNotifications(ctx context.Context, client *s3.Client, bucket *string) ([]Notification, error) {
+	nc, err := client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{Bucket: bucket})
+	if err != nil {
+		return nil, err
+	}
+	ret := []Notification{}
+	for _, c := range nc.LambdaFunctionConfigurations {
+		n := notificationFrom(c.Id, c.Events, c.Filter)
+		n.Lambda = aws.ToString(c.LambdaFunctionArn)
+		ret = append(ret, n)
+	}
+	for _, c := range nc.QueueConfigurations {
+		n := notificationFrom(c.Id, c.Events, c.Filter)
+		n.Queue = aws.ToString(c.QueueArn)
+		ret = append(ret, n)
+	}
+	for _, c := range nc.TopicConfigurations {
+		n := notificationFrom(c.Id, c.Events, c.Filter)
+		n.Topic = aws.ToString(c.TopicArn)
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+func notificationFrom(id *string, events []types.Event, filter *types.NotificationConfigurationFilter) Notification {
+	ret := Notification{Id: aws.ToString(id)}
+	for _, e := range events {
+		ret.Events = append(ret.Events, string(e))
+	}
+	if filter != nil && filter.Key != nil {
+		for _, r := range filter.Key.FilterRules {
+			switch strings.ToLower(string(r.Name)) {
+			case "prefix":
+				ret.Prefix = aws.ToString(r.Value)
+			case "suffix":
+				ret.Suffix = aws.ToString(r.Value)
+			}
+		}
+	}
+	return ret
+}
+
+// applyNotifications replaces all the notifications of a bucket; an empty list removes them
+func applyNotifications(ctx context.Context, client *s3.Client, bucket *string, ns []Notification) error {
+	nc := &types.NotificationConfiguration{}
+	for _, n := range ns {
+		var events []types.Event
+		for _, e := range n.Events {
+			events = append(events, types.Event(e))
+		}
+		filter := n.filter()
+		switch {
+		case n.Lambda != "":
+			nc.LambdaFunctionConfigurations = append(nc.LambdaFunctionConfigurations, types.LambdaFunctionConfiguration{Id: aws.String(n.Id), Events: events, Filter: filter, LambdaFunctionArn: aws.String(n.Lambda)})
+		case n.Queue != "":
+			nc.QueueConfigurations = append(nc.QueueConfigurations, types.QueueConfiguration{Id: aws.String(n.Id), Events: events, Filter: filter, QueueArn: aws.String(n.Queue)})
+		default:
+			nc.TopicConfigurations = append(nc.TopicConfigurations, types.TopicConfiguration{Id: aws.String(n.Id), Events: events, Filter: filter, TopicArn: aws.String(n.Topic)})
+		}
+	}
+	_, err := client.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{Bucket: bucket, NotificationConfiguration: nc})
+	return err
+}
+
+func (n Notification) filter() *types.NotificationConfigurationFilter {
+	var rules []types.FilterRule
+	if n.Prefix != "" {
+		rules = append(rules, types.FilterRule{Name: types.FilterRuleNamePrefix, Value: aws.String(n.Prefix)})
+	}
+	if n.Suffix != "" {
+		rules = append(rules, types.FilterRule{Name: types.FilterRuleNameSuffix, Value: aws.String(n.Suffix)})
+	}
+	if rules == nil {
+		return nil
+	}
+	return &types.NotificationConfigurationFilter{Key: &types.S3KeyFilter{FilterRules: rules}}
+}
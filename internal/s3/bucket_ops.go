@@ -2,7 +2,11 @@ package s3
 
 import (
 	"context"
+	e "errors"
+	"fmt"
 	"log"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -10,57 +14,143 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func CreateBucket(client *s3.Client, name string) *s3.CreateBucketOutput {
-	bucket, err := client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket: aws.String(name),
-	})
+func CreateBucket(ctx context.Context, client *s3.Client, name string) (*s3.CreateBucketOutput, error) {
+	return CreateBucketIn(ctx, client, name, "")
+}
+
+// CreateBucketIn creates a bucket in region, or in the client's region if that is empty
+func CreateBucketIn(ctx context.Context, client *s3.Client, name, region string) (*s3.CreateBucketOutput, error) {
+	client = RegionalClient(client, region)
+	input := &s3.CreateBucketInput{Bucket: aws.String(name)}
+	// us-east-1 is where buckets go by default, and S3 refuses it as a constraint
+	if r := client.Options().Region; r != "" && r != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(r)}
+	}
+	bucket, err := client.CreateBucket(ctx, input)
 	if err != nil {
-		log.Fatalf("error creating bucket %s: %v\n", name, err)
-		return nil
+		return nil, err
 	} else {
 		err = s3.NewBucketExistsWaiter(client).Wait(
-			context.TODO(), &s3.HeadBucketInput{Bucket: aws.String(name)},
+			ctx, &s3.HeadBucketInput{Bucket: aws.String(name)},
 			time.Minute,
 		)
 		if err != nil {
 			log.Printf("Failed attempt to wait for bucket %s to exist: %v.\n", name, err)
 		}
 	}
-	return bucket
+	return bucket, nil
+}
 
+// RegionalClient returns a client which talks to S3 in region, which is what buckets
+// in that region need; it is client itself if that is already in region
+func RegionalClient(client *s3.Client, region string) *s3.Client {
+	if region == "" || client.Options().Region == region {
+		return client
+	}
+	return s3.New(client.Options(), func(o *s3.Options) { o.Region = region })
 }
 
-func EmptyBucket(client *s3.Client, name string) bool {
-	for {
-		keys, err := ListBucket(client, name)
+// BucketRegion asks S3 which region a bucket is in
+func BucketRegion(ctx context.Context, client *s3.Client, name string) (string, error) {
+	loc, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	switch loc.LocationConstraint {
+	case "":
+		// buckets in us-east-1 do not have a constraint
+		return "us-east-1", nil
+	case types.BucketLocationConstraintEu:
+		// and some very old ones are just in "EU"
+		return "eu-west-1", nil
+	default:
+		return string(loc.LocationConstraint), nil
+	}
+}
+
+// BucketPolicy returns the policy of a bucket, or "" if it does not have one (or does not exist yet)
+func BucketPolicy(ctx context.Context, client *s3.Client, name string) (string, error) {
+	policy, err := client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(name)})
+	if err != nil {
+		if notConfigured(err, "NoSuchBucketPolicy") || notConfigured(err, "NoSuchBucket") || notConfigured(err, "NotFound") {
+			return "", nil
+		}
+		return "", err
+	}
+	return aws.ToString(policy.Policy), nil
+}
+
+// how many batches of deletes EmptyBucket sends at once
+const emptyConcurrency = 4
+
+// EmptyBucket deletes everything in a bucket so that it can be deleted: not just the
+// objects, but (if the bucket is or has been versioned) all their old versions and
+// delete markers too.  The versions are deleted in batches, several at a time, while
+// they are still being listed.  It returns an error for each key it could not delete.
+func EmptyBucket(ctx context.Context, client *s3.Client, name string) error {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, emptyConcurrency)
+	var mu sync.Mutex
+	var errs []error
+	pages := s3.NewListObjectVersionsPaginator(client, &s3.ListObjectVersionsInput{Bucket: aws.String(name)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
 		if err != nil {
-			log.Printf("failed to list bucket %s", name)
-			return false
+			errs = append(errs, err)
+			break
 		}
-		if keys != nil {
-			DeleteFromBucket(client, name, keys)
-		} else {
-			return true
+		for batch := range slices.Chunk(versionsOf(page), 1000) {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := DeleteFromBucket(ctx, client, name, batch); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}()
 		}
 	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return e.Join(errs...)
 }
 
-func ListBucket(client *s3.Client, name string) ([]types.ObjectIdentifier, error) {
-	objs, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(name),
-	})
-	if err != nil {
-		return nil, err
+// CountVersions says how many versions and delete markers EmptyBucket would delete
+func CountVersions(ctx context.Context, client *s3.Client, name string) (int, error) {
+	ret := 0
+	pages := s3.NewListObjectVersionsPaginator(client, &s3.ListObjectVersionsInput{Bucket: aws.String(name)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		ret += len(page.Versions) + len(page.DeleteMarkers)
 	}
+	return ret, nil
+}
 
-	if *objs.KeyCount == 0 {
-		return nil, nil
+// ListBucket returns all the (current) objects in a bucket
+func ListBucket(ctx context.Context, client *s3.Client, name string) ([]types.ObjectIdentifier, error) {
+	var ret []types.ObjectIdentifier
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{Bucket: aws.String(name)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, identifiersOf(page.Contents)...)
 	}
-	return identifiersOf(objs.Contents), nil
+	return ret, nil
 }
 
-func DeleteFromBucket(client *s3.Client, name string, keys []types.ObjectIdentifier) error {
-	_, err := client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+// DeleteFromBucket deletes up to 1000 keys (or versions of keys), returning an error for
+// each one S3 would not delete
+func DeleteFromBucket(ctx context.Context, client *s3.Client, name string, keys []types.ObjectIdentifier) error {
+	out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
 		Bucket: aws.String(name),
 		Delete: &types.Delete{
 			Objects: keys,
@@ -70,19 +160,26 @@ func DeleteFromBucket(client *s3.Client, name string, keys []types.ObjectIdentif
 	if err != nil {
 		return err
 	}
-	return nil
+	var errs []error
+	for _, oe := range out.Errors {
+		key := aws.ToString(oe.Key)
+		if oe.VersionId != nil {
+			key += " (version " + aws.ToString(oe.VersionId) + ")"
+		}
+		errs = append(errs, fmt.Errorf("could not delete %s: %s: %s", key, aws.ToString(oe.Code), aws.ToString(oe.Message)))
+	}
+	return e.Join(errs...)
 }
 
-func DeleteBucket(client *s3.Client, name string) bool {
-	_, err := client.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{
+func DeleteBucket(ctx context.Context, client *s3.Client, name string) error {
+	_, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{
 		Bucket: aws.String(name),
 	})
 	if err != nil {
-		log.Fatalf("error deleting bucket %s: %v\n", name, err)
-		return false
+		return err
 	} else {
 		err = s3.NewBucketNotExistsWaiter(client).Wait(
-			context.TODO(), &s3.HeadBucketInput{Bucket: aws.String(name)},
+			ctx, &s3.HeadBucketInput{Bucket: aws.String(name)},
 			time.Minute,
 		)
 		if err != nil {
@@ -90,7 +187,18 @@ func DeleteBucket(client *s3.Client, name string) bool {
 		}
 		log.Printf("Deleted bucket %s\n", name)
 	}
-	return true
+	return nil
+}
+
+func versionsOf(page *s3.ListObjectVersionsOutput) []types.ObjectIdentifier {
+	var ret []types.ObjectIdentifier
+	for _, v := range page.Versions {
+		ret = append(ret, types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+	}
+	for _, m := range page.DeleteMarkers {
+		ret = append(ret, types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+	}
+	return ret
 }
 
 func identifiersOf(objs []types.Object) []types.ObjectIdentifier {
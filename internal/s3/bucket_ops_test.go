@@ -0,0 +1,156 @@
+package s3_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+func fakeClient() (*fakeaws.Backend, *s3.Client) {
+	fake := fakeaws.New()
+	return fake, fakeClientFor(fake)
+}
+
+func fakeClientFor(fake *fakeaws.Backend) *s3.Client {
+	return s3.NewFromConfig(fake.Config())
+}
+
+func TestBucketLifecycle(t *testing.T) {
+	fake, client := fakeClient()
+	ctx := context.Background()
+
+	if _, err := mys3.CreateBucket(ctx, client, "my-bucket"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !fake.HasBucket("my-bucket") {
+		t.Fatalf("bucket was not created")
+	}
+	for _, k := range []string{"a.html", "b.html"} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("my-bucket"), Key: aws.String(k), Body: strings.NewReader("hello")})
+		if err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+	keys, err := mys3.ListBucket(ctx, client, "my-bucket")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 objects, not %d", len(keys))
+	}
+	if err := mys3.EmptyBucket(ctx, client, "my-bucket"); err != nil {
+		t.Fatalf("empty failed: %v", err)
+	}
+	if err := mys3.DeleteBucket(ctx, client, "my-bucket"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if fake.HasBucket("my-bucket") {
+		t.Fatalf("bucket was not deleted")
+	}
+}
+
+func TestCannotDeleteFullBucket(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucket(ctx, client, "full")
+	client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("full"), Key: aws.String("x"), Body: strings.NewReader("x")})
+	if err := mys3.DeleteBucket(ctx, client, "full"); err == nil {
+		t.Fatalf("deleting a bucket with objects in it should fail")
+	}
+}
+
+func TestBucketIsCreatedInItsRegion(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	for bucket, region := range map[string]string{"home": "", "away": "eu-west-2"} {
+		if _, err := mys3.CreateBucketIn(ctx, client, bucket, region); err != nil {
+			t.Fatalf("create %s failed: %v", bucket, err)
+		}
+	}
+	home, err := mys3.BucketRegion(ctx, client, "home")
+	if err != nil || home != "us-east-1" {
+		t.Fatalf("home was in %s (%v)", home, err)
+	}
+	away, err := mys3.BucketRegion(ctx, client, "away")
+	if err != nil || away != "eu-west-2" {
+		t.Fatalf("away was in %s (%v)", away, err)
+	}
+	if r := mys3.RegionalClient(client, away).Options().Region; r != "eu-west-2" {
+		t.Fatalf("regional client was for %s", r)
+	}
+}
+
+func TestBucketWithoutPolicyHasEmptyPolicy(t *testing.T) {
+	_, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucket(ctx, client, "open")
+	policy, err := mys3.BucketPolicy(ctx, client, "open")
+	if err != nil || policy != "" {
+		t.Fatalf("policy was %q (%v)", policy, err)
+	}
+	client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{Bucket: aws.String("open"), Policy: aws.String("{}")})
+	if policy, _ := mys3.BucketPolicy(ctx, client, "open"); policy != "{}" {
+		t.Fatalf("policy was %q", policy)
+	}
+}
+
+func TestVersionedBucketCanBeEmptiedAndDeleted(t *testing.T) {
+	fake, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucket(ctx, client, "versioned")
+	none, _ := mys3.ReadBucketConfig(ctx, client, "versioned")
+	mys3.ApplyBucketConfig(ctx, client, "versioned", &mys3.BucketConfig{Versioning: aws.Bool(true)}, none)
+	// enough versions that they come back in more than one page, and need more than one batch
+	for i := range 1400 {
+		k := fmt.Sprintf("obj-%03d", i%700)
+		client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("versioned"), Key: aws.String(k), Body: strings.NewReader(k)})
+	}
+	keys, _ := mys3.ListBucket(ctx, client, "versioned")
+	if err := mys3.DeleteFromBucket(ctx, client, "versioned", keys[:100]); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if n, err := mys3.CountVersions(ctx, client, "versioned"); err != nil || n != 1500 {
+		t.Fatalf("bucket had %d versions and markers (%v)", n, err)
+	}
+
+	if err := mys3.EmptyBucket(ctx, client, "versioned"); err != nil {
+		t.Fatalf("empty failed: %v", err)
+	}
+	if n, _ := mys3.CountVersions(ctx, client, "versioned"); n != 0 {
+		t.Fatalf("bucket still had %d versions", n)
+	}
+	if err := mys3.DeleteBucket(ctx, client, "versioned"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if fake.HasBucket("versioned") {
+		t.Fatalf("bucket was not deleted")
+	}
+}
+
+func TestEmptyingReportsKeysThatCannotBeDeleted(t *testing.T) {
+	fake, client := fakeClient()
+	ctx := context.Background()
+
+	mys3.CreateBucket(ctx, client, "held")
+	for _, k := range []string{"a", "evidence", "z"} {
+		client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("held"), Key: aws.String(k), Body: strings.NewReader(k)})
+	}
+	fake.LockObject("held", "evidence")
+	err := mys3.EmptyBucket(ctx, client, "held")
+	if err == nil || !strings.Contains(err.Error(), "evidence") {
+		t.Fatalf("error was %v", err)
+	}
+	if keys, _ := mys3.ListBucket(ctx, client, "held"); len(keys) != 1 {
+		t.Fatalf("bucket had %d objects left", len(keys))
+	}
+}
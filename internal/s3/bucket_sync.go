@@ -0,0 +1,556 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	e "errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"ziniki.org/deployer/modules/aws/internal/events"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// SyncOptions say how files are copied into a bucket
+type SyncOptions struct {
+	// Delete removes the objects under the prefix which were not copied this time
+	Delete bool
+	// Concurrency is how many uploads can be in progress at once; 0 means DefaultConcurrency
+	Concurrency int
+	// Rules set the headers of the objects (see HeadersFor)
+	Rules []UploadRule
+	// PartSize is the size of the parts that objects bigger than it are uploaded in;
+	// 0 means DefaultPartSize.  S3 does not accept parts smaller than MinPartSize.
+	PartSize int64
+	// PartConcurrency is how many parts of one object can be uploaded at once; 0 means DefaultPartConcurrency
+	PartConcurrency int
+}
+
+const (
+	DefaultConcurrency     = 8
+	DefaultPartSize        = 8 * 1024 * 1024
+	MinPartSize            = 5 * 1024 * 1024
+	DefaultPartConcurrency = 4
+
+	// how many times a part is sent before the upload is given up
+	partAttempts = 3
+
+	// the user metadata that the MD5 of the contents of each object is kept in
+	md5Metadata = "content-md5"
+)
+
+// A Sync copies files into a bucket under a prefix, only uploading the ones whose
+// contents (or headers) are different from the objects already there.
+//
+// Put starts the uploads, which run in the background; Finish must be called once
+// everything has been Put, to wait for them and delete anything left over.
+//
+// The contents are compared using the ETags S3 gives objects, which are their MD5s, except
+// for objects encrypted with SSE-KMS; so the MD5 is also kept in the metadata of each
+// object (as md5Metadata) and that is used for those.
+type Sync struct {
+	ctx    context.Context
+	client *s3.Client
+	plan   *plan.Plan
+	bucket string
+	prefix string
+	opts   SyncOptions
+
+	listOnce sync.Once
+	listErr  error
+	existing map[string]string // the ETag of each object that was there before
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	seen     map[string]bool
+	uploaded []string
+	deleted  []string
+	errs     []error
+	finished bool
+}
+
+func NewSync(ctx context.Context, client *s3.Client, bucket, prefix string, opts SyncOptions) *Sync {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	if opts.PartConcurrency <= 0 {
+		opts.PartConcurrency = DefaultPartConcurrency
+	}
+	return &Sync{ctx: ctx, client: client, bucket: bucket, prefix: prefix, opts: opts, sem: make(chan struct{}, opts.Concurrency), seen: make(map[string]bool)}
+}
+
+// Put makes the object key have contents, uploading it unless it already does.
+// The contents do not need to be seekable; anything bigger than a part is copied to
+// a temporary file rather than being held in memory.
+// The error is for this object or any upload that has failed before it.
+func (s *Sync) Put(key string, contents io.Reader) error {
+	obj, err := s.read(key, contents)
+	if err != nil {
+		return err
+	}
+	if err := s.list(); err != nil {
+		obj.close()
+		return err
+	}
+	etag, exists := s.existing[key]
+	etag = strings.Trim(etag, `"`)
+
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		obj.close()
+		return fmt.Errorf("cannot put %s into %s after the sync has finished", key, s.bucket)
+	}
+	s.seen[key] = true
+	if err := e.Join(s.errs...); err != nil {
+		s.mu.Unlock()
+		obj.close()
+		return err
+	}
+	s.mu.Unlock()
+
+	obj.headers = HeadersFor(key, s.opts.Rules)
+	obj.exists = exists
+	// it may have been uploaded in one go, or in parts of the same size as we use
+	obj.sameContent = exists && (etag == hex.EncodeToString(obj.sum[:]) || etag == obj.etag())
+	if s.plan != nil {
+		defer obj.close()
+		s.planObject(obj, etag)
+		return nil
+	}
+
+	s.sem <- struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.sem }()
+		defer obj.close()
+		s.upload(obj)
+	}()
+	return nil
+}
+
+// Keep stops the object key from being deleted as stale, as if it had been Put, without
+// changing it; it is for objects that are put in the bucket some other way
+func (s *Sync) Keep(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen[key] = true
+}
+
+// Seen returns the keys of all the objects which have been Put or kept
+func (s *Sync) Seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.seen))
+}
+
+// read reads contents into a syncObject, working out the checksums as it goes
+func (s *Sync) read(key string, contents io.Reader) (*syncObject, error) {
+	obj := &syncObject{key: key}
+	first, err := io.ReadAll(io.LimitReader(contents, s.opts.PartSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", key, err)
+	}
+	if int64(len(first)) <= s.opts.PartSize {
+		obj.body = first
+		obj.size = int64(len(first))
+		obj.sum = md5.Sum(first)
+		return obj, nil
+	}
+
+	obj.file, err = os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("copying %s: %w", key, err)
+	}
+	whole := md5.New()
+	parts := &partSums{size: s.opts.PartSize}
+	obj.size, err = io.Copy(io.MultiWriter(obj.file, whole, parts), io.MultiReader(bytes.NewReader(first), contents))
+	if err != nil {
+		obj.close()
+		return nil, fmt.Errorf("copying %s: %w", key, err)
+	}
+	copy(obj.sum[:], whole.Sum(nil))
+	obj.parts = parts.finish()
+	return obj, nil
+}
+
+// a syncObject is a file which has been Put, compared with what is already in the bucket
+type syncObject struct {
+	key  string
+	size int64
+	sum  [md5.Size]byte
+
+	// small objects are kept in memory and uploaded in one go
+	body []byte
+
+	// bigger ones are copied to a file and uploaded in parts
+	file  *os.File
+	parts [][md5.Size]byte
+
+	headers     ObjectHeaders
+	exists      bool
+	sameContent bool
+}
+
+// etag is the ETag S3 will give the object once it is uploaded: the MD5 of the
+// contents, or for multipart uploads the MD5 of the MD5s of the parts and how many there were
+func (o *syncObject) etag() string {
+	if o.file == nil {
+		return hex.EncodeToString(o.sum[:])
+	}
+	return multipartETag(o.parts)
+}
+
+// sameAs says whether head, the object in the bucket, has the contents and headers
+// that o should have.  SSE-KMS objects do not have the MD5 of their contents as their
+// ETag, so for them it is the MD5 kept in their metadata that is compared.
+func (o *syncObject) sameAs(head *s3.HeadObjectOutput) bool {
+	return o.sameContentAs(head) && o.headers.Matches(head)
+}
+
+// sameContentAs says whether head, which may be nil if it could not be found, has the contents o should have
+func (o *syncObject) sameContentAs(head *s3.HeadObjectOutput) bool {
+	if head != nil && isKMS(head.ServerSideEncryption) {
+		return head.Metadata[md5Metadata] == hex.EncodeToString(o.sum[:])
+	}
+	return o.sameContent
+}
+
+// metadata is the user metadata to upload the object with: that from the rules, and its MD5
+func (o *syncObject) metadata() map[string]string {
+	ret := maps.Clone(o.headers.Metadata)
+	if ret == nil {
+		ret = make(map[string]string)
+	}
+	ret[md5Metadata] = hex.EncodeToString(o.sum[:])
+	return ret
+}
+
+func isKMS(sse types.ServerSideEncryption) bool {
+	return sse == types.ServerSideEncryptionAwsKms || sse == types.ServerSideEncryptionAwsKmsDsse
+}
+
+func (o *syncObject) close() {
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+}
+
+func multipartETag(parts [][md5.Size]byte) string {
+	all := md5.New()
+	for _, p := range parts {
+		all.Write(p[:])
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(all.Sum(nil)), len(parts))
+}
+
+// partSums works out the MD5 of each part of whatever is written to it
+type partSums struct {
+	size int64
+	cur  hash.Hash
+	n    int64
+	sums [][md5.Size]byte
+}
+
+func (p *partSums) Write(bs []byte) (int, error) {
+	ret := len(bs)
+	for len(bs) > 0 {
+		if p.cur == nil {
+			p.cur = md5.New()
+			p.n = 0
+		}
+		k := min(int64(len(bs)), p.size-p.n)
+		p.cur.Write(bs[:k])
+		p.n += k
+		bs = bs[k:]
+		if p.n == p.size {
+			p.finish()
+		}
+	}
+	return ret, nil
+}
+
+func (p *partSums) finish() [][md5.Size]byte {
+	if p.cur != nil {
+		var sum [md5.Size]byte
+		copy(sum[:], p.cur.Sum(nil))
+		p.sums = append(p.sums, sum)
+		p.cur = nil
+	}
+	return p.sums
+}
+
+// upload uploads an object unless it is already there, with the same headers
+func (s *Sync) upload(obj *syncObject) {
+	if obj.exists {
+		head, err := s.client.HeadObject(s.ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(obj.key)})
+		if err == nil && obj.sameAs(head) {
+			log.Printf("%s:%s has not changed", s.bucket, obj.key)
+			return
+		}
+	}
+	log.Printf("uploading %s into %s", obj.key, s.bucket)
+	ctx := events.About(s.ctx, events.Resource{Kind: "aws.S3.Object", Name: s.bucket + ":" + obj.key})
+	var err error
+	if obj.file != nil {
+		err = s.uploadParts(ctx, obj)
+	} else {
+		in := &s3.PutObjectInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(obj.key),
+			Body:       bytes.NewReader(obj.body),
+			ContentMD5: aws.String(base64.StdEncoding.EncodeToString(obj.sum[:])),
+		}
+		obj.headers.applyTo(in)
+		in.Metadata = obj.metadata()
+		_, err = s.client.PutObject(ctx, in)
+	}
+	if err != nil {
+		err = fmt.Errorf("uploading %s: %w", obj.key, err)
+	}
+	s.record(&s.uploaded, obj.key, err)
+}
+
+// uploadParts does a multipart upload of an object, sending several parts at once.
+// A part which fails is sent again on its own, rather than starting the whole upload
+// again; if it still cannot be sent, the upload is aborted so that the parts which
+// were sent are not left behind (and charged for).
+func (s *Sync) uploadParts(ctx context.Context, obj *syncObject) error {
+	in := &s3.CreateMultipartUploadInput{Bucket: aws.String(s.bucket), Key: aws.String(obj.key)}
+	obj.headers.applyToMultipart(in)
+	in.Metadata = obj.metadata()
+	created, err := s.client.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	completed := make([]types.CompletedPart, len(obj.parts))
+	sem := make(chan struct{}, s.opts.PartConcurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for i := range obj.parts {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			etag, err := s.uploadPart(ctx, obj, created.UploadId, i)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			completed[i] = types.CompletedPart{PartNumber: aws.Int32(int32(i + 1)), ETag: etag}
+		}()
+	}
+	wg.Wait()
+
+	if err := e.Join(errs...); err != nil {
+		_, aerr := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String(s.bucket), Key: aws.String(obj.key), UploadId: created.UploadId})
+		if aerr != nil {
+			log.Printf("could not abort upload of %s:%s: %v", s.bucket, obj.key, aerr)
+		}
+		return err
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(obj.key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+func (s *Sync) uploadPart(ctx context.Context, obj *syncObject, uploadId *string, i int) (*string, error) {
+	from := int64(i) * s.opts.PartSize
+	size := min(s.opts.PartSize, obj.size-from)
+	var err error
+	for attempt := 1; attempt <= partAttempts; attempt++ {
+		var out *s3.UploadPartOutput
+		out, err = s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(obj.key),
+			UploadId:   uploadId,
+			PartNumber: aws.Int32(int32(i + 1)),
+			Body:       io.NewSectionReader(obj.file, from, size),
+			ContentMD5: aws.String(base64.StdEncoding.EncodeToString(obj.parts[i][:])),
+		})
+		if err == nil {
+			return out.ETag, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("part %d of %s:%s failed on attempt %d: %v", i+1, s.bucket, obj.key, attempt, err)
+	}
+	return nil, fmt.Errorf("part %d: %w", i+1, err)
+}
+
+// planObject records what upload would do
+func (s *Sync) planObject(obj *syncObject, etag string) {
+	name := s.bucket + ":" + obj.key
+	fields := []plan.Field{plan.Set("ContentType", obj.headers.ContentType), plan.Set("CacheControl", obj.headers.CacheControl), plan.Set("ContentEncoding", obj.headers.ContentEncoding)}
+	if !obj.exists {
+		s.plan.Create("aws.S3.Object", name, fields...)
+		s.record(&s.uploaded, obj.key, nil)
+		return
+	}
+	head, err := s.client.HeadObject(s.ctx, &s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(obj.key)})
+	if err != nil {
+		head = nil
+	}
+	switch {
+	case head != nil && obj.sameAs(head):
+		return
+	case !obj.sameContentAs(head):
+		s.plan.Update("aws.S3.Object", name, plan.Compare("ETag", etag, obj.etag()))
+	default:
+		var found ObjectHeaders
+		if head != nil {
+			metadata := maps.Clone(head.Metadata)
+			delete(metadata, md5Metadata)
+			found = ObjectHeaders{ContentType: aws.ToString(head.ContentType), CacheControl: aws.ToString(head.CacheControl), ContentEncoding: aws.ToString(head.ContentEncoding), Metadata: metadata}
+		}
+		s.plan.Update("aws.S3.Object", name,
+			plan.Compare("ContentType", found.ContentType, obj.headers.ContentType),
+			plan.Compare("CacheControl", found.CacheControl, obj.headers.CacheControl),
+			plan.Compare("ContentEncoding", found.ContentEncoding, obj.headers.ContentEncoding),
+			plan.Compare("Metadata", describeTags(found.Metadata), describeTags(obj.headers.Metadata)))
+	}
+	s.record(&s.uploaded, obj.key, nil)
+}
+
+// Wait waits for the uploads which have been started and returns the errors they had;
+// unlike Finish, it leaves the sync open for more to be Put
+func (s *Sync) Wait() error {
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return e.Join(s.errs...)
+}
+
+// Finish waits for all the uploads, deletes the objects which were not Put (if asked
+// to), and returns the keys of all the objects which were changed
+func (s *Sync) Finish() ([]string, error) {
+	s.mu.Lock()
+	if s.finished {
+		defer s.mu.Unlock()
+		return s.changed(), e.Join(s.errs...)
+	}
+	s.finished = true
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if s.opts.Delete && s.list() == nil {
+		s.deleteUnseen()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listErr != nil {
+		s.errs = append(s.errs, s.listErr)
+	}
+	return s.changed(), e.Join(s.errs...)
+}
+
+func (s *Sync) deleteUnseen() {
+	var stale []string
+	for k := range s.existing {
+		if !s.seen[k] {
+			stale = append(stale, k)
+		}
+	}
+	slices.Sort(stale)
+	for batch := range slices.Chunk(stale, 1000) {
+		if s.plan != nil {
+			for _, k := range batch {
+				s.plan.Delete("aws.S3.Object", s.bucket+":"+k)
+				s.record(&s.deleted, k, nil)
+			}
+			continue
+		}
+		var ids []types.ObjectIdentifier
+		for _, k := range batch {
+			ids = append(ids, types.ObjectIdentifier{Key: aws.String(k)})
+		}
+		ctx := events.About(s.ctx, events.Resource{Kind: "aws.S3.Object", Name: s.bucket + ":" + s.prefix})
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{Bucket: aws.String(s.bucket), Delete: &types.Delete{Objects: ids, Quiet: aws.Bool(true)}})
+		if err != nil {
+			s.record(nil, "", fmt.Errorf("deleting stale objects: %w", err))
+			continue
+		}
+		failed := make(map[string]bool)
+		for _, oe := range out.Errors {
+			failed[aws.ToString(oe.Key)] = true
+			s.record(nil, "", fmt.Errorf("deleting %s: %s", aws.ToString(oe.Key), aws.ToString(oe.Message)))
+		}
+		for _, k := range batch {
+			if !failed[k] {
+				s.record(&s.deleted, k, nil)
+			}
+		}
+	}
+}
+
+// list finds the objects which are already under the prefix, the first time it is called
+func (s *Sync) list() error {
+	s.listOnce.Do(func() {
+		s.existing = make(map[string]string)
+		pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(s.prefix)})
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(s.ctx)
+			if notConfigured(err, "NoSuchBucket") && s.plan != nil {
+				// it is only going to be created
+				return
+			}
+			if err != nil {
+				s.listErr = fmt.Errorf("listing %s:%s: %w", s.bucket, s.prefix, err)
+				return
+			}
+			for _, o := range page.Contents {
+				s.existing[aws.ToString(o.Key)] = aws.ToString(o.ETag)
+			}
+		}
+	})
+	return s.listErr
+}
+
+// record notes that key has been changed, if it was, and any error
+func (s *Sync) record(into *[]string, key string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errs = append(s.errs, err)
+	} else if into != nil {
+		*into = append(*into, key)
+	}
+}
+
+// changed must be called with mu held
+func (s *Sync) changed() []string {
+	ret := slices.Concat(s.uploaded, s.deleted)
+	slices.Sort(ret)
+	return ret
+}
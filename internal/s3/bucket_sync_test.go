@@ -0,0 +1,152 @@
+package s3_test
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+func syncFiles(t *testing.T, fake *fakeaws.Backend, opts mys3.SyncOptions, files map[string]string) []string {
+	t.Helper()
+	s := mys3.NewSync(context.Background(), fakeClientFor(fake), "site", "", opts)
+	for k, v := range files {
+		if err := s.Put(k, strings.NewReader(v)); err != nil {
+			t.Fatalf("put %s failed: %v", k, err)
+		}
+	}
+	changed, err := s.Finish()
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	return changed
+}
+
+func TestOnlyChangedFilesAreUploaded(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+
+	first := syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "app.js": "1", "style.css": "x"})
+	if !slices.Equal(first, []string{"app.js", "index.html", "style.css"}) {
+		t.Fatalf("first sync changed %v", first)
+	}
+	second := syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "app.js": "2", "style.css": "x"})
+	if !slices.Equal(second, []string{"app.js"}) {
+		t.Fatalf("second sync changed %v", second)
+	}
+	if obj, _ := fake.Object("site", "app.js"); string(obj) != "2" {
+		t.Fatalf("app.js was %q", obj)
+	}
+}
+
+func TestStaleObjectsAreOnlyDeletedWhenAsked(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+	syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "old.html": "bye"})
+
+	if changed := syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello"}); len(changed) != 0 {
+		t.Fatalf("sync without deletes changed %v", changed)
+	}
+	if _, ok := fake.Object("site", "old.html"); !ok {
+		t.Fatalf("old.html was deleted")
+	}
+	changed := syncFiles(t, fake, mys3.SyncOptions{Delete: true, Concurrency: 2}, map[string]string{"index.html": "hello"})
+	if !slices.Equal(changed, []string{"old.html"}) {
+		t.Fatalf("sync with deletes changed %v", changed)
+	}
+	if _, ok := fake.Object("site", "old.html"); ok {
+		t.Fatalf("old.html was not deleted")
+	}
+}
+
+func TestObjectsEncryptedWithKMSAreComparedByTheirMD5(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+	_, err := client.PutBucketEncryption(context.Background(), &s3.PutBucketEncryptionInput{
+		Bucket:                            aws.String("site"),
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{Rules: []types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAwsKms}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "app.js": "1"})
+	if changed := syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "app.js": "1"}); len(changed) != 0 {
+		t.Fatalf("nothing had changed, but %v were uploaded", changed)
+	}
+	if changed := syncFiles(t, fake, mys3.SyncOptions{}, map[string]string{"index.html": "hello", "app.js": "2"}); !slices.Equal(changed, []string{"app.js"}) {
+		t.Fatalf("second sync changed %v", changed)
+	}
+}
+
+func TestCopiesIntoABucketDoNotDeleteWhatEachOtherCopied(t *testing.T) {
+	h := awstest.New(t)
+	client := fakeClientFor(h.Fake)
+	mys3.CreateBucket(context.Background(), client, "site")
+	syncFiles(t, h.Fake, mys3.SyncOptions{}, map[string]string{"old.html": "bye"})
+	bucket := h.Coin("bucket")
+	obj := h.Coin("obj")
+
+	h.Ensure(&mys3.BucketBlank{}, bucket, "site", h.Props(map[string]any{"DeleteStaleObjects": true}))
+	h.Ensure(&mys3.ObjectBlank{}, obj, "robots.txt", h.Props(map[string]any{"Bucket": h.Value(bucket), "Content": "allow"}))
+	holder := h.Tools().Storage.Eval(h.Value(bucket)).(corebottom.DestHolder)
+	changedPaths := func() []string {
+		return h.Tools().Storage.Eval(h.Get(bucket, "changedPaths")).([]string)
+	}
+	copyFile := func(key, contents string) {
+		dest := holder.ObtainDest()
+		if err := dest.PourInto(key, strings.NewReader(contents)); err != nil {
+			t.Fatal(err)
+		}
+		if err := dest.(io.Closer).Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copyFile("index.html", "hello")
+	if _, ok := h.Fake.Object("site", "old.html"); ok {
+		t.Fatalf("old.html was not deleted when the copy finished")
+	}
+	if paths := changedPaths(); !slices.Equal(paths, []string{"/index.html", "/old.html"}) {
+		t.Fatalf("changed paths were %v", paths)
+	}
+
+	// a copy after changedPaths has been asked for still works
+	copyFile("app.js", "1")
+	for _, k := range []string{"index.html", "app.js", "robots.txt"} {
+		if _, ok := h.Fake.Object("site", k); !ok {
+			t.Fatalf("%s was deleted", k)
+		}
+	}
+	if paths := changedPaths(); !slices.Equal(paths, []string{"/index.html", "/old.html", "/app.js"}) {
+		t.Fatalf("changed paths were %v", paths)
+	}
+}
+
+func TestFailedUploadsAreReportedAgainstTheBucket(t *testing.T) {
+	h := awstest.New(t)
+	mys3.CreateBucket(context.Background(), fakeClientFor(h.Fake), "site")
+	bucket := h.Coin("bucket")
+	h.Ensure(&mys3.BucketBlank{}, bucket, "site", h.Props(map[string]any{}))
+	h.Fake.Fail("S3.PutObject", 10)
+
+	dest := h.Tools().Storage.Eval(h.Value(bucket)).(corebottom.DestHolder).ObtainDest()
+	if err := dest.PourInto("index.html", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dest.(io.Closer).Close(); err == nil {
+		t.Fatalf("the upload failed, but closing the copy did not say so")
+	}
+	if errs := h.Reported(); len(errs) != 1 || !strings.Contains(errs[0], "copying files into bucket site failed") {
+		t.Fatalf("the failure was reported as %v", errs)
+	}
+}
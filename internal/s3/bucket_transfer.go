@@ -1,38 +1,45 @@
 package s3
 
 import (
-	"context"
 	"io"
 	"log"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"ziniki.org/deployer/coremod/pkg/corebottom"
 )
 
+// bucketTransfer is where files are copied into a bucket; they are synced, so that
+// only the files that have changed are uploaded (see Sync).  Each copy into the bucket
+// is a sync of its own, which is finished (deleting stale objects if asked to) when the
+// copy closes it; the objects that other copies into the bucket have already copied
+// are never deleted as stale.
 type bucketTransfer struct {
-	client *s3.Client
-	bucket string
+	bucket *bucketModel // only for the transfer that ObtainDest returned, which closes the sync
+	sync   *Sync
 	path   string
 }
 
 func (b *bucketTransfer) PourInto(key string, contents io.Reader) error {
-	log.Printf("want to pour %s into %s:%s", key, b.bucket, b.path+key)
-	_, err := b.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(b.bucket),
-		Key:    aws.String(b.path + key),
-		Body:   contents,
-	})
-	return err
+	log.Printf("want to pour %s into %s:%s", key, b.sync.bucket, b.path+key)
+	return b.sync.Put(b.path+key, contents)
 }
 
 func (b *bucketTransfer) Relative(name string) (corebottom.FileDest, error) {
-	nested := &bucketTransfer{client: b.client, bucket: b.bucket, path: b.path + name + "/"}
+	nested := &bucketTransfer{sync: b.sync, path: b.path + name + "/"}
 	return nested, nil
 }
 
-func NewBucketTransfer(client *s3.Client, bucket string) *bucketTransfer {
-	return &bucketTransfer{client: client, bucket: bucket}
+// Close waits for the files to be uploaded; closing the transfer that ObtainDest returned
+// also finishes the sync, and reports any errors against the bucket as well as returning them
+func (b *bucketTransfer) Close() error {
+	if b.bucket == nil {
+		return b.sync.Wait()
+	}
+	err := b.bucket.uploads.finish(b.sync)
+	if err != nil {
+		b.bucket.tools.Reporter.ReportAtf(b.bucket.loc, "copying files into bucket %s failed: %v", b.bucket.name, err)
+	}
+	return err
 }
 
 var _ corebottom.FileDest = &bucketTransfer{}
+var _ io.Closer = &bucketTransfer{}
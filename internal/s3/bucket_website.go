@@ -0,0 +1,253 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Website is how a bucket serves its objects as a website: either from Index and
+// Error (with any redirect Rules), or by redirecting every request to RedirectAllTo.
+// A Website with nothing in it means that the bucket is not a website.
+type Website struct {
+	Index               string
+	Error               string
+	RedirectAllTo       string
+	RedirectAllProtocol string
+	Rules               []RedirectRule
+}
+
+// A RedirectRule sends requests for keys starting with WhenPrefix (or which fail with
+// WhenError) somewhere else
+type RedirectRule struct {
+	WhenPrefix    string
+	WhenError     string
+	Host          string
+	Protocol      string
+	ReplacePrefix string
+	ReplaceKey    string
+	Code          string
+}
+
+// A CORSRule allows browsers on Origins to make requests using Methods
+type CORSRule struct {
+	Id      string
+	Origins []string
+	Methods []string
+	Headers []string
+	Expose  []string
+	MaxAge  int32
+}
+
+func (w *Website) IsEmpty() bool {
+	return w.Index == "" && w.RedirectAllTo == ""
+}
+
+// Validate checks that the website is something S3 will accept
+func (w *Website) Validate() error {
+	if w.RedirectAllTo != "" {
+		if w.Index != "" || w.Error != "" || len(w.Rules) > 0 {
+			return fmt.Errorf("a website which redirects all requests cannot have any other configuration")
+		}
+		return nil
+	}
+	if w.Index == "" && (w.Error != "" || len(w.Rules) > 0) {
+		return fmt.Errorf("a website must have an index document")
+	}
+	for _, r := range w.Rules {
+		if r.ReplacePrefix != "" && r.ReplaceKey != "" {
+			return fmt.Errorf("a redirect cannot replace both the prefix and the whole key")
+		}
+	}
+	return nil
+}
+
+func (w *Website) String() string {
+	if w == nil || w.IsEmpty() {
+		return "none"
+	}
+	if w.RedirectAllTo != "" {
+		return "redirect-all " + w.RedirectAllProtocol + "://" + w.RedirectAllTo
+	}
+	ret := "index=" + w.Index
+	if w.Error != "" {
+		ret += " error=" + w.Error
+	}
+	for _, r := range w.Rules {
+		ret += " " + r.String()
+	}
+	return ret
+}
+
+func (r RedirectRule) String() string {
+	return fmt.Sprintf("redirect[%s|%s -> %s://%s %s%s %s]", r.WhenPrefix, r.WhenError, r.Protocol, r.Host, r.ReplacePrefix, r.ReplaceKey, r.Code)
+}
+
+func (r CORSRule) String() string {
+	return fmt.Sprintf("%s[%s %s headers=%s expose=%s maxAge=%d]", r.Id, strings.Join(r.Origins, " "), strings.Join(r.Methods, " "), strings.Join(r.Headers, " "), strings.Join(r.Expose, " "), r.MaxAge)
+}
+
+func describeCORS(rules []CORSRule) string {
+	var ret []string
+	for _, r := range rules {
+		ret = append(ret, r.String())
+	}
+	slices.Sort(ret)
+	return strings.Join(ret, ", ")
+}
+
+func readWebsite(ctx context.Context, client *s3.Client, bucket *string) (*Website, error) {
+	ret := &Website{}
+	ws, err := client.GetBucketWebsite(ctx, &s3.GetBucketWebsiteInput{Bucket: bucket})
+	if err != nil {
+		if notConfigured(err, "NoSuchWebsiteConfiguration") {
+			return ret, nil
+		}
+		return nil, err
+	}
+	if ws.IndexDocument != nil {
+		ret.Index = aws.ToString(ws.IndexDocument.Suffix)
+	}
+	if ws.ErrorDocument != nil {
+		ret.Error = aws.ToString(ws.ErrorDocument.Key)
+	}
+	if ws.RedirectAllRequestsTo != nil {
+		ret.RedirectAllTo = aws.ToString(ws.RedirectAllRequestsTo.HostName)
+		ret.RedirectAllProtocol = string(ws.RedirectAllRequestsTo.Protocol)
+	}
+	for _, rr := range ws.RoutingRules {
+		var r RedirectRule
+		if c := rr.Condition; c != nil {
+			r.WhenPrefix = aws.ToString(c.KeyPrefixEquals)
+			r.WhenError = aws.ToString(c.HttpErrorCodeReturnedEquals)
+		}
+		if d := rr.Redirect; d != nil {
+			r.Host = aws.ToString(d.HostName)
+			r.Protocol = string(d.Protocol)
+			r.ReplacePrefix = aws.ToString(d.ReplaceKeyPrefixWith)
+			r.ReplaceKey = aws.ToString(d.ReplaceKeyWith)
+			r.Code = aws.ToString(d.HttpRedirectCode)
+		}
+		ret.Rules = append(ret.Rules, r)
+	}
+	return ret, nil
+}
+
+func applyWebsite(ctx context.Context, client *s3.Client, bucket *string, w *Website) error {
+	if w.IsEmpty() {
+		_, err := client.DeleteBucketWebsite(ctx, &s3.DeleteBucketWebsiteInput{Bucket: bucket})
+		return err
+	}
+	config := &types.WebsiteConfiguration{}
+	if w.RedirectAllTo != "" {
+		config.RedirectAllRequestsTo = &types.RedirectAllRequestsTo{HostName: aws.String(w.RedirectAllTo), Protocol: types.Protocol(w.RedirectAllProtocol)}
+	} else {
+		config.IndexDocument = &types.IndexDocument{Suffix: aws.String(w.Index)}
+		if w.Error != "" {
+			config.ErrorDocument = &types.ErrorDocument{Key: aws.String(w.Error)}
+		}
+	}
+	for _, r := range w.Rules {
+		rr := types.RoutingRule{Redirect: &types.Redirect{
+			HostName:             optional(r.Host),
+			Protocol:             types.Protocol(r.Protocol),
+			ReplaceKeyPrefixWith: optional(r.ReplacePrefix),
+			ReplaceKeyWith:       optional(r.ReplaceKey),
+			HttpRedirectCode:     optional(r.Code),
+		}}
+		if r.WhenPrefix != "" || r.WhenError != "" {
+			rr.Condition = &types.Condition{KeyPrefixEquals: optional(r.WhenPrefix), HttpErrorCodeReturnedEquals: optional(r.WhenError)}
+		}
+		config.RoutingRules = append(config.RoutingRules, rr)
+	}
+	_, err := client.PutBucketWebsite(ctx, &s3.PutBucketWebsiteInput{Bucket: bucket, WebsiteConfiguration: config})
+	return err
+}
+
+func readCORS(ctx context.Context, client *s3.Client, bucket *string) ([]CORSRule, error) {
+	ret := []CORSRule{}
+	cors, err := client.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: bucket})
+	if err != nil {
+		if notConfigured(err, "NoSuchCORSConfiguration") {
+			return ret, nil
+		}
+		return nil, err
+	}
+	for _, r := range cors.CORSRules {
+		ret = append(ret, CORSRule{Id: aws.ToString(r.ID), Origins: r.AllowedOrigins, Methods: r.AllowedMethods, Headers: r.AllowedHeaders, Expose: r.ExposeHeaders, MaxAge: aws.ToInt32(r.MaxAgeSeconds)})
+	}
+	return ret, nil
+}
+
+func applyCORS(ctx context.Context, client *s3.Client, bucket *string, rules []CORSRule) error {
+	if len(rules) == 0 {
+		_, err := client.DeleteBucketCors(ctx, &s3.DeleteBucketCorsInput{Bucket: bucket})
+		return err
+	}
+	var cors []types.CORSRule
+	for _, r := range rules {
+		rule := types.CORSRule{ID: aws.String(r.Id), AllowedOrigins: r.Origins, AllowedMethods: r.Methods, AllowedHeaders: r.Headers, ExposeHeaders: r.Expose}
+		if r.MaxAge != 0 {
+			rule.MaxAgeSeconds = aws.Int32(r.MaxAge)
+		}
+		cors = append(cors, rule)
+	}
+	_, err := client.PutBucketCors(ctx, &s3.PutBucketCorsInput{Bucket: bucket, CORSConfiguration: &types.CORSConfiguration{CORSRules: cors}})
+	return err
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+// the regions which were around before S3 website endpoints started using a "." before the region
+var dashedWebsiteRegions = []string{"us-east-1", "us-west-1", "us-west-2", "eu-west-1", "ap-southeast-1", "ap-southeast-2", "ap-northeast-1", "sa-east-1", "us-gov-west-1"}
+
+// WebsiteEndpoint is the host name that S3 serves a bucket's website on
+func WebsiteEndpoint(bucket, region string) string {
+	if slices.Contains(dashedWebsiteRegions, region) {
+		return fmt.Sprintf("%s.s3-website-%s.amazonaws.com", bucket, region)
+	}
+	return fmt.Sprintf("%s.s3-website.%s.amazonaws.com", bucket, region)
+}
+
+// the hosted zones of the S3 website endpoints, which Route53 aliases need
+var websiteZoneIds = map[string]string{
+	"us-east-1":      "Z3AQBSTGFYJSTF",
+	"us-east-2":      "Z2O1EMRO9K5GLX",
+	"us-west-1":      "Z2F56UZL2M1ACD",
+	"us-west-2":      "Z3BJ6K6RIION7M",
+	"ca-central-1":   "Z1QDHH18159H29",
+	"eu-west-1":      "Z1BKCTXD74EZPE",
+	"eu-west-2":      "Z3GKZC51ZF0DB4",
+	"eu-west-3":      "Z3R1K369G5AVDG",
+	"eu-central-1":   "Z21DNDUVLTQW6Q",
+	"eu-north-1":     "Z3BAZG2TWCNX0D",
+	"ap-south-1":     "Z11RGJOFQNVJUP",
+	"ap-northeast-1": "Z2M4EHUR26P7ZW",
+	"ap-northeast-2": "Z3W03O7B5YMIYP",
+	"ap-northeast-3": "Z2YQB5RD63NC85",
+	"ap-southeast-1": "Z3O0J2DXBE1FTB",
+	"ap-southeast-2": "Z1WCIGYICN2BYD",
+	"sa-east-1":      "Z7KQH4QJS55SO",
+}
+
+// WebsiteZoneId is the Route53 hosted zone of the website endpoints in region
+func WebsiteZoneId(region string) (string, bool) {
+	id, ok := websiteZoneIds[region]
+	return id, ok
+}
+
+// httpCode formats a number from a script as an HTTP status code
+func httpCode(f float64) string {
+	return strconv.Itoa(int(f))
+}
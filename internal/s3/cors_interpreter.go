@@ -0,0 +1,191 @@
+package s3
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// CORSInterpreter reads the CORS rules of a bucket, one per line:
+//
+//	CORS <- aws.S3.CORS
+//		uploads
+//			@Origins "https://example.com" "https://www.example.com"
+//			@Methods GET PUT
+//			@Headers "*"
+//			@Expose "ETag"
+//			@MaxAge 3000
+type CORSInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model []driverbottom.Expr
+}
+
+func (c *CORSInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	if len(tokens) != 1 {
+		c.tools.Reporter.Report(tokens[0].Loc().Offset, "<rule-id>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var id string
+	switch tok := tokens[0].(type) {
+	case driverbottom.Identifier:
+		id = tok.Id()
+	case driverbottom.String:
+		id = tok.Text()
+	default:
+		c.tools.Reporter.Report(tokens[0].Loc().Offset, "CORS rule id must be an Identifier or a String")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	rule := &CORSRuleExpr{loc: tokens[0].Loc(), id: id}
+	c.model = append(c.model, rule)
+	return &CORSRuleInterpreter{tools: c.tools, rule: rule}
+}
+
+func (c *CORSInterpreter) Completed() {
+	expr := drivertop.NewListExpr(c.prop.Loc(), c.model)
+	c.parent.AddProperty(c.prop, expr)
+}
+
+type CORSRuleInterpreter struct {
+	tools *driverbottom.CoreTools
+	rule  *CORSRuleExpr
+}
+
+func (c *CORSRuleInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok || len(tokens) < 2 {
+		c.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@<attribute> <value> ...")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	switch adv.Name() {
+	case "Methods":
+		for _, t := range tokens[1:] {
+			m, ok := t.(driverbottom.Identifier)
+			if !ok {
+				c.tools.Reporter.Reportf(t.Loc().Offset, "methods must be identifiers such as GET")
+				return drivertop.NewIgnoreInnerScope()
+			}
+			c.rule.methods = append(c.rule.methods, m.Id())
+		}
+	case "Origins", "Headers", "Expose":
+		for _, t := range tokens[1:] {
+			ex, ok := t.(driverbottom.Expr)
+			if !ok {
+				c.tools.Reporter.Reportf(t.Loc().Offset, "invalid argument to @%s", adv.Name())
+				return drivertop.NewIgnoreInnerScope()
+			}
+			switch adv.Name() {
+			case "Origins":
+				c.rule.origins = append(c.rule.origins, ex)
+			case "Headers":
+				c.rule.headers = append(c.rule.headers, ex)
+			case "Expose":
+				c.rule.expose = append(c.rule.expose, ex)
+			}
+		}
+	case "MaxAge":
+		ex, ok := tokens[1].(driverbottom.Expr)
+		if !ok || len(tokens) != 2 {
+			c.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@MaxAge <seconds>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		if c.rule.maxAge != nil {
+			c.tools.Reporter.ReportAtf(adv.Loc(), "cannot set @MaxAge multiple times on CORS rule %s", c.rule.id)
+			return drivertop.NewIgnoreInnerScope()
+		}
+		c.rule.maxAge = ex
+	default:
+		c.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid CORS rule attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(c.tools)
+}
+
+func (c *CORSRuleInterpreter) Completed() {
+	if len(c.rule.origins) == 0 || len(c.rule.methods) == 0 {
+		c.tools.Reporter.ReportAtf(c.rule.loc, "CORS rule %s must have @Origins and @Methods", c.rule.id)
+	}
+}
+
+// CORSRuleExpr is a CORS rule as it appears in the script
+type CORSRuleExpr struct {
+	loc     *errorsink.Location
+	id      string
+	origins []driverbottom.Expr
+	methods []string
+	headers []driverbottom.Expr
+	expose  []driverbottom.Expr
+	maxAge  driverbottom.Expr
+}
+
+// Rule evaluates the parts of the rule
+func (c *CORSRuleExpr) Rule(s driverbottom.RuntimeStorage) (CORSRule, error) {
+	ret := CORSRule{Id: c.id, Methods: c.methods}
+	for _, l := range []struct {
+		what  string
+		exprs []driverbottom.Expr
+		into  *[]string
+	}{{"@Origins", c.origins, &ret.Origins}, {"@Headers", c.headers, &ret.Headers}, {"@Expose", c.expose, &ret.Expose}} {
+		for _, e := range l.exprs {
+			str, err := evalText(s, e, l.what)
+			if err != nil {
+				return ret, fmt.Errorf("CORS rule %s: %w", c.id, err)
+			}
+			*l.into = append(*l.into, str)
+		}
+	}
+	if c.maxAge != nil {
+		ret.MaxAge = int32(s.EvalAsNumber(c.maxAge).F64())
+	}
+	return ret, nil
+}
+
+func (c *CORSRuleExpr) Loc() *errorsink.Location {
+	return c.loc
+}
+
+func (c *CORSRuleExpr) ShortDescription() string {
+	return fmt.Sprintf("CORSRule[%s]", c.id)
+}
+
+func (c *CORSRuleExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("CORSRuleExpr")
+	to.AttrsWhere(c)
+	to.TextAttr("id", c.id)
+	to.TextAttr("methods", fmt.Sprint(c.methods))
+	to.EndAttrs()
+}
+
+func (c *CORSRuleExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, l := range [][]driverbottom.Expr{c.origins, c.headers, c.expose} {
+		for _, e := range l {
+			ret = ret.Merge(e.Resolve(r))
+		}
+	}
+	if c.maxAge != nil {
+		ret = ret.Merge(c.maxAge.Resolve(r))
+	}
+	return ret
+}
+
+func (c *CORSRuleExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// the parts are evaluated when the rule is turned into a CORSRule
+	return c
+}
+
+func (c *CORSRuleExpr) String() string {
+	return c.ShortDescription()
+}
+
+func CreateCORSInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &CORSInterpreter{tools: tools, parent: parent, prop: prop}
+}
+
+var _ driverbottom.Interpreter = &CORSInterpreter{}
+var _ driverbottom.Interpreter = &CORSRuleInterpreter{}
+var _ driverbottom.Expr = &CORSRuleExpr{}
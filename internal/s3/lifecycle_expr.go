@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// LifecycleRuleExpr is a rule as it appears in the script; the days and prefix can be
+// expressions, so it is not turned into a LifecycleRule until the desired state is
+// being determined
+type LifecycleRuleExpr struct {
+	loc         *errorsink.Location
+	id          string
+	prefix      driverbottom.Expr
+	expire      driverbottom.Expr
+	noncurrent  driverbottom.Expr
+	transitions []lifecycleTransition
+}
+
+type lifecycleTransition struct {
+	days  driverbottom.Expr
+	class string
+}
+
+func (r *LifecycleRuleExpr) set(tools *driverbottom.CoreTools, adv driverbottom.Adverb, field *driverbottom.Expr, value driverbottom.Expr) {
+	if *field != nil {
+		tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on lifecycle rule %s", adv.Name(), r.id)
+		return
+	}
+	*field = value
+}
+
+// Rule evaluates the parts of the rule
+func (r *LifecycleRuleExpr) Rule(s driverbottom.RuntimeStorage) (LifecycleRule, error) {
+	ret := LifecycleRule{Id: r.id}
+	if r.prefix != nil {
+		prefix, ok := s.EvalAsStringer(r.prefix)
+		if !ok {
+			return ret, fmt.Errorf("@Prefix of lifecycle rule %s must be a string", r.id)
+		}
+		ret.Prefix = prefix.String()
+	}
+	if r.expire != nil {
+		ret.ExpireDays = int32(s.EvalAsNumber(r.expire).F64())
+	}
+	if r.noncurrent != nil {
+		ret.NoncurrentExpireDays = int32(s.EvalAsNumber(r.noncurrent).F64())
+	}
+	for _, t := range r.transitions {
+		ret.Transitions = append(ret.Transitions, Transition{Days: int32(s.EvalAsNumber(t.days).F64()), StorageClass: t.class})
+	}
+	return ret, nil
+}
+
+func (r *LifecycleRuleExpr) Loc() *errorsink.Location {
+	return r.loc
+}
+
+func (r *LifecycleRuleExpr) ShortDescription() string {
+	return fmt.Sprintf("LifecycleRule[%s]", r.id)
+}
+
+func (r *LifecycleRuleExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("LifecycleRuleExpr")
+	to.AttrsWhere(r)
+	to.TextAttr("id", r.id)
+	if r.prefix != nil {
+		to.NestedAttr("prefix", r.prefix)
+	}
+	if r.expire != nil {
+		to.NestedAttr("expire", r.expire)
+	}
+	if r.noncurrent != nil {
+		to.NestedAttr("noncurrent", r.noncurrent)
+	}
+	for _, t := range r.transitions {
+		to.NestedAttr(t.class, t.days)
+	}
+	to.EndAttrs()
+}
+
+func (r *LifecycleRuleExpr) Resolve(res driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, e := range []driverbottom.Expr{r.prefix, r.expire, r.noncurrent} {
+		if e != nil {
+			ret = ret.Merge(e.Resolve(res))
+		}
+	}
+	for _, t := range r.transitions {
+		ret = ret.Merge(t.days.Resolve(res))
+	}
+	return ret
+}
+
+func (r *LifecycleRuleExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// the parts are evaluated when the rule is turned into a LifecycleRule
+	return r
+}
+
+func (r *LifecycleRuleExpr) String() string {
+	return r.ShortDescription()
+}
+
+var _ driverbottom.Expr = &LifecycleRuleExpr{}
@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+)
+
+// LifecycleInterpreter reads the rules of a Lifecycle property, one per line:
+//
+//	Lifecycle <- aws.S3.Lifecycle
+//		expire-logs
+//			@Prefix "logs/"
+//			@Transition 30 STANDARD_IA
+//			@Expire 365
+//			@NoncurrentExpire 30
+type LifecycleInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model []driverbottom.Expr
+}
+
+func (l *LifecycleInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	if len(tokens) != 1 {
+		l.tools.Reporter.Report(tokens[0].Loc().Offset, "<rule-id>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var id string
+	switch tok := tokens[0].(type) {
+	case driverbottom.Identifier:
+		id = tok.Id()
+	case driverbottom.String:
+		id = tok.Text()
+	default:
+		l.tools.Reporter.Report(tokens[0].Loc().Offset, "lifecycle rule id must be an Identifier or a String")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	rule := &LifecycleRuleExpr{loc: tokens[0].Loc(), id: id}
+	l.model = append(l.model, rule)
+	return &LifecycleRuleInterpreter{tools: l.tools, rule: rule}
+}
+
+func (l *LifecycleInterpreter) Completed() {
+	expr := drivertop.NewListExpr(l.prop.Loc(), l.model)
+	l.parent.AddProperty(l.prop, expr)
+}
+
+type LifecycleRuleInterpreter struct {
+	tools *driverbottom.CoreTools
+	rule  *LifecycleRuleExpr
+}
+
+func (l *LifecycleRuleInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok {
+		l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid lifecycle rule attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var args []driverbottom.Expr
+	for _, t := range tokens[1:] {
+		ex, ok := t.(driverbottom.Expr)
+		if !ok {
+			l.tools.Reporter.Reportf(t.Loc().Offset, "invalid argument to @%s", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		args = append(args, ex)
+	}
+	switch adv.Name() {
+	case "Prefix":
+		if len(args) != 1 {
+			l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Prefix <prefix>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		l.rule.set(l.tools, adv, &l.rule.prefix, args[0])
+	case "Expire":
+		if len(args) != 1 {
+			l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Expire <days>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		l.rule.set(l.tools, adv, &l.rule.expire, args[0])
+	case "NoncurrentExpire":
+		if len(args) != 1 {
+			l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@NoncurrentExpire <days>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		l.rule.set(l.tools, adv, &l.rule.noncurrent, args[0])
+	case "Transition":
+		if len(args) != 2 {
+			l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Transition <days> <storage-class>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		class, ok := args[1].(driverbottom.Identifier)
+		if !ok {
+			l.tools.Reporter.Reportf(tokens[2].Loc().Offset, "@Transition <days> <storage-class> must be an identifier")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		l.rule.transitions = append(l.rule.transitions, lifecycleTransition{days: args[0], class: class.Id()})
+	default:
+		l.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid lifecycle rule attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(l.tools)
+}
+
+func (l *LifecycleRuleInterpreter) Completed() {
+	if l.rule.expire == nil && l.rule.noncurrent == nil && len(l.rule.transitions) == 0 {
+		l.tools.Reporter.ReportAtf(l.rule.loc, "lifecycle rule %s must have at least one of @Expire, @NoncurrentExpire and @Transition", l.rule.id)
+	}
+}
+
+func CreateLifecycleInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &LifecycleInterpreter{tools: tools, parent: parent, prop: prop}
+}
+
+var _ driverbottom.Interpreter = &LifecycleInterpreter{}
+var _ driverbottom.Interpreter = &LifecycleRuleInterpreter{}
@@ -0,0 +1,47 @@
+package s3
+
+import (
+	"regexp"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// AddPermissions is lambda.AddLambdaPermissionsAction; it is given to the BucketBlank
+// because the lambda package already depends on this one
+type AddPermissions func(tools *corebottom.Tools, loc *errorsink.Location, name driverbottom.String, env driverbottom.Expr, actions []corebottom.PolicyRuleAction) corebottom.RealityShifter
+
+// invokeFromBucket allows S3 to invoke a function, but only for notifications from one bucket;
+// bucket names are not tied to an account, so it must also be the account that owns the bucket
+type invokeFromBucket struct {
+	function string
+	bucket   string
+	account  string
+}
+
+func (i *invokeFromBucket) ApplyTo(doc corebottom.PolicyDocument) {
+	item := doc.Item("Allow")
+	item.Action("lambda:InvokeFunction")
+	item.Resource(i.function)
+	item.Principal(coretop.NewPrincipal("Service", "s3.amazonaws.com"))
+	item.AMore("Condition", map[string]any{
+		"ArnLike":      map[string]any{"aws:SourceArn": "arn:aws:s3:::" + i.bucket},
+		"StringEquals": map[string]any{"aws:SourceAccount": i.account},
+	})
+}
+
+func (i *invokeFromBucket) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	return driverbottom.MAY_BE_BOUND
+}
+
+var notStatementChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// permissionName is the start of the ids of the statements which let a bucket invoke
+// the target of a notification
+func permissionName(bucket, id string) string {
+	return notStatementChars.ReplaceAllString("S3-"+bucket+"-"+id, "-")
+}
+
+var _ corebottom.PolicyRuleAction = &invokeFromBucket{}
@@ -0,0 +1,208 @@
+package s3
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// NotificationsInterpreter reads the event notifications of a bucket, one per line;
+// the target can be a Lambda function coin (or its ARN), or the ARN of a queue or topic:
+//
+//	Notifications <- aws.S3.Notifications
+//		thumbnails
+//			@Events "s3:ObjectCreated:*"
+//			@Prefix "uploads/"
+//			@Suffix ".jpg"
+//			@Lambda thumbnailer
+//		audit
+//			@Events "s3:ObjectRemoved:*"
+//			@Queue "arn:aws:sqs:us-east-1:123456789012:audit"
+type NotificationsInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model []driverbottom.Expr
+}
+
+func (n *NotificationsInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	if len(tokens) != 1 {
+		n.tools.Reporter.Report(tokens[0].Loc().Offset, "<notification-id>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var id string
+	switch tok := tokens[0].(type) {
+	case driverbottom.Identifier:
+		id = tok.Id()
+	case driverbottom.String:
+		id = tok.Text()
+	default:
+		n.tools.Reporter.Report(tokens[0].Loc().Offset, "notification id must be an Identifier or a String")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	notification := &NotificationExpr{loc: tokens[0].Loc(), id: id}
+	n.model = append(n.model, notification)
+	return &NotificationInterpreter{tools: n.tools, notification: notification}
+}
+
+func (n *NotificationsInterpreter) Completed() {
+	expr := drivertop.NewListExpr(n.prop.Loc(), n.model)
+	n.parent.AddProperty(n.prop, expr)
+}
+
+type NotificationInterpreter struct {
+	tools        *driverbottom.CoreTools
+	notification *NotificationExpr
+}
+
+func (n *NotificationInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok || len(tokens) < 2 {
+		n.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@<attribute> <value> ...")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	switch adv.Name() {
+	case "Events":
+		for _, t := range tokens[1:] {
+			ev, ok := t.(driverbottom.String)
+			if !ok {
+				n.tools.Reporter.Reportf(t.Loc().Offset, "events must be strings such as \"s3:ObjectCreated:*\"")
+				return drivertop.NewIgnoreInnerScope()
+			}
+			n.notification.events = append(n.notification.events, ev.Text())
+		}
+	case "Prefix", "Suffix", "Lambda", "Queue", "Topic":
+		ex, ok := tokens[1].(driverbottom.Expr)
+		if !ok || len(tokens) != 2 {
+			n.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@%s <value>", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		var into *driverbottom.Expr
+		switch adv.Name() {
+		case "Prefix":
+			into = &n.notification.prefix
+		case "Suffix":
+			into = &n.notification.suffix
+		default:
+			if n.notification.target != nil {
+				n.tools.Reporter.ReportAtf(adv.Loc(), "notification %s can only have one of @Lambda, @Queue and @Topic", n.notification.id)
+				return drivertop.NewIgnoreInnerScope()
+			}
+			n.notification.kind = adv.Name()
+			into = &n.notification.target
+		}
+		if *into != nil {
+			n.tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on notification %s", adv.Name(), n.notification.id)
+			return drivertop.NewIgnoreInnerScope()
+		}
+		*into = ex
+	default:
+		n.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid notification attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(n.tools)
+}
+
+func (n *NotificationInterpreter) Completed() {
+	if len(n.notification.events) == 0 || n.notification.target == nil {
+		n.tools.Reporter.ReportAtf(n.notification.loc, "notification %s must have @Events and one of @Lambda, @Queue and @Topic", n.notification.id)
+	}
+}
+
+// NotificationExpr is a notification as it appears in the script
+type NotificationExpr struct {
+	loc    *errorsink.Location
+	id     string
+	events []string
+	prefix driverbottom.Expr
+	suffix driverbottom.Expr
+	kind   string // Lambda, Queue or Topic
+	target driverbottom.Expr
+}
+
+// Notification evaluates the parts of the notification; a Lambda target can be a
+// function coin, in which case its ARN is used.  This needs to wait until the bucket
+// is updated, because the function may only just have been created.
+func (n *NotificationExpr) Notification(s driverbottom.RuntimeStorage) (Notification, error) {
+	ret := Notification{Id: n.id, Events: n.events}
+	var err error
+	if ret.Prefix, err = evalText(s, n.prefix, "@Prefix"); err != nil {
+		return ret, fmt.Errorf("notification %s: %w", n.id, err)
+	}
+	if ret.Suffix, err = evalText(s, n.suffix, "@Suffix"); err != nil {
+		return ret, fmt.Errorf("notification %s: %w", n.id, err)
+	}
+	target := s.Eval(n.target)
+	if hm, ok := target.(driverbottom.HasMethods); ok {
+		if arn := hm.ObtainMethod("arn"); arn != nil {
+			target = arn.Invoke(s, n.target, nil)
+		}
+	}
+	var arn string
+	switch t := target.(type) {
+	case string:
+		arn = t
+	case fmt.Stringer:
+		arn = t.String()
+	default:
+		return ret, fmt.Errorf("notification %s: @%s must be an ARN, not %T", n.id, n.kind, target)
+	}
+	switch n.kind {
+	case "Lambda":
+		ret.Lambda = arn
+	case "Queue":
+		ret.Queue = arn
+	case "Topic":
+		ret.Topic = arn
+	}
+	return ret, nil
+}
+
+func (n *NotificationExpr) Loc() *errorsink.Location {
+	return n.loc
+}
+
+func (n *NotificationExpr) ShortDescription() string {
+	return fmt.Sprintf("Notification[%s]", n.id)
+}
+
+func (n *NotificationExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("NotificationExpr")
+	to.AttrsWhere(n)
+	to.TextAttr("id", n.id)
+	to.TextAttr("events", fmt.Sprint(n.events))
+	if n.target != nil {
+		to.NestedAttr(n.kind, n.target)
+	}
+	to.EndAttrs()
+}
+
+func (n *NotificationExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, e := range []driverbottom.Expr{n.prefix, n.suffix, n.target} {
+		if e != nil {
+			ret = ret.Merge(e.Resolve(r))
+		}
+	}
+	return ret
+}
+
+func (n *NotificationExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// the parts are evaluated when the bucket is updated
+	return n
+}
+
+func (n *NotificationExpr) String() string {
+	return n.ShortDescription()
+}
+
+func CreateNotificationsInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &NotificationsInterpreter{tools: tools, parent: parent, prop: prop}
+}
+
+var _ driverbottom.Interpreter = &NotificationsInterpreter{}
+var _ driverbottom.Interpreter = &NotificationInterpreter{}
+var _ driverbottom.Expr = &NotificationExpr{}
@@ -0,0 +1,31 @@
+package s3
+
+import (
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+type ObjectBlank struct{}
+
+func (b *ObjectBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr, teardown corebottom.TearDown) corebottom.Ensurable {
+	return &objectCreator{tools: tools, teardown: teardown, loc: loc, coin: id, name: named, props: props}
+}
+
+func (b *ObjectBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
+	return &objectCreator{tools: tools, loc: loc, coin: id, name: named, props: props}
+}
+
+func (b *ObjectBlank) Loc() *errorsink.Location {
+	panic("not implemented")
+}
+
+func (b *ObjectBlank) ShortDescription() string {
+	return "aws.S3.Object[]"
+}
+
+func (b *ObjectBlank) DumpTo(iw driverbottom.IndentWriter) {
+	panic("not implemented")
+}
+
+var _ corebottom.Blank = &ObjectBlank{}
@@ -0,0 +1,284 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// objectCreator looks after a single object in a bucket, whose contents are given in
+// the script, read from a local file, or made by another coin:
+//
+//	ensure aws.S3.Object "config.json"
+//		Bucket <- site
+//		Content <- api->endpoint
+//		ContentType "application/json"
+//
+// The object is only uploaded if its checksum (or headers) are different from what is there.
+type objectCreator struct {
+	tools *corebottom.Tools
+
+	loc      *errorsink.Location
+	coin     corebottom.CoinId
+	teardown corebottom.TearDown
+	name     string
+	props    map[driverbottom.Identifier]driverbottom.Expr
+
+	client  *s3.Client
+	ctx     context.Context
+	timeout time.Duration
+	plan    *plan.Plan
+}
+
+func (o *objectCreator) Loc() *errorsink.Location {
+	return o.loc
+}
+
+func (o *objectCreator) ShortDescription() string {
+	return "aws.S3.Object[" + o.name + "]"
+}
+
+func (o *objectCreator) DumpTo(iw driverbottom.IndentWriter) {
+	iw.Intro("aws.S3.Object[")
+	iw.AttrsWhere(o)
+	iw.TextAttr("named", o.name)
+	iw.EndAttrs()
+}
+
+func (o *objectCreator) CoinId() corebottom.CoinId {
+	return o.coin
+}
+
+func (o *objectCreator) DetermineInitialState(pres corebottom.ValuePresenter) {
+	awsEnv := env.ObtainEnv(o.tools, o.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
+	}
+	o.client = awsEnv.S3Client()
+	o.ctx = awsEnv.Context()
+	o.timeout = env.ObtainTimeout(o.tools, o.props)
+	o.plan = awsEnv.Plan()
+
+	bucket, key, ok := o.location()
+	if !ok {
+		return
+	}
+	client, err := o.clientFor(o.ctx, bucket)
+	if err != nil {
+		// the bucket is not there (yet), so neither is the object
+		log.Printf("could not find bucket %s for object %s: %v", bucket, key, err)
+		pres.NotFound()
+		return
+	}
+	head, err := FindObject(o.ctx, client, bucket, key)
+	if err != nil {
+		o.tools.Reporter.ReportAtf(o.loc, "could not find object %s:%s: %v", bucket, key, err)
+		return
+	}
+	if head == nil {
+		log.Printf("object does not exist: %s:%s", bucket, key)
+		pres.NotFound()
+		return
+	}
+	model := &objectModel{loc: o.loc, id: o.coin, ctx: o.ctx, client: client, bucket: bucket, key: key, etag: aws.ToString(head.ETag)}
+	model.headers = ObjectHeaders{ContentType: aws.ToString(head.ContentType), CacheControl: aws.ToString(head.CacheControl), ContentEncoding: aws.ToString(head.ContentEncoding), Metadata: head.Metadata}
+	pres.Present(model)
+}
+
+func (o *objectCreator) DetermineDesiredState(pres corebottom.ValuePresenter) {
+	bucket, key, ok := o.location()
+	if !ok {
+		return
+	}
+	model := &objectModel{loc: o.loc, id: o.coin, ctx: o.ctx, client: o.client, bucket: bucket, key: key}
+	rule := UploadRule{Pattern: "**"}
+	for i, e := range o.props {
+		switch i.Id() {
+		case "Env", "DeployTimeout":
+		case "Bucket", "Key", "Location":
+			// already used to find the object
+		case "Content":
+			model.content = e
+		case "File":
+			model.file = e
+		case "ContentType", "CacheControl":
+			v, ok := o.tools.Storage.EvalAsStringer(e)
+			if !ok {
+				o.tools.Reporter.ReportAtf(e.Loc(), "%s must be a string", i.Id())
+				return
+			}
+			if i.Id() == "ContentType" {
+				rule.ContentType = v.String()
+			} else {
+				rule.CacheControl = v.String()
+			}
+		default:
+			o.tools.Reporter.ReportAtf(i.Loc(), "invalid property for Object: %s", i.Id())
+			return
+		}
+	}
+	if (model.content == nil) == (model.file == nil) {
+		o.tools.Reporter.ReportAtf(o.loc, "an Object must have exactly one of Content and File")
+		return
+	}
+	model.rules = []UploadRule{rule}
+	pres.Present(model)
+}
+
+// location works out which bucket the object is in, and its key, which is the name
+// of the coin unless it says otherwise; they can also be given as an aws.S3.Location
+func (o *objectCreator) location() (string, string, bool) {
+	var bucketExpr, keyExpr driverbottom.Expr
+	for i, e := range o.props {
+		switch i.Id() {
+		case "Bucket":
+			bucketExpr = e
+		case "Key":
+			keyExpr = e
+		case "Location":
+			loc, ok := e.(*S3Location)
+			if !ok {
+				o.tools.Reporter.ReportAtf(e.Loc(), "Location must be defined with aws.S3.Location")
+				return "", "", false
+			}
+			bucketExpr, keyExpr = loc.Bucket, loc.Key
+		}
+	}
+	if bucketExpr == nil {
+		o.tools.Reporter.ReportAtf(o.loc, "Bucket was not defined")
+		return "", "", false
+	}
+	b := o.tools.Storage.Eval(bucketExpr)
+	bucket, ok := BucketName(b)
+	if !ok {
+		o.tools.Reporter.ReportAtf(bucketExpr.Loc(), "Bucket must be a bucket or the name of one, not %T", b)
+		return "", "", false
+	}
+	key := o.name
+	if keyExpr != nil {
+		k, ok := o.tools.Storage.EvalAsStringer(keyExpr)
+		if !ok {
+			o.tools.Reporter.ReportAtf(keyExpr.Loc(), "Key must be a string")
+			return "", "", false
+		}
+		key = k.String()
+	}
+	key = strings.TrimPrefix(key, "/")
+	if bm, ok := b.(*bucketModel); ok {
+		// files copied into the bucket must not delete this as stale
+		bm.uploads.keep(key)
+	}
+	return bucket, key, true
+}
+
+// clientFor returns a client for the region the bucket is in
+func (o *objectCreator) clientFor(ctx context.Context, bucket string) (*s3.Client, error) {
+	region, err := BucketRegion(ctx, o.client, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return RegionalClient(o.client, region), nil
+}
+
+func (o *objectCreator) UpdateReality() {
+	desired := o.tools.Storage.GetCoin(o.coin, corebottom.DETERMINE_DESIRED_MODE).(*objectModel)
+	name := desired.bucket + ":" + desired.key
+	ctx, cancel := env.WithTimeout(o.ctx, o.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.S3.Object", name, o.coin)
+
+	// the bucket may only just have been created, so look for it again
+	client, err := o.clientFor(ctx, desired.bucket)
+	if err != nil && o.plan != nil {
+		// it is only going to be created, so the object will be too
+		client = o.client
+	} else if err != nil {
+		o.tools.Reporter.ReportAtf(o.loc, "could not find bucket %s: %v", desired.bucket, err)
+		return
+	}
+
+	var contents io.Reader
+	if desired.content != nil {
+		content, ok := o.tools.Storage.EvalAsStringer(desired.content)
+		if !ok {
+			o.tools.Reporter.ReportAtf(desired.content.Loc(), "Content must be a string")
+			return
+		}
+		contents = strings.NewReader(content.String())
+	} else {
+		path, ok := o.tools.Storage.EvalAsStringer(desired.file)
+		if !ok {
+			o.tools.Reporter.ReportAtf(desired.file.Loc(), "File must be a string")
+			return
+		}
+		f, err := os.Open(path.String())
+		if err != nil {
+			o.tools.Reporter.ReportAtf(desired.file.Loc(), "cannot read %s: %v", path, err)
+			return
+		}
+		defer f.Close()
+		contents = f
+	}
+
+	changed, err := PutObject(ctx, client, o.plan, desired.bucket, desired.key, contents, desired.rules)
+	if err != nil {
+		o.tools.Reporter.ReportAtf(o.loc, "error uploading object %s: %v", name, err)
+		return
+	}
+	if !changed {
+		log.Printf("object %s has not changed\n", name)
+		if o.plan != nil {
+			o.plan.NoChange("aws.S3.Object", name)
+		}
+	}
+}
+
+func (o *objectCreator) TearDown() {
+	tmp := o.tools.Storage.GetCoin(o.coin, corebottom.DETERMINE_INITIAL_MODE)
+	if tmp == nil {
+		log.Printf("object %s does not exist\n", o.name)
+		return
+	}
+	found := tmp.(*objectModel)
+	name := found.bucket + ":" + found.key
+	ctx, cancel := env.WithTimeout(o.ctx, o.timeout)
+	defer cancel()
+	ctx = env.About(ctx, "aws.S3.Object", name, o.coin)
+
+	log.Printf("you have asked to tear down object %s %s\n", name, o.teardown.Mode())
+	switch o.teardown.Mode() {
+	case "preserve":
+		log.Printf("not deleting object %s because teardown mode is 'preserve'", name)
+	case "delete":
+		if o.plan != nil {
+			o.plan.Delete("aws.S3.Object", name)
+			return
+		}
+		log.Printf("deleting object %s with teardown mode 'delete'", name)
+		if err := DeleteObject(ctx, found.client, found.bucket, found.key); err != nil {
+			o.tools.Reporter.ReportAtf(o.loc, "error deleting object %s: %v", name, err)
+		}
+	default:
+		log.Printf("cannot handle teardown mode '%s' for object %s", o.teardown.Mode(), name)
+	}
+}
+
+func (o *objectCreator) String() string {
+	return fmt.Sprintf("EnsureObject[%s]", o.name)
+}
+
+var _ corebottom.Ensurable = &objectCreator{}
+var _ corebottom.FindCoin = &objectCreator{}
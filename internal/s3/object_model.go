@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+type objectModel struct {
+	loc *errorsink.Location
+	id  corebottom.CoinId
+
+	ctx    context.Context
+	client *s3.Client
+
+	bucket string
+	key    string
+
+	// for an object which is there, its ETag and headers
+	etag    string
+	headers ObjectHeaders
+
+	// for the object the script wants, where its contents come from
+	content driverbottom.Expr
+	file    driverbottom.Expr
+	rules   []UploadRule
+}
+
+func (o *objectModel) ObtainMethod(name string) driverbottom.Method {
+	switch name {
+	case "arn":
+		return &objectArnMethod{}
+	case "uri":
+		return &objectUriMethod{}
+	case "etag":
+		return &objectEtagMethod{}
+	}
+	return nil
+}
+
+// return something like "arn:aws:s3:::my-bucket/config.json"
+type objectArnMethod struct {
+}
+
+func (a *objectArnMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	obj := objectFor(s, on, "arn", args)
+	return fmt.Sprintf("arn:aws:s3:::%s/%s", obj.bucket, obj.key)
+}
+
+// return something like "s3://my-bucket/config.json"
+type objectUriMethod struct {
+}
+
+func (a *objectUriMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	obj := objectFor(s, on, "uri", args)
+	return fmt.Sprintf("s3://%s/%s", obj.bucket, obj.key)
+}
+
+// the ETag of the object as it was found, without the quotes S3 puts round it
+type objectEtagMethod struct {
+}
+
+func (a *objectEtagMethod) Invoke(s driverbottom.RuntimeStorage, on driverbottom.Expr, args []driverbottom.Expr) any {
+	obj := objectFor(s, on, "etag", args)
+	return strings.Trim(obj.etag, `"`)
+}
+
+func objectFor(s driverbottom.RuntimeStorage, on driverbottom.Expr, method string, args []driverbottom.Expr) *objectModel {
+	e := on.Eval(s)
+	obj, ok := e.(*objectModel)
+	if !ok {
+		panic(fmt.Sprintf("%s can only be called on an object, not a %T", method, e))
+	}
+	if len(args) != 0 {
+		panic("invalid number of arguments")
+	}
+	return obj
+}
+
+var _ driverbottom.HasMethods = &objectModel{}
+var _ driverbottom.Method = &objectArnMethod{}
+var _ driverbottom.Method = &objectUriMethod{}
+var _ driverbottom.Method = &objectEtagMethod{}
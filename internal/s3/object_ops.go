@@ -0,0 +1,42 @@
+package s3
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+)
+
+// PutObject makes the object key in bucket have contents, with the headers given by
+// rules, and says whether it had to be uploaded; like a Sync, it does nothing if the
+// object is already there with the same checksum and headers.  If p is not nil, it
+// only records what it would do.
+func PutObject(ctx context.Context, client *s3.Client, p *plan.Plan, bucket, key string, contents io.Reader, rules []UploadRule) (bool, error) {
+	sync := NewSync(ctx, client, bucket, key, SyncOptions{Rules: rules})
+	sync.plan = p
+	if err := sync.Put(key, contents); err != nil {
+		sync.Finish()
+		return false, err
+	}
+	changed, err := sync.Finish()
+	return len(changed) > 0, err
+}
+
+// FindObject returns the headers of an object, including any checksums it was uploaded
+// with, or nil if it is not there
+func FindObject(ctx context.Context, client *s3.Client, bucket, key string) (*s3.HeadObjectOutput, error) {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), ChecksumMode: types.ChecksumModeEnabled})
+	if notConfigured(err, "NotFound") || notConfigured(err, "NoSuchBucket") {
+		return nil, nil
+	}
+	return head, err
+}
+
+// DeleteObject deletes an object; it is not an error if it is not there
+func DeleteObject(ctx context.Context, client *s3.Client, bucket, key string) error {
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	return err
+}
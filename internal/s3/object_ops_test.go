@@ -0,0 +1,50 @@
+package s3_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+func TestObjectIsOnlyUploadedWhenItChanges(t *testing.T) {
+	fake, client := fakeClient()
+	ctx := context.Background()
+	mys3.CreateBucket(ctx, client, "site")
+	config := `{"api": "https://abc.execute-api.us-east-1.amazonaws.com"}`
+
+	if changed, err := mys3.PutObject(ctx, client, nil, "site", "config.json", strings.NewReader(config), nil); err != nil || !changed {
+		t.Fatalf("first put changed %v (%v)", changed, err)
+	}
+	if changed, err := mys3.PutObject(ctx, client, nil, "site", "config.json", strings.NewReader(config), nil); err != nil || changed {
+		t.Fatalf("second put changed %v (%v)", changed, err)
+	}
+	head, err := mys3.FindObject(ctx, client, "site", "config.json")
+	if err != nil || head == nil {
+		t.Fatalf("object was not found (%v)", err)
+	}
+	if aws.ToString(head.ContentType) != "application/json" {
+		t.Fatalf("content type was %s", aws.ToString(head.ContentType))
+	}
+
+	p := plan.New(nil)
+	if changed, err := mys3.PutObject(ctx, client, p, "site", "config.json", strings.NewReader(`{}`), nil); err != nil || !changed {
+		t.Fatalf("planned put changed %v (%v)", changed, err)
+	}
+	if c := p.Changes(); len(c) != 1 || c[0].Action != plan.Update {
+		t.Fatalf("plan was %v", c)
+	}
+	if obj, _ := fake.Object("site", "config.json"); string(obj) != config {
+		t.Fatalf("planning changed the object to %s", obj)
+	}
+
+	if err := mys3.DeleteObject(ctx, client, "site", "config.json"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if head, err := mys3.FindObject(ctx, client, "site", "config.json"); err != nil || head != nil {
+		t.Fatalf("object was still there (%v)", err)
+	}
+}
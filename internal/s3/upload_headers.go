@@ -0,0 +1,182 @@
+package s3
+
+import (
+	"maps"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// An UploadRule sets the headers of the objects whose keys match Pattern, which is a
+// glob in which "*" does not match "/" but "**" does; a Pattern without a "/" is matched
+// against the last part of the key. Empty fields leave the headers as they are.
+type UploadRule struct {
+	Pattern         string
+	ContentType     string
+	CacheControl    string
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// ObjectHeaders are the headers S3 serves an object with
+type ObjectHeaders struct {
+	ContentType     string
+	CacheControl    string
+	ContentEncoding string
+	Metadata        map[string]string
+}
+
+// files which have been compressed before they are uploaded, so that browsers can be
+// told to uncompress them
+var precompressed = map[string]string{".gz": "gzip", ".br": "br"}
+
+// the types of the files websites are usually made of; these are fixed, rather than coming
+// from the host's mime tables, so that the same file gets the same type on every machine
+// (and so is not uploaded again just because it was deployed from somewhere else)
+var webTypes = map[string]string{
+	".avif":        "image/avif",
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".eot":         "application/vnd.ms-fontobject",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".mp3":         "audio/mpeg",
+	".mp4":         "video/mp4",
+	".otf":         "font/otf",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".webm":        "video/webm",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xml":         "application/xml",
+	".zip":         "application/zip",
+}
+
+// contentType is the type of a file with extension ext, from webTypes if it is there and
+// otherwise from the host
+func contentType(ext string) string {
+	if t, ok := webTypes[strings.ToLower(ext)]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// HeadersFor works out the headers for an object from its key and then applies all
+// the rules that match it, in order
+func HeadersFor(key string, rules []UploadRule) ObjectHeaders {
+	var ret ObjectHeaders
+	typed := key
+	if enc, ok := precompressed[path.Ext(key)]; ok {
+		ret.ContentEncoding = enc
+		typed = strings.TrimSuffix(key, path.Ext(key))
+	}
+	ret.ContentType = contentType(path.Ext(typed))
+	for _, r := range rules {
+		if !globMatch(r.Pattern, key) {
+			continue
+		}
+		if r.ContentType != "" {
+			ret.ContentType = r.ContentType
+		}
+		if r.CacheControl != "" {
+			ret.CacheControl = r.CacheControl
+		}
+		if r.ContentEncoding != "" {
+			ret.ContentEncoding = r.ContentEncoding
+		}
+		for k, v := range r.Metadata {
+			if ret.Metadata == nil {
+				ret.Metadata = make(map[string]string)
+			}
+			// S3 always gives metadata back in lower case
+			ret.Metadata[strings.ToLower(k)] = v
+		}
+	}
+	return ret
+}
+
+// Matches says whether an object which has been uploaded already has these headers;
+// anything which is not set here is not compared
+func (h ObjectHeaders) Matches(head *s3.HeadObjectOutput) bool {
+	if h.ContentType != "" && h.ContentType != aws.ToString(head.ContentType) {
+		return false
+	}
+	if h.CacheControl != "" && h.CacheControl != aws.ToString(head.CacheControl) {
+		return false
+	}
+	if h.ContentEncoding != "" && h.ContentEncoding != aws.ToString(head.ContentEncoding) {
+		return false
+	}
+	for k, v := range h.Metadata {
+		if head.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (h ObjectHeaders) applyTo(in *s3.PutObjectInput) {
+	in.ContentType = optional(h.ContentType)
+	in.CacheControl = optional(h.CacheControl)
+	in.ContentEncoding = optional(h.ContentEncoding)
+	if len(h.Metadata) > 0 {
+		in.Metadata = maps.Clone(h.Metadata)
+	}
+}
+
+func (h ObjectHeaders) applyToMultipart(in *s3.CreateMultipartUploadInput) {
+	in.ContentType = optional(h.ContentType)
+	in.CacheControl = optional(h.CacheControl)
+	in.ContentEncoding = optional(h.ContentEncoding)
+	if len(h.Metadata) > 0 {
+		in.Metadata = maps.Clone(h.Metadata)
+	}
+}
+
+func globMatch(pattern, key string) bool {
+	if !strings.Contains(pattern, "/") {
+		key = path.Base(key)
+	}
+	return globRegexp(pattern).MatchString(key)
+}
+
+func globRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
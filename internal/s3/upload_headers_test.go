@@ -0,0 +1,54 @@
+package s3_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	mys3 "ziniki.org/deployer/modules/aws/internal/s3"
+)
+
+func TestHeadersComeFromTheExtensionAndTheRules(t *testing.T) {
+	rules := []mys3.UploadRule{
+		{Pattern: "*.html", CacheControl: "no-cache"},
+		{Pattern: "assets/**", CacheControl: "max-age=31536000", Metadata: map[string]string{"Team": "web"}},
+	}
+	page := mys3.HeadersFor("docs/index.html", rules)
+	if !strings.HasPrefix(page.ContentType, "text/html") || page.CacheControl != "no-cache" {
+		t.Fatalf("page headers were %+v", page)
+	}
+	script := mys3.HeadersFor("assets/js/app.js.gz", rules)
+	if script.ContentEncoding != "gzip" || !strings.Contains(script.ContentType, "javascript") {
+		t.Fatalf("script headers were %+v", script)
+	}
+	if script.CacheControl != "max-age=31536000" || script.Metadata["team"] != "web" {
+		t.Fatalf("assets rule was not applied: %+v", script)
+	}
+	if other := mys3.HeadersFor("notassets/x.css", rules); other.CacheControl != "" {
+		t.Fatalf("assets rule matched notassets: %+v", other)
+	}
+}
+
+func TestWebTypesDoNotDependOnTheHost(t *testing.T) {
+	for key, want := range map[string]string{"index.HTML": "text/html; charset=utf-8", "app.js": "text/javascript; charset=utf-8", "data.json": "application/json", "font.woff2": "font/woff2", "logo.svg": "image/svg+xml", "app.wasm": "application/wasm"} {
+		if got := mys3.HeadersFor(key, nil).ContentType; got != want {
+			t.Fatalf("%s had type %s, not %s", key, got, want)
+		}
+	}
+}
+
+func TestObjectsAreUploadedAgainWhenOnlyTheirHeadersChange(t *testing.T) {
+	fake, client := fakeClient()
+	mys3.CreateBucket(context.Background(), client, "site")
+	files := map[string]string{"index.html": "hello", "app.js": "1"}
+	syncFiles(t, fake, mys3.SyncOptions{}, files)
+
+	rules := []mys3.UploadRule{{Pattern: "*.html", CacheControl: "no-cache"}}
+	if changed := syncFiles(t, fake, mys3.SyncOptions{Rules: rules}, files); !slices.Equal(changed, []string{"index.html"}) {
+		t.Fatalf("sync with new rules changed %v", changed)
+	}
+	if changed := syncFiles(t, fake, mys3.SyncOptions{Rules: rules}, files); len(changed) != 0 {
+		t.Fatalf("sync with the same rules changed %v", changed)
+	}
+}
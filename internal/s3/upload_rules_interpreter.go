@@ -0,0 +1,219 @@
+package s3
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// UploadRulesInterpreter reads the rules for the headers of files copied into a bucket,
+// one glob per line; content types are worked out from the extensions of the files,
+// so the rules are only needed for anything else:
+//
+//	Uploads <- aws.S3.UploadRules
+//		"*.html"
+//			@CacheControl "no-cache"
+//		"assets/**"
+//			@CacheControl "public, max-age=31536000, immutable"
+//		"*.js"
+//			@Encoding gzip
+//		"**"
+//			@Metadata team "web"
+type UploadRulesInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model []driverbottom.Expr
+}
+
+func (u *UploadRulesInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	pattern, ok := tokens[0].(driverbottom.String)
+	if !ok || len(tokens) != 1 {
+		u.tools.Reporter.Report(tokens[0].Loc().Offset, "\"<glob>\"")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	rule := &UploadRuleExpr{loc: pattern.Loc(), pattern: pattern.Text(), metadata: make(map[string]driverbottom.Expr)}
+	u.model = append(u.model, rule)
+	return &UploadRuleInterpreter{tools: u.tools, rule: rule}
+}
+
+func (u *UploadRulesInterpreter) Completed() {
+	expr := drivertop.NewListExpr(u.prop.Loc(), u.model)
+	u.parent.AddProperty(u.prop, expr)
+}
+
+type UploadRuleInterpreter struct {
+	tools *driverbottom.CoreTools
+	rule  *UploadRuleExpr
+}
+
+func (u *UploadRuleInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok {
+		u.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid upload rule attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	switch adv.Name() {
+	case "ContentType", "CacheControl":
+		ex, ok := u.single(adv, tokens)
+		if !ok {
+			return drivertop.NewIgnoreInnerScope()
+		}
+		if adv.Name() == "ContentType" {
+			u.rule.set(u.tools, adv, &u.rule.contentType, ex)
+		} else {
+			u.rule.set(u.tools, adv, &u.rule.cacheControl, ex)
+		}
+	case "Encoding":
+		if len(tokens) != 2 {
+			u.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Encoding <encoding>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		switch enc := tokens[1].(type) {
+		case driverbottom.Identifier:
+			u.rule.encoding = enc.Id()
+		case driverbottom.String:
+			u.rule.encoding = enc.Text()
+		default:
+			u.tools.Reporter.Reportf(tokens[1].Loc().Offset, "the encoding must be a name such as gzip")
+			return drivertop.NewIgnoreInnerScope()
+		}
+	case "Metadata":
+		if len(tokens) != 3 {
+			u.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Metadata <name> <value>")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		var name string
+		switch n := tokens[1].(type) {
+		case driverbottom.Identifier:
+			name = n.Id()
+		case driverbottom.String:
+			name = n.Text()
+		default:
+			u.tools.Reporter.Reportf(tokens[1].Loc().Offset, "metadata name must be an Identifier or a String")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		value, ok := tokens[2].(driverbottom.Expr)
+		if !ok {
+			u.tools.Reporter.Reportf(tokens[2].Loc().Offset, "invalid metadata value")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		u.rule.metadata[name] = value
+	default:
+		u.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid upload rule attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(u.tools)
+}
+
+func (u *UploadRuleInterpreter) single(adv driverbottom.Adverb, tokens []driverbottom.Token) (driverbottom.Expr, bool) {
+	if len(tokens) != 2 {
+		u.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@%s <value>", adv.Name())
+		return nil, false
+	}
+	ex, ok := tokens[1].(driverbottom.Expr)
+	if !ok {
+		u.tools.Reporter.Reportf(tokens[1].Loc().Offset, "invalid argument to @%s", adv.Name())
+		return nil, false
+	}
+	return ex, true
+}
+
+func (u *UploadRuleInterpreter) Completed() {
+}
+
+// UploadRuleExpr is an upload rule as it appears in the script
+type UploadRuleExpr struct {
+	loc          *errorsink.Location
+	pattern      string
+	contentType  driverbottom.Expr
+	cacheControl driverbottom.Expr
+	encoding     string
+	metadata     map[string]driverbottom.Expr
+}
+
+func (u *UploadRuleExpr) set(tools *driverbottom.CoreTools, adv driverbottom.Adverb, field *driverbottom.Expr, value driverbottom.Expr) {
+	if *field != nil {
+		tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on upload rule %s", adv.Name(), u.pattern)
+		return
+	}
+	*field = value
+}
+
+// Rule evaluates the parts of the rule
+func (u *UploadRuleExpr) Rule(s driverbottom.RuntimeStorage) (UploadRule, error) {
+	ret := UploadRule{Pattern: u.pattern, ContentEncoding: u.encoding}
+	var err error
+	if ret.ContentType, err = evalText(s, u.contentType, "@ContentType"); err != nil {
+		return ret, err
+	}
+	if ret.CacheControl, err = evalText(s, u.cacheControl, "@CacheControl"); err != nil {
+		return ret, err
+	}
+	for k, e := range u.metadata {
+		if ret.Metadata == nil {
+			ret.Metadata = make(map[string]string)
+		}
+		if ret.Metadata[k], err = evalText(s, e, "@Metadata "+k); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
+
+func (u *UploadRuleExpr) Loc() *errorsink.Location {
+	return u.loc
+}
+
+func (u *UploadRuleExpr) ShortDescription() string {
+	return fmt.Sprintf("UploadRule[%s]", u.pattern)
+}
+
+func (u *UploadRuleExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("UploadRuleExpr")
+	to.AttrsWhere(u)
+	to.TextAttr("pattern", u.pattern)
+	if u.contentType != nil {
+		to.NestedAttr("contentType", u.contentType)
+	}
+	if u.cacheControl != nil {
+		to.NestedAttr("cacheControl", u.cacheControl)
+	}
+	if u.encoding != "" {
+		to.TextAttr("encoding", u.encoding)
+	}
+	to.EndAttrs()
+}
+
+func (u *UploadRuleExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, e := range []driverbottom.Expr{u.contentType, u.cacheControl} {
+		if e != nil {
+			ret = ret.Merge(e.Resolve(r))
+		}
+	}
+	for _, e := range u.metadata {
+		ret = ret.Merge(e.Resolve(r))
+	}
+	return ret
+}
+
+func (u *UploadRuleExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// the parts are evaluated when the rule is turned into an UploadRule
+	return u
+}
+
+func (u *UploadRuleExpr) String() string {
+	return u.ShortDescription()
+}
+
+func CreateUploadRulesInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &UploadRulesInterpreter{tools: tools, parent: parent, prop: prop}
+}
+
+var _ driverbottom.Interpreter = &UploadRulesInterpreter{}
+var _ driverbottom.Interpreter = &UploadRuleInterpreter{}
+var _ driverbottom.Expr = &UploadRuleExpr{}
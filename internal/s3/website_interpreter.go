@@ -0,0 +1,259 @@
+package s3
+
+import (
+	"fmt"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+// WebsiteInterpreter reads the Website property of a bucket:
+//
+//	Website <- aws.S3.Website
+//		@Index "index.html"
+//		@Error "error.html"
+//		@Redirect
+//			@WhenPrefix "docs/"
+//			@ReplacePrefix "documents/"
+//
+// or, to send every request somewhere else:
+//
+//	Website <- aws.S3.Website
+//		@RedirectAll "www.example.com" https
+type WebsiteInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model *WebsiteExpr
+}
+
+func (w *WebsiteInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok {
+		w.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid website attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	switch adv.Name() {
+	case "Index", "Error":
+		if len(tokens) != 2 {
+			w.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@%s <key>", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		if !w.model.set(w.tools, adv, tokens[1]) {
+			return drivertop.NewIgnoreInnerScope()
+		}
+	case "RedirectAll":
+		if len(tokens) < 2 || len(tokens) > 3 {
+			w.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@RedirectAll <host> [<protocol>]")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		if !w.model.set(w.tools, adv, tokens[1]) {
+			return drivertop.NewIgnoreInnerScope()
+		}
+		if len(tokens) == 3 {
+			proto, ok := tokens[2].(driverbottom.Identifier)
+			if !ok {
+				w.tools.Reporter.Reportf(tokens[2].Loc().Offset, "the protocol must be http or https")
+				return drivertop.NewIgnoreInnerScope()
+			}
+			w.model.redirectAllProtocol = proto.Id()
+		}
+	case "Redirect":
+		if len(tokens) != 1 {
+			w.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@Redirect takes no arguments")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		rule := &redirectRuleExpr{loc: adv.Loc(), values: make(map[string]driverbottom.Expr)}
+		w.model.rules = append(w.model.rules, rule)
+		return &RedirectRuleInterpreter{tools: w.tools, rule: rule}
+	default:
+		w.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid website attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(w.tools)
+}
+
+func (w *WebsiteInterpreter) Completed() {
+	w.parent.AddProperty(w.prop, w.model)
+}
+
+type RedirectRuleInterpreter struct {
+	tools *driverbottom.CoreTools
+	rule  *redirectRuleExpr
+}
+
+func (r *RedirectRuleInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	adv, ok := tokens[0].(driverbottom.Adverb)
+	if !ok || len(tokens) != 2 {
+		r.tools.Reporter.Reportf(tokens[0].Loc().Offset, "@<attribute> <value>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	switch adv.Name() {
+	case "WhenPrefix", "WhenError", "Host", "ReplacePrefix", "ReplaceKey", "Code":
+		if _, ok := r.rule.values[adv.Name()]; ok {
+			r.tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on a redirect", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		ex, ok := tokens[1].(driverbottom.Expr)
+		if !ok {
+			r.tools.Reporter.Reportf(tokens[1].Loc().Offset, "invalid argument to @%s", adv.Name())
+			return drivertop.NewIgnoreInnerScope()
+		}
+		r.rule.values[adv.Name()] = ex
+	case "Protocol":
+		proto, ok := tokens[1].(driverbottom.Identifier)
+		if !ok {
+			r.tools.Reporter.Reportf(tokens[1].Loc().Offset, "the protocol must be http or https")
+			return drivertop.NewIgnoreInnerScope()
+		}
+		r.rule.protocol = proto.Id()
+	default:
+		r.tools.Reporter.Reportf(tokens[0].Loc().Offset, "invalid redirect attribute")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	return drivertop.NewDisallowInnerScope(r.tools)
+}
+
+func (r *RedirectRuleInterpreter) Completed() {
+	if r.rule.values["Host"] == nil && r.rule.values["ReplacePrefix"] == nil && r.rule.values["ReplaceKey"] == nil && r.rule.values["Code"] == nil && r.rule.protocol == "" {
+		r.tools.Reporter.ReportAtf(r.rule.loc, "a redirect must say where to redirect to")
+	}
+}
+
+// WebsiteExpr is the website configuration as it appears in the script
+type WebsiteExpr struct {
+	loc                 *errorsink.Location
+	index               driverbottom.Expr
+	error               driverbottom.Expr
+	redirectAll         driverbottom.Expr
+	redirectAllProtocol string
+	rules               []*redirectRuleExpr
+}
+
+type redirectRuleExpr struct {
+	loc      *errorsink.Location
+	values   map[string]driverbottom.Expr
+	protocol string
+}
+
+func (w *WebsiteExpr) set(tools *driverbottom.CoreTools, adv driverbottom.Adverb, tok driverbottom.Token) bool {
+	ex, ok := tok.(driverbottom.Expr)
+	if !ok {
+		tools.Reporter.Reportf(tok.Loc().Offset, "invalid argument to @%s", adv.Name())
+		return false
+	}
+	var field *driverbottom.Expr
+	switch adv.Name() {
+	case "Index":
+		field = &w.index
+	case "Error":
+		field = &w.error
+	case "RedirectAll":
+		field = &w.redirectAll
+	}
+	if *field != nil {
+		tools.Reporter.ReportAtf(adv.Loc(), "cannot set @%s multiple times on a website", adv.Name())
+		return false
+	}
+	*field = ex
+	return true
+}
+
+// Website evaluates the parts of the website configuration
+func (w *WebsiteExpr) Website(s driverbottom.RuntimeStorage) (*Website, error) {
+	ret := &Website{RedirectAllProtocol: w.redirectAllProtocol}
+	var err error
+	if ret.Index, err = evalText(s, w.index, "@Index"); err != nil {
+		return nil, err
+	}
+	if ret.Error, err = evalText(s, w.error, "@Error"); err != nil {
+		return nil, err
+	}
+	if ret.RedirectAllTo, err = evalText(s, w.redirectAll, "@RedirectAll"); err != nil {
+		return nil, err
+	}
+	for _, r := range w.rules {
+		rule := RedirectRule{Protocol: r.protocol}
+		for name, field := range map[string]*string{"WhenPrefix": &rule.WhenPrefix, "WhenError": &rule.WhenError, "Host": &rule.Host, "ReplacePrefix": &rule.ReplacePrefix, "ReplaceKey": &rule.ReplaceKey, "Code": &rule.Code} {
+			if *field, err = evalText(s, r.values[name], "@"+name); err != nil {
+				return nil, err
+			}
+		}
+		ret.Rules = append(ret.Rules, rule)
+	}
+	if err := ret.Validate(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// evalText evaluates an optional string in a script; numbers (such as HTTP status codes) are allowed too
+func evalText(s driverbottom.RuntimeStorage, e driverbottom.Expr, what string) (string, error) {
+	if e == nil {
+		return "", nil
+	}
+	switch v := s.Eval(e).(type) {
+	case float64:
+		return httpCode(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%s must be a string, not %T", what, v)
+	}
+}
+
+func (w *WebsiteExpr) Loc() *errorsink.Location {
+	return w.loc
+}
+
+func (w *WebsiteExpr) ShortDescription() string {
+	return "Website"
+}
+
+func (w *WebsiteExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("WebsiteExpr")
+	to.AttrsWhere(w)
+	for name, e := range map[string]driverbottom.Expr{"index": w.index, "error": w.error, "redirectAll": w.redirectAll} {
+		if e != nil {
+			to.NestedAttr(name, e)
+		}
+	}
+	to.TextAttr("rules", fmt.Sprint(len(w.rules)))
+	to.EndAttrs()
+}
+
+func (w *WebsiteExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, e := range []driverbottom.Expr{w.index, w.error, w.redirectAll} {
+		if e != nil {
+			ret = ret.Merge(e.Resolve(r))
+		}
+	}
+	for _, rule := range w.rules {
+		for _, e := range rule.values {
+			ret = ret.Merge(e.Resolve(r))
+		}
+	}
+	return ret
+}
+
+func (w *WebsiteExpr) Eval(s driverbottom.RuntimeStorage) any {
+	// the parts are evaluated when it is turned into a Website
+	return w
+}
+
+func (w *WebsiteExpr) String() string {
+	return w.ShortDescription()
+}
+
+func CreateWebsiteInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &WebsiteInterpreter{tools: tools, parent: parent, prop: prop, model: &WebsiteExpr{loc: prop.Loc()}}
+}
+
+var _ driverbottom.Interpreter = &WebsiteInterpreter{}
+var _ driverbottom.Interpreter = &RedirectRuleInterpreter{}
+var _ driverbottom.Expr = &WebsiteExpr{}
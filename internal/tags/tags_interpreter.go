@@ -0,0 +1,113 @@
+// Package tags reads the tags for a resource from a script, one per line:
+//
+//	Tags <- aws.Tags
+//		Team "platform"
+//		"cost-centre" "1234"
+//		Table table->name
+//
+// The environment of a Lambda function is read the same way, with aws.Lambda.Environment.
+package tags
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+)
+
+type TagsInterpreter struct {
+	tools  *driverbottom.CoreTools
+	parent driverbottom.PropertyParent
+	prop   driverbottom.Identifier
+
+	model *TagsExpr
+}
+
+func (t *TagsInterpreter) HaveTokens(scope driverbottom.Scope, tokens []driverbottom.Token) driverbottom.Interpreter {
+	if len(tokens) != 2 {
+		t.tools.Reporter.Report(tokens[0].Loc().Offset, "<key> <value>")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	var key string
+	switch tok := tokens[0].(type) {
+	case driverbottom.Identifier:
+		key = tok.Id()
+	case driverbottom.String:
+		key = tok.Text()
+	default:
+		t.tools.Reporter.Report(tokens[0].Loc().Offset, "tag key must be an Identifier or a String")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	value, ok := tokens[1].(driverbottom.Expr)
+	if !ok {
+		t.tools.Reporter.Report(tokens[1].Loc().Offset, "tag value must be an expression")
+		return drivertop.NewIgnoreInnerScope()
+	}
+	if _, ok := t.model.values[key]; ok {
+		t.tools.Reporter.ReportAtf(tokens[0].Loc(), "cannot set tag %s multiple times", key)
+		return drivertop.NewIgnoreInnerScope()
+	}
+	t.model.values[key] = value
+	return drivertop.NewDisallowInnerScope(t.tools)
+}
+
+func (t *TagsInterpreter) Completed() {
+	t.parent.AddProperty(t.prop, t.model)
+}
+
+// TagsExpr evaluates to a map[string]string of the tags
+type TagsExpr struct {
+	loc    *errorsink.Location
+	values map[string]driverbottom.Expr
+}
+
+func (t *TagsExpr) Loc() *errorsink.Location {
+	return t.loc
+}
+
+func (t *TagsExpr) ShortDescription() string {
+	return fmt.Sprintf("Tags%v", slices.Sorted(maps.Keys(t.values)))
+}
+
+func (t *TagsExpr) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("TagsExpr")
+	to.AttrsWhere(t)
+	for _, k := range slices.Sorted(maps.Keys(t.values)) {
+		to.NestedAttr(k, t.values[k])
+	}
+	to.EndAttrs()
+}
+
+func (t *TagsExpr) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	ret := driverbottom.MAY_BE_BOUND
+	for _, v := range t.values {
+		ret = ret.Merge(v.Resolve(r))
+	}
+	return ret
+}
+
+func (t *TagsExpr) Eval(s driverbottom.RuntimeStorage) any {
+	ret := make(map[string]string)
+	for k, v := range t.values {
+		str, ok := s.EvalAsStringer(v)
+		if !ok {
+			panic(fmt.Sprintf("the value of tag %s is not a string", k))
+		}
+		ret[k] = str.String()
+	}
+	return ret
+}
+
+func (t *TagsExpr) String() string {
+	return t.ShortDescription()
+}
+
+func CreateInterpreter(tools *driverbottom.CoreTools, scope driverbottom.Scope, parent driverbottom.PropertyParent, prop driverbottom.Identifier, tokens []driverbottom.Token) driverbottom.Interpreter {
+	return &TagsInterpreter{tools: tools, parent: parent, prop: prop, model: &TagsExpr{loc: prop.Loc(), values: make(map[string]driverbottom.Expr)}}
+}
+
+var _ driverbottom.Interpreter = &TagsInterpreter{}
+var _ driverbottom.Expr = &TagsExpr{}
@@ -14,7 +14,7 @@ func (b *VPCBlank) Mint(tools *corebottom.Tools, loc *errorsink.Location, id cor
 }
 
 func (b *VPCBlank) Find(tools *corebottom.Tools, loc *errorsink.Location, id corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.FindCoin {
-	return &vpcFinder{tools: tools, loc: loc, name: named}
+	return &vpcFinder{tools: tools, loc: loc, name: named, props: props}
 }
 
 func (b *VPCBlank) ShortDescription() string {
@@ -1,7 +1,6 @@
 package vpc
 
 import (
-	"context"
 	"fmt"
 	"log"
 
@@ -20,6 +19,7 @@ type vpcFinder struct {
 	loc       *errorsink.Location
 	name      string
 	coin      corebottom.CoinId
+	props     map[driverbottom.Identifier]driverbottom.Expr
 	vpcClient *ec2.Client
 }
 
@@ -43,21 +43,23 @@ func (vf *vpcFinder) CoinId() corebottom.CoinId {
 }
 
 func (vf *vpcFinder) DetermineInitialState(pres corebottom.ValuePresenter) {
-	eq := vf.tools.Recall.ObtainDriver("aws.AwsEnv")
-	awsEnv, ok := eq.(*env.AwsEnv)
-	if !ok {
-		panic("could not cast env to AwsEnv")
+	awsEnv := env.ObtainEnv(vf.tools, vf.props)
+	if awsEnv == nil {
+		pres.NotFound()
+		return
 	}
 
 	vf.vpcClient = awsEnv.EC2Client()
+	ctx := awsEnv.Context()
 
 	var nextTok *string
 	var wanted *types.Vpc
 outer:
 	for {
-		curr, err := vf.vpcClient.DescribeVpcs(context.TODO(), &ec2.DescribeVpcsInput{NextToken: nextTok})
+		curr, err := vf.vpcClient.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{NextToken: nextTok})
 		if err != nil {
-			log.Fatalf("could not recover integration list: %v\n", err)
+			vf.tools.Reporter.ReportAtf(vf.loc, "could not recover vpc list: %v", err)
+			return
 		}
 		for _, intg := range curr.Vpcs {
 			for _, t := range intg.Tags {
@@ -92,9 +94,10 @@ outer:
 			},
 			NextToken: nextTok,
 		}
-		curr, err := vf.vpcClient.DescribeSubnets(context.TODO(), dsi)
+		curr, err := vf.vpcClient.DescribeSubnets(ctx, dsi)
 		if err != nil {
-			panic(err)
+			vf.tools.Reporter.ReportAtf(vf.loc, "could not recover subnets for vpc %s: %v", vf.name, err)
+			return
 		}
 		for _, sn := range curr.Subnets {
 			subnetIds = append(subnetIds, *sn.SubnetId)
@@ -121,9 +124,10 @@ outer:
 			},
 			NextToken: nextTok,
 		}
-		curr, err := vf.vpcClient.DescribeSecurityGroups(context.TODO(), dsi)
+		curr, err := vf.vpcClient.DescribeSecurityGroups(ctx, dsi)
 		if err != nil {
-			panic(err)
+			vf.tools.Reporter.ReportAtf(vf.loc, "could not recover security groups for vpc %s: %v", vf.name, err)
+			return
 		}
 		for _, sg := range curr.SecurityGroups {
 			secgroups = append(secgroups, *sg.GroupId)
@@ -1,10 +1,13 @@
 package awsmod
 
 import (
-	"reflect"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 
 	"ziniki.org/deployer/coremod/pkg/corebottom"
-	"ziniki.org/deployer/coremod/pkg/corepkg"
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/driver/pkg/drivertop"
 	"ziniki.org/deployer/driver/pkg/errorsink"
@@ -13,30 +16,160 @@ import (
 	"ziniki.org/deployer/modules/aws/internal/cfront"
 	"ziniki.org/deployer/modules/aws/internal/dynamodb"
 	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/events"
 	"ziniki.org/deployer/modules/aws/internal/gatewayV2"
 	"ziniki.org/deployer/modules/aws/internal/iam"
 	"ziniki.org/deployer/modules/aws/internal/lambda"
 	"ziniki.org/deployer/modules/aws/internal/neptune"
+	"ziniki.org/deployer/modules/aws/internal/plan"
 	"ziniki.org/deployer/modules/aws/internal/route53"
 	"ziniki.org/deployer/modules/aws/internal/s3"
+	"ziniki.org/deployer/modules/aws/internal/tags"
 	"ziniki.org/deployer/modules/aws/internal/vpc"
+	"ziniki.org/deployer/modules/aws/pkg/cassette"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
 )
 
-// var testRunner deployer.TestRunner
+var configLoader env.ConfigLoader = config.LoadDefaultConfig
+
+var fake *fakeaws.Backend
+
+var testRunner driverbottom.TestRunner
+
+var planning *plan.Plan
+
+var eventLog *events.Log
+
+var recorder *cassette.Recorder
+
+// UseAwsConfig makes the module build its AWS clients from cfg rather than loading
+// the usual shared config; set cfg.BaseEndpoint to point everything at an emulator.
+// It must be called before RegisterWithDriver.
+func UseAwsConfig(cfg aws.Config) {
+	configLoader = env.FixedConfig(cfg)
+}
+
+// RecordCassette makes the module record all the HTTP traffic it has with AWS into a
+// cassette at path, which ReplayCassette can play back later; each interaction is written
+// as it happens, and Close closes the file.
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
+func RecordCassette(path string) error {
+	rec, err := cassette.NewRecorder(path)
+	if err != nil {
+		return err
+	}
+	recorder = rec
+	configLoader = env.WithHTTPClient(configLoader, func(cfg aws.Config) aws.HTTPClient {
+		rec.SetRegion(cfg.Region)
+		return rec.Client(cfg.HTTPClient)
+	})
+	return nil
+}
+
+// ReplayCassette makes the module answer everything it asks of AWS from a cassette
+// made by RecordCassette, so it needs neither network access nor credentials.
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
+func ReplayCassette(path string) error {
+	c, err := cassette.Load(path)
+	if err != nil {
+		return err
+	}
+	player := cassette.NewPlayer(c)
+	UseAwsConfig(aws.Config{
+		Region:      player.Region(),
+		Credentials: credentials.NewStaticCredentialsProvider("replay", "replay", ""),
+		HTTPClient:  player,
+	})
+	return nil
+}
+
+// PlanOnly puts the module into plan mode, in which it changes nothing in AWS, but
+// writes to out what it would have created, updated or deleted.
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
+func PlanOnly(out io.Writer) *plan.Plan {
+	planning = plan.New(out)
+	return planning
+}
 
+// LogEvents makes the module write a line of JSON to the file at path (adding to it if it
+// exists) for every call it makes which changes AWS.
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
+func LogEvents(path string) error {
+	l, err := events.Open(path)
+	if err != nil {
+		return err
+	}
+	eventLog = l
+	return nil
+}
+
+// Close closes the cassette being recorded, if there is one, and says if anything could
+// not be written to it.  It should be called once the deployer has run; the event log
+// does not need it, since each event is written to its file as it happens.
+func Close() error {
+	if recorder == nil {
+		return nil
+	}
+	ret := recorder.Close()
+	recorder = nil
+	return ret
+}
+
+// ProvideTestRunner gives the module the driver's test runner, which RegisterWithDriver
+// provides to the driver as "aws.TestRunner".  It does not change where the module
+// talks to AWS: call UseFakeAWS as well to run the tests against the in-memory fake.
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
 func ProvideTestRunner(runner driverbottom.TestRunner) error {
-	// testRunner = runner
+	testRunner = runner
 	return nil
 }
 
+// UseFakeAWS makes everything the module does to AWS happen in an in-memory fake, which
+// RegisterWithDriver also provides to the driver as "aws.FakeAWS".
+// Like UseAwsConfig, it must be called before RegisterWithDriver.
+func UseFakeAWS() *fakeaws.Backend {
+	fake = fakeaws.New()
+	UseAwsConfig(fake.Config())
+	return fake
+}
+
+// FakeAWS returns the backend the module is using in place of AWS, so that tests can set up
+// the things a deployment expects to find (domains, VPCs, ...) and check what it did.
+// It is nil unless UseFakeAWS has been called.
+func FakeAWS() *fakeaws.Backend {
+	return fake
+}
+
 func RegisterWithDriver(deployer driverbottom.Driver) error {
 	tools := deployer.ObtainCoreTools()
-	tools.Register.ProvideDriver("aws.AwsEnv", env.InitAwsEnv())
+	awsEnv, err := env.InitAwsEnvWith(env.DeploymentContext(), configLoader)
+	if err != nil {
+		return err
+	}
+	if planning != nil {
+		if err := awsEnv.PlanOnly(planning); err != nil {
+			return err
+		}
+	}
+	if eventLog != nil {
+		if err := awsEnv.LogEvents(eventLog); err != nil {
+			return err
+		}
+	}
+	tools.Register.ProvideDriver("aws.AwsEnv", awsEnv)
+	if testRunner != nil {
+		tools.Register.ProvideDriver("aws.TestRunner", testRunner)
+	}
+	if fake != nil {
+		tools.Register.ProvideDriver("aws.FakeAWS", fake)
+	}
 
 	mytools := tools.RetrieveOther("coremod").(*corebottom.Tools)
 
 	tools.Register.ExtensionPoint("dns-asserter")
 
+	tools.Register.Register("target", "aws.env", env.NewEnvHandler(mytools))
+
 	tools.Register.Register("target", "cloudfront.distribution.fromS3", cfront.NewWebsiteFromS3Handler(mytools))
 	tools.Register.Register("target", "cloudfront.invalidate", cfront.NewInvalidateHandler(mytools))
 
@@ -52,7 +185,7 @@ func RegisterWithDriver(deployer driverbottom.Driver) error {
 	tools.Register.Register("blank", "aws.ApiGatewayV2.Route", &gatewayV2.RouteBlank{})
 	tools.Register.Register("blank", "aws.ApiGatewayV2.Stage", &gatewayV2.StageBlank{})
 	tools.Register.Register("blank", "aws.ApiGatewayV2.VPCLink", &gatewayV2.VPCLinkBlank{})
-	tools.Register.Register("blank", "aws.AuroraDSQL.Cluster", &corepkg.CoreBlank{OfType: reflect.TypeFor[auroraDSQL.ClusterCreator](), Name: "aws.AuroraDSQL.Cluster"})
+	tools.Register.Register("blank", "aws.AuroraDSQL.Cluster", &auroraDSQL.ClusterBlank{})
 	tools.Register.Register("blank", "aws.CertificateManager.Certificate", &acm.CertificateBlank{})
 	tools.Register.Register("blank", "aws.CloudFront.OriginAccessControl", &cfront.OACBlank{})
 	tools.Register.Register("blank", "aws.CloudFront.ResponseHeadersPolicy", &cfront.RHPBlank{})
@@ -62,21 +195,32 @@ func RegisterWithDriver(deployer driverbottom.Driver) error {
 	tools.Register.Register("blank", "aws.DynamoDB.Table", &dynamodb.TableBlank{})
 	tools.Register.Register("blank", "aws.IAM.Policy", &iam.PolicyBlank{})
 	tools.Register.Register("blank", "aws.IAM.Role", &iam.RoleBlank{})
-	tools.Register.Register("blank", "aws.IAM.User", &corepkg.CoreFinder{OfType: reflect.TypeFor[iam.UserFinder](), Name: "aws.IAM.User"})
+	tools.Register.Register("blank", "aws.IAM.User", &iam.UserBlank{})
 	tools.Register.Register("blank", "aws.Lambda.Alias", &lambda.AliasBlank{})
+	tools.Register.Register("blank", "aws.Lambda.EventSourceMapping", &lambda.EventSourceMappingBlank{})
 	tools.Register.Register("blank", "aws.Lambda.Function", &lambda.FunctionBlank{})
+	tools.Register.Register("blank", "aws.Lambda.Layer", &lambda.LayerBlank{})
 	tools.Register.Register("blank", "aws.Neptune.SubnetGroup", &neptune.SubnetBlank{})
 	tools.Register.Register("blank", "aws.Neptune.Cluster", &neptune.ClusterBlank{})
 	tools.Register.Register("blank", "aws.Neptune.Instance", &neptune.InstanceBlank{})
 	tools.Register.Register("blank", "aws.Route53.DomainName", &route53.DomainNameBlank{})
 	tools.Register.Register("blank", "aws.Route53.ALIAS", &route53.ALIASBlank{})
 	tools.Register.Register("blank", "aws.Route53.CNAME", &route53.CNAMEBlank{})
-	tools.Register.Register("blank", "aws.S3.Bucket", &s3.BucketBlank{})
+	tools.Register.Register("blank", "aws.S3.Bucket", &s3.BucketBlank{LambdaPermissions: lambda.AddLambdaPermissionsAction})
+	tools.Register.Register("blank", "aws.S3.Object", &s3.ObjectBlank{})
 	tools.Register.Register("blank", "aws.VPC.VPC", &vpc.VPCBlank{})
 
 	tools.Register.Register("prop-interpreter", "aws.DynamoFields", driverbottom.CreateInterpreter(dynamodb.CreateFieldInterpreter))
 	tools.Register.Register("prop-interpreter", "aws.IAM.WithRole", driverbottom.CreateInterpreter(iam.CreateWithRoleInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.Lambda.Environment", driverbottom.CreateInterpreter(tags.CreateInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.Lambda.EventSources", driverbottom.CreateInterpreter(lambda.CreateEventSourcesInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.S3.CORS", driverbottom.CreateInterpreter(s3.CreateCORSInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.S3.Lifecycle", driverbottom.CreateInterpreter(s3.CreateLifecycleInterpreter))
 	tools.Register.Register("prop-interpreter", "aws.S3.Location", driverbottom.CreateInterpreter(s3.CreateLocationInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.S3.Notifications", driverbottom.CreateInterpreter(s3.CreateNotificationsInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.S3.UploadRules", driverbottom.CreateInterpreter(s3.CreateUploadRulesInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.S3.Website", driverbottom.CreateInterpreter(s3.CreateWebsiteInterpreter))
+	tools.Register.Register("prop-interpreter", "aws.Tags", driverbottom.CreateInterpreter(tags.CreateInterpreter))
 	tools.Register.Register("prop-interpreter", "aws.VPC.Config", driverbottom.CreateInterpreter(vpc.CreateConfigInterpreter))
 
 	loc := &errorsink.Location{}
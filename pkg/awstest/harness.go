@@ -0,0 +1,352 @@
+// Package awstest runs the blanks of this module against the in-memory fake of AWS in
+// fakeaws, going through the same steps as the deployer does when it runs a script, so
+// that the create, update and teardown of each of them can be tested without an account.
+package awstest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/driver/pkg/utils"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+// Harness is one deployment against a fake AWS; it can be run as many times as a test
+// wants, and each run starts from what AWS has in it, just as a new run of awsdep would
+type Harness struct {
+	t    *testing.T
+	Fake *fakeaws.Backend
+
+	awsEnv  *env.AwsEnv
+	tools   *corebottom.Tools
+	storage *storage
+	errors  *errors
+	loc     *errorsink.Location
+
+	// how many of the calls made to Fake have been returned by Calls
+	seen int
+}
+
+// New creates a harness whose AWS is a new, empty, fake
+func New(t *testing.T) *Harness {
+	fake := fakeaws.New()
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(fake.Config()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	s := &storage{values: make(map[corebottom.CoinId]map[int]any)}
+	e := &errors{}
+	tools := &corebottom.Tools{CoreTools: &driverbottom.CoreTools{Reporter: e, Recall: &recall{awsEnv: awsEnv}, Storage: s}}
+	return &Harness{t: t, Fake: fake, awsEnv: awsEnv, tools: tools, storage: s, errors: e, loc: &errorsink.Location{}}
+}
+
+// Tools are the tools that the harness gives to the blanks it runs
+func (h *Harness) Tools() *corebottom.Tools {
+	return h.tools
+}
+
+// PlanOnly puts the harness into plan mode: AWS is no longer changed, and the plan of
+// what would have been done is returned
+func (h *Harness) PlanOnly() *plan.Plan {
+	p := plan.New(io.Discard)
+	if err := h.awsEnv.PlanOnly(p); err != nil {
+		h.t.Fatal(err)
+	}
+	return p
+}
+
+// NextRun forgets everything that the previous run bound to its coins, as happens
+// between one run of awsdep and the next
+func (h *Harness) NextRun() {
+	h.storage.values = make(map[corebottom.CoinId]map[int]any)
+	h.errors.reported = nil
+}
+
+// Coin makes a new coin for a blank to bind its value to
+func (h *Harness) Coin(name string) corebottom.CoinId {
+	return corebottom.CoinId(&coin{name: drivertop.NewIdentifierToken(h.loc, name)})
+}
+
+// Props turns a map of property names to values into the properties of a blank: strings
+// become string literals, numbers and bools become numbers (as they are in a script),
+// lists of strings become lists, and expressions are passed through unchanged
+func (h *Harness) Props(values map[string]any) map[driverbottom.Identifier]driverbottom.Expr {
+	ret := make(map[driverbottom.Identifier]driverbottom.Expr)
+	for k, v := range values {
+		ret[drivertop.NewIdentifierToken(h.loc, k)] = h.Expr(v)
+	}
+	return ret
+}
+
+// Expr turns a value into an expression, as Props does
+func (h *Harness) Expr(v any) driverbottom.Expr {
+	switch v := v.(type) {
+	case driverbottom.Expr:
+		return v
+	case string:
+		return drivertop.MakeString(h.loc, v)
+	case int:
+		return &number{loc: h.loc, value: float64(v)}
+	case float64:
+		return &number{loc: h.loc, value: v}
+	case bool:
+		if v {
+			return &number{loc: h.loc, value: 1}
+		}
+		return &number{loc: h.loc, value: 0}
+	case []string:
+		var es []driverbottom.Expr
+		for _, s := range v {
+			es = append(es, drivertop.MakeString(h.loc, s))
+		}
+		return drivertop.NewListExpr(h.loc, es)
+	default:
+		panic(fmt.Sprintf("cannot make an expression from %T", v))
+	}
+}
+
+// Value is the expression for the value bound to a coin, as when a script names it
+func (h *Harness) Value(c corebottom.CoinId) driverbottom.Expr {
+	return coretop.MakeGetCoinMethod(h.loc, c)
+}
+
+// Get is the expression (coin -> method), such as (role -> arn), that one blank
+// uses to refer to another
+func (h *Harness) Get(c corebottom.CoinId, method string) driverbottom.Expr {
+	return drivertop.MakeInvokeExpr(coretop.MakeGetCoinMethod(h.loc, c), drivertop.NewIdentifierToken(h.loc, method))
+}
+
+// Ensure runs a blank as if a script had asked for it: it finds what is there, works out
+// what is wanted and then brings AWS into line, failing the test if any errors are reported.
+// It returns what was bound to the coin.
+func (h *Harness) Ensure(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) any {
+	if errs := h.Attempt(blank, c, named, props); len(errs) > 0 {
+		h.t.Fatalf("ensuring %s %s failed: %v", blank.ShortDescription(), named, errs)
+	}
+	return h.storage.GetCoin(c, corebottom.UPDATE_REALITY_MODE)
+}
+
+// Attempt runs a blank in the same way as Ensure, but returns the errors that were reported
+func (h *Harness) Attempt(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) []string {
+	e := h.find(blank, c, named, props)
+	if len(h.errors.reported) == 0 {
+		h.storage.mode = corebottom.UPDATE_REALITY_MODE
+		e.UpdateReality()
+	}
+	return h.errors.reported
+}
+
+// Reported returns the errors that have been reported in this run
+func (h *Harness) Reported() []string {
+	return h.errors.reported
+}
+
+// Determine works out what there is of a blank in AWS and what the script wants of it,
+// without changing anything, as the deployer does for every coin in a script before it
+// starts to change or tear down any of them
+func (h *Harness) Determine(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) {
+	h.find(blank, c, named, props)
+	if len(h.errors.reported) > 0 {
+		h.t.Fatalf("determining %s %s failed: %v", blank.ShortDescription(), named, h.errors.reported)
+	}
+}
+
+// Find runs a blank as if a script had asked to find it, failing the test if any errors
+// are reported or it cannot be found; it returns what was found
+func (h *Harness) Find(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) any {
+	h.errors.reported = nil
+	f := blank.Find(h.tools, h.loc, c, named, props)
+	h.storage.mode = corebottom.DETERMINE_INITIAL_MODE
+	f.DetermineInitialState(&presenter{storage: h.storage, coin: c})
+	ret := h.storage.GetCoin(c, corebottom.DETERMINE_INITIAL_MODE)
+	if len(h.errors.reported) > 0 || ret == nil {
+		h.t.Fatalf("finding %s %s failed: %v", blank.ShortDescription(), named, h.errors.reported)
+	}
+	return ret
+}
+
+// TearDown finds what a blank has in AWS and removes it, failing the test if any errors are reported
+func (h *Harness) TearDown(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) {
+	e := h.find(blank, c, named, props)
+	if len(h.errors.reported) == 0 {
+		e.TearDown()
+	}
+	if len(h.errors.reported) > 0 {
+		h.t.Fatalf("tearing down %s %s failed: %v", blank.ShortDescription(), named, h.errors.reported)
+	}
+}
+
+func (h *Harness) find(blank corebottom.Blank, c corebottom.CoinId, named string, props map[driverbottom.Identifier]driverbottom.Expr) corebottom.Ensurable {
+	h.errors.reported = nil
+	e := blank.Mint(h.tools, h.loc, c, named, props, &teardown{})
+	h.storage.mode = corebottom.DETERMINE_INITIAL_MODE
+	e.DetermineInitialState(&presenter{storage: h.storage, coin: c})
+	if len(h.errors.reported) == 0 {
+		h.storage.mode = corebottom.DETERMINE_DESIRED_MODE
+		e.DetermineDesiredState(&presenter{storage: h.storage, coin: c})
+	}
+	return e
+}
+
+// Calls returns the calls made to the fake AWS since the last time it was called
+func (h *Harness) Calls() []string {
+	all := h.Fake.Calls()
+	ret := all[h.seen:]
+	h.seen = len(all)
+	return ret
+}
+
+type coin struct {
+	driverbottom.ResolvableHolder
+	name driverbottom.Identifier
+}
+
+func (c *coin) VarName() driverbottom.Identifier {
+	return c.name
+}
+
+// storage keeps the values bound to each coin in each mode
+type storage struct {
+	driverbottom.RuntimeStorage
+	mode   int
+	values map[corebottom.CoinId]map[int]any
+}
+
+func (s *storage) Eval(e driverbottom.Expr) any {
+	return e.Eval(s)
+}
+
+func (s *storage) EvalAsStringer(e driverbottom.Expr) (fmt.Stringer, bool) {
+	return utils.AsStringer(s.Eval(e))
+}
+
+func (s *storage) EvalAsNumber(e driverbottom.Expr) driverbottom.AsNumber {
+	if f, ok := s.Eval(e).(float64); ok {
+		return utils.F64AsNumber(f)
+	}
+	return nil
+}
+
+func (s *storage) Bind(c driverbottom.ResolvableHolder, value any) {
+	s.bind(c, s.mode, value)
+}
+
+func (s *storage) Adopt(c driverbottom.ResolvableHolder, value any) {
+	s.bind(c, s.mode, value)
+}
+
+func (s *storage) bind(c driverbottom.ResolvableHolder, mode int, value any) {
+	if s.values[c] == nil {
+		s.values[c] = make(map[int]any)
+	}
+	s.values[c][mode] = value
+}
+
+func (s *storage) GetCoin(c driverbottom.ResolvableHolder, mode int) any {
+	return s.values[c][mode]
+}
+
+func (s *storage) GetCoinFrom(c driverbottom.ResolvableHolder, modes []int) any {
+	for _, m := range modes {
+		if v, ok := s.values[c][m]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+type presenter struct {
+	storage *storage
+	coin    corebottom.CoinId
+}
+
+func (p *presenter) Present(value any) {
+	p.storage.Bind(p.coin, value)
+}
+
+func (p *presenter) NotFound() {
+}
+
+type teardown struct {
+	corebottom.TearDown
+}
+
+func (t *teardown) Mode() string {
+	return "delete"
+}
+
+type recall struct {
+	driverbottom.Recall
+	awsEnv *env.AwsEnv
+}
+
+func (r *recall) ObtainDriver(name string) any {
+	if name == "aws.AwsEnv" {
+		return r.awsEnv
+	}
+	return nil
+}
+
+type errors struct {
+	errorsink.ErrorSink
+	reported []string
+}
+
+func (e *errors) Report(offset int, msg string) {
+	e.reported = append(e.reported, msg)
+}
+
+func (e *errors) Reportf(offset int, format string, args ...any) {
+	e.reported = append(e.reported, fmt.Sprintf(format, args...))
+}
+
+func (e *errors) ReportAtf(loc *errorsink.Location, format string, args ...any) {
+	e.reported = append(e.reported, fmt.Sprintf(format, args...))
+}
+
+func (e *errors) HasErrors() bool {
+	return len(e.reported) > 0
+}
+
+// number is a number as it appears in a script
+type number struct {
+	loc   *errorsink.Location
+	value float64
+}
+
+func (n *number) Loc() *errorsink.Location {
+	return n.loc
+}
+
+func (n *number) ShortDescription() string {
+	return fmt.Sprintf("Number[%v]", n.value)
+}
+
+func (n *number) DumpTo(to driverbottom.IndentWriter) {
+	to.Intro("Number")
+	to.TextAttr("value", fmt.Sprintf("%v", n.value))
+	to.EndAttrs()
+}
+
+func (n *number) Resolve(r driverbottom.Resolver) driverbottom.BindingRequirement {
+	return driverbottom.MAY_BE_BOUND
+}
+
+func (n *number) Eval(s driverbottom.RuntimeStorage) any {
+	return n.value
+}
+
+func (n *number) String() string {
+	return fmt.Sprintf("%v", n.value)
+}
+
+var _ driverbottom.Expr = &number{}
@@ -0,0 +1,70 @@
+package awstest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ziniki.org/deployer/coremod/pkg/corebottom"
+	"ziniki.org/deployer/coremod/pkg/coretop"
+	"ziniki.org/deployer/driver/pkg/driverbottom"
+	"ziniki.org/deployer/driver/pkg/drivertop"
+	"ziniki.org/deployer/driver/pkg/errorsink"
+	"ziniki.org/deployer/modules/aws/internal/gatewayV2"
+	"ziniki.org/deployer/modules/aws/internal/iam"
+	"ziniki.org/deployer/modules/aws/internal/lambda"
+	"ziniki.org/deployer/modules/aws/internal/plan"
+	"ziniki.org/deployer/modules/aws/pkg/awstest"
+)
+
+func TestAnApiOnAFunctionCanBePlannedFromNothing(t *testing.T) {
+	h := awstest.New(t)
+	p := h.PlanOnly()
+	loc := &errorsink.Location{}
+	assume := coretop.NewPolicyActionList(loc)
+	principal := coretop.NewPolicyPrincipalAction(h.Tools(), loc, drivertop.MakeString(loc, "Service"), drivertop.MakeString(loc, "lambda.amazonaws.com"))
+	assume.Add(coretop.NewPolicyAllowAction(h.Tools(), loc, []driverbottom.Expr{drivertop.MakeString(loc, "sts:AssumeRole")}, nil, []corebottom.UpdatePolicyAllowAction{principal}))
+	code := t.TempDir()
+	if err := os.WriteFile(filepath.Join(code, "bootstrap"), []byte("handler"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	role := h.Coin("role")
+	fn := h.Coin("fn")
+	api := h.Coin("api")
+	intg := h.Coin("intg")
+	route := h.Coin("route")
+	h.Ensure(&iam.RoleBlank{}, role, "runner", h.Props(map[string]any{"Assume": assume}))
+	h.Ensure(&lambda.FunctionBlank{}, fn, "handler", h.Props(map[string]any{"Runtime": "go", "Code": code, "Role": h.Get(role, "arn")}))
+	h.Ensure(&gatewayV2.ApiBlank{}, api, "orders", h.Props(map[string]any{"Protocol": "http"}))
+	h.Ensure(&gatewayV2.IntegrationBlank{}, intg, "handler", h.Props(map[string]any{"Api": h.Get(api, "id"), "Region": "us-east-1", "Type": "aws_proxy", "Uri": h.Get(fn, "arn")}))
+	h.Ensure(&gatewayV2.RouteBlank{}, route, "GET /orders", h.Props(map[string]any{"Api": h.Get(api, "id"), "Target": "handler"}))
+
+	for _, call := range h.Calls() {
+		op := call[strings.Index(call, ".")+1:]
+		if !strings.HasPrefix(op, "Get") && !strings.HasPrefix(op, "List") {
+			t.Fatalf("planning made a call that is not read only: %s", call)
+		}
+	}
+	want := map[string]string{
+		"aws.IAM.Role":                 "",
+		"aws.Lambda.Function":          plan.Placeholder("aws.IAM.Role", "runner"),
+		"aws.ApiGatewayV2.Api":         "",
+		"aws.ApiGatewayV2.Integration": plan.Placeholder("aws.ApiGatewayV2.Api", "orders"),
+		"aws.ApiGatewayV2.Route":       plan.Placeholder("aws.ApiGatewayV2.Api", "orders"),
+	}
+	changes := p.Changes()
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, not %v", len(want), changes)
+	}
+	for _, c := range changes {
+		ref, ok := want[c.Kind]
+		if !ok || c.Action != plan.Create {
+			t.Fatalf("did not expect %v", c)
+		}
+		if ref != "" && !strings.Contains(c.String(), ref) {
+			t.Fatalf("%s did not refer to %s: %v", c.Kind, ref, c)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package cassette records the HTTP traffic between the AWS SDK and AWS into a file,
+// and plays it back later, so that a real deployment can be turned into a test that
+// runs offline and gives the same answers every time.
+//
+// Both the Recorder and the Player are aws.HTTPClients, to be put in the HTTPClient of
+// the aws.Config the clients are built from.  Signatures, credentials and other headers
+// that change from run to run are not recorded, and nor are the bodies of requests, which
+// can hold secrets such as environment variables: only a hash of each is kept.  Secrets in
+// responses (see responseSecrets) are replaced with "REDACTED".
+//
+// The file has a line of JSON for each interaction, which is written as soon as the
+// interaction is over, so a run that is cut short still leaves what it did behind.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// A Cassette is what is stored in the file: the default region of the run that recorded
+// it, and every request it made, in order
+type Cassette struct {
+	Region       string         `json:"region,omitempty"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// An Interaction is one request and the response AWS gave to it
+type Interaction struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+
+	// Operation is given when the URL does not say which operation is wanted: it is the
+	// X-Amz-Target header of the JSON protocols, or the Action of the query protocols
+	Operation string `json:"operation,omitempty"`
+	BodyHash  string `json:"bodyHash,omitempty"`
+
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response []byte      `json:"response,omitempty"`
+}
+
+// the response headers worth keeping; the rest are request ids, dates and the like
+var keepHeaders = []string{"Content-Type", "Etag", "Location", "X-Amzn-Errortype", "X-Amz-Bucket-Region"}
+
+// secrets are removed from XML responses before they are written (e.g. from sts AssumeRole)
+var secrets = regexp.MustCompile(`<(SecretAccessKey|SessionToken)>[^<]*</(SecretAccessKey|SessionToken)>`)
+
+// responseSecrets are the fields of JSON responses whose values are not written, such as
+// the environment variables of a lambda and the presigned URL of its code.  The keys of
+// an object are kept, so that a replay still sees which variables there are.
+var responseSecrets = map[string]bool{"Variables": true, "Location": true, "SecretAccessKey": true, "SessionToken": true}
+
+// line is one line of the file: the region, or an interaction
+type line struct {
+	Region string `json:"region,omitempty"`
+	*Interaction
+}
+
+// Load reads a cassette from a file
+func Load(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ret Cassette
+	lines := bufio.NewScanner(f)
+	// a response can be much longer than the scanner allows by default
+	lines.Buffer(nil, 64*1024*1024)
+	for lines.Scan() {
+		var l line
+		if err := json.Unmarshal(lines.Bytes(), &l); err != nil {
+			return nil, err
+		}
+		if l.Region != "" {
+			ret.Region = l.Region
+		}
+		if l.Interaction != nil {
+			ret.Interactions = append(ret.Interactions, l.Interaction)
+		}
+	}
+	return &ret, lines.Err()
+}
+
+// Save writes the cassette to a file, replacing anything that was there
+func (c *Cassette) Save(path string) error {
+	var buf bytes.Buffer
+	if c.Region != "" {
+		if err := writeLine(&buf, line{Region: c.Region}); err != nil {
+			return err
+		}
+	}
+	for _, i := range c.Interactions {
+		if err := writeLine(&buf, line{Interaction: i}); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func writeLine(w io.Writer, l line) error {
+	bs, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
+
+// redact takes the secrets out of the body of a response
+func redact(body []byte) []byte {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if dec.Decode(&doc) != nil {
+		return secrets.ReplaceAll(body, []byte("<$1>REDACTED</$2>"))
+	}
+	bs, err := json.Marshal(redactFields(doc))
+	if err != nil {
+		return body
+	}
+	return bs
+}
+
+func redactFields(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if responseSecrets[k] {
+				v[k] = redactValue(e)
+			} else {
+				v[k] = redactFields(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactFields(e)
+		}
+	}
+	return v
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = redactValue(e)
+		}
+		return v
+	case nil:
+		return nil
+	}
+	return "REDACTED"
+}
+
+// key is what requests are matched on: which operation they are for and on what,
+// but not the details in the body
+func (i *Interaction) key() string {
+	return i.Method + " " + i.URL + " " + i.Operation
+}
+
+// capture reads the body of req, leaving it in place to be read again, and describes the request
+func capture(req *http.Request) (*Interaction, error) {
+	ret := &Interaction{Method: req.Method, URL: canonicalURL(req.URL), Operation: req.Header.Get("X-Amz-Target")}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(body)
+		ret.BodyHash = hex.EncodeToString(sum[:])
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if ret.Operation == "" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			if form, err := url.ParseQuery(string(body)); err == nil {
+				ret.Operation = form.Get("Action")
+			}
+		}
+	}
+	return ret, nil
+}
+
+// canonicalURL puts the query parameters in a fixed order
+func canonicalURL(u *url.URL) string {
+	c := *u
+	c.RawQuery = c.Query().Encode()
+	c.Fragment = ""
+	return c.String()
+}
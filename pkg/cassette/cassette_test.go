@@ -0,0 +1,155 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"ziniki.org/deployer/modules/aws/pkg/cassette"
+)
+
+// iamServer knows about one role, "known"
+func iamServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "text/xml")
+		if r.Form.Get("Action") != "GetRole" || r.Form.Get("RoleName") != "known" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>NoSuchEntity</Code><Message>The role cannot be found.</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<GetRoleResponse><GetRoleResult><Role><RoleName>known</RoleName><Path>/</Path><RoleId>AROAKNOWN</RoleId>` +
+			`<Arn>arn:aws:iam::123456789012:role/known</Arn><CreateDate>2025-01-01T00:00:00Z</CreateDate></Role></GetRoleResult></GetRoleResponse>`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func iamClient(endpoint string, client aws.HTTPClient) *iam.Client {
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test", "secret", ""),
+		HTTPClient:  client,
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	}
+	return iam.NewFromConfig(cfg, func(o *iam.Options) { o.BaseEndpoint = aws.String(endpoint) })
+}
+
+func getRoles(client *iam.Client) (string, error) {
+	r, err := client.GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String("known")})
+	if err != nil {
+		return "", err
+	}
+	_, err = client.GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String("unknown")})
+	return *r.Role.Arn, err
+}
+
+func TestReplayGivesTheRecordedAnswers(t *testing.T) {
+	srv := iamServer(t)
+	path := filepath.Join(t.TempDir(), "iam.json")
+	rec, err := cassette.NewRecorder(path)
+	if err != nil {
+		t.Fatalf("could not create recorder: %v", err)
+	}
+	rec.SetRegion("us-east-1")
+	if _, err := getRoles(iamClient(srv.URL, rec.Client(nil))); err == nil {
+		t.Fatalf("recording did not see the missing role")
+	}
+	srv.Close()
+	if c, err := cassette.Load(path); err != nil || len(c.Interactions) != 2 {
+		t.Fatalf("cassette did not have the interactions before it was closed: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("could not close recorder: %v", err)
+	}
+
+	bs, _ := os.ReadFile(path)
+	if strings.Contains(string(bs), "secret") || strings.Contains(string(bs), "Authorization") {
+		t.Fatalf("cassette contains credentials: %s", bs)
+	}
+	if strings.Contains(string(bs), "RoleName=") {
+		t.Fatalf("cassette contains request bodies: %s", bs)
+	}
+
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("could not load cassette: %v", err)
+	}
+	player := cassette.NewPlayer(c)
+	arn, err := getRoles(iamClient(srv.URL, player))
+	if arn != "arn:aws:iam::123456789012:role/known" {
+		t.Fatalf("replayed arn was %s", arn)
+	}
+	var nse *types.NoSuchEntityException
+	if !errors.As(err, &nse) {
+		t.Fatalf("replayed error was %v", err)
+	}
+	if player.Region() != "us-east-1" || player.Unplayed() != 0 {
+		t.Fatalf("player had region %s and %d unplayed", player.Region(), player.Unplayed())
+	}
+}
+
+func TestSecretsInResponsesAreNotRecorded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Configuration":{"FunctionName":"fn","Environment":{"Variables":{"DB_PASSWORD":"hunter2"}}},` +
+			`"Code":{"RepositoryType":"S3","Location":"https://code.s3.amazonaws.com/fn?X-Amz-Signature=abc"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	path := filepath.Join(t.TempDir(), "lambda.json")
+	rec, err := cassette.NewRecorder(path)
+	if err != nil {
+		t.Fatalf("could not create recorder: %v", err)
+	}
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test", "secret", ""),
+		HTTPClient:  rec.Client(nil),
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	}
+	client := lambda.NewFromConfig(cfg, func(o *lambda.Options) { o.BaseEndpoint = aws.String(srv.URL) })
+	if _, err := client.GetFunction(context.Background(), &lambda.GetFunctionInput{FunctionName: aws.String("fn")}); err != nil {
+		t.Fatalf("could not get function: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("could not close recorder: %v", err)
+	}
+
+	bs, _ := os.ReadFile(path)
+	if strings.Contains(string(bs), "hunter2") || strings.Contains(string(bs), "X-Amz-Signature") {
+		t.Fatalf("cassette contains secrets: %s", bs)
+	}
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("could not load cassette: %v", err)
+	}
+	client = lambda.NewFromConfig(cfg, func(o *lambda.Options) {
+		o.BaseEndpoint = aws.String(srv.URL)
+		o.HTTPClient = cassette.NewPlayer(c)
+	})
+	fn, err := client.GetFunction(context.Background(), &lambda.GetFunctionInput{FunctionName: aws.String("fn")})
+	if err != nil {
+		t.Fatalf("could not replay function: %v", err)
+	}
+	if v := fn.Configuration.Environment.Variables["DB_PASSWORD"]; v != "REDACTED" {
+		t.Fatalf("replayed variable was %q", v)
+	}
+}
+
+func TestReplayFailsForSomethingNotRecorded(t *testing.T) {
+	player := cassette.NewPlayer(&cassette.Cassette{})
+	_, err := getRoles(iamClient("https://iam.amazonaws.com", player))
+	if err == nil || !strings.Contains(err.Error(), "cassette has no recording") {
+		t.Fatalf("error was %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package cassette
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// A Recorder collects the interactions of all the clients made with Client, and
+// writes each of them to its file as soon as it is over
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	region string
+	err    error // the first error in writing the file
+}
+
+// NewRecorder creates a recorder which writes to path; the file is created straight
+// away, so that an unwritable path is found before anything is sent to AWS
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: f}, nil
+}
+
+// SetRegion records the default region of the run, if it does not already have one
+func (r *Recorder) SetRegion(region string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.region == "" {
+		r.region = region
+		r.write(line{Region: region})
+	}
+}
+
+// Client returns an aws.HTTPClient which sends requests through next (or the SDK's
+// default client, if next is nil) and records them and their responses
+func (r *Recorder) Client(next aws.HTTPClient) aws.HTTPClient {
+	if next == nil {
+		next = awshttp.NewBuildableClient()
+	}
+	return &recording{r: r, next: next}
+}
+
+type recording struct {
+	r    *Recorder
+	next aws.HTTPClient
+}
+
+func (c *recording) Do(req *http.Request) (*http.Response, error) {
+	i, err := capture(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.next.Do(req)
+	if err != nil {
+		// there is no response to play back; the SDK will retry or give up on its own
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	i.Status = resp.StatusCode
+	i.Response = redact(body)
+	for _, h := range keepHeaders {
+		if vs := resp.Header.Values(h); len(vs) > 0 {
+			if i.Header == nil {
+				i.Header = make(http.Header)
+			}
+			i.Header[h] = vs
+		}
+	}
+	c.r.add(i)
+	return resp, nil
+}
+
+func (r *Recorder) add(i *Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write(line{Interaction: i})
+}
+
+// write appends l to the file; only the first error is kept, to be returned by Close,
+// since a failure to record should not stop the run being recorded
+func (r *Recorder) write(l line) {
+	if r.err == nil && r.file != nil {
+		r.err = writeLine(r.file, l)
+	}
+}
+
+// Close closes the file, returning the first error there was in writing it
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	err := r.file.Close()
+	r.file = nil
+	if r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
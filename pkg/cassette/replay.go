@@ -0,0 +1,100 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// A Player answers requests from a cassette without going anywhere near AWS.
+//
+// Requests are matched on their method, URL and operation; among those, recorded
+// interactions are used in the order they were recorded, preferring one whose body
+// is the same as the request's (bodies often contain made-up ids, so an exact match
+// cannot be required).  If a request is made more often than it was recorded, the
+// last response is given again, which copes with polling and refreshing credentials.
+type Player struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	played   []bool
+	last     map[string]*Interaction
+}
+
+// NewPlayer creates a player for a cassette
+func NewPlayer(c *Cassette) *Player {
+	return &Player{cassette: c, played: make([]bool, len(c.Interactions)), last: make(map[string]*Interaction)}
+}
+
+// Region is the default region of the run that was recorded
+func (p *Player) Region() string {
+	return p.cassette.Region
+}
+
+// Unplayed returns how many recorded interactions have not been asked for, which
+// suggests that the replayed run did not do everything the recorded one did
+func (p *Player) Unplayed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ret := 0
+	for _, done := range p.played {
+		if !done {
+			ret++
+		}
+	}
+	return ret
+}
+
+func (p *Player) Do(req *http.Request) (*http.Response, error) {
+	want, err := capture(req)
+	if err != nil {
+		return nil, err
+	}
+	i := p.find(want)
+	if i == nil {
+		return nil, fmt.Errorf("cassette has no recording of %s %s %s", want.Method, want.URL, want.Operation)
+	}
+	header := i.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(i.Response)))
+	return &http.Response{
+		Status:        strconv.Itoa(i.Status) + " " + http.StatusText(i.Status),
+		StatusCode:    i.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(i.Response)),
+		ContentLength: int64(len(i.Response)),
+		Request:       req,
+	}, nil
+}
+
+func (p *Player) find(want *Interaction) *Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := want.key()
+	first := -1
+	for n, i := range p.cassette.Interactions {
+		if p.played[n] || i.key() != key {
+			continue
+		}
+		if i.BodyHash == want.BodyHash {
+			first = n
+			break
+		}
+		if first == -1 {
+			first = n
+		}
+	}
+	if first == -1 {
+		return p.last[key]
+	}
+	p.played[first] = true
+	p.last[key] = p.cassette.Interactions[first]
+	return p.cassette.Interactions[first]
+}
@@ -0,0 +1,104 @@
+package fakeaws
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	"github.com/aws/aws-sdk-go-v2/service/acm/types"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Certificates are issued as soon as all their validation records are in Route53
+type acmFake struct {
+	b     *Backend
+	certs map[string]*certificate
+}
+
+type certificate struct {
+	domain      string
+	sans        []string
+	method      types.ValidationMethod
+	validations []types.DomainValidation
+	issued      *time.Time
+}
+
+func (f *acmFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *acm.ListCertificatesInput:
+		var ret []types.CertificateSummary
+		for _, arn := range sortedKeys(f.certs) {
+			c := f.certs[arn]
+			ret = append(ret, types.CertificateSummary{CertificateArn: aws.String(arn), DomainName: aws.String(c.domain), Status: c.status()})
+		}
+		return &acm.ListCertificatesOutput{CertificateSummaryList: ret}, nil
+	case *acm.RequestCertificateInput:
+		arn := f.b.arn("acm", "certificate/"+f.b.id("cert-"))
+		c := &certificate{domain: *p.DomainName, sans: p.SubjectAlternativeNames, method: p.ValidationMethod}
+		if c.method == "" {
+			c.method = types.ValidationMethodEmail
+		}
+		for _, d := range append([]string{c.domain}, c.sans...) {
+			token := "_" + strings.ToLower(f.b.id("v"))
+			dv := types.DomainValidation{DomainName: aws.String(d), ValidationMethod: c.method, ValidationStatus: types.DomainStatusPendingValidation}
+			if c.method == types.ValidationMethodDns {
+				dv.ResourceRecord = &types.ResourceRecord{Name: aws.String(token + "." + strings.TrimPrefix(d, "*.") + "."), Type: types.RecordTypeCname, Value: aws.String(token + ".acm-validations.aws.")}
+			}
+			c.validations = append(c.validations, dv)
+		}
+		f.certs[arn] = c
+		return &acm.RequestCertificateOutput{CertificateArn: aws.String(arn)}, nil
+	case *acm.DescribeCertificateInput:
+		c, err := f.find(*p.CertificateArn)
+		if err != nil {
+			return nil, err
+		}
+		f.validate(c)
+		detail := &types.CertificateDetail{CertificateArn: p.CertificateArn, DomainName: aws.String(c.domain), SubjectAlternativeNames: append([]string{c.domain}, c.sans...), Status: c.status(), DomainValidationOptions: c.validations}
+		if c.issued != nil {
+			detail.IssuedAt = c.issued
+			detail.NotBefore = c.issued
+			detail.NotAfter = aws.Time(c.issued.AddDate(1, 0, 0))
+		}
+		return &acm.DescribeCertificateOutput{Certificate: detail}, nil
+	case *acm.DeleteCertificateInput:
+		if _, err := f.find(*p.CertificateArn); err != nil {
+			return nil, err
+		}
+		delete(f.certs, *p.CertificateArn)
+		return &acm.DeleteCertificateOutput{}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *acmFake) find(arn string) (*certificate, error) {
+	c, ok := f.certs[arn]
+	if !ok {
+		return nil, failure(400, &types.ResourceNotFoundException{Message: aws.String("Could not find certificate " + arn + ".")})
+	}
+	return c, nil
+}
+
+// validate issues the certificate if all the records it asked for are now in place
+func (f *acmFake) validate(c *certificate) {
+	if c.issued != nil || c.method != types.ValidationMethodDns {
+		return
+	}
+	for _, v := range c.validations {
+		if !f.b.route53.hasRecord(*v.ResourceRecord.Name, r53types.RRTypeCname, *v.ResourceRecord.Value) {
+			return
+		}
+	}
+	for i := range c.validations {
+		c.validations[i].ValidationStatus = types.DomainStatusSuccess
+	}
+	c.issued = aws.Time(time.Now())
+}
+
+func (c *certificate) status() types.CertificateStatus {
+	if c.issued != nil {
+		return types.CertificateStatusIssued
+	}
+	return types.CertificateStatusPendingValidation
+}
@@ -0,0 +1,293 @@
+package fakeaws
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewayv2/types"
+)
+
+// Everything in API Gateway is listed on a single page, and deployments and vpc links
+// are ready straight away
+type apiGatewayFake struct {
+	b        *Backend
+	apis     map[string]*api
+	vpcLinks map[string]*vpcLink
+}
+
+type api struct {
+	api          types.Api
+	integrations map[string]types.Integration
+	routes       map[string]types.Route
+	stages       map[string]types.Stage
+	deployments  map[string]types.Deployment
+}
+
+type vpcLink struct {
+	link types.VpcLink
+}
+
+func (f *apiGatewayFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *apigatewayv2.GetApisInput:
+		var items []types.Api
+		for _, id := range sortedKeys(f.apis) {
+			items = append(items, f.apis[id].api)
+		}
+		return &apigatewayv2.GetApisOutput{Items: items}, nil
+	case *apigatewayv2.CreateApiInput:
+		id := strings.ToLower(f.b.id("api"))
+		a := &api{integrations: make(map[string]types.Integration), routes: make(map[string]types.Route), stages: make(map[string]types.Stage), deployments: make(map[string]types.Deployment)}
+		a.api = types.Api{
+			ApiId:                    aws.String(id),
+			Name:                     p.Name,
+			ProtocolType:             p.ProtocolType,
+			ApiEndpoint:              aws.String("https://" + id + ".execute-api." + Region + ".amazonaws.com"),
+			RouteSelectionExpression: p.RouteSelectionExpression,
+			IpAddressType:            p.IpAddressType,
+			CreatedDate:              aws.Time(time.Now()),
+		}
+		if a.api.RouteSelectionExpression == nil {
+			a.api.RouteSelectionExpression = aws.String("$request.method $request.path")
+		}
+		f.apis[id] = a
+		return &apigatewayv2.CreateApiOutput{ApiId: a.api.ApiId, Name: a.api.Name, ApiEndpoint: a.api.ApiEndpoint, ProtocolType: a.api.ProtocolType, RouteSelectionExpression: a.api.RouteSelectionExpression, IpAddressType: a.api.IpAddressType}, nil
+	case *apigatewayv2.UpdateApiInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if p.RouteSelectionExpression != nil {
+			a.api.RouteSelectionExpression = p.RouteSelectionExpression
+		}
+		if p.IpAddressType != "" {
+			a.api.IpAddressType = p.IpAddressType
+		}
+		if p.Name != nil {
+			a.api.Name = p.Name
+		}
+		return &apigatewayv2.UpdateApiOutput{ApiId: a.api.ApiId, Name: a.api.Name, ApiEndpoint: a.api.ApiEndpoint, ProtocolType: a.api.ProtocolType, RouteSelectionExpression: a.api.RouteSelectionExpression, IpAddressType: a.api.IpAddressType}, nil
+	case *apigatewayv2.DeleteApiInput:
+		if _, err := f.findApi(*p.ApiId); err != nil {
+			return nil, err
+		}
+		delete(f.apis, *p.ApiId)
+		return &apigatewayv2.DeleteApiOutput{}, nil
+
+	case *apigatewayv2.GetIntegrationsInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		var items []types.Integration
+		for _, id := range sortedKeys(a.integrations) {
+			items = append(items, a.integrations[id])
+		}
+		return &apigatewayv2.GetIntegrationsOutput{Items: items}, nil
+	case *apigatewayv2.CreateIntegrationInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		i := types.Integration{IntegrationId: aws.String(strings.ToLower(f.b.id("intg"))), Description: p.Description, IntegrationType: p.IntegrationType, IntegrationUri: p.IntegrationUri, PayloadFormatVersion: p.PayloadFormatVersion, ConnectionType: p.ConnectionType, ConnectionId: p.ConnectionId}
+		a.integrations[*i.IntegrationId] = i
+		return &apigatewayv2.CreateIntegrationOutput{IntegrationId: i.IntegrationId, Description: i.Description, IntegrationType: i.IntegrationType, IntegrationUri: i.IntegrationUri, PayloadFormatVersion: i.PayloadFormatVersion, ConnectionType: i.ConnectionType, ConnectionId: i.ConnectionId}, nil
+	case *apigatewayv2.UpdateIntegrationInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := a.integrations[*p.IntegrationId]
+		if !ok {
+			return nil, notFound("Integration", *p.IntegrationId)
+		}
+		if p.Description != nil {
+			i.Description = p.Description
+		}
+		if p.IntegrationType != "" {
+			i.IntegrationType = p.IntegrationType
+		}
+		if p.IntegrationUri != nil {
+			i.IntegrationUri = p.IntegrationUri
+		}
+		if p.PayloadFormatVersion != nil {
+			i.PayloadFormatVersion = p.PayloadFormatVersion
+		}
+		a.integrations[*p.IntegrationId] = i
+		return &apigatewayv2.UpdateIntegrationOutput{IntegrationId: i.IntegrationId, Description: i.Description, IntegrationType: i.IntegrationType, IntegrationUri: i.IntegrationUri, PayloadFormatVersion: i.PayloadFormatVersion, ConnectionType: i.ConnectionType, ConnectionId: i.ConnectionId}, nil
+	case *apigatewayv2.DeleteIntegrationInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.integrations[*p.IntegrationId]; !ok {
+			return nil, notFound("Integration", *p.IntegrationId)
+		}
+		delete(a.integrations, *p.IntegrationId)
+		return &apigatewayv2.DeleteIntegrationOutput{}, nil
+
+	case *apigatewayv2.GetRoutesInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		var items []types.Route
+		for _, id := range sortedKeys(a.routes) {
+			items = append(items, a.routes[id])
+		}
+		return &apigatewayv2.GetRoutesOutput{Items: items}, nil
+	case *apigatewayv2.CreateRouteInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range a.routes {
+			if *r.RouteKey == *p.RouteKey {
+				return nil, failure(409, &types.ConflictException{Message: aws.String("Route with key " + *p.RouteKey + " already exists for this API")})
+			}
+		}
+		r := types.Route{RouteId: aws.String(strings.ToLower(f.b.id("rt"))), RouteKey: p.RouteKey, Target: p.Target}
+		a.routes[*r.RouteId] = r
+		return &apigatewayv2.CreateRouteOutput{RouteId: r.RouteId, RouteKey: r.RouteKey, Target: r.Target}, nil
+	case *apigatewayv2.DeleteRouteInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.routes[*p.RouteId]; !ok {
+			return nil, notFound("Route", *p.RouteId)
+		}
+		delete(a.routes, *p.RouteId)
+		return &apigatewayv2.DeleteRouteOutput{}, nil
+
+	case *apigatewayv2.GetStageInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := a.stages[*p.StageName]
+		if !ok {
+			return nil, notFound("Stage", *p.StageName)
+		}
+		return &apigatewayv2.GetStageOutput{StageName: s.StageName, DeploymentId: s.DeploymentId, Description: s.Description}, nil
+	case *apigatewayv2.CreateStageInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.stages[*p.StageName]; ok {
+			return nil, failure(409, &types.ConflictException{Message: aws.String("Stage already exists")})
+		}
+		a.stages[*p.StageName] = types.Stage{StageName: p.StageName, DeploymentId: p.DeploymentId, Description: p.Description}
+		return &apigatewayv2.CreateStageOutput{StageName: p.StageName, DeploymentId: p.DeploymentId, Description: p.Description}, nil
+	case *apigatewayv2.UpdateStageInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := a.stages[*p.StageName]
+		if !ok {
+			return nil, notFound("Stage", *p.StageName)
+		}
+		if p.Description != nil {
+			s.Description = p.Description
+		}
+		if p.DeploymentId != nil {
+			s.DeploymentId = p.DeploymentId
+		}
+		a.stages[*p.StageName] = s
+		return &apigatewayv2.UpdateStageOutput{StageName: s.StageName, DeploymentId: s.DeploymentId, Description: s.Description}, nil
+	case *apigatewayv2.DeleteStageInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := a.stages[*p.StageName]; !ok {
+			return nil, notFound("Stage", *p.StageName)
+		}
+		delete(a.stages, *p.StageName)
+		return &apigatewayv2.DeleteStageOutput{}, nil
+
+	case *apigatewayv2.CreateDeploymentInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		d := types.Deployment{DeploymentId: aws.String(strings.ToLower(f.b.id("dep"))), DeploymentStatus: types.DeploymentStatusDeployed, Description: p.Description, CreatedDate: aws.Time(time.Now())}
+		a.deployments[*d.DeploymentId] = d
+		if p.StageName != nil {
+			s, ok := a.stages[*p.StageName]
+			if !ok {
+				return nil, notFound("Stage", *p.StageName)
+			}
+			s.DeploymentId = d.DeploymentId
+			a.stages[*p.StageName] = s
+		}
+		return &apigatewayv2.CreateDeploymentOutput{DeploymentId: d.DeploymentId, DeploymentStatus: d.DeploymentStatus, Description: d.Description, CreatedDate: d.CreatedDate}, nil
+	case *apigatewayv2.GetDeploymentInput:
+		a, err := f.findApi(*p.ApiId)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := a.deployments[*p.DeploymentId]
+		if !ok {
+			return nil, notFound("Deployment", *p.DeploymentId)
+		}
+		return &apigatewayv2.GetDeploymentOutput{DeploymentId: d.DeploymentId, DeploymentStatus: d.DeploymentStatus, Description: d.Description, CreatedDate: d.CreatedDate}, nil
+
+	case *apigatewayv2.GetVpcLinksInput:
+		var items []types.VpcLink
+		for _, id := range sortedKeys(f.vpcLinks) {
+			items = append(items, f.vpcLinks[id].link)
+		}
+		return &apigatewayv2.GetVpcLinksOutput{Items: items}, nil
+	case *apigatewayv2.CreateVpcLinkInput:
+		id := strings.ToLower(f.b.id("vl"))
+		l := &vpcLink{link: types.VpcLink{VpcLinkId: aws.String(id), Name: p.Name, SubnetIds: p.SubnetIds, SecurityGroupIds: p.SecurityGroupIds, VpcLinkStatus: types.VpcLinkStatusAvailable, CreatedDate: aws.Time(time.Now())}}
+		f.vpcLinks[id] = l
+		return &apigatewayv2.CreateVpcLinkOutput{VpcLinkId: l.link.VpcLinkId, Name: l.link.Name, SubnetIds: l.link.SubnetIds, SecurityGroupIds: l.link.SecurityGroupIds, VpcLinkStatus: l.link.VpcLinkStatus}, nil
+	case *apigatewayv2.GetVpcLinkInput:
+		l, ok := f.vpcLinks[*p.VpcLinkId]
+		if !ok {
+			return nil, notFound("VpcLink", *p.VpcLinkId)
+		}
+		return &apigatewayv2.GetVpcLinkOutput{VpcLinkId: l.link.VpcLinkId, Name: l.link.Name, SubnetIds: l.link.SubnetIds, SecurityGroupIds: l.link.SecurityGroupIds, VpcLinkStatus: l.link.VpcLinkStatus}, nil
+	case *apigatewayv2.DeleteVpcLinkInput:
+		if _, ok := f.vpcLinks[*p.VpcLinkId]; !ok {
+			return nil, notFound("VpcLink", *p.VpcLinkId)
+		}
+		delete(f.vpcLinks, *p.VpcLinkId)
+		return &apigatewayv2.DeleteVpcLinkOutput{}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *apiGatewayFake) findApi(id string) (*api, error) {
+	a, ok := f.apis[id]
+	if !ok {
+		return nil, notFound("Api", id)
+	}
+	return a, nil
+}
+
+func notFound(what, id string) error {
+	return failure(404, &types.NotFoundException{Message: aws.String("Invalid " + what + " identifier specified " + id), ResourceType: aws.String(what)})
+}
+
+// Api returns the id of the api with the given name, along with the route keys it has
+func (b *Backend) Api(name string) (string, []string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, a := range b.apis.apis {
+		if aws.ToString(a.api.Name) == name {
+			var keys []string
+			for _, r := range a.routes {
+				keys = append(keys, *r.RouteKey)
+			}
+			return id, keys, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,159 @@
+// Package fakeaws is an in-memory stand-in for the AWS services that the module uses,
+// so that blanks can be created, updated and torn down without an AWS account.
+//
+// It sits inside the SDK clients as middleware, answering each operation before it
+// is turned into an HTTP request; errors come back in the same shape as the real
+// services use, so the checks the module makes (e.g. for 404s) behave as they would
+// against AWS.  Anything the module does not use is reported as unimplemented.
+package fakeaws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Account is the account id that appears in all the ARNs the fake makes up
+const Account = "123456789012"
+
+// Region is the region in the configuration returned by Config
+const Region = "us-east-1"
+
+var errNotHandled = errors.New("not handled")
+
+// a service looks at the parameters of each call and answers the ones it recognises,
+// returning errNotHandled for the rest
+type service interface {
+	handle(params any) (any, error)
+}
+
+// Backend holds the state of all the fake services; it is safe to use from several goroutines.
+type Backend struct {
+	mu       sync.Mutex
+	calls    []string
+	failing  map[string]int
+	nextId   int
+	services []service
+
+	acm     *acmFake
+	apis    *apiGatewayFake
+	cfront  *cloudFrontFake
+	dsql    *dsqlFake
+	dynamo  *dynamoFake
+	ec2     *ec2Fake
+	iam     *iamFake
+	lambda  *lambdaFake
+	neptune *neptuneFake
+	route53 *route53Fake
+	s3      *s3Fake
+	sts     *stsFake
+}
+
+// New creates an empty backend, with nothing but the managed policies AWS provides
+func New() *Backend {
+	b := &Backend{}
+	b.acm = &acmFake{b: b, certs: make(map[string]*certificate)}
+	b.apis = &apiGatewayFake{b: b, apis: make(map[string]*api), vpcLinks: make(map[string]*vpcLink)}
+	b.cfront = &cloudFrontFake{b: b, distributions: make(map[string]*distribution), cachePolicies: make(map[string]*cachePolicy), oacs: make(map[string]*oac), rhps: make(map[string]*rhp)}
+	b.dsql = &dsqlFake{b: b, clusters: make(map[string]*dsqlCluster)}
+	b.dynamo = &dynamoFake{b: b, tables: make(map[string]*table)}
+	b.ec2 = &ec2Fake{b: b}
+	b.iam = &iamFake{b: b, roles: make(map[string]*role), policies: make(map[string]*managedPolicy), users: make(map[string]*user)}
+	for _, n := range awsManagedPolicies {
+		b.iam.addPolicy(n, "arn:aws:iam::aws:policy/service-role/"+n)
+	}
+	b.lambda = &lambdaFake{b: b, functions: make(map[string]*function), layers: make(map[string]*layer), mappings: make(map[string]*mapping)}
+	b.neptune = &neptuneFake{b: b, clusters: make(map[string]*neptuneCluster), instances: make(map[string]*neptuneInstance), subnetGroups: make(map[string]*subnetGroup)}
+	b.route53 = &route53Fake{b: b, zones: make(map[string]*hostedZone), domains: make(map[string]bool)}
+	b.s3 = &s3Fake{b: b, buckets: make(map[string]*bucket), uploads: make(map[string]*multipartUpload)}
+	b.sts = &stsFake{b: b}
+	b.services = []service{b.acm, b.apis, b.cfront, b.dsql, b.dynamo, b.ec2, b.iam, b.lambda, b.neptune, b.route53, b.s3, b.sts}
+	return b
+}
+
+// Config returns a configuration which sends every call made by clients built from it
+// to this backend.
+func (b *Backend) Config() aws.Config {
+	return aws.Config{
+		Region:      Region,
+		Credentials: credentials.NewStaticCredentialsProvider("fake", "fake", ""),
+		APIOptions:  []func(*middleware.Stack) error{b.install},
+	}
+}
+
+// Calls returns the operations that have been made so far, in order, as "Service.Operation"
+func (b *Backend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+// Fail makes the next times calls to operation (as "Service.Operation") fail as if
+// the service had had an internal error
+func (b *Backend) Fail(operation string, times int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failing == nil {
+		b.failing = make(map[string]int)
+	}
+	b.failing[operation] += times
+}
+
+func (b *Backend) install(stack *middleware.Stack) error {
+	// after everything else in initialize, so that the SDK's own validation still happens
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("fakeaws", b.serve), middleware.After)
+}
+
+func (b *Backend) serve(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	op := middleware.GetServiceID(ctx) + "." + middleware.GetOperationName(ctx)
+	b.calls = append(b.calls, op)
+	if b.failing[op] > 0 {
+		b.failing[op]--
+		return middleware.InitializeOutput{}, middleware.Metadata{}, failure(500, &smithy.GenericAPIError{Code: "InternalError", Message: "we encountered an internal error"})
+	}
+	for _, s := range b.services {
+		out, err := s.handle(in.Parameters)
+		if err == errNotHandled {
+			continue
+		}
+		if err != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, err
+		}
+		return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+	}
+	return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("fakeaws does not implement %T", in.Parameters)
+}
+
+// id makes up a new identifier with the given prefix; it is unique within the backend
+func (b *Backend) id(prefix string) string {
+	b.nextId++
+	return fmt.Sprintf("%s%08d", prefix, b.nextId)
+}
+
+func (b *Backend) arn(service, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, Region, Account, resource)
+}
+
+// failure wraps err the way the SDK does when a service answers with the given status code
+func failure(status int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: http.Header{}}},
+			Err:      err,
+		},
+	}
+}
@@ -0,0 +1,257 @@
+package fakeaws_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamotypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"ziniki.org/deployer/modules/aws/internal/env"
+	"ziniki.org/deployer/modules/aws/pkg/fakeaws"
+)
+
+func statusOf(t *testing.T, err error) int {
+	var re *awshttp.ResponseError
+	if !errors.As(err, &re) {
+		t.Fatalf("error was not a response error: %v", err)
+	}
+	return re.HTTPStatusCode()
+}
+
+func TestMissingFunctionIsA404(t *testing.T) {
+	client := lambda.NewFromConfig(fakeaws.New().Config())
+	_, err := client.GetFunction(context.Background(), &lambda.GetFunctionInput{FunctionName: aws.String("nothing")})
+	if _, ok := err.(*smithy.OperationError); !ok {
+		t.Fatalf("error was not an operation error: %v", err)
+	}
+	if statusOf(t, err) != 404 {
+		t.Fatalf("expected a 404, not %v", err)
+	}
+	var rnf *lambdatypes.ResourceNotFoundException
+	if !errors.As(err, &rnf) {
+		t.Fatalf("expected ResourceNotFound, not %v", err)
+	}
+}
+
+func TestFunctionNeedsARole(t *testing.T) {
+	fake := fakeaws.New()
+	ctx := context.Background()
+	fns := lambda.NewFromConfig(fake.Config())
+	create := &lambda.CreateFunctionInput{FunctionName: aws.String("fn"), Role: aws.String("arn:aws:iam::123456789012:role/runner"), Code: &lambdatypes.FunctionCode{S3Bucket: aws.String("b"), S3Key: aws.String("k")}}
+
+	_, err := fns.CreateFunction(ctx, create)
+	var ipv *lambdatypes.InvalidParameterValueException
+	if !errors.As(err, &ipv) || statusOf(t, err) != 400 {
+		t.Fatalf("expected the role to be invalid, not %v", err)
+	}
+
+	_, err = iam.NewFromConfig(fake.Config()).CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("runner"), AssumeRolePolicyDocument: aws.String("{}")})
+	if err != nil {
+		t.Fatalf("create role failed: %v", err)
+	}
+	out, err := fns.CreateFunction(ctx, create)
+	if err != nil {
+		t.Fatalf("create function failed: %v", err)
+	}
+	if *out.FunctionArn != "arn:aws:lambda:us-east-1:123456789012:function:fn" {
+		t.Fatalf("arn was %s", *out.FunctionArn)
+	}
+	if !fake.HasFunction("fn") {
+		t.Fatalf("function was not created")
+	}
+}
+
+func TestFunctionCodeIsHashed(t *testing.T) {
+	fake := fakeaws.New()
+	ctx := context.Background()
+	_, err := iam.NewFromConfig(fake.Config()).CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("runner"), AssumeRolePolicyDocument: aws.String("{}")})
+	if err != nil {
+		t.Fatalf("create role failed: %v", err)
+	}
+	fns := lambda.NewFromConfig(fake.Config())
+	zipped := []byte("not really a zip")
+	_, err = fns.CreateFunction(ctx, &lambda.CreateFunctionInput{FunctionName: aws.String("fn"), Role: aws.String("arn:aws:iam::123456789012:role/runner"), Code: &lambdatypes.FunctionCode{ZipFile: zipped}})
+	if err != nil {
+		t.Fatalf("create function failed: %v", err)
+	}
+	got, err := fns.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String("fn")})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	sum := sha256.Sum256(zipped)
+	if *got.Configuration.CodeSha256 != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("hash was %s", *got.Configuration.CodeSha256)
+	}
+}
+
+func TestLayerVersionsAreListedLatestFirst(t *testing.T) {
+	fns := lambda.NewFromConfig(fakeaws.New().Config())
+	ctx := context.Background()
+	for _, code := range []string{"v1", "v2"} {
+		_, err := fns.PublishLayerVersion(ctx, &lambda.PublishLayerVersionInput{LayerName: aws.String("deps"), Content: &lambdatypes.LayerVersionContentInput{ZipFile: []byte(code)}})
+		if err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+	list, err := fns.ListLayerVersions(ctx, &lambda.ListLayerVersionsInput{LayerName: aws.String("deps"), MaxItems: aws.Int32(1)})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list.LayerVersions) != 1 || *list.LayerVersions[0].LayerVersionArn != "arn:aws:lambda:us-east-1:123456789012:layer:deps:2" {
+		t.Fatalf("versions were %+v", list.LayerVersions)
+	}
+
+	_, err = fns.DeleteLayerVersion(ctx, &lambda.DeleteLayerVersionInput{LayerName: aws.String("deps"), VersionNumber: aws.Int64(2)})
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	got, err := fns.GetLayerVersion(ctx, &lambda.GetLayerVersionInput{LayerName: aws.String("deps"), VersionNumber: aws.Int64(1)})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte("v1"))
+	if *got.Content.CodeSha256 != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("hash was %s", *got.Content.CodeSha256)
+	}
+	_, err = fns.GetLayerVersion(ctx, &lambda.GetLayerVersionInput{LayerName: aws.String("deps"), VersionNumber: aws.Int64(2)})
+	if statusOf(t, err) != 404 {
+		t.Fatalf("expected a 404, not %v", err)
+	}
+}
+
+func TestTableStreamCanBeMapped(t *testing.T) {
+	fake := fakeaws.New()
+	ctx := context.Background()
+	_, err := iam.NewFromConfig(fake.Config()).CreateRole(ctx, &iam.CreateRoleInput{RoleName: aws.String("runner"), AssumeRolePolicyDocument: aws.String("{}")})
+	if err != nil {
+		t.Fatalf("create role failed: %v", err)
+	}
+	fns := lambda.NewFromConfig(fake.Config())
+	_, err = fns.CreateFunction(ctx, &lambda.CreateFunctionInput{FunctionName: aws.String("fn"), Role: aws.String("arn:aws:iam::123456789012:role/runner"), Code: &lambdatypes.FunctionCode{ZipFile: []byte("zip")}})
+	if err != nil {
+		t.Fatalf("create function failed: %v", err)
+	}
+	table, err := dynamodb.NewFromConfig(fake.Config()).CreateTable(ctx, &dynamodb.CreateTableInput{TableName: aws.String("users"),
+		AttributeDefinitions: []dynamotypes.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: dynamotypes.ScalarAttributeTypeS}},
+		KeySchema:            []dynamotypes.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: dynamotypes.KeyTypeHash}},
+		StreamSpecification:  &dynamotypes.StreamSpecification{StreamEnabled: aws.Bool(true), StreamViewType: dynamotypes.StreamViewTypeNewAndOldImages}})
+	if err != nil {
+		t.Fatalf("create table failed: %v", err)
+	}
+	stream := table.TableDescription.LatestStreamArn
+	if stream == nil {
+		t.Fatalf("table has no stream")
+	}
+
+	create := &lambda.CreateEventSourceMappingInput{FunctionName: aws.String("fn"), EventSourceArn: stream, StartingPosition: lambdatypes.EventSourcePositionLatest, Enabled: aws.Bool(false)}
+	created, err := fns.CreateEventSourceMapping(ctx, create)
+	if err != nil {
+		t.Fatalf("create mapping failed: %v", err)
+	}
+	_, err = fns.CreateEventSourceMapping(ctx, create)
+	if statusOf(t, err) != 409 {
+		t.Fatalf("expected a conflict, not %v", err)
+	}
+	_, err = fns.UpdateEventSourceMapping(ctx, &lambda.UpdateEventSourceMappingInput{UUID: created.UUID, BatchSize: aws.Int32(50), Enabled: aws.Bool(true)})
+	if err != nil {
+		t.Fatalf("update mapping failed: %v", err)
+	}
+	list, err := fns.ListEventSourceMappings(ctx, &lambda.ListEventSourceMappingsInput{FunctionName: aws.String("fn"), EventSourceArn: stream})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(list.EventSourceMappings) != 1 {
+		t.Fatalf("mappings were %+v", list.EventSourceMappings)
+	}
+	m := list.EventSourceMappings[0]
+	if *m.UUID != *created.UUID || *m.BatchSize != 50 || *m.State != "Enabled" {
+		t.Fatalf("mapping was %+v", m)
+	}
+}
+
+func TestCertificateIsIssuedOnceValidated(t *testing.T) {
+	fake := fakeaws.New()
+	ctx := context.Background()
+	zone := fake.AddDomain("example.com")
+	certs := acm.NewFromConfig(fake.Config())
+
+	req, err := certs.RequestCertificate(ctx, &acm.RequestCertificateInput{DomainName: aws.String("www.example.com"), ValidationMethod: acmtypes.ValidationMethodDns})
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	desc, err := certs.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: req.CertificateArn})
+	if err != nil {
+		t.Fatalf("describe failed: %v", err)
+	}
+	if desc.Certificate.Status != acmtypes.CertificateStatusPendingValidation {
+		t.Fatalf("status was %s", desc.Certificate.Status)
+	}
+
+	rr := desc.Certificate.DomainValidationOptions[0].ResourceRecord
+	rrs := r53types.ResourceRecordSet{Name: rr.Name, Type: r53types.RRTypeCname, TTL: aws.Int64(300), ResourceRecords: []r53types.ResourceRecord{{Value: rr.Value}}}
+	_, err = route53.NewFromConfig(fake.Config()).ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{HostedZoneId: &zone, ChangeBatch: &r53types.ChangeBatch{Changes: []r53types.Change{{Action: r53types.ChangeActionCreate, ResourceRecordSet: &rrs}}}})
+	if err != nil {
+		t.Fatalf("change failed: %v", err)
+	}
+
+	desc, err = certs.DescribeCertificate(ctx, &acm.DescribeCertificateInput{CertificateArn: req.CertificateArn})
+	if err != nil {
+		t.Fatalf("describe failed: %v", err)
+	}
+	if desc.Certificate.Status != acmtypes.CertificateStatusIssued || desc.Certificate.NotAfter == nil {
+		t.Fatalf("status was %s", desc.Certificate.Status)
+	}
+}
+
+func TestEnvClientsUseTheFake(t *testing.T) {
+	fake := fakeaws.New()
+	awsEnv, err := env.InitAwsEnvWith(context.Background(), env.FixedConfig(fake.Config()))
+	if err != nil {
+		t.Fatalf("could not create env: %v", err)
+	}
+	if err := awsEnv.Configure(env.Settings{AssumeRole: "arn:aws:iam::123456789012:role/deployer"}); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+
+	_, err = awsEnv.S3Client().CreateBucket(awsEnv.Context(), &s3.CreateBucketInput{Bucket: aws.String("b")})
+	if err != nil {
+		t.Fatalf("create bucket failed: %v", err)
+	}
+	if !fake.HasBucket("b") {
+		t.Fatalf("bucket was not created")
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0] != "S3.CreateBucket" {
+		t.Fatalf("calls were %v", calls)
+	}
+}
+
+func TestCancelledContextFails(t *testing.T) {
+	fake := fakeaws.New()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+
+	_, err := s3.NewFromConfig(fake.Config()).HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String("b")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to have passed, not %v", err)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("the call should not have reached the fake")
+	}
+}
@@ -0,0 +1,315 @@
+package fakeaws
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// CloudFront changes are deployed as soon as they are made, so nothing is ever InProgress
+type cloudFrontFake struct {
+	b             *Backend
+	distributions map[string]*distribution
+	cachePolicies map[string]*cachePolicy
+	oacs          map[string]*oac
+	rhps          map[string]*rhp
+}
+
+type distribution struct {
+	id            string
+	arn           string
+	domainName    string
+	etag          string
+	config        types.DistributionConfig
+	tags          []types.Tag
+	invalidations int
+}
+
+type cachePolicy struct {
+	etag   string
+	config types.CachePolicyConfig
+}
+
+type oac struct {
+	etag   string
+	config types.OriginAccessControlConfig
+}
+
+type rhp struct {
+	etag   string
+	config types.ResponseHeadersPolicyConfig
+}
+
+func (f *cloudFrontFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *cloudfront.ListDistributionsInput:
+		var items []types.DistributionSummary
+		for _, id := range sortedKeys(f.distributions) {
+			items = append(items, f.distributions[id].summary())
+		}
+		return &cloudfront.ListDistributionsOutput{DistributionList: &types.DistributionList{Items: items, Quantity: aws.Int32(int32(len(items))), IsTruncated: aws.Bool(false)}}, nil
+	case *cloudfront.ListTagsForResourceInput:
+		for _, d := range f.distributions {
+			if d.arn == *p.Resource {
+				return &cloudfront.ListTagsForResourceOutput{Tags: &types.Tags{Items: d.tags}}, nil
+			}
+		}
+		return nil, failure(404, &types.NoSuchResource{Message: aws.String("no resource " + *p.Resource)})
+	case *cloudfront.CreateDistributionWithTagsInput:
+		id := f.b.id("E")
+		d := &distribution{id: id, arn: "arn:aws:cloudfront::" + Account + ":distribution/" + id, domainName: id + ".cloudfront.net", etag: f.b.id("ETAG")}
+		d.config = *p.DistributionConfigWithTags.DistributionConfig
+		if p.DistributionConfigWithTags.Tags != nil {
+			d.tags = p.DistributionConfigWithTags.Tags.Items
+		}
+		f.distributions[id] = d
+		return &cloudfront.CreateDistributionWithTagsOutput{Distribution: d.distribution(), ETag: aws.String(d.etag), Location: aws.String("https://cloudfront.amazonaws.com/2020-05-31/distribution/" + id)}, nil
+	case *cloudfront.GetDistributionInput:
+		d, err := f.findDistribution(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudfront.GetDistributionOutput{Distribution: d.distribution(), ETag: aws.String(d.etag)}, nil
+	case *cloudfront.GetDistributionConfigInput:
+		d, err := f.findDistribution(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		config := d.config
+		return &cloudfront.GetDistributionConfigOutput{DistributionConfig: &config, ETag: aws.String(d.etag)}, nil
+	case *cloudfront.UpdateDistributionInput:
+		d, err := f.findDistribution(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		if err := ifMatch(p.IfMatch, d.etag); err != nil {
+			return nil, err
+		}
+		d.config = *p.DistributionConfig
+		d.etag = f.b.id("ETAG")
+		return &cloudfront.UpdateDistributionOutput{Distribution: d.distribution(), ETag: aws.String(d.etag)}, nil
+	case *cloudfront.DeleteDistributionInput:
+		d, err := f.findDistribution(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		if err := ifMatch(p.IfMatch, d.etag); err != nil {
+			return nil, err
+		}
+		if aws.ToBool(d.config.Enabled) {
+			return nil, failure(409, &types.DistributionNotDisabled{Message: aws.String("The distribution you are trying to delete has not been disabled.")})
+		}
+		delete(f.distributions, *p.Id)
+		return &cloudfront.DeleteDistributionOutput{}, nil
+	case *cloudfront.CreateInvalidationInput:
+		d, err := f.findDistribution(*p.DistributionId)
+		if err != nil {
+			return nil, err
+		}
+		d.invalidations++
+		return &cloudfront.CreateInvalidationOutput{Invalidation: &types.Invalidation{Id: aws.String(f.b.id("I")), Status: aws.String("Completed"), CreateTime: aws.Time(time.Now()), InvalidationBatch: p.InvalidationBatch}}, nil
+
+	case *cloudfront.ListCachePoliciesInput:
+		var items []types.CachePolicySummary
+		for _, id := range sortedKeys(f.cachePolicies) {
+			items = append(items, types.CachePolicySummary{Type: types.CachePolicyTypeCustom, CachePolicy: f.cachePolicies[id].policy(id)})
+		}
+		return &cloudfront.ListCachePoliciesOutput{CachePolicyList: &types.CachePolicyList{Items: items, Quantity: aws.Int32(int32(len(items)))}}, nil
+	case *cloudfront.CreateCachePolicyInput:
+		for _, cp := range f.cachePolicies {
+			if aws.ToString(cp.config.Name) == aws.ToString(p.CachePolicyConfig.Name) {
+				return nil, failure(409, &types.CachePolicyAlreadyExists{Message: aws.String("a cache policy called " + *p.CachePolicyConfig.Name + " already exists")})
+			}
+		}
+		id := f.b.id("cp-")
+		cp := &cachePolicy{etag: f.b.id("ETAG"), config: *p.CachePolicyConfig}
+		f.cachePolicies[id] = cp
+		return &cloudfront.CreateCachePolicyOutput{CachePolicy: cp.policy(id), ETag: aws.String(cp.etag)}, nil
+	case *cloudfront.GetCachePolicyInput:
+		cp, ok := f.cachePolicies[*p.Id]
+		if !ok {
+			return nil, failure(404, &types.NoSuchCachePolicy{Message: aws.String("no cache policy " + *p.Id)})
+		}
+		return &cloudfront.GetCachePolicyOutput{CachePolicy: cp.policy(*p.Id), ETag: aws.String(cp.etag)}, nil
+	case *cloudfront.UpdateCachePolicyInput:
+		cp, ok := f.cachePolicies[*p.Id]
+		if !ok {
+			return nil, failure(404, &types.NoSuchCachePolicy{Message: aws.String("no cache policy " + *p.Id)})
+		}
+		if err := ifMatch(p.IfMatch, cp.etag); err != nil {
+			return nil, err
+		}
+		cp.config = *p.CachePolicyConfig
+		cp.etag = f.b.id("ETAG")
+		return &cloudfront.UpdateCachePolicyOutput{CachePolicy: cp.policy(*p.Id), ETag: aws.String(cp.etag)}, nil
+	case *cloudfront.DeleteCachePolicyInput:
+		cp, ok := f.cachePolicies[*p.Id]
+		if !ok {
+			return nil, failure(404, &types.NoSuchCachePolicy{Message: aws.String("no cache policy " + *p.Id)})
+		}
+		if err := ifMatch(p.IfMatch, cp.etag); err != nil {
+			return nil, err
+		}
+		delete(f.cachePolicies, *p.Id)
+		return &cloudfront.DeleteCachePolicyOutput{}, nil
+
+	case *cloudfront.ListOriginAccessControlsInput:
+		var items []types.OriginAccessControlSummary
+		for _, id := range sortedKeys(f.oacs) {
+			c := f.oacs[id].config
+			items = append(items, types.OriginAccessControlSummary{Id: aws.String(id), Name: c.Name, Description: aws.String(aws.ToString(c.Description)), OriginAccessControlOriginType: c.OriginAccessControlOriginType, SigningBehavior: c.SigningBehavior, SigningProtocol: c.SigningProtocol})
+		}
+		return &cloudfront.ListOriginAccessControlsOutput{OriginAccessControlList: &types.OriginAccessControlList{Items: items, Quantity: aws.Int32(int32(len(items)))}}, nil
+	case *cloudfront.CreateOriginAccessControlInput:
+		id := f.b.id("OAC")
+		o := &oac{etag: f.b.id("ETAG"), config: *p.OriginAccessControlConfig}
+		f.oacs[id] = o
+		return &cloudfront.CreateOriginAccessControlOutput{OriginAccessControl: o.oac(id), ETag: aws.String(o.etag)}, nil
+	case *cloudfront.GetOriginAccessControlInput:
+		o, ok := f.oacs[*p.Id]
+		if !ok {
+			return nil, failure(404, &types.NoSuchOriginAccessControl{Message: aws.String("no origin access control " + *p.Id)})
+		}
+		return &cloudfront.GetOriginAccessControlOutput{OriginAccessControl: o.oac(*p.Id), ETag: aws.String(o.etag)}, nil
+	case *cloudfront.DeleteOriginAccessControlInput:
+		o, ok := f.oacs[*p.Id]
+		if !ok {
+			return nil, failure(404, &types.NoSuchOriginAccessControl{Message: aws.String("no origin access control " + *p.Id)})
+		}
+		if err := ifMatch(p.IfMatch, o.etag); err != nil {
+			return nil, err
+		}
+		delete(f.oacs, *p.Id)
+		return &cloudfront.DeleteOriginAccessControlOutput{}, nil
+
+	case *cloudfront.ListResponseHeadersPoliciesInput:
+		var items []types.ResponseHeadersPolicySummary
+		for _, id := range sortedKeys(f.rhps) {
+			items = append(items, types.ResponseHeadersPolicySummary{Type: types.ResponseHeadersPolicyTypeCustom, ResponseHeadersPolicy: f.rhps[id].policy(id)})
+		}
+		return &cloudfront.ListResponseHeadersPoliciesOutput{ResponseHeadersPolicyList: &types.ResponseHeadersPolicyList{Items: items, Quantity: aws.Int32(int32(len(items)))}}, nil
+	case *cloudfront.CreateResponseHeadersPolicyInput:
+		id := f.b.id("rhp-")
+		r := &rhp{etag: f.b.id("ETAG"), config: *p.ResponseHeadersPolicyConfig}
+		f.rhps[id] = r
+		return &cloudfront.CreateResponseHeadersPolicyOutput{ResponseHeadersPolicy: r.policy(id), ETag: aws.String(r.etag)}, nil
+	case *cloudfront.GetResponseHeadersPolicyInput:
+		r, err := f.findRHP(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudfront.GetResponseHeadersPolicyOutput{ResponseHeadersPolicy: r.policy(*p.Id), ETag: aws.String(r.etag)}, nil
+	case *cloudfront.GetResponseHeadersPolicyConfigInput:
+		r, err := f.findRHP(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		config := r.config
+		return &cloudfront.GetResponseHeadersPolicyConfigOutput{ResponseHeadersPolicyConfig: &config, ETag: aws.String(r.etag)}, nil
+	case *cloudfront.DeleteResponseHeadersPolicyInput:
+		r, err := f.findRHP(*p.Id)
+		if err != nil {
+			return nil, err
+		}
+		if err := ifMatch(p.IfMatch, r.etag); err != nil {
+			return nil, err
+		}
+		delete(f.rhps, *p.Id)
+		return &cloudfront.DeleteResponseHeadersPolicyOutput{}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *cloudFrontFake) findDistribution(id string) (*distribution, error) {
+	d, ok := f.distributions[id]
+	if !ok {
+		return nil, failure(404, &types.NoSuchDistribution{Message: aws.String("The specified distribution does not exist.")})
+	}
+	return d, nil
+}
+
+func (f *cloudFrontFake) findRHP(id string) (*rhp, error) {
+	r, ok := f.rhps[id]
+	if !ok {
+		return nil, failure(404, &types.NoSuchResponseHeadersPolicy{Message: aws.String("no response headers policy " + id)})
+	}
+	return r, nil
+}
+
+// ifMatch checks that the caller has seen the latest version, as CloudFront insists
+func ifMatch(given *string, etag string) error {
+	if aws.ToString(given) != etag {
+		return failure(412, &types.PreconditionFailed{Message: aws.String("The If-Match version is missing or not valid for the resource.")})
+	}
+	return nil
+}
+
+func (d *distribution) distribution() *types.Distribution {
+	config := d.config
+	return &types.Distribution{Id: aws.String(d.id), ARN: aws.String(d.arn), DomainName: aws.String(d.domainName), Status: aws.String("Deployed"), LastModifiedTime: aws.Time(time.Now()), InProgressInvalidationBatches: aws.Int32(0), DistributionConfig: &config}
+}
+
+func (d *distribution) summary() types.DistributionSummary {
+	c := d.config
+	behaviors := c.CacheBehaviors
+	if behaviors == nil {
+		behaviors = &types.CacheBehaviors{Quantity: aws.Int32(0)}
+	}
+	return types.DistributionSummary{
+		Id:                   aws.String(d.id),
+		ARN:                  aws.String(d.arn),
+		DomainName:           aws.String(d.domainName),
+		Status:               aws.String("Deployed"),
+		Enabled:              c.Enabled,
+		Comment:              c.Comment,
+		Aliases:              c.Aliases,
+		Origins:              c.Origins,
+		DefaultCacheBehavior: c.DefaultCacheBehavior,
+		CacheBehaviors:       behaviors,
+		ViewerCertificate:    c.ViewerCertificate,
+		LastModifiedTime:     aws.Time(time.Now()),
+	}
+}
+
+func (cp *cachePolicy) policy(id string) *types.CachePolicy {
+	config := cp.config
+	return &types.CachePolicy{Id: aws.String(id), CachePolicyConfig: &config, LastModifiedTime: aws.Time(time.Now())}
+}
+
+func (o *oac) oac(id string) *types.OriginAccessControl {
+	config := o.config
+	return &types.OriginAccessControl{Id: aws.String(id), OriginAccessControlConfig: &config}
+}
+
+func (r *rhp) policy(id string) *types.ResponseHeadersPolicy {
+	config := r.config
+	return &types.ResponseHeadersPolicy{Id: aws.String(id), ResponseHeadersPolicyConfig: &config, LastModifiedTime: aws.Time(time.Now())}
+}
+
+// Distribution returns the id and configuration of the distribution tagged with the
+// given deployer name
+func (b *Backend) Distribution(name string) (string, *types.DistributionConfig, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, d := range b.cfront.distributions {
+		for _, t := range d.tags {
+			if aws.ToString(t.Key) == "deployer-name" && aws.ToString(t.Value) == name {
+				config := d.config
+				return id, &config, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// Invalidations says how many times a distribution has been invalidated
+func (b *Backend) Invalidations(id string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d, ok := b.cfront.distributions[id]; ok {
+		return d.invalidations
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package fakeaws
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dsql"
+	"github.com/aws/aws-sdk-go-v2/service/dsql/types"
+)
+
+type dsqlFake struct {
+	b        *Backend
+	clusters map[string]*dsqlCluster
+}
+
+type dsqlCluster struct {
+	arn                string
+	deletionProtection bool
+	tags               map[string]string
+	created            time.Time
+}
+
+func (f *dsqlFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *dsql.CreateClusterInput:
+		id := f.b.id("dsql")
+		c := &dsqlCluster{arn: f.b.arn("dsql", "cluster/"+id), deletionProtection: aws.ToBool(p.DeletionProtectionEnabled) || p.DeletionProtectionEnabled == nil, tags: p.Tags, created: time.Now()}
+		f.clusters[id] = c
+		return &dsql.CreateClusterOutput{Identifier: aws.String(id), Arn: aws.String(c.arn), Status: types.ClusterStatusActive, CreationTime: aws.Time(c.created), DeletionProtectionEnabled: aws.Bool(c.deletionProtection)}, nil
+	case *dsql.GetClusterInput:
+		c, err := f.find(*p.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		return &dsql.GetClusterOutput{Identifier: p.Identifier, Arn: aws.String(c.arn), Status: types.ClusterStatusActive, CreationTime: aws.Time(c.created), DeletionProtectionEnabled: aws.Bool(c.deletionProtection), Tags: c.tags}, nil
+	case *dsql.ListClustersInput:
+		var ret []types.ClusterSummary
+		for _, id := range sortedKeys(f.clusters) {
+			ret = append(ret, types.ClusterSummary{Identifier: aws.String(id), Arn: aws.String(f.clusters[id].arn)})
+		}
+		return &dsql.ListClustersOutput{Clusters: ret}, nil
+	case *dsql.ListTagsForResourceInput:
+		for _, c := range f.clusters {
+			if c.arn == *p.ResourceArn {
+				return &dsql.ListTagsForResourceOutput{Tags: c.tags}, nil
+			}
+		}
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("no resource " + *p.ResourceArn)})
+	case *dsql.UpdateClusterInput:
+		c, err := f.find(*p.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		if p.DeletionProtectionEnabled != nil {
+			c.deletionProtection = *p.DeletionProtectionEnabled
+		}
+		return &dsql.UpdateClusterOutput{Identifier: p.Identifier, Arn: aws.String(c.arn), Status: types.ClusterStatusActive, CreationTime: aws.Time(c.created)}, nil
+	case *dsql.DeleteClusterInput:
+		c, err := f.find(*p.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		if c.deletionProtection {
+			return nil, failure(400, &types.ValidationException{Message: aws.String("Cluster has deletion protection enabled")})
+		}
+		delete(f.clusters, *p.Identifier)
+		return &dsql.DeleteClusterOutput{Identifier: p.Identifier, Arn: aws.String(c.arn), Status: types.ClusterStatusDeleting, CreationTime: aws.Time(c.created)}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *dsqlFake) find(id string) (*dsqlCluster, error) {
+	c, ok := f.clusters[id]
+	if !ok {
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("Cluster " + id + " not found")})
+	}
+	return c, nil
+}
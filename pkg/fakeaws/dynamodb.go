@@ -0,0 +1,88 @@
+package fakeaws
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type dynamoFake struct {
+	b      *Backend
+	tables map[string]*table
+}
+
+type table struct {
+	description types.TableDescription
+}
+
+func (f *dynamoFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *dynamodb.DescribeTableInput:
+		t, ok := f.tables[*p.TableName]
+		if !ok {
+			return nil, failure(400, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: Table: " + *p.TableName + " not found")})
+		}
+		desc := t.description
+		return &dynamodb.DescribeTableOutput{Table: &desc}, nil
+	case *dynamodb.CreateTableInput:
+		if _, ok := f.tables[*p.TableName]; ok {
+			return nil, failure(400, &types.ResourceInUseException{Message: aws.String("Table already exists: " + *p.TableName)})
+		}
+		t := &table{description: types.TableDescription{
+			TableName:            p.TableName,
+			TableArn:             aws.String(f.b.arn("dynamodb", "table/"+*p.TableName)),
+			TableId:              aws.String(f.b.id("table-")),
+			TableStatus:          types.TableStatusActive,
+			AttributeDefinitions: p.AttributeDefinitions,
+			KeySchema:            p.KeySchema,
+			BillingModeSummary:   &types.BillingModeSummary{BillingMode: p.BillingMode},
+			CreationDateTime:     aws.Time(time.Now()),
+			ItemCount:            aws.Int64(0),
+		}}
+		f.stream(t, p.StreamSpecification)
+		f.tables[*p.TableName] = t
+		desc := t.description
+		return &dynamodb.CreateTableOutput{TableDescription: &desc}, nil
+	case *dynamodb.UpdateTableInput:
+		t, ok := f.tables[*p.TableName]
+		if !ok {
+			return nil, failure(400, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: Table: " + *p.TableName + " not found")})
+		}
+		if p.BillingMode != "" {
+			t.description.BillingModeSummary = &types.BillingModeSummary{BillingMode: p.BillingMode}
+		}
+		if p.StreamSpecification != nil {
+			enabled := t.description.StreamSpecification != nil && aws.ToBool(t.description.StreamSpecification.StreamEnabled)
+			if enabled && aws.ToBool(p.StreamSpecification.StreamEnabled) {
+				return nil, failure(400, &types.ResourceInUseException{Message: aws.String("Table already has an enabled stream: " + *p.TableName)})
+			}
+			f.stream(t, p.StreamSpecification)
+		}
+		desc := t.description
+		return &dynamodb.UpdateTableOutput{TableDescription: &desc}, nil
+	}
+	return nil, errNotHandled
+}
+
+// stream enables or disables the stream of a table; each time it is enabled it is a new stream
+func (f *dynamoFake) stream(t *table, spec *types.StreamSpecification) {
+	if spec == nil {
+		return
+	}
+	t.description.StreamSpecification = spec
+	if aws.ToBool(spec.StreamEnabled) {
+		label := time.Now().UTC().Format("2006-01-02T15:04:05.000000000")
+		t.description.LatestStreamLabel = aws.String(label)
+		t.description.LatestStreamArn = aws.String(*t.description.TableArn + "/stream/" + label)
+	}
+}
+
+// HasTable says whether the named table exists
+func (b *Backend) HasTable(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.dynamo.tables[name]
+	return ok
+}
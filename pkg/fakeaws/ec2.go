@@ -0,0 +1,83 @@
+package fakeaws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// The module only looks for networks that already exist, so they are all set up
+// through AddVpc, AddSubnet and AddSecurityGroup
+type ec2Fake struct {
+	b              *Backend
+	vpcs           []types.Vpc
+	subnets        []types.Subnet
+	securityGroups []types.SecurityGroup
+}
+
+func (f *ec2Fake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *ec2.DescribeVpcsInput:
+		return &ec2.DescribeVpcsOutput{Vpcs: append([]types.Vpc(nil), f.vpcs...)}, nil
+	case *ec2.DescribeSubnetsInput:
+		var ret []types.Subnet
+		for _, s := range f.subnets {
+			if matchesVpc(p.Filters, *s.VpcId) {
+				ret = append(ret, s)
+			}
+		}
+		return &ec2.DescribeSubnetsOutput{Subnets: ret}, nil
+	case *ec2.DescribeSecurityGroupsInput:
+		var ret []types.SecurityGroup
+		for _, sg := range f.securityGroups {
+			if matchesVpc(p.Filters, *sg.VpcId) {
+				ret = append(ret, sg)
+			}
+		}
+		return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: ret}, nil
+	}
+	return nil, errNotHandled
+}
+
+// matchesVpc applies any vpc-id filter; other filters are not supported and match everything
+func matchesVpc(filters []types.Filter, vpcId string) bool {
+	for _, f := range filters {
+		if aws.ToString(f.Name) != "vpc-id" {
+			continue
+		}
+		for _, v := range f.Values {
+			if v == vpcId {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// AddVpc creates a VPC with the given Name tag and returns its id
+func (b *Backend) AddVpc(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.id("vpc-")
+	b.ec2.vpcs = append(b.ec2.vpcs, types.Vpc{VpcId: aws.String(id), CidrBlock: aws.String("10.0.0.0/16"), State: types.VpcStateAvailable, Tags: []types.Tag{{Key: aws.String("Name"), Value: aws.String(name)}}})
+	return id
+}
+
+// AddSubnet creates a subnet in a VPC and returns its id
+func (b *Backend) AddSubnet(vpcId string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.id("subnet-")
+	b.ec2.subnets = append(b.ec2.subnets, types.Subnet{SubnetId: aws.String(id), VpcId: aws.String(vpcId), State: types.SubnetStateAvailable})
+	return id
+}
+
+// AddSecurityGroup creates a security group in a VPC and returns its id
+func (b *Backend) AddSecurityGroup(vpcId, name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.id("sg-")
+	b.ec2.securityGroups = append(b.ec2.securityGroups, types.SecurityGroup{GroupId: aws.String(id), GroupName: aws.String(name), VpcId: aws.String(vpcId)})
+	return id
+}
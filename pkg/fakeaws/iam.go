@@ -0,0 +1,183 @@
+package fakeaws
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+type iamFake struct {
+	b        *Backend
+	roles    map[string]*role
+	policies map[string]*managedPolicy
+	users    map[string]*user
+}
+
+type role struct {
+	role     types.Role
+	inline   map[string]string
+	attached map[string]bool
+}
+
+type managedPolicy struct {
+	policy   types.Policy
+	document string
+}
+
+type user struct {
+	user types.User
+}
+
+// the managed policies that AWS provides which lambdas most commonly need
+var awsManagedPolicies = []string{"AWSLambdaBasicExecutionRole", "AWSLambdaVPCAccessExecutionRole"}
+
+func (f *iamFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *iam.GetRoleInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		ret := r.role
+		return &iam.GetRoleOutput{Role: &ret}, nil
+	case *iam.CreateRoleInput:
+		if _, ok := f.roles[*p.RoleName]; ok {
+			return nil, failure(409, &types.EntityAlreadyExistsException{Message: aws.String("Role with name " + *p.RoleName + " already exists.")})
+		}
+		r := &role{inline: make(map[string]string), attached: make(map[string]bool)}
+		r.role = types.Role{
+			RoleName:                 p.RoleName,
+			RoleId:                   aws.String(f.b.id("AROA")),
+			Arn:                      aws.String("arn:aws:iam::" + Account + ":role/" + *p.RoleName),
+			Path:                     aws.String("/"),
+			AssumeRolePolicyDocument: p.AssumeRolePolicyDocument,
+			CreateDate:               aws.Time(time.Now()),
+		}
+		f.roles[*p.RoleName] = r
+		ret := r.role
+		return &iam.CreateRoleOutput{Role: &ret}, nil
+	case *iam.DeleteRoleInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.inline) > 0 {
+			return nil, failure(409, &types.DeleteConflictException{Message: aws.String("Cannot delete entity, must delete policies first.")})
+		}
+		delete(f.roles, *p.RoleName)
+		return &iam.DeleteRoleOutput{}, nil
+	case *iam.ListRolePoliciesInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		return &iam.ListRolePoliciesOutput{PolicyNames: sortedKeys(r.inline)}, nil
+	case *iam.ListAttachedRolePoliciesInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		var ret []types.AttachedPolicy
+		for _, arn := range sortedKeys(r.attached) {
+			ret = append(ret, types.AttachedPolicy{PolicyArn: aws.String(arn), PolicyName: aws.String(arn[strings.LastIndex(arn, "/")+1:])})
+		}
+		return &iam.ListAttachedRolePoliciesOutput{AttachedPolicies: ret}, nil
+	case *iam.PutRolePolicyInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		r.inline[*p.PolicyName] = *p.PolicyDocument
+		return &iam.PutRolePolicyOutput{}, nil
+	case *iam.DeleteRolePolicyInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.inline[*p.PolicyName]; !ok {
+			return nil, failure(404, &types.NoSuchEntityException{Message: aws.String("The role policy with name " + *p.PolicyName + " cannot be found.")})
+		}
+		delete(r.inline, *p.PolicyName)
+		return &iam.DeleteRolePolicyOutput{}, nil
+	case *iam.AttachRolePolicyInput:
+		r, err := f.findRole(*p.RoleName)
+		if err != nil {
+			return nil, err
+		}
+		r.attached[*p.PolicyArn] = true
+		return &iam.AttachRolePolicyOutput{}, nil
+	case *iam.ListPoliciesInput:
+		// everything fits on one page, so there is never a marker
+		var ret []types.Policy
+		for _, n := range sortedKeys(f.policies) {
+			ret = append(ret, f.policies[n].policy)
+		}
+		return &iam.ListPoliciesOutput{Policies: ret}, nil
+	case *iam.CreatePolicyInput:
+		if _, ok := f.policies[*p.PolicyName]; ok {
+			return nil, failure(409, &types.EntityAlreadyExistsException{Message: aws.String("A policy called " + *p.PolicyName + " already exists.")})
+		}
+		mp := f.addPolicy(*p.PolicyName, "arn:aws:iam::"+Account+":policy/"+*p.PolicyName)
+		mp.document = *p.PolicyDocument
+		ret := mp.policy
+		return &iam.CreatePolicyOutput{Policy: &ret}, nil
+	case *iam.GetUserInput:
+		u, ok := f.users[aws.ToString(p.UserName)]
+		if !ok {
+			return nil, failure(404, &types.NoSuchEntityException{Message: aws.String("The user with name " + aws.ToString(p.UserName) + " cannot be found.")})
+		}
+		ret := u.user
+		return &iam.GetUserOutput{User: &ret}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *iamFake) findRole(name string) (*role, error) {
+	r, ok := f.roles[name]
+	if !ok {
+		return nil, failure(404, &types.NoSuchEntityException{Message: aws.String("The role with name " + name + " cannot be found.")})
+	}
+	return r, nil
+}
+
+func (f *iamFake) addPolicy(name, arn string) *managedPolicy {
+	mp := &managedPolicy{policy: types.Policy{PolicyName: aws.String(name), PolicyId: aws.String(f.b.id("ANPA")), Arn: aws.String(arn)}}
+	f.policies[name] = mp
+	return mp
+}
+
+// AddManagedPolicy makes a policy that AWS provides available to attach to roles
+func (b *Backend) AddManagedPolicy(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.iam.addPolicy(name, "arn:aws:iam::aws:policy/"+name)
+}
+
+// AddUser creates an IAM user, which would be created by hand rather than deployed
+func (b *Backend) AddUser(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.iam.users[name] = &user{user: types.User{UserName: aws.String(name), UserId: aws.String(b.id("AIDA")), Arn: aws.String("arn:aws:iam::" + Account + ":user/" + name), Path: aws.String("/")}}
+}
+
+// HasRole says whether the named role exists
+func (b *Backend) HasRole(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.iam.roles[name]
+	return ok
+}
+
+// RolePolicies returns the names of the inline policies and the ARNs of the managed
+// policies attached to a role
+func (b *Backend) RolePolicies(name string) (inline []string, attached []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.iam.roles[name]; ok {
+		return sortedKeys(r.inline), sortedKeys(r.attached)
+	}
+	return nil, nil
+}
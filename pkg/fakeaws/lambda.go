@@ -0,0 +1,568 @@
+package fakeaws
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+type lambdaFake struct {
+	b         *Backend
+	functions map[string]*function
+	layers    map[string]*layer
+	mappings  map[string]*mapping
+}
+
+type function struct {
+	config     types.FunctionConfiguration
+	code       types.FunctionCode
+	versions   int
+	aliases    map[string]*types.AliasConfiguration
+	statements map[string]*lambda.AddPermissionInput
+	tags       map[string]string
+}
+
+func (f *lambdaFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *lambda.GetFunctionInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		config := fn.config
+		loc := &types.FunctionCodeLocation{Location: fn.code.S3Key, RepositoryType: aws.String("S3")}
+		if fn.code.ImageUri != nil {
+			loc = &types.FunctionCodeLocation{ImageUri: fn.code.ImageUri, ResolvedImageUri: fn.code.ImageUri, RepositoryType: aws.String("ECR")}
+		}
+		return &lambda.GetFunctionOutput{Configuration: &config, Code: loc, Tags: maps.Clone(fn.tags)}, nil
+	case *lambda.CreateFunctionInput:
+		name := *p.FunctionName
+		if _, ok := f.functions[name]; ok {
+			return nil, failure(409, &types.ResourceConflictException{Message: aws.String("Function already exist: " + name)})
+		}
+		if err := f.assumable(p.Role); err != nil {
+			return nil, err
+		}
+		fn := &function{aliases: make(map[string]*types.AliasConfiguration), statements: make(map[string]*lambda.AddPermissionInput), tags: maps.Clone(p.Tags)}
+		fn.config = types.FunctionConfiguration{
+			FunctionName:     p.FunctionName,
+			FunctionArn:      aws.String(f.b.arn("lambda", "function:"+name)),
+			Runtime:          p.Runtime,
+			Handler:          p.Handler,
+			Role:             p.Role,
+			Version:          aws.String("$LATEST"),
+			State:            types.StateActive,
+			LastUpdateStatus: types.LastUpdateStatusSuccessful,
+			RevisionId:       aws.String(f.b.id("rev-")),
+			MemorySize:       aws.Int32(128),
+			Timeout:          aws.Int32(3),
+			Architectures:    []types.Architecture{types.ArchitectureX8664},
+			EphemeralStorage: &types.EphemeralStorage{Size: aws.Int32(512)},
+			Description:      aws.String(""),
+		}
+		f.configure(fn, p.MemorySize, p.Timeout, p.Environment, p.EphemeralStorage, p.Description)
+		if len(p.Architectures) > 0 {
+			fn.config.Architectures = p.Architectures
+		}
+		if p.Layers != nil {
+			fn.config.Layers = layersOf(p.Layers)
+		}
+		if p.VpcConfig != nil {
+			fn.config.VpcConfig = vpcConfigOf(p.VpcConfig)
+		}
+		if p.PackageType == "" {
+			fn.config.PackageType = types.PackageTypeZip
+		} else {
+			fn.config.PackageType = p.PackageType
+		}
+		if p.Code != nil {
+			f.setCode(fn, *p.Code)
+		}
+		f.functions[name] = fn
+		c := fn.config
+		return &lambda.CreateFunctionOutput{FunctionName: c.FunctionName, FunctionArn: c.FunctionArn, Runtime: c.Runtime, Handler: c.Handler, Role: c.Role, Version: c.Version, State: c.State, RevisionId: c.RevisionId, CodeSha256: c.CodeSha256}, nil
+	case *lambda.UpdateFunctionConfigurationInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if p.Role != nil {
+			if err := f.assumable(p.Role); err != nil {
+				return nil, err
+			}
+			fn.config.Role = p.Role
+		}
+		if p.Runtime != "" {
+			fn.config.Runtime = p.Runtime
+		}
+		if p.Handler != nil {
+			fn.config.Handler = p.Handler
+		}
+		if p.VpcConfig != nil {
+			fn.config.VpcConfig = vpcConfigOf(p.VpcConfig)
+		}
+		f.configure(fn, p.MemorySize, p.Timeout, p.Environment, p.EphemeralStorage, p.Description)
+		if p.Layers != nil {
+			fn.config.Layers = layersOf(p.Layers)
+		}
+		fn.config.RevisionId = aws.String(f.b.id("rev-"))
+		c := fn.config
+		return &lambda.UpdateFunctionConfigurationOutput{FunctionName: c.FunctionName, FunctionArn: c.FunctionArn, Runtime: c.Runtime, Handler: c.Handler, Role: c.Role, Version: c.Version, State: c.State, RevisionId: c.RevisionId}, nil
+	case *lambda.UpdateFunctionCodeInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		f.setCode(fn, types.FunctionCode{S3Bucket: p.S3Bucket, S3Key: p.S3Key, ZipFile: p.ZipFile, ImageUri: p.ImageUri})
+		if len(p.Architectures) > 0 {
+			fn.config.Architectures = p.Architectures
+		}
+		fn.config.RevisionId = aws.String(f.b.id("rev-"))
+		c := fn.config
+		return &lambda.UpdateFunctionCodeOutput{FunctionName: c.FunctionName, FunctionArn: c.FunctionArn, RevisionId: c.RevisionId, State: c.State, CodeSha256: c.CodeSha256}, nil
+	case *lambda.DeleteFunctionInput:
+		if _, err := f.find(*p.FunctionName); err != nil {
+			return nil, err
+		}
+		delete(f.functions, functionName(*p.FunctionName))
+		return &lambda.DeleteFunctionOutput{}, nil
+	case *lambda.PublishVersionInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		fn.versions++
+		v := strconv.Itoa(fn.versions)
+		return &lambda.PublishVersionOutput{FunctionName: fn.config.FunctionName, FunctionArn: aws.String(*fn.config.FunctionArn + ":" + v), Version: aws.String(v), State: types.StateActive}, nil
+	case *lambda.GetAliasInput:
+		alias, err := f.findAlias(*p.FunctionName, *p.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &lambda.GetAliasOutput{AliasArn: alias.AliasArn, Name: alias.Name, FunctionVersion: alias.FunctionVersion, RevisionId: alias.RevisionId}, nil
+	case *lambda.CreateAliasInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fn.aliases[*p.Name]; ok {
+			return nil, failure(409, &types.ResourceConflictException{Message: aws.String("Alias already exists: " + *p.Name)})
+		}
+		alias := &types.AliasConfiguration{AliasArn: aws.String(*fn.config.FunctionArn + ":" + *p.Name), Name: p.Name, FunctionVersion: p.FunctionVersion, RevisionId: aws.String(f.b.id("rev-"))}
+		fn.aliases[*p.Name] = alias
+		return &lambda.CreateAliasOutput{AliasArn: alias.AliasArn, Name: alias.Name, FunctionVersion: alias.FunctionVersion, RevisionId: alias.RevisionId}, nil
+	case *lambda.UpdateAliasInput:
+		alias, err := f.findAlias(*p.FunctionName, *p.Name)
+		if err != nil {
+			return nil, err
+		}
+		if p.FunctionVersion != nil {
+			alias.FunctionVersion = p.FunctionVersion
+		}
+		alias.RevisionId = aws.String(f.b.id("rev-"))
+		return &lambda.UpdateAliasOutput{AliasArn: alias.AliasArn, Name: alias.Name, FunctionVersion: alias.FunctionVersion, RevisionId: alias.RevisionId}, nil
+	case *lambda.DeleteAliasInput:
+		if _, err := f.findAlias(*p.FunctionName, *p.Name); err != nil {
+			return nil, err
+		}
+		delete(f.functions[functionName(*p.FunctionName)].aliases, *p.Name)
+		return &lambda.DeleteAliasOutput{}, nil
+	case *lambda.AddPermissionInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fn.statements[*p.StatementId]; ok {
+			return nil, failure(409, &types.ResourceConflictException{Message: aws.String("The statement id (" + *p.StatementId + ") provided already exists.")})
+		}
+		fn.statements[*p.StatementId] = p
+		stmt, _ := json.Marshal(policyStatement(*fn.config.FunctionArn, p))
+		return &lambda.AddPermissionOutput{Statement: aws.String(string(stmt))}, nil
+	case *lambda.RemovePermissionInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fn.statements[*p.StatementId]; !ok {
+			return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("Statement " + *p.StatementId + " is not found in resource policy.")})
+		}
+		delete(fn.statements, *p.StatementId)
+		return &lambda.RemovePermissionOutput{}, nil
+	case *lambda.GetPolicyInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if len(fn.statements) == 0 {
+			return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("The resource you requested does not exist.")})
+		}
+		var stmts []any
+		for _, sid := range slices.Sorted(maps.Keys(fn.statements)) {
+			stmts = append(stmts, policyStatement(*fn.config.FunctionArn, fn.statements[sid]))
+		}
+		policy, _ := json.Marshal(map[string]any{"Version": "2012-10-17", "Id": "default", "Statement": stmts})
+		return &lambda.GetPolicyOutput{Policy: aws.String(string(policy)), RevisionId: aws.String(f.b.id("rev-"))}, nil
+	case *lambda.ListTagsInput:
+		fn, err := f.find(*p.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &lambda.ListTagsOutput{Tags: maps.Clone(fn.tags)}, nil
+	case *lambda.TagResourceInput:
+		fn, err := f.find(*p.Resource)
+		if err != nil {
+			return nil, err
+		}
+		if fn.tags == nil {
+			fn.tags = make(map[string]string)
+		}
+		maps.Copy(fn.tags, p.Tags)
+		return &lambda.TagResourceOutput{}, nil
+	case *lambda.UntagResourceInput:
+		fn, err := f.find(*p.Resource)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range p.TagKeys {
+			delete(fn.tags, k)
+		}
+		return &lambda.UntagResourceOutput{}, nil
+	case *lambda.PublishLayerVersionInput:
+		name := layerName(*p.LayerName)
+		l, ok := f.layers[name]
+		if !ok {
+			l = &layer{}
+			f.layers[name] = l
+		}
+		versions := l.versions
+		sha, size := f.hash(p.Content.ZipFile, p.Content.S3Bucket, p.Content.S3Key)
+		layerArn := f.b.arn("lambda", "layer:"+name)
+		v := &lambda.GetLayerVersionOutput{
+			LayerArn:                aws.String(layerArn),
+			LayerVersionArn:         aws.String(layerArn + ":" + strconv.Itoa(len(versions)+1)),
+			Version:                 int64(len(versions) + 1),
+			Content:                 &types.LayerVersionContentOutput{CodeSha256: aws.String(sha), CodeSize: size},
+			CompatibleRuntimes:      p.CompatibleRuntimes,
+			CompatibleArchitectures: p.CompatibleArchitectures,
+			Description:             p.Description,
+		}
+		l.versions = append(versions, v)
+		return &lambda.PublishLayerVersionOutput{LayerArn: v.LayerArn, LayerVersionArn: v.LayerVersionArn, Version: v.Version, Content: v.Content,
+			CompatibleRuntimes: v.CompatibleRuntimes, CompatibleArchitectures: v.CompatibleArchitectures, Description: v.Description}, nil
+	case *lambda.ListLayerVersionsInput:
+		// the latest version comes first
+		var ret []types.LayerVersionsListItem
+		var versions []*lambda.GetLayerVersionOutput
+		if l, ok := f.layers[layerName(*p.LayerName)]; ok {
+			versions = l.versions
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			if v == nil {
+				continue
+			}
+			if p.MaxItems != nil && len(ret) == int(*p.MaxItems) {
+				break
+			}
+			ret = append(ret, types.LayerVersionsListItem{LayerVersionArn: v.LayerVersionArn, Version: v.Version, CompatibleRuntimes: v.CompatibleRuntimes, CompatibleArchitectures: v.CompatibleArchitectures, Description: v.Description})
+		}
+		return &lambda.ListLayerVersionsOutput{LayerVersions: ret}, nil
+	case *lambda.GetLayerVersionInput:
+		v, err := f.findLayerVersion(*p.LayerName, *p.VersionNumber)
+		if err != nil {
+			return nil, err
+		}
+		ret := *v
+		return &ret, nil
+	case *lambda.DeleteLayerVersionInput:
+		// deleting a version which is not there is not an error
+		if _, err := f.findLayerVersion(*p.LayerName, *p.VersionNumber); err == nil {
+			f.layers[layerName(*p.LayerName)].versions[*p.VersionNumber-1] = nil
+		}
+		return &lambda.DeleteLayerVersionOutput{}, nil
+	case *lambda.CreateEventSourceMappingInput:
+		fn, err := f.find(*p.FunctionName)
+		if err != nil {
+			return nil, err
+		}
+		if len(f.mappingsFor(*fn.config.FunctionArn, *p.EventSourceArn)) > 0 {
+			return nil, failure(409, &types.ResourceConflictException{Message: aws.String("An event source mapping with event source (" + *p.EventSourceArn + ") and function (" + *fn.config.FunctionName + ") already exists.")})
+		}
+		mp := &mapping{config: types.EventSourceMappingConfiguration{
+			UUID:                           aws.String(f.b.id("esm-")),
+			FunctionArn:                    fn.config.FunctionArn,
+			EventSourceArn:                 p.EventSourceArn,
+			BatchSize:                      p.BatchSize,
+			MaximumBatchingWindowInSeconds: p.MaximumBatchingWindowInSeconds,
+			FilterCriteria:                 p.FilterCriteria,
+			StartingPosition:               p.StartingPosition,
+			State:                          aws.String("Enabled"),
+		}}
+		m := &mp.config
+		if m.BatchSize == nil {
+			// queues are read ten messages at a time, streams a hundred records
+			m.BatchSize = aws.Int32(10)
+			if p.StartingPosition != "" {
+				m.BatchSize = aws.Int32(100)
+			}
+		}
+		if m.MaximumBatchingWindowInSeconds == nil {
+			m.MaximumBatchingWindowInSeconds = aws.Int32(0)
+		}
+		if p.Enabled != nil && !*p.Enabled {
+			m.State = aws.String("Disabled")
+		}
+		f.mappings[*m.UUID] = mp
+		return &lambda.CreateEventSourceMappingOutput{UUID: m.UUID, FunctionArn: m.FunctionArn, EventSourceArn: m.EventSourceArn, BatchSize: m.BatchSize,
+			MaximumBatchingWindowInSeconds: m.MaximumBatchingWindowInSeconds, FilterCriteria: m.FilterCriteria, StartingPosition: m.StartingPosition, State: m.State}, nil
+	case *lambda.ListEventSourceMappingsInput:
+		arn := ""
+		if p.FunctionName != nil {
+			fn, err := f.find(*p.FunctionName)
+			if err != nil {
+				return nil, err
+			}
+			arn = *fn.config.FunctionArn
+		}
+		var ret []types.EventSourceMappingConfiguration
+		for _, m := range f.mappingsFor(arn, aws.ToString(p.EventSourceArn)) {
+			ret = append(ret, *m)
+		}
+		return &lambda.ListEventSourceMappingsOutput{EventSourceMappings: ret}, nil
+	case *lambda.GetEventSourceMappingInput:
+		m, err := f.findMapping(*p.UUID)
+		if err != nil {
+			return nil, err
+		}
+		return &lambda.GetEventSourceMappingOutput{UUID: m.UUID, FunctionArn: m.FunctionArn, EventSourceArn: m.EventSourceArn, BatchSize: m.BatchSize,
+			MaximumBatchingWindowInSeconds: m.MaximumBatchingWindowInSeconds, FilterCriteria: m.FilterCriteria, StartingPosition: m.StartingPosition, State: m.State}, nil
+	case *lambda.UpdateEventSourceMappingInput:
+		m, err := f.findMapping(*p.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if p.BatchSize != nil {
+			m.BatchSize = p.BatchSize
+		}
+		if p.MaximumBatchingWindowInSeconds != nil {
+			m.MaximumBatchingWindowInSeconds = p.MaximumBatchingWindowInSeconds
+		}
+		if p.FilterCriteria != nil {
+			m.FilterCriteria = p.FilterCriteria
+		}
+		if p.Enabled != nil {
+			m.State = aws.String("Disabled")
+			if *p.Enabled {
+				m.State = aws.String("Enabled")
+			}
+		}
+		return &lambda.UpdateEventSourceMappingOutput{UUID: m.UUID, FunctionArn: m.FunctionArn, EventSourceArn: m.EventSourceArn, BatchSize: m.BatchSize,
+			MaximumBatchingWindowInSeconds: m.MaximumBatchingWindowInSeconds, FilterCriteria: m.FilterCriteria, StartingPosition: m.StartingPosition, State: m.State}, nil
+	case *lambda.DeleteEventSourceMappingInput:
+		m, err := f.findMapping(*p.UUID)
+		if err != nil {
+			return nil, err
+		}
+		delete(f.mappings, *p.UUID)
+		return &lambda.DeleteEventSourceMappingOutput{UUID: m.UUID, State: aws.String("Deleting")}, nil
+	}
+	return nil, errNotHandled
+}
+
+// mappingsFor finds the event source mappings for a function and a source, either of which may be ""
+func (f *lambdaFake) mappingsFor(functionArn, sourceArn string) []*types.EventSourceMappingConfiguration {
+	var ret []*types.EventSourceMappingConfiguration
+	for _, uuid := range slices.Sorted(maps.Keys(f.mappings)) {
+		m := &f.mappings[uuid].config
+		if (functionArn == "" || *m.FunctionArn == functionArn) && (sourceArn == "" || *m.EventSourceArn == sourceArn) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+func (f *lambdaFake) findMapping(uuid string) (*types.EventSourceMappingConfiguration, error) {
+	m, ok := f.mappings[uuid]
+	if !ok {
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("The resource you requested does not exist.")})
+	}
+	return &m.config, nil
+}
+
+type mapping struct {
+	config types.EventSourceMappingConfiguration
+}
+
+type layer struct {
+	// the versions in the order they were published; deleted ones are nil
+	versions []*lambda.GetLayerVersionOutput
+}
+
+// setCode records the code of a function along with its hash, which is of the zip
+// (wherever it came from) or is the digest of the image
+func (f *lambdaFake) setCode(fn *function, code types.FunctionCode) {
+	fn.code = code
+	if code.ImageUri != nil {
+		_, digest, _ := strings.Cut(*code.ImageUri, "@sha256:")
+		fn.config.CodeSha256 = aws.String(digest)
+		fn.config.CodeSize = 0
+		return
+	}
+	sha, size := f.hash(code.ZipFile, code.S3Bucket, code.S3Key)
+	fn.config.CodeSha256 = aws.String(sha)
+	fn.config.CodeSize = size
+}
+
+// hash is the hash and size of a zip, which is either given directly or is an object in the fake S3
+func (f *lambdaFake) hash(zipped []byte, bucket, key *string) (string, int64) {
+	if zipped == nil && bucket != nil {
+		if b, ok := f.b.s3.buckets[*bucket]; ok {
+			zipped = b.objects[aws.ToString(key)]
+		}
+	}
+	sum := sha256.Sum256(zipped)
+	return base64.StdEncoding.EncodeToString(sum[:]), int64(len(zipped))
+}
+
+// configure sets the parts of a function's configuration which are the same for creating and updating it
+func (f *lambdaFake) configure(fn *function, memorySize, timeout *int32, env *types.Environment, storage *types.EphemeralStorage, description *string) {
+	if memorySize != nil {
+		fn.config.MemorySize = memorySize
+	}
+	if timeout != nil {
+		fn.config.Timeout = timeout
+	}
+	if env != nil {
+		fn.config.Environment = &types.EnvironmentResponse{Variables: maps.Clone(env.Variables)}
+	}
+	if storage != nil {
+		fn.config.EphemeralStorage = storage
+	}
+	if description != nil {
+		fn.config.Description = description
+	}
+}
+
+// canInvoke says whether principal has been allowed to invoke the function fn when acting for source
+func (f *lambdaFake) canInvoke(fn, principal, source string) bool {
+	function, err := f.find(fn)
+	if err != nil {
+		return false
+	}
+	for _, p := range function.statements {
+		if aws.ToString(p.Action) == "lambda:InvokeFunction" && aws.ToString(p.Principal) == principal && (p.SourceArn == nil || *p.SourceArn == source) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyStatement is how lambda describes the statement that p added to the policy of the function arn
+func policyStatement(arn string, p *lambda.AddPermissionInput) map[string]any {
+	principal := map[string]any{"Service": aws.ToString(p.Principal)}
+	if !strings.Contains(aws.ToString(p.Principal), ".") {
+		principal = map[string]any{"AWS": "arn:aws:iam::" + aws.ToString(p.Principal) + ":root"}
+	}
+	ret := map[string]any{"Sid": *p.StatementId, "Effect": "Allow", "Principal": principal, "Action": aws.ToString(p.Action), "Resource": arn}
+	cond := map[string]any{}
+	if p.SourceArn != nil {
+		cond["ArnLike"] = map[string]any{"AWS:SourceArn": *p.SourceArn}
+	}
+	if p.SourceAccount != nil {
+		cond["StringEquals"] = map[string]any{"AWS:SourceAccount": *p.SourceAccount}
+	}
+	if len(cond) > 0 {
+		ret["Condition"] = cond
+	}
+	return ret
+}
+
+func (f *lambdaFake) find(name string) (*function, error) {
+	fn, ok := f.functions[functionName(name)]
+	if !ok {
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("Function not found: " + name)})
+	}
+	return fn, nil
+}
+
+func (f *lambdaFake) findLayerVersion(name string, version int64) (*lambda.GetLayerVersionOutput, error) {
+	l, ok := f.layers[layerName(name)]
+	if !ok || version < 1 || version > int64(len(l.versions)) || l.versions[version-1] == nil {
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("The resource you requested does not exist.")})
+	}
+	return l.versions[version-1], nil
+}
+
+func (f *lambdaFake) findAlias(fname, name string) (*types.AliasConfiguration, error) {
+	fn, err := f.find(fname)
+	if err != nil {
+		return nil, err
+	}
+	alias, ok := fn.aliases[name]
+	if !ok {
+		return nil, failure(404, &types.ResourceNotFoundException{Message: aws.String("Alias not found: " + name)})
+	}
+	return alias, nil
+}
+
+// assumable checks that the role is one that IAM knows about, as lambda would
+func (f *lambdaFake) assumable(role *string) error {
+	name := aws.ToString(role)
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if _, ok := f.b.iam.roles[name]; !ok {
+		return failure(400, &types.InvalidParameterValueException{Message: aws.String("The role defined for the function cannot be assumed by Lambda.")})
+	}
+	return nil
+}
+
+// functionName allows functions to be referred to by name or by (possibly qualified) ARN
+func functionName(s string) string {
+	if !strings.HasPrefix(s, "arn:") {
+		return s
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) >= 7 {
+		return parts[6]
+	}
+	return s
+}
+
+// layerName allows layers to be referred to by name or by ARN
+func layerName(name string) string {
+	if idx := strings.LastIndex(name, ":layer:"); idx >= 0 {
+		return name[idx+len(":layer:"):]
+	}
+	return name
+}
+
+func layersOf(arns []string) []types.Layer {
+	ret := []types.Layer{}
+	for _, arn := range arns {
+		ret = append(ret, types.Layer{Arn: aws.String(arn)})
+	}
+	return ret
+}
+
+// HasFunction says whether the named lambda function exists
+func (b *Backend) HasFunction(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.lambda.functions[name]
+	return ok
+}
+
+// vpcConfigOf is the VPC config lambda reports for the one it was given; like lambda,
+// it does not keep the subnets and security groups in the order they were given
+func vpcConfigOf(c *types.VpcConfig) *types.VpcConfigResponse {
+	return &types.VpcConfigResponse{SubnetIds: slices.Sorted(slices.Values(c.SubnetIds)), SecurityGroupIds: slices.Sorted(slices.Values(c.SecurityGroupIds))}
+}
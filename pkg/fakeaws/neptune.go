@@ -0,0 +1,169 @@
+package fakeaws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/neptune"
+	"github.com/aws/aws-sdk-go-v2/service/neptune/types"
+)
+
+// Clusters and instances are available as soon as they are created, and gone as soon
+// as they are deleted
+type neptuneFake struct {
+	b            *Backend
+	clusters     map[string]*neptuneCluster
+	instances    map[string]*neptuneInstance
+	subnetGroups map[string]*subnetGroup
+}
+
+type neptuneCluster struct {
+	cluster types.DBCluster
+}
+
+type neptuneInstance struct {
+	instance types.DBInstance
+}
+
+type subnetGroup struct {
+	group types.DBSubnetGroup
+}
+
+func (f *neptuneFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *neptune.DescribeDBClustersInput:
+		if p.DBClusterIdentifier == nil {
+			var ret []types.DBCluster
+			for _, n := range sortedKeys(f.clusters) {
+				ret = append(ret, f.clusters[n].cluster)
+			}
+			return &neptune.DescribeDBClustersOutput{DBClusters: ret}, nil
+		}
+		c, ok := f.clusters[*p.DBClusterIdentifier]
+		if !ok {
+			return nil, failure(404, &types.DBClusterNotFoundFault{Message: aws.String("DBCluster " + *p.DBClusterIdentifier + " not found.")})
+		}
+		return &neptune.DescribeDBClustersOutput{DBClusters: []types.DBCluster{c.cluster}}, nil
+	case *neptune.CreateDBClusterInput:
+		name := *p.DBClusterIdentifier
+		if _, ok := f.clusters[name]; ok {
+			return nil, failure(400, &types.DBClusterAlreadyExistsFault{Message: aws.String("DB Cluster already exists")})
+		}
+		if p.DBSubnetGroupName != nil && *p.DBSubnetGroupName != "" {
+			if _, ok := f.subnetGroups[*p.DBSubnetGroupName]; !ok {
+				return nil, failure(404, &types.DBSubnetGroupNotFoundFault{Message: aws.String("DB subnet group " + *p.DBSubnetGroupName + " does not exist.")})
+			}
+		}
+		c := &neptuneCluster{cluster: types.DBCluster{
+			DBClusterIdentifier:              p.DBClusterIdentifier,
+			DBClusterArn:                     aws.String(f.b.arn("rds", "cluster:"+name)),
+			Engine:                           p.Engine,
+			DBSubnetGroup:                    p.DBSubnetGroupName,
+			ServerlessV2ScalingConfiguration: scalingInfo(p.ServerlessV2ScalingConfiguration),
+			Status:                           aws.String("available"),
+			Endpoint:                         aws.String(name + ".cluster-fake." + Region + ".neptune.amazonaws.com"),
+		}}
+		f.clusters[name] = c
+		ret := c.cluster
+		return &neptune.CreateDBClusterOutput{DBCluster: &ret}, nil
+	case *neptune.DeleteDBClusterInput:
+		if _, ok := f.clusters[*p.DBClusterIdentifier]; !ok {
+			return nil, failure(404, &types.DBClusterNotFoundFault{Message: aws.String("DBCluster " + *p.DBClusterIdentifier + " not found.")})
+		}
+		ret := f.clusters[*p.DBClusterIdentifier].cluster
+		ret.Status = aws.String("deleting")
+		delete(f.clusters, *p.DBClusterIdentifier)
+		return &neptune.DeleteDBClusterOutput{DBCluster: &ret}, nil
+
+	case *neptune.DescribeDBInstancesInput:
+		if p.DBInstanceIdentifier == nil {
+			var ret []types.DBInstance
+			for _, n := range sortedKeys(f.instances) {
+				ret = append(ret, f.instances[n].instance)
+			}
+			return &neptune.DescribeDBInstancesOutput{DBInstances: ret}, nil
+		}
+		i, ok := f.instances[*p.DBInstanceIdentifier]
+		if !ok {
+			return nil, failure(404, &types.DBInstanceNotFoundFault{Message: aws.String("DBInstance " + *p.DBInstanceIdentifier + " not found.")})
+		}
+		return &neptune.DescribeDBInstancesOutput{DBInstances: []types.DBInstance{i.instance}}, nil
+	case *neptune.CreateDBInstanceInput:
+		name := *p.DBInstanceIdentifier
+		if _, ok := f.instances[name]; ok {
+			return nil, failure(400, &types.DBInstanceAlreadyExistsFault{Message: aws.String("DB instance already exists")})
+		}
+		if p.DBClusterIdentifier != nil {
+			if _, ok := f.clusters[*p.DBClusterIdentifier]; !ok {
+				return nil, failure(404, &types.DBClusterNotFoundFault{Message: aws.String("DBCluster " + *p.DBClusterIdentifier + " not found.")})
+			}
+		}
+		i := &neptuneInstance{instance: types.DBInstance{
+			DBInstanceIdentifier: p.DBInstanceIdentifier,
+			DBInstanceArn:        aws.String(f.b.arn("rds", "db:"+name)),
+			DBClusterIdentifier:  p.DBClusterIdentifier,
+			DBInstanceClass:      p.DBInstanceClass,
+			Engine:               p.Engine,
+			DBInstanceStatus:     aws.String("available"),
+		}}
+		f.instances[name] = i
+		ret := i.instance
+		return &neptune.CreateDBInstanceOutput{DBInstance: &ret}, nil
+	case *neptune.DeleteDBInstanceInput:
+		if _, ok := f.instances[*p.DBInstanceIdentifier]; !ok {
+			return nil, failure(404, &types.DBInstanceNotFoundFault{Message: aws.String("DBInstance " + *p.DBInstanceIdentifier + " not found.")})
+		}
+		ret := f.instances[*p.DBInstanceIdentifier].instance
+		ret.DBInstanceStatus = aws.String("deleting")
+		delete(f.instances, *p.DBInstanceIdentifier)
+		return &neptune.DeleteDBInstanceOutput{DBInstance: &ret}, nil
+
+	case *neptune.DescribeDBSubnetGroupsInput:
+		if p.DBSubnetGroupName == nil {
+			var ret []types.DBSubnetGroup
+			for _, n := range sortedKeys(f.subnetGroups) {
+				ret = append(ret, f.subnetGroups[n].group)
+			}
+			return &neptune.DescribeDBSubnetGroupsOutput{DBSubnetGroups: ret}, nil
+		}
+		g, ok := f.subnetGroups[*p.DBSubnetGroupName]
+		if !ok {
+			return nil, failure(404, &types.DBSubnetGroupNotFoundFault{Message: aws.String("DB subnet group " + *p.DBSubnetGroupName + " does not exist.")})
+		}
+		return &neptune.DescribeDBSubnetGroupsOutput{DBSubnetGroups: []types.DBSubnetGroup{g.group}}, nil
+	}
+	return nil, errNotHandled
+}
+
+func scalingInfo(c *types.ServerlessV2ScalingConfiguration) *types.ServerlessV2ScalingConfigurationInfo {
+	if c == nil {
+		return nil
+	}
+	return &types.ServerlessV2ScalingConfigurationInfo{MinCapacity: c.MinCapacity, MaxCapacity: c.MaxCapacity}
+}
+
+// AddNeptuneSubnetGroup creates a DB subnet group, which the module expects to find
+// rather than create
+func (b *Backend) AddNeptuneSubnetGroup(name string, subnets ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g := types.DBSubnetGroup{DBSubnetGroupName: aws.String(name), DBSubnetGroupArn: aws.String(b.arn("rds", "subgrp:"+name)), SubnetGroupStatus: aws.String("Complete")}
+	for _, s := range subnets {
+		g.Subnets = append(g.Subnets, types.Subnet{SubnetIdentifier: aws.String(s), SubnetStatus: aws.String("Active")})
+	}
+	b.neptune.subnetGroups[name] = &subnetGroup{group: g}
+}
+
+// HasNeptuneCluster says whether the named cluster exists
+func (b *Backend) HasNeptuneCluster(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.neptune.clusters[name]
+	return ok
+}
+
+// HasNeptuneInstance says whether the named instance exists
+func (b *Backend) HasNeptuneInstance(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.neptune.instances[name]
+	return ok
+}
@@ -0,0 +1,140 @@
+package fakeaws
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53domains"
+	domaintypes "github.com/aws/aws-sdk-go-v2/service/route53domains/types"
+)
+
+// route53Fake also answers for route53domains, since the only thing the module asks
+// that is whether a domain is registered to the account
+type route53Fake struct {
+	b       *Backend
+	zones   map[string]*hostedZone
+	domains map[string]bool
+}
+
+type hostedZone struct {
+	name    string
+	records []types.ResourceRecordSet
+}
+
+func (f *route53Fake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *route53domains.GetDomainDetailInput:
+		if !f.domains[*p.DomainName] {
+			return nil, failure(400, &domaintypes.InvalidInput{Message: aws.String("Domain " + *p.DomainName + " not found in account")})
+		}
+		return &route53domains.GetDomainDetailOutput{DomainName: p.DomainName, Nameservers: []domaintypes.Nameserver{{Name: aws.String("ns-1.awsdns-01.org")}}}, nil
+	case *route53.ListHostedZonesInput:
+		var ret []types.HostedZone
+		for _, id := range sortedKeys(f.zones) {
+			z := f.zones[id]
+			ret = append(ret, types.HostedZone{Id: aws.String("/hostedzone/" + id), Name: aws.String(z.name), CallerReference: aws.String(id), ResourceRecordSetCount: aws.Int64(int64(len(z.records)))})
+		}
+		return &route53.ListHostedZonesOutput{HostedZones: ret, IsTruncated: false, MaxItems: aws.Int32(100)}, nil
+	case *route53.ListResourceRecordSetsInput:
+		z, err := f.findZone(*p.HostedZoneId)
+		if err != nil {
+			return nil, err
+		}
+		return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: append([]types.ResourceRecordSet(nil), z.records...), IsTruncated: false, MaxItems: aws.Int32(300)}, nil
+	case *route53.ChangeResourceRecordSetsInput:
+		z, err := f.findZone(*p.HostedZoneId)
+		if err != nil {
+			return nil, err
+		}
+		// the whole batch succeeds or fails together
+		records := append([]types.ResourceRecordSet(nil), z.records...)
+		for _, c := range p.ChangeBatch.Changes {
+			rrs := *c.ResourceRecordSet
+			rrs.Name = aws.String(fqdn(*rrs.Name))
+			idx := findRecord(records, *rrs.Name, rrs.Type)
+			switch c.Action {
+			case types.ChangeActionCreate:
+				if idx >= 0 {
+					return nil, failure(400, &types.InvalidChangeBatch{Message: aws.String("Tried to create resource record set " + *rrs.Name + " type " + string(rrs.Type) + " but it already exists")})
+				}
+				records = append(records, rrs)
+			case types.ChangeActionUpsert:
+				if idx >= 0 {
+					records[idx] = rrs
+				} else {
+					records = append(records, rrs)
+				}
+			case types.ChangeActionDelete:
+				if idx < 0 {
+					return nil, failure(400, &types.InvalidChangeBatch{Message: aws.String("Tried to delete resource record set " + *rrs.Name + " type " + string(rrs.Type) + " but it was not found")})
+				}
+				records = append(records[:idx], records[idx+1:]...)
+			}
+		}
+		z.records = records
+		return &route53.ChangeResourceRecordSetsOutput{ChangeInfo: &types.ChangeInfo{Id: aws.String("/change/" + f.b.id("C")), Status: types.ChangeStatusInsync}}, nil
+	}
+	return nil, errNotHandled
+}
+
+func (f *route53Fake) findZone(id string) (*hostedZone, error) {
+	z, ok := f.zones[strings.TrimPrefix(id, "/hostedzone/")]
+	if !ok {
+		return nil, failure(404, &types.NoSuchHostedZone{Message: aws.String("No hosted zone found with ID: " + id)})
+	}
+	return z, nil
+}
+
+// hasRecord looks for a record in any zone
+func (f *route53Fake) hasRecord(name string, ty types.RRType, value string) bool {
+	for _, z := range f.zones {
+		if idx := findRecord(z.records, fqdn(name), ty); idx >= 0 {
+			for _, rr := range z.records[idx].ResourceRecords {
+				if aws.ToString(rr.Value) == value {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func findRecord(records []types.ResourceRecordSet, name string, ty types.RRType) int {
+	for i, r := range records {
+		if *r.Name == name && r.Type == ty {
+			return i
+		}
+	}
+	return -1
+}
+
+// Route53 always reports names as fully qualified
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// AddDomain registers a domain to the account and gives it a hosted zone, returning
+// the id of the zone
+func (b *Backend) AddDomain(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.route53.domains[name] = true
+	id := b.id("Z")
+	b.route53.zones[id] = &hostedZone{name: fqdn(name)}
+	return id
+}
+
+// Records returns the records in a hosted zone
+func (b *Backend) Records(zoneId string) []types.ResourceRecordSet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if z, ok := b.route53.zones[zoneId]; ok {
+		return append([]types.ResourceRecordSet(nil), z.records...)
+	}
+	return nil
+}
@@ -0,0 +1,629 @@
+package fakeaws
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type s3Fake struct {
+	b       *Backend
+	buckets map[string]*bucket
+	uploads map[string]*multipartUpload
+}
+
+type objectVersion struct {
+	key    string
+	id     string
+	body   []byte
+	marker bool
+}
+
+// a multipartUpload is an object which is being uploaded in parts
+type multipartUpload struct {
+	bucket  string
+	key     string
+	headers *s3.HeadObjectOutput
+	parts   map[int32][]byte
+}
+
+type bucket struct {
+	region  string
+	policy  string
+	objects map[string][]byte
+	headers map[string]*s3.HeadObjectOutput
+
+	// when the bucket is versioned, the versions which are no longer current and the delete markers
+	versions []objectVersion
+	// keys whose versions cannot be deleted, as if they had a legal hold on them
+	locked map[string]bool
+
+	versioning types.BucketVersioningStatus
+	encryption *types.ServerSideEncryptionConfiguration
+	pab        *types.PublicAccessBlockConfiguration
+	ownership  *types.OwnershipControls
+	lifecycle  []types.LifecycleRule
+	tags       []types.Tag
+	website    *types.WebsiteConfiguration
+	cors       []types.CORSRule
+	notify     *types.NotificationConfiguration
+}
+
+func (f *s3Fake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *s3.CreateBucketInput:
+		if _, ok := f.buckets[*p.Bucket]; ok {
+			return nil, failure(409, &types.BucketAlreadyOwnedByYou{Message: aws.String("bucket " + *p.Bucket + " already exists")})
+		}
+		region := "us-east-1"
+		if p.CreateBucketConfiguration != nil && p.CreateBucketConfiguration.LocationConstraint != "" {
+			region = string(p.CreateBucketConfiguration.LocationConstraint)
+		}
+		// like S3, new buckets are encrypted, private and owned by the bucket owner
+		block := aws.Bool(true)
+		f.buckets[*p.Bucket] = &bucket{
+			region:     region,
+			objects:    make(map[string][]byte),
+			headers:    make(map[string]*s3.HeadObjectOutput),
+			encryption: &types.ServerSideEncryptionConfiguration{Rules: []types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAes256}}}},
+			pab:        &types.PublicAccessBlockConfiguration{BlockPublicAcls: block, BlockPublicPolicy: block, IgnorePublicAcls: block, RestrictPublicBuckets: block},
+			ownership:  &types.OwnershipControls{Rules: []types.OwnershipControlsRule{{ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced}}},
+		}
+		return &s3.CreateBucketOutput{Location: aws.String("/" + *p.Bucket)}, nil
+	case *s3.HeadBucketInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		return &s3.HeadBucketOutput{BucketRegion: aws.String(b.region)}, nil
+	case *s3.GetBucketLocationInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.region == "us-east-1" {
+			return &s3.GetBucketLocationOutput{}, nil
+		}
+		return &s3.GetBucketLocationOutput{LocationConstraint: types.BucketLocationConstraint(b.region)}, nil
+	case *s3.DeleteBucketInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if len(b.objects) > 0 || len(b.versions) > 0 {
+			return nil, failure(409, &smithy.GenericAPIError{Code: "BucketNotEmpty", Message: "the bucket you tried to delete is not empty"})
+		}
+		delete(f.buckets, *p.Bucket)
+		return &s3.DeleteBucketOutput{}, nil
+	case *s3.GetBucketPolicyInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.policy == "" {
+			return nil, notConfigured("NoSuchBucketPolicy")
+		}
+		return &s3.GetBucketPolicyOutput{Policy: aws.String(b.policy)}, nil
+	case *s3.PutBucketPolicyInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.policy = aws.ToString(p.Policy)
+		return &s3.PutBucketPolicyOutput{}, nil
+	case *s3.GetBucketVersioningInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		return &s3.GetBucketVersioningOutput{Status: b.versioning}, nil
+	case *s3.PutBucketVersioningInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.versioning = p.VersioningConfiguration.Status
+		return &s3.PutBucketVersioningOutput{}, nil
+	case *s3.GetBucketEncryptionInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.encryption == nil {
+			return nil, notConfigured("ServerSideEncryptionConfigurationNotFoundError")
+		}
+		return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: b.encryption}, nil
+	case *s3.PutBucketEncryptionInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.encryption = p.ServerSideEncryptionConfiguration
+		return &s3.PutBucketEncryptionOutput{}, nil
+	case *s3.GetPublicAccessBlockInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.pab == nil {
+			return nil, notConfigured("NoSuchPublicAccessBlockConfiguration")
+		}
+		return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: b.pab}, nil
+	case *s3.PutPublicAccessBlockInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.pab = p.PublicAccessBlockConfiguration
+		return &s3.PutPublicAccessBlockOutput{}, nil
+	case *s3.DeletePublicAccessBlockInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.pab = nil
+		return &s3.DeletePublicAccessBlockOutput{}, nil
+	case *s3.GetBucketOwnershipControlsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.ownership == nil {
+			return nil, notConfigured("OwnershipControlsNotFoundError")
+		}
+		return &s3.GetBucketOwnershipControlsOutput{OwnershipControls: b.ownership}, nil
+	case *s3.PutBucketOwnershipControlsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.ownership = p.OwnershipControls
+		return &s3.PutBucketOwnershipControlsOutput{}, nil
+	case *s3.GetBucketLifecycleConfigurationInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.lifecycle == nil {
+			return nil, notConfigured("NoSuchLifecycleConfiguration")
+		}
+		return &s3.GetBucketLifecycleConfigurationOutput{Rules: b.lifecycle}, nil
+	case *s3.PutBucketLifecycleConfigurationInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.lifecycle = p.LifecycleConfiguration.Rules
+		return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+	case *s3.DeleteBucketLifecycleInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.lifecycle = nil
+		return &s3.DeleteBucketLifecycleOutput{}, nil
+	case *s3.GetBucketTaggingInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.tags == nil {
+			return nil, notConfigured("NoSuchTagSet")
+		}
+		return &s3.GetBucketTaggingOutput{TagSet: b.tags}, nil
+	case *s3.PutBucketTaggingInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.tags = p.Tagging.TagSet
+		return &s3.PutBucketTaggingOutput{}, nil
+	case *s3.DeleteBucketTaggingInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.tags = nil
+		return &s3.DeleteBucketTaggingOutput{}, nil
+	case *s3.GetBucketWebsiteInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.website == nil {
+			return nil, notConfigured("NoSuchWebsiteConfiguration")
+		}
+		w := b.website
+		return &s3.GetBucketWebsiteOutput{IndexDocument: w.IndexDocument, ErrorDocument: w.ErrorDocument, RedirectAllRequestsTo: w.RedirectAllRequestsTo, RoutingRules: w.RoutingRules}, nil
+	case *s3.PutBucketWebsiteInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.website = p.WebsiteConfiguration
+		return &s3.PutBucketWebsiteOutput{}, nil
+	case *s3.DeleteBucketWebsiteInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.website = nil
+		return &s3.DeleteBucketWebsiteOutput{}, nil
+	case *s3.GetBucketCorsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if b.cors == nil {
+			return nil, notConfigured("NoSuchCORSConfiguration")
+		}
+		return &s3.GetBucketCorsOutput{CORSRules: b.cors}, nil
+	case *s3.PutBucketCorsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.cors = p.CORSConfiguration.CORSRules
+		return &s3.PutBucketCorsOutput{}, nil
+	case *s3.DeleteBucketCorsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		b.cors = nil
+		return &s3.DeleteBucketCorsOutput{}, nil
+	case *s3.PutObjectInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		var body []byte
+		if p.Body != nil {
+			if body, err = io.ReadAll(p.Body); err != nil {
+				return nil, err
+			}
+		}
+		h := f.store(b, *p.Key, body, &s3.HeadObjectOutput{ContentType: p.ContentType, CacheControl: p.CacheControl, ContentEncoding: p.ContentEncoding, Metadata: p.Metadata, ETag: aws.String(etag(body)), ChecksumSHA256: p.ChecksumSHA256})
+		return &s3.PutObjectOutput{ETag: h.ETag, VersionId: h.VersionId}, nil
+	case *s3.CreateMultipartUploadInput:
+		if _, err := f.find(*p.Bucket); err != nil {
+			return nil, err
+		}
+		id := f.b.id("upload-")
+		f.uploads[id] = &multipartUpload{bucket: *p.Bucket, key: *p.Key, headers: &s3.HeadObjectOutput{ContentType: p.ContentType, CacheControl: p.CacheControl, ContentEncoding: p.ContentEncoding, Metadata: p.Metadata}, parts: make(map[int32][]byte)}
+		return &s3.CreateMultipartUploadOutput{Bucket: p.Bucket, Key: p.Key, UploadId: aws.String(id)}, nil
+	case *s3.UploadPartInput:
+		u, err := f.upload(p.UploadId)
+		if err != nil {
+			return nil, err
+		}
+		var body []byte
+		if p.Body != nil {
+			if body, err = io.ReadAll(p.Body); err != nil {
+				return nil, err
+			}
+		}
+		u.parts[*p.PartNumber] = body
+		return &s3.UploadPartOutput{ETag: aws.String(etag(body))}, nil
+	case *s3.CompleteMultipartUploadInput:
+		u, err := f.upload(p.UploadId)
+		if err != nil {
+			return nil, err
+		}
+		b, err := f.find(u.bucket)
+		if err != nil {
+			return nil, err
+		}
+		var body []byte
+		all := md5.New()
+		for _, cp := range p.MultipartUpload.Parts {
+			part, ok := u.parts[*cp.PartNumber]
+			if !ok || etag(part) != aws.ToString(cp.ETag) {
+				return nil, failure(400, &smithy.GenericAPIError{Code: "InvalidPart", Message: fmt.Sprintf("part %d was not uploaded", *cp.PartNumber)})
+			}
+			body = append(body, part...)
+			sum := md5.Sum(part)
+			all.Write(sum[:])
+		}
+		tag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(all.Sum(nil)), len(p.MultipartUpload.Parts))
+		u.headers.ETag = aws.String(tag)
+		h := f.store(b, u.key, body, u.headers)
+		delete(f.uploads, *p.UploadId)
+		return &s3.CompleteMultipartUploadOutput{Bucket: p.Bucket, Key: p.Key, ETag: h.ETag}, nil
+	case *s3.AbortMultipartUploadInput:
+		if _, err := f.upload(p.UploadId); err != nil {
+			return nil, err
+		}
+		delete(f.uploads, *p.UploadId)
+		return &s3.AbortMultipartUploadOutput{}, nil
+	case *s3.ListMultipartUploadsInput:
+		if _, err := f.find(*p.Bucket); err != nil {
+			return nil, err
+		}
+		var uploads []types.MultipartUpload
+		for _, id := range sortedKeys(f.uploads) {
+			if u := f.uploads[id]; u.bucket == *p.Bucket {
+				uploads = append(uploads, types.MultipartUpload{Key: aws.String(u.key), UploadId: aws.String(id)})
+			}
+		}
+		return &s3.ListMultipartUploadsOutput{Bucket: p.Bucket, Uploads: uploads}, nil
+	case *s3.HeadObjectInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		body, ok := b.objects[*p.Key]
+		if !ok {
+			return nil, failure(404, &types.NotFound{Message: aws.String("no object " + *p.Key)})
+		}
+		h := *b.headers[*p.Key]
+		h.ContentLength = aws.Int64(int64(len(body)))
+		return &h, nil
+	case *s3.ListObjectsV2Input:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		var contents []types.Object
+		for _, k := range sortedKeys(b.objects) {
+			if !strings.HasPrefix(k, aws.ToString(p.Prefix)) {
+				continue
+			}
+			contents = append(contents, types.Object{Key: aws.String(k), Size: aws.Int64(int64(len(b.objects[k]))), ETag: b.headers[k].ETag})
+		}
+		return &s3.ListObjectsV2Output{Name: p.Bucket, Contents: contents, KeyCount: aws.Int32(int32(len(contents)))}, nil
+	case *s3.DeleteObjectsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Delete.Objects) > 1000 {
+			return nil, failure(400, &smithy.GenericAPIError{Code: "MalformedXML", Message: "no more than 1000 objects can be deleted at once"})
+		}
+		out := &s3.DeleteObjectsOutput{}
+		for _, o := range p.Delete.Objects {
+			key := *o.Key
+			switch {
+			case o.VersionId != nil && b.locked[key]:
+				out.Errors = append(out.Errors, types.Error{Key: o.Key, VersionId: o.VersionId, Code: aws.String("AccessDenied"), Message: aws.String("the object has a legal hold")})
+				continue
+			case o.VersionId != nil:
+				f.deleteVersion(b, key, *o.VersionId)
+				out.Deleted = append(out.Deleted, types.DeletedObject{Key: o.Key, VersionId: o.VersionId})
+			case b.versioning == types.BucketVersioningStatusEnabled:
+				// the object is still there as an old version, hidden by a delete marker
+				f.archive(b, key)
+				marker := f.b.id("marker-")
+				b.versions = append(b.versions, objectVersion{key: key, id: marker, marker: true})
+				out.Deleted = append(out.Deleted, types.DeletedObject{Key: o.Key, DeleteMarker: aws.Bool(true), DeleteMarkerVersionId: aws.String(marker)})
+			default:
+				delete(b.objects, key)
+				delete(b.headers, key)
+				out.Deleted = append(out.Deleted, types.DeletedObject{Key: o.Key})
+			}
+		}
+		return out, nil
+	case *s3.GetBucketNotificationConfigurationInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		out := &s3.GetBucketNotificationConfigurationOutput{}
+		if b.notify != nil {
+			out.LambdaFunctionConfigurations = b.notify.LambdaFunctionConfigurations
+			out.QueueConfigurations = b.notify.QueueConfigurations
+			out.TopicConfigurations = b.notify.TopicConfigurations
+		}
+		return out, nil
+	case *s3.PutBucketNotificationConfigurationInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		// like S3, check that the functions can be invoked by the bucket
+		for _, c := range p.NotificationConfiguration.LambdaFunctionConfigurations {
+			if !f.b.lambda.canInvoke(aws.ToString(c.LambdaFunctionArn), "s3.amazonaws.com", "arn:aws:s3:::"+*p.Bucket) {
+				return nil, failure(400, &smithy.GenericAPIError{Code: "InvalidArgument", Message: "Unable to validate the following destination configurations"})
+			}
+		}
+		b.notify = p.NotificationConfiguration
+		return &s3.PutBucketNotificationConfigurationOutput{}, nil
+	case *s3.DeleteObjectInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		delete(b.objects, *p.Key)
+		delete(b.headers, *p.Key)
+		return &s3.DeleteObjectOutput{}, nil
+	case *s3.ListObjectVersionsInput:
+		b, err := f.find(*p.Bucket)
+		if err != nil {
+			return nil, err
+		}
+		return f.listVersions(b, p), nil
+	}
+	return nil, errNotHandled
+}
+
+// store makes body the current version of key
+func (f *s3Fake) store(b *bucket, key string, body []byte, h *s3.HeadObjectOutput) *s3.HeadObjectOutput {
+	if sse := b.defaultEncryption(); sse == types.ServerSideEncryptionAwsKms || sse == types.ServerSideEncryptionAwsKmsDsse {
+		// like S3, the ETag of an object encrypted with KMS is not the MD5 of its contents
+		h.ServerSideEncryption = sse
+		h.ETag = aws.String(etag([]byte(f.b.id("kms-"))))
+	}
+	h.VersionId = aws.String("null")
+	if b.versioning == types.BucketVersioningStatusEnabled {
+		f.archive(b, key)
+		h.VersionId = aws.String(f.b.id("version-"))
+	}
+	b.objects[key] = body
+	b.headers[key] = h
+	return h
+}
+
+func (b *bucket) defaultEncryption() types.ServerSideEncryption {
+	if b.encryption == nil {
+		return ""
+	}
+	for _, r := range b.encryption.Rules {
+		if r.ApplyServerSideEncryptionByDefault != nil {
+			return r.ApplyServerSideEncryptionByDefault.SSEAlgorithm
+		}
+	}
+	return ""
+}
+
+// archive keeps the current version of key (if there is one) as an old version
+func (f *s3Fake) archive(b *bucket, key string) {
+	if body, ok := b.objects[key]; ok {
+		b.versions = append(b.versions, objectVersion{key: key, id: aws.ToString(b.headers[key].VersionId), body: body})
+		delete(b.objects, key)
+		delete(b.headers, key)
+	}
+}
+
+func (f *s3Fake) deleteVersion(b *bucket, key, id string) {
+	if h, ok := b.headers[key]; ok && aws.ToString(h.VersionId) == id {
+		delete(b.objects, key)
+		delete(b.headers, key)
+		return
+	}
+	b.versions = slices.DeleteFunc(b.versions, func(v objectVersion) bool { return v.key == key && v.id == id })
+}
+
+// listVersions returns a page of the versions, in order of key and version id, starting
+// after the markers; this is not quite the order S3 uses, but it means that deleting
+// versions while listing them does not cause any to be missed
+func (f *s3Fake) listVersions(b *bucket, p *s3.ListObjectVersionsInput) *s3.ListObjectVersionsOutput {
+	all := slices.Clone(b.versions)
+	for k, body := range b.objects {
+		all = append(all, objectVersion{key: k, id: aws.ToString(b.headers[k].VersionId), body: body})
+	}
+	slices.SortFunc(all, func(x, y objectVersion) int {
+		if c := strings.Compare(x.key, y.key); c != 0 {
+			return c
+		}
+		return strings.Compare(x.id, y.id)
+	})
+	limit := int(aws.ToInt32(p.MaxKeys))
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	out := &s3.ListObjectVersionsOutput{Name: p.Bucket, IsTruncated: aws.Bool(false)}
+	n := 0
+	for _, v := range all {
+		if !strings.HasPrefix(v.key, aws.ToString(p.Prefix)) {
+			continue
+		}
+		if mk := aws.ToString(p.KeyMarker); v.key < mk || (v.key == mk && v.id <= aws.ToString(p.VersionIdMarker)) {
+			continue
+		}
+		if n == limit {
+			out.IsTruncated = aws.Bool(true)
+			break
+		}
+		n++
+		out.NextKeyMarker, out.NextVersionIdMarker = aws.String(v.key), aws.String(v.id)
+		current := false
+		if h, ok := b.headers[v.key]; ok && aws.ToString(h.VersionId) == v.id {
+			current = true
+		}
+		if v.marker {
+			out.DeleteMarkers = append(out.DeleteMarkers, types.DeleteMarkerEntry{Key: aws.String(v.key), VersionId: aws.String(v.id)})
+		} else {
+			out.Versions = append(out.Versions, types.ObjectVersion{Key: aws.String(v.key), VersionId: aws.String(v.id), IsLatest: aws.Bool(current), ETag: aws.String(etag(v.body)), Size: aws.Int64(int64(len(v.body)))})
+		}
+	}
+	if !aws.ToBool(out.IsTruncated) {
+		out.NextKeyMarker, out.NextVersionIdMarker = nil, nil
+	}
+	return out
+}
+
+func (f *s3Fake) upload(id *string) (*multipartUpload, error) {
+	u, ok := f.uploads[aws.ToString(id)]
+	if !ok {
+		return nil, failure(404, &types.NoSuchUpload{Message: aws.String("no upload " + aws.ToString(id))})
+	}
+	return u, nil
+}
+
+func (f *s3Fake) find(name string) (*bucket, error) {
+	b, ok := f.buckets[name]
+	if !ok {
+		return nil, failure(404, &types.NotFound{Message: aws.String("no bucket " + name)})
+	}
+	return b, nil
+}
+
+// notConfigured is how S3 says that a bucket does not have some part of its configuration
+func notConfigured(code string) error {
+	return failure(404, &smithy.GenericAPIError{Code: code, Message: "the bucket does not have this configuration"})
+}
+
+// HasBucket says whether the named bucket exists
+func (b *Backend) HasBucket(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.s3.buckets[name]
+	return ok
+}
+
+// Object returns the contents of an object in a bucket, if it is there
+func (b *Backend) Object(bucket, key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bkt, ok := b.s3.buckets[bucket]; ok {
+		obj, ok := bkt.objects[key]
+		return obj, ok
+	}
+	return nil, false
+}
+
+// LockObject puts a legal hold on all the versions of an object, so that they cannot be deleted
+func (b *Backend) LockObject(bucket, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bkt, ok := b.s3.buckets[bucket]; ok {
+		if bkt.locked == nil {
+			bkt.locked = make(map[string]bool)
+		}
+		bkt.locked[key] = true
+	}
+}
+
+// BucketPolicy returns the policy last put on a bucket
+func (b *Backend) BucketPolicy(bucket string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if bkt, ok := b.s3.buckets[bucket]; ok {
+		return bkt.policy
+	}
+	return ""
+}
+
+// etag is what S3 uses as the ETag of an object uploaded in one go: its MD5, in quotes
+func etag(body []byte) string {
+	sum := md5.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,27 @@
+package fakeaws
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// Credentials are never checked, so any role can be assumed
+type stsFake struct {
+	b *Backend
+}
+
+func (f *stsFake) handle(params any) (any, error) {
+	switch p := params.(type) {
+	case *sts.GetCallerIdentityInput:
+		return &sts.GetCallerIdentityOutput{Account: aws.String(Account), Arn: aws.String("arn:aws:iam::" + Account + ":user/fake"), UserId: aws.String("AIDAFAKE")}, nil
+	case *sts.AssumeRoleInput:
+		return &sts.AssumeRoleOutput{
+			AssumedRoleUser: &types.AssumedRoleUser{Arn: aws.String(*p.RoleArn + "/" + *p.RoleSessionName), AssumedRoleId: aws.String(f.b.id("AROA") + ":" + *p.RoleSessionName)},
+			Credentials:     &types.Credentials{AccessKeyId: aws.String("fake"), SecretAccessKey: aws.String("fake"), SessionToken: aws.String("fake"), Expiration: aws.Time(time.Now().Add(time.Hour))},
+		}, nil
+	}
+	return nil, errNotHandled
+}
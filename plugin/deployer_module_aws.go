@@ -1,11 +1,18 @@
 package main
 
 import (
+	"os"
+
 	"ziniki.org/deployer/driver/pkg/driverbottom"
 	"ziniki.org/deployer/modules/aws/pkg/awsmod"
 )
 
+// ProvideTestRunner runs the tests against the in-memory fake rather than AWS when
+// AWSDEP_FAKE is set in the environment.
 func ProvideTestRunner(runner driverbottom.TestRunner) error {
+	if os.Getenv("AWSDEP_FAKE") != "" {
+		awsmod.UseFakeAWS()
+	}
 	return awsmod.ProvideTestRunner(runner)
 }
 